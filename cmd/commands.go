@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/barpav/msg-messages/internal/data"
+	"github.com/barpav/msg-messages/internal/outbox"
+	"github.com/barpav/msg-messages/internal/rabbitmq"
+)
+
+// Maintenance commands, e.g. 'app rotate-keys -batch 1000'.
+// They use the same settings (environment variables) as the microservice itself.
+func runCommand(name string, args []string) {
+	var err error
+
+	switch name {
+	case "migrate":
+		err = migrate()
+	case "rotate-keys":
+		err = rotateKeys(args)
+	case "pause-file-usage":
+		err = pauseFileUsage()
+	case "resume-file-usage":
+		err = resumeFileUsage()
+	case "reconcile-files":
+		err = reconcileFiles(args)
+	default:
+		err = fmt.Errorf("unknown command '%s'", name)
+	}
+
+	if err != nil {
+		log.Err(err).Msg(fmt.Sprintf("Command '%s' failed.", name))
+		os.Exit(1)
+	}
+}
+
+// Applies pending database migrations (the service applies them on startup as well).
+func migrate() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	applied, err := data.Migrate(ctx)
+
+	log.Info().Msg(fmt.Sprintf("%d migrations applied.", applied))
+
+	return err
+}
+
+// Re-encrypts message data keys with the active encryption key (MSG_ENCRYPTION_KEY_ID).
+func rotateKeys(args []string) error {
+	flags := flag.NewFlagSet("rotate-keys", flag.ContinueOnError)
+	batchSize := flags.Int("batch", 500, "number of messages processed in one transaction")
+
+	err := flags.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	if *batchSize <= 0 {
+		return fmt.Errorf("invalid batch size %d", *batchSize)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	storage := &data.Storage{}
+	err = storage.Open()
+
+	if err != nil {
+		return err
+	}
+
+	defer storage.Close(context.Background())
+
+	var rotated int
+	rotated, err = storage.RotateEncryptionKeys(ctx, *batchSize)
+
+	log.Info().Msg(fmt.Sprintf("Encryption keys of %d messages rotated.", rotated))
+
+	return err
+}
+
+// Pauses relaying of file usage events to the statistics by all instances of the service (see reconcileFiles).
+// Events are still written to the outbox, and they are relayed after 'app resume-file-usage'.
+func pauseFileUsage() error {
+	return withStorage(func(ctx context.Context, storage *data.Storage) error {
+		err := storage.PauseFileUsageRelay(ctx)
+
+		if err == nil {
+			log.Info().Msg("File usage relay paused.")
+		}
+
+		return err
+	})
+}
+
+func resumeFileUsage() error {
+	return withStorage(func(ctx context.Context, storage *data.Storage) error {
+		err := storage.ResumeFileUsageRelay(ctx)
+
+		if err == nil {
+			log.Info().Msg("File usage relay resumed.")
+		}
+
+		return err
+	})
+}
+
+func withStorage(command func(ctx context.Context, storage *data.Storage) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	storage := &data.Storage{}
+	err := storage.Open()
+
+	if err != nil {
+		return err
+	}
+
+	defer storage.Close(context.Background())
+
+	return command(ctx, storage)
+}
+
+// Corrects the files usage statistics, which could lose events before they were written to the outbox.
+// Uses counted from the messages are compared with the exported counters of the statistics (see outbox.ReadFileUsage),
+// and the differences are corrected by usage events. With '-dry-run' the differences are only printed.
+// The counters change whenever the relay delivers events, so events delivered between the export and the command
+// would look like differences and be corrected twice. Hence the relay must be paused ('app pause-file-usage')
+// before the export and resumed after the command, otherwise the command refuses to run.
+func reconcileFiles(args []string) error {
+	flags := flag.NewFlagSet("reconcile-files", flag.ContinueOnError)
+	usageFile := flags.String("usage", "", "CSV file with file ids and uses exported from the files usage statistics")
+	dryRun := flags.Bool("dry-run", false, "print the differences without correcting them")
+
+	err := flags.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	if *usageFile == "" {
+		return fmt.Errorf("file usage exported from the statistics is not specified (-usage)")
+	}
+
+	var file *os.File
+	file, err = os.Open(*usageFile)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	var reported map[string]int
+	reported, err = outbox.ReadFileUsage(file)
+
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	storage := &data.Storage{}
+	err = storage.Open()
+
+	if err != nil {
+		return err
+	}
+
+	defer storage.Close(context.Background())
+
+	var expected map[string]int
+	expected, err = storage.FileUsage(ctx)
+
+	if _, ok := err.(*data.ErrFileUsageRelayNotPaused); ok {
+		return fmt.Errorf("%w: pause it by 'app pause-file-usage' before exporting the counters", err)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	differences := outbox.FileUsageDifferences(expected, reported)
+	printFileUsageDifferences(differences)
+
+	if *dryRun || len(differences) == 0 {
+		log.Info().Msg(fmt.Sprintf("%d files usage differences found.", len(differences)))
+		return nil
+	}
+
+	fileStats := &rabbitmq.FileStats{}
+	err = fileStats.Connect()
+
+	if err != nil {
+		return err
+	}
+
+	defer fileStats.Disconnect(context.Background())
+
+	var sent int
+	sent, err = outbox.Reconcile(ctx, fileStats, differences)
+
+	log.Info().Msg(fmt.Sprintf("%d files usage differences found, %d corrective events sent.", len(differences), sent))
+
+	return err
+}
+
+func printFileUsageDifferences(differences []*outbox.FileUsageDifference) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tEXPECTED\tREPORTED\tCORRECTION")
+
+	for _, d := range differences {
+		usage := "used"
+		inUse, events := d.Correction()
+
+		if !inUse {
+			usage = "unused"
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d x %s\n", d.FileId, d.Expected, d.Reported, events, usage)
+	}
+
+	w.Flush()
+}
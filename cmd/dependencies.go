@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/barpav/msg-messages/internal/backoff"
+)
+
+const (
+	envVarStartupTimeout  = "MSG_STARTUP_TIMEOUT"
+	defaultStartupTimeout = time.Minute
+)
+
+// Service or database the microservice depends on, which may be not ready yet
+// when the microservice starts (e.g. launched by docker-compose at the same time).
+type dependency struct {
+	name    string
+	connect func() error
+	release func() // optional: frees resources of the failed connection attempt
+}
+
+// Connects to all the dependencies at once, retrying failed attempts with exponential backoff (see backoff.Connect)
+// until every dependency is ready or the deadline of the context is exceeded.
+func connectDependencies(ctx context.Context, dependencies ...dependency) error {
+	errs := make([]error, len(dependencies))
+
+	var wg sync.WaitGroup
+
+	for i, d := range dependencies {
+		wg.Add(1)
+
+		go func(i int, d dependency) {
+			defer wg.Done()
+			errs[i] = d.connectWithRetries(ctx)
+		}(i, d)
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (d dependency) connectWithRetries(ctx context.Context) error {
+	return backoff.Connect(ctx, d.name, d.connect, d.release)
+}
+
+// Total time given to the dependencies to get ready.
+func startupTimeout() time.Duration {
+	value := os.Getenv(envVarStartupTimeout)
+
+	if value == "" {
+		return defaultStartupTimeout
+	}
+
+	timeout, err := time.ParseDuration(value)
+
+	if err != nil || timeout <= 0 {
+		log.Warn().Msg(fmt.Sprintf("Invalid %s value '%s', default '%s' is used.", envVarStartupTimeout, value, defaultStartupTimeout))
+		return defaultStartupTimeout
+	}
+
+	return timeout
+}
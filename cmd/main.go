@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -11,15 +12,25 @@ import (
 	"github.com/rs/zerolog/log"
 	"go.elastic.co/ecszerolog"
 
-	"github.com/barpav/msg-files/statistics"
 	"github.com/barpav/msg-messages/internal/data"
+	"github.com/barpav/msg-messages/internal/events"
+	"github.com/barpav/msg-messages/internal/memory"
+	"github.com/barpav/msg-messages/internal/outbox"
+	"github.com/barpav/msg-messages/internal/rabbitmq"
 	"github.com/barpav/msg-messages/internal/rest"
+	"github.com/barpav/msg-messages/internal/sqlite"
+	"github.com/barpav/msg-messages/internal/webhooks"
 	sessions "github.com/barpav/msg-sessions/grpc_client"
 )
 
 func main() {
 	log.Logger = ecszerolog.New(os.Stdout)
 
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	app := microservice{}
 	err := app.launch()
 
@@ -44,28 +55,77 @@ type microservice struct {
 		public *rest.Service // specification: https://barpav.github.io/msg-api-spec/#/messages
 	}
 	clients struct {
-		sessions  *sessions.Client   // github.com/barpav/msg-sessions
-		fileStats *statistics.Client // github.com/barpav/msg-files
+		sessions  *sessions.Client    // github.com/barpav/msg-sessions
+		fileStats *rabbitmq.FileStats // github.com/barpav/msg-files
+		events    *events.Broker      // domain events for other services
 	}
-	storage  *data.Storage
+	storage  storage
+	relay    *outbox.Relay // delivers file usage statistics and domain events written by the storage
+	webhooks *webhooks.Dispatcher
 	shutdown chan os.Signal
 }
 
+type storage interface {
+	rest.Storage
+	outbox.Storage
+	webhooks.Storage
+	Open() error
+	Close(ctx context.Context) error
+}
+
+const envVarStorageDriver = "MSG_STORAGE_DRIVER"
+
+// PostgreSQL by default, whereas SQLite and in-memory storages allow to run the microservice without
+// database server (in-memory storage loses all data on shutdown).
+func newStorage() (storage, error) {
+	switch driver := os.Getenv(envVarStorageDriver); driver {
+	case "", "postgres":
+		return &data.Storage{}, nil
+	case "sqlite":
+		return &sqlite.Storage{}, nil
+	case "memory":
+		log.Warn().Msg("In-memory storage is used, data will be lost on shutdown.")
+		return &memory.Storage{}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver '%s'", driver)
+	}
+}
+
 func (m *microservice) launch() (err error) {
 	m.shutdown = make(chan os.Signal, 2)
 	signal.Notify(m.shutdown, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGHUP)
 
-	m.storage = &data.Storage{}
-	err = errors.Join(err, m.storage.Open())
-
+	m.storage, err = newStorage()
 	m.clients.sessions = &sessions.Client{}
-	err = errors.Join(err, m.clients.sessions.Connect())
+	m.clients.fileStats = &rabbitmq.FileStats{}
+	m.clients.events = &events.Broker{}
 
-	m.clients.fileStats = &statistics.Client{}
-	err = errors.Join(err, m.clients.fileStats.Connect())
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), startupTimeout())
+		defer cancel()
+
+		err = connectDependencies(ctx,
+			dependency{name: "storage", connect: m.storage.Open},
+			dependency{name: "'sessions' service", connect: m.clients.sessions.Connect},
+			dependency{name: "files usage statistics", connect: m.clients.fileStats.Connect, release: func() {
+				m.clients.fileStats.Disconnect(context.Background())
+			}},
+			dependency{name: "message broker", connect: m.clients.events.Connect, release: func() {
+				m.clients.events.Disconnect(context.Background())
+			}},
+		)
+	}
 
 	m.api.public = &rest.Service{}
-	m.api.public.Start(m.clients.sessions, m.storage, m.clients.fileStats)
+	m.api.public.Start(m.clients.sessions, m.storage)
+
+	m.relay = &outbox.Relay{}
+	m.webhooks = &webhooks.Dispatcher{}
+
+	if err == nil {
+		m.relay.Start(m.storage, m.clients.fileStats, m.clients.events)
+		m.webhooks.Start(m.storage)
+	}
 
 	return err
 }
@@ -86,9 +146,14 @@ func (m *microservice) serveAndShutdownGracefully() (err error) {
 	defer cancel()
 
 	err = errors.Join(err, m.api.public.Stop(ctx))
+	err = errors.Join(err, m.relay.Stop(ctx)) // events written by the last requests are delivered if possible
+	err = errors.Join(err, m.webhooks.Stop(ctx))
 	err = errors.Join(err, m.clients.fileStats.Disconnect(ctx))
+	err = errors.Join(err, m.clients.events.Disconnect(ctx))
 	err = errors.Join(err, m.clients.sessions.Disconnect(ctx))
-	err = errors.Join(err, m.storage.Close(ctx))
+	if m.storage != nil {
+		err = errors.Join(err, m.storage.Close(ctx))
+	}
 
 	return err
 }
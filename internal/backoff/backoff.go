@@ -0,0 +1,61 @@
+// Package backoff retries connecting to the services and databases the microservice depends on
+// with exponential backoff: on startup (they may be not ready yet, e.g. launched by docker-compose
+// at the same time) and after the connection is lost.
+package backoff
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	initialDelay = 100 * time.Millisecond
+	maxDelay     = 5 * time.Second
+)
+
+// Retries failed attempts until connect succeeds or the context is done. Release (optional) frees resources
+// of the failed attempt. Attempt in progress is not interrupted when the deadline is exceeded,
+// but there is no next attempt if the deadline comes before it.
+func Connect(ctx context.Context, name string, connect func() error, release func()) error {
+	delay := initialDelay
+
+	for attempt := 1; ; attempt++ {
+		err := connect()
+
+		if err == nil {
+			if attempt > 1 {
+				log.Info().Msg(fmt.Sprintf("Connected to %s (attempt %d).", name, attempt))
+			}
+
+			return nil
+		}
+
+		if release != nil {
+			release()
+		}
+
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2))) // jitter spreads attempts of the replicas
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return fmt.Errorf("%s is not ready (attempts: %d): %w", name, attempt, err)
+		}
+
+		log.Warn().Msg(fmt.Sprintf("Failed to connect to %s (attempt %d), retrying in %s: %s", name, attempt, wait.Round(time.Millisecond), err))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return fmt.Errorf("%s is not ready (attempts: %d): %w", name, attempt, err)
+		}
+
+		delay *= 2
+
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
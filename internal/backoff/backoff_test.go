@@ -0,0 +1,46 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnect(t *testing.T) {
+	var attempts, released int
+
+	err := Connect(context.Background(), "test", func() error {
+		attempts++
+
+		if attempts < 3 {
+			return errors.New("not ready")
+		}
+
+		return nil
+	}, func() {
+		released++
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+	require.Equal(t, 2, released)
+}
+
+func TestConnect_deadlineExceeded(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	attempts := 0
+	notReady := errors.New("not ready")
+
+	err := Connect(ctx, "test", func() error {
+		attempts++
+		return notReady
+	}, nil)
+
+	require.ErrorIs(t, err, notReady)
+	require.Equal(t, 1, attempts) // the next attempt would be after the deadline
+}
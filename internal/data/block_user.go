@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+type queryGetBlockForUpdate struct{}
+
+func (q queryGetBlockForUpdate) text() string {
+	return `
+	SELECT hide_conversation
+	FROM blocks
+	WHERE user_id = $1 AND blocked_user = $2
+	FOR UPDATE;
+	`
+}
+
+type queryCreateBlock struct{}
+
+func (q queryCreateBlock) text() string {
+	return `
+	INSERT INTO blocks (user_id, blocked_user, hide_conversation, created, event_timestamp)
+	VALUES ($1, $2, $3, $4, nextval('timeline'))
+	ON CONFLICT (user_id, blocked_user) DO NOTHING
+	RETURNING event_timestamp;
+	`
+}
+
+type queryUpdateBlock struct{}
+
+func (q queryUpdateBlock) text() string {
+	return `
+	UPDATE blocks SET
+		hide_conversation = $3,
+		event_timestamp = nextval('timeline')
+	WHERE user_id = $1 AND blocked_user = $2
+	RETURNING event_timestamp;
+	`
+}
+
+type queryDeleteBlock struct{}
+
+func (q queryDeleteBlock) text() string {
+	return `
+	DELETE FROM blocks
+	WHERE user_id = $1 AND blocked_user = $2
+	RETURNING hide_conversation, nextval('timeline');
+	`
+}
+
+type queryCheckSenderBlocked struct{}
+
+func (q queryCheckSenderBlocked) text() string {
+	return `
+	SELECT EXISTS (
+		SELECT 1 FROM blocks
+		WHERE user_id = $1 AND blocked_user = $2
+	);
+	`
+}
+
+// Writes conversation messages to the user's timeline again,
+// so previously hidden conversation is received by the user's clients while syncing.
+type queryRestoreConversationUpdates struct{}
+
+func (q queryRestoreConversationUpdates) text() string {
+	return `
+	INSERT INTO updates (user_id, event_timestamp, message_id)
+	SELECT $1, nextval('timeline'), id
+	FROM (
+		SELECT id
+		FROM messages
+		WHERE ((sender = $1 AND receiver = $2) OR (sender = $2 AND receiver = $1))
+			AND NOT (receiver = $1 AND is_request)
+		ORDER BY id
+	) AS conversation;
+	`
+}
+
+func (s *Storage) BlockUser(ctx context.Context, userId, blockedUser string, hideConversation bool) (err error) {
+	var tx pgx.Tx
+	tx, err = s.db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var hidden bool
+	err = tx.QueryRow(ctx, queryGetBlockForUpdate{}.text(), userId, blockedUser).Scan(&hidden)
+
+	var timestamp int64
+
+	switch {
+	case err == pgx.ErrNoRows:
+		err = tx.QueryRow(ctx, queryCreateBlock{}.text(),
+			userId, blockedUser, hideConversation, time.Now().UTC()).Scan(&timestamp)
+
+		if err == pgx.ErrNoRows {
+			return nil // concurrently blocked
+		}
+	case err != nil:
+		return fmt.Errorf("failed to get user block: %w", err)
+	case hidden == hideConversation:
+		return nil // already blocked
+	default:
+		err = tx.QueryRow(ctx, queryUpdateBlock{}.text(),
+			userId, blockedUser, hideConversation).Scan(&timestamp)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, queryWriteUserUpdate{}.text(), userId, timestamp, models.UpdateTypeBlock, blockedUser)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' update: %w", userId, err)
+	}
+
+	if hidden && !hideConversation {
+		_, err = tx.Exec(ctx, queryRestoreConversationUpdates{}.text(), userId, blockedUser)
+
+		if err != nil {
+			return fmt.Errorf("failed to restore conversation with '%s': %w", blockedUser, err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *Storage) UnblockUser(ctx context.Context, userId, blockedUser string) (err error) {
+	var tx pgx.Tx
+	tx, err = s.db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var hidden bool
+	var timestamp int64
+	err = tx.QueryRow(ctx, queryDeleteBlock{}.text(), userId, blockedUser).Scan(&hidden, &timestamp)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil // not blocked
+		}
+
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, queryWriteUserUpdate{}.text(), userId, timestamp, models.UpdateTypeBlock, blockedUser)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' update: %w", userId, err)
+	}
+
+	if hidden {
+		_, err = tx.Exec(ctx, queryRestoreConversationUpdates{}.text(), userId, blockedUser)
+
+		if err != nil {
+			return fmt.Errorf("failed to restore conversation with '%s': %w", blockedUser, err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,101 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+type queryGetBlockedUsersV1 struct{}
+
+func (q queryGetBlockedUsersV1) text() string {
+	return `
+	SELECT
+		blocked_user,
+		hide_conversation,
+		created,
+		event_timestamp
+	FROM blocks
+	WHERE user_id = $1
+	ORDER BY blocked_user;
+	`
+}
+
+type queryGetBlockedUserV1 struct{}
+
+func (q queryGetBlockedUserV1) text() string {
+	return `
+	SELECT
+		blocked_user,
+		hide_conversation,
+		created,
+		event_timestamp
+	FROM blocks
+	WHERE user_id = $1 AND blocked_user = $2;
+	`
+}
+
+func (s *Storage) BlockedUsersV1(ctx context.Context, userId string) (*models.BlockedUsersV1, error) {
+	rows, err := s.db.Query(ctx, queryGetBlockedUsersV1{}.text(), userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	blocked := &models.BlockedUsersV1{Users: make([]*models.BlockedUserV1, 0)}
+
+	for rows.Next() {
+		user := &models.BlockedUserV1{}
+		err = scanBlockedUserV1(rows, user)
+
+		if err != nil {
+			return nil, err
+		}
+
+		blocked.Users = append(blocked.Users, user)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	blocked.Total = len(blocked.Users)
+
+	return blocked, nil
+}
+
+func (s *Storage) BlockedUserV1(ctx context.Context, userId, blockedUser string) (*models.BlockedUserV1, error) {
+	user := &models.BlockedUserV1{}
+	err := scanBlockedUserV1(s.db.QueryRow(ctx, queryGetBlockedUserV1{}.text(), userId, blockedUser), user)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func scanBlockedUserV1(row interface{ Scan(dest ...any) error }, user *models.BlockedUserV1) error {
+	var created time.Time
+	err := row.Scan(&user.User, &user.HideConversation, &created, &user.Timestamp)
+
+	if err != nil {
+		return err
+	}
+
+	user.Created = storage.UtcTime(&created)
+
+	return nil
+}
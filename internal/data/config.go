@@ -1,29 +1,55 @@
 package data
 
-import "os"
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
 
 const (
-	defaultHost     = "localhost"
-	defaultPort     = "5432"
-	defaultDatabase = "postgres"
-	defaultUser     = "postgres"
-	defaultPassword = "postgres"
+	defaultHost              = "localhost"
+	defaultPort              = "5432"
+	defaultDatabase          = "postgres"
+	defaultUser              = "postgres"
+	defaultPassword          = "postgres"
+	defaultIdempotencyKeyTTL = "24h"
+	defaultStatementCache    = 512
+	defaultHealthCheckPeriod = "1m"
 )
 
 const (
-	envVarHost     = "MSG_STORAGE_HOST"
-	envVarPort     = "MSG_STORAGE_PORT"
-	envVarDatabase = "MSG_STORAGE_DATABASE"
-	envVarUser     = "MSG_STORAGE_USER"
-	envVarPassword = "MSG_STORAGE_PASSWORD"
+	envVarHost              = "MSG_STORAGE_HOST"
+	envVarPort              = "MSG_STORAGE_PORT"
+	envVarDatabase          = "MSG_STORAGE_DATABASE"
+	envVarUser              = "MSG_STORAGE_USER"
+	envVarPassword          = "MSG_STORAGE_PASSWORD"
+	envVarMaxConns          = "MSG_STORAGE_MAX_CONNS"       // max(4, number of CPUs) by default
+	envVarMinConns          = "MSG_STORAGE_MIN_CONNS"       // kept open even when idle, 0 by default
+	envVarStatementCache    = "MSG_STORAGE_STATEMENT_CACHE" // prepared statements per connection, 0 disables caching
+	envVarHealthCheckPeriod = "MSG_STORAGE_HEALTH_CHECK_PERIOD"
+	envVarIdempotencyKeyTTL = "MSG_IDEMPOTENCY_KEY_TTL"
+	envVarEncryptionKeys    = "MSG_ENCRYPTION_KEYS"   // "id1:base64key,id2:base64key"
+	envVarEncryptionKeyId   = "MSG_ENCRYPTION_KEY_ID" // active key, the last one by default
 )
 
 type config struct {
-	host     string
-	port     string
-	database string
-	user     string
-	password string
+	host              string
+	port              string
+	database          string
+	user              string
+	password          string
+	maxConns          int
+	minConns          int
+	statementCache    int
+	healthCheckPeriod time.Duration
+	idempotencyKeyTTL time.Duration
+	encryptionKeys    string
+	encryptionKeyId   string
 }
 
 func (c *config) Read() {
@@ -32,6 +58,23 @@ func (c *config) Read() {
 	readSetting(envVarDatabase, defaultDatabase, &c.database)
 	readSetting(envVarUser, defaultUser, &c.user)
 	readSetting(envVarPassword, defaultPassword, &c.password)
+	readIntSetting(envVarMaxConns, 0, &c.maxConns)
+	readIntSetting(envVarMinConns, 0, &c.minConns)
+	readIntSetting(envVarStatementCache, defaultStatementCache, &c.statementCache)
+	readDurationSetting(envVarHealthCheckPeriod, defaultHealthCheckPeriod, &c.healthCheckPeriod)
+	readDurationSetting(envVarIdempotencyKeyTTL, defaultIdempotencyKeyTTL, &c.idempotencyKeyTTL)
+	readSetting(envVarEncryptionKeys, "", &c.encryptionKeys)
+	readSetting(envVarEncryptionKeyId, "", &c.encryptionKeyId)
+}
+
+// User name and password are escaped, so they may contain any characters (e.g. '@' or '/').
+func (c *config) databaseURL(database string) *url.URL {
+	return &url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.user, c.password),
+		Host:   net.JoinHostPort(c.host, c.port),
+		Path:   database,
+	}
 }
 
 func readSetting(setting, defaultValue string, result *string) {
@@ -40,3 +83,34 @@ func readSetting(setting, defaultValue string, result *string) {
 		*result = defaultValue
 	}
 }
+
+func readDurationSetting(setting, defaultValue string, result *time.Duration) {
+	var value string
+	readSetting(setting, defaultValue, &value)
+
+	var err error
+	*result, err = time.ParseDuration(value)
+
+	if err != nil || *result <= 0 {
+		log.Warn().Msg(fmt.Sprintf("Invalid %s value '%s', default '%s' is used.", setting, value, defaultValue))
+		*result, _ = time.ParseDuration(defaultValue)
+	}
+}
+
+func readIntSetting(setting string, defaultValue int, result *int) {
+	*result = defaultValue
+	value := os.Getenv(setting)
+
+	if value == "" {
+		return
+	}
+
+	parsed, err := strconv.Atoi(value)
+
+	if err != nil || parsed < 0 {
+		log.Warn().Msg(fmt.Sprintf("Invalid %s value '%s', default '%d' is used.", setting, value, defaultValue))
+		return
+	}
+
+	*result = parsed
+}
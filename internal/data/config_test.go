@@ -0,0 +1,23 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_databaseURL(t *testing.T) {
+	cfg := &config{user: "msg@app", password: "p@ss/w:rd%2F?#", host: "db", port: "5433"}
+	address := cfg.databaseURL("messages")
+
+	parsed, err := pgx.ParseConfig(address.String())
+	require.NoError(t, err)
+	require.Equal(t, "msg@app", parsed.User)
+	require.Equal(t, "p@ss/w:rd%2F?#", parsed.Password)
+	require.Equal(t, "db", parsed.Host)
+	require.Equal(t, uint16(5433), parsed.Port)
+	require.Equal(t, "messages", parsed.Database)
+
+	require.NotContains(t, address.Redacted(), "p@ss")
+}
@@ -0,0 +1,106 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+type queryGetConversationsV1 struct{}
+
+func (q queryGetConversationsV1) text() string {
+	return `
+	SELECT
+		c.counterpart,
+		c.state,
+		c.muted AND (c.muted_until IS NULL OR c.muted_until > timezone('UTC', now())),
+		c.muted_until,
+		c.archived,
+		COALESCE(last.id, 0),
+		c.event_timestamp
+	FROM conversations AS c
+		LEFT JOIN LATERAL (
+			SELECT MAX(id) AS id
+			FROM messages
+			WHERE (sender = c.user_id AND receiver = c.counterpart)
+				OR (sender = c.counterpart AND receiver = c.user_id)
+		) AS last ON true
+	WHERE c.user_id = $1
+		AND ($2 = '' OR c.counterpart = $2)
+		AND NOT EXISTS (
+			SELECT 1 FROM blocks AS b
+			WHERE b.user_id = $1
+				AND b.hide_conversation
+				AND b.blocked_user = c.counterpart
+		)
+	ORDER BY last.id DESC NULLS LAST, c.counterpart;
+	`
+}
+
+func (s *Storage) ConversationsV1(ctx context.Context, userId string) (*models.ConversationsV1, error) {
+	rows, err := s.db.Query(ctx, queryGetConversationsV1{}.text(), userId, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	conversations := &models.ConversationsV1{Conversations: make([]*models.ConversationV1, 0)}
+
+	for rows.Next() {
+		conversation := &models.ConversationV1{}
+		err = scanConversationV1(rows, conversation)
+
+		if err != nil {
+			return nil, err
+		}
+
+		conversations.Conversations = append(conversations.Conversations, conversation)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	conversations.Total = len(conversations.Conversations)
+
+	return conversations, nil
+}
+
+func (s *Storage) ConversationV1(ctx context.Context, userId, counterpart string) (*models.ConversationV1, error) {
+	conversation := &models.ConversationV1{}
+	err := scanConversationV1(s.db.QueryRow(ctx, queryGetConversationsV1{}.text(), userId, counterpart), conversation)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return conversation, nil
+}
+
+func scanConversationV1(row interface{ Scan(dest ...any) error }, conversation *models.ConversationV1) error {
+	var mutedUntil *time.Time
+	err := row.Scan(&conversation.User, &conversation.State, &conversation.Muted, &mutedUntil,
+		&conversation.Archived, &conversation.LastMessage, &conversation.Timestamp)
+
+	if err != nil {
+		return err
+	}
+
+	if conversation.Muted {
+		conversation.MutedUntil = storage.UtcTime(mutedUntil)
+	}
+
+	return nil
+}
@@ -0,0 +1,280 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+// Returns the first (in the order of recipients) of those who have blocked the sender.
+type queryGetRecipientBlockingSender struct{}
+
+func (q queryGetRecipientBlockingSender) text() string {
+	return `
+	SELECT user_id
+	FROM blocks
+	WHERE user_id = ANY($1::varchar[]) AND blocked_user = $2
+	ORDER BY array_position($1::varchar[], user_id)
+	LIMIT 1;
+	`
+}
+
+type queryCreateBroadcastMessages struct{}
+
+func (q queryCreateBroadcastMessages) text() string {
+	return `
+	INSERT INTO messages (id, sender, receiver, created, message_text, text_search, is_request, text_digest, key_id, data_key)
+	SELECT r.id, $1, r.receiver, $3, NULLIF(r.message_text, ''), searchable_text($6, $8::varchar IS NOT NULL), r.is_request,
+		r.text_digest, $8, r.data_key
+	FROM unnest($10::bigint[], $2::varchar[], $5::boolean[], $4::text[], $7::bytea[], $9::bytea[])
+		AS r(id, receiver, is_request, message_text, text_digest, data_key)
+	ORDER BY r.id
+	RETURNING id, receiver, event_timestamp;
+	`
+}
+
+type queryWriteBroadcastUpdates struct{}
+
+func (q queryWriteBroadcastUpdates) text() string {
+	return `
+	INSERT INTO updates (user_id, event_timestamp, message_id, entry_type, counterpart)
+	SELECT sender, event_timestamp, id, 'message', NULL
+	FROM messages
+	WHERE id = ANY($1::bigint[])
+	UNION ALL
+	SELECT
+		receiver,
+		event_timestamp,
+		id,
+		CASE WHEN is_request THEN 'request' ELSE 'message' END,
+		CASE WHEN is_request THEN sender END
+	FROM messages
+	WHERE id = ANY($1::bigint[]);
+	`
+}
+
+// Recipients are checked one by one (the same way as for a personal message),
+// whereas messages, attachments and updates are created for all recipients at once.
+// Message ids are reserved in advance (in the order of recipients), since every message gets its own data key
+// bound to the id (see messageBinding).
+func (s *Storage) CreateNewBroadcastMessageV1(ctx context.Context, sender string, message *models.NewBroadcastMessageV1,
+	idempotencyKey *models.IdempotencyKey) (*models.SentMessagesV1, error) {
+	ids, err := s.reserveMessageIds(ctx, len(message.To))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var encrypted *broadcastData
+	encrypted, err = s.encryptBroadcast(ids, sender, message)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var tx pgx.Tx
+	tx, err = s.db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var blockedBy string
+	err = tx.QueryRow(ctx, queryGetRecipientBlockingSender{}.text(), message.To, sender).Scan(&blockedBy)
+
+	switch {
+	case err == nil:
+		return nil, &ErrSenderBlocked{recipient: blockedBy}
+	case err != pgx.ErrNoRows:
+		return nil, fmt.Errorf("failed to check if sender is blocked: %w", err)
+	}
+
+	requests := make([]bool, len(message.To))
+
+	for i, receiver := range message.To {
+		err = s.acceptConversation(ctx, tx, sender, receiver)
+
+		if err != nil {
+			return nil, err
+		}
+
+		requests[i], err = s.checkReceiverAccepts(ctx, tx, sender, receiver)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.unarchiveConversation(ctx, tx, receiver, sender)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var rows pgx.Rows
+	rows, err = tx.Query(ctx, queryCreateBroadcastMessages{}.text(),
+		sender, message.To, time.Now().UTC(), encrypted.texts, requests, message.Text, encrypted.textDigests, s.keys.activeKeyId(),
+		encrypted.wrappedKeys, ids)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new messages: %w", err)
+	}
+
+	defer rows.Close()
+
+	created := make(map[string]*models.SentMessageInfoV1, len(message.To))
+
+	for rows.Next() {
+		info := &models.SentMessageInfoV1{}
+		err = rows.Scan(&info.Id, &info.To, &info.Timestamp)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new messages: %w", err)
+		}
+
+		created[info.To] = info
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new messages: %w", err)
+	}
+
+	if len(message.Files) != 0 {
+		err = copyBroadcastAttachments(ctx, tx, ids, encrypted.files, encrypted.fileDigests)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create attachments: %w", err)
+		}
+
+		var fileUsage []any
+		fileUsage, err = s.fileUsageArgs(broadcastFiles(message.Files, len(ids)), true)
+
+		if err == nil {
+			_, err = tx.Exec(ctx, queryWriteFileUsage{}.text(), fileUsage...)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to write file usage: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(ctx, queryWriteBroadcastUpdates{}.text(), ids)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to write users updates: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, queryWriteBroadcastEvents{}.text(), ids, time.Now().UTC())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to write message events: %w", err)
+	}
+
+	sent := &models.SentMessagesV1{Messages: make([]*models.SentMessageInfoV1, 0, len(message.To))}
+
+	for _, receiver := range message.To {
+		sent.Messages = append(sent.Messages, created[receiver])
+	}
+
+	sent.Total = len(sent.Messages)
+
+	if idempotencyKey != nil {
+		err = s.saveBroadcastIdempotencyKey(ctx, tx, sender, idempotencyKey, sent)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sent, nil
+}
+
+// Data of every message as it is stored (encrypted with the message data key if encryption is enabled).
+type broadcastData struct {
+	texts       []string
+	textDigests [][]byte
+	wrappedKeys [][]byte
+	files       [][]string
+	fileDigests [][][]byte
+}
+
+func (s *Storage) encryptBroadcast(ids []int64, sender string, message *models.NewBroadcastMessageV1) (*broadcastData, error) {
+	data := &broadcastData{
+		texts:       make([]string, 0, len(ids)),
+		textDigests: make([][]byte, 0, len(ids)),
+		wrappedKeys: make([][]byte, 0, len(ids)),
+		files:       make([][]string, 0, len(ids)),
+		fileDigests: make([][][]byte, 0, len(ids)),
+	}
+
+	for _, id := range ids {
+		key, err := s.keys.newMessageKey(id, sender)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var text string
+		text, err = key.encrypt(message.Text)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var files []string
+		files, err = key.encryptAll(message.Files)
+
+		if err != nil {
+			return nil, err
+		}
+
+		data.texts = append(data.texts, text)
+		data.textDigests = append(data.textDigests, key.digest(message.Text))
+		data.wrappedKeys = append(data.wrappedKeys, key.wrappedKey())
+		data.files = append(data.files, files)
+		data.fileDigests = append(data.fileDigests, key.digestAll(message.Files))
+	}
+
+	return data, nil
+}
+
+// Every message gets all the files (in the specified order), which may be a lot of rows, so they are copied.
+func copyBroadcastAttachments(ctx context.Context, tx pgx.Tx, messageIds []int64, files [][]string, digests [][][]byte) error {
+	perMessage := len(files[0])
+
+	_, err := tx.CopyFrom(ctx,
+		pgx.Identifier{"attachments"},
+		[]string{"message_id", "file_id", "file_digest"},
+		pgx.CopyFromSlice(len(messageIds)*perMessage, func(i int) ([]any, error) {
+			m, f := i/perMessage, i%perMessage
+			return []any{messageIds[m], files[m][f], digests[m][f]}, nil
+		}),
+	)
+
+	return err
+}
+
+// Every message has its own attachments, so the files are used once per message.
+func broadcastFiles(files []string, messages int) []string {
+	used := make([]string, 0, len(files)*messages)
+
+	for i := 0; i < messages; i++ {
+		used = append(used, files...)
+	}
+
+	return used
+}
@@ -2,29 +2,61 @@ package data
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/events"
 	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
 )
 
+type ErrSenderBlocked struct {
+	recipient string
+}
+type ErrClientIdConflict struct {
+	messageId int64
+}
+
 type queryCreateMessage struct{}
 
 func (q queryCreateMessage) text() string {
 	return `
-	INSERT INTO messages (sender, receiver,	created, message_text)
-	VALUES ($1, $2, $3, NULLIF($4, ''))
+	INSERT INTO messages (id, sender, receiver,	created, message_text, text_entities, content, envelope, text_search,
+		is_request, client_id, text_digest, key_id, data_key, entities_digest)
+	VALUES (COALESCE(NULLIF($14::bigint, 0), nextval('messages_id_seq')), $1, $2, $3, NULLIF($4, ''), $5, $8, $9,
+		searchable_text($10, $12::varchar IS NOT NULL), $6, NULLIF($7, '')::uuid, $11, $12, $13, $15)
+	ON CONFLICT (sender, client_id) DO NOTHING
 	RETURNING id, event_timestamp;
 	`
 }
 
+type queryGetMessageIdByClientId struct{}
+
+func (q queryGetMessageIdByClientId) text() string {
+	return `
+	SELECT id
+	FROM messages
+	WHERE sender = $1 AND client_id = $2::uuid;
+	`
+}
+
 type queryCreateAttachment struct{}
 
 func (q queryCreateAttachment) text() string {
 	return `
-	INSERT INTO attachments (message_id, file_id)
-	VALUES ($1, $2);
+	INSERT INTO attachments (message_id, file_id, file_digest)
+	VALUES ($1, $2, $3);
+	`
+}
+
+type queryReserveMessageIds struct{}
+
+func (q queryReserveMessageIds) text() string {
+	return `
+	SELECT nextval('messages_id_seq')
+	FROM generate_series(1, $1);
 	`
 }
 
@@ -37,46 +69,163 @@ func (q queryWriteUpdate) text() string {
 	`
 }
 
-func (s *Storage) CreateNewPersonalMessageV1(ctx context.Context, sender string, message *models.NewPersonalMessageV1) (id int64, timestamp int64, err error) {
-	var tx *sql.Tx
-	tx, err = s.db.BeginTx(ctx, nil)
+// Message requests are written to the receiver's timeline as separate entry type.
+type queryWriteReceiverUpdate struct{}
+
+func (q queryWriteReceiverUpdate) text() string {
+	return `
+	INSERT INTO updates (user_id, event_timestamp, message_id, entry_type, counterpart)
+	SELECT
+		receiver,
+		$2,
+		id,
+		CASE WHEN is_request THEN 'request' ELSE 'message' END,
+		CASE WHEN is_request THEN sender END
+	FROM messages
+	WHERE id = $1;
+	`
+}
+
+func (s *Storage) CreateNewPersonalMessageV1(ctx context.Context, sender string, message *models.NewPersonalMessageV1, key *models.IdempotencyKey) (id int64, timestamp int64, err error) {
+	id, timestamp, err = s.createPersonalMessage(ctx, storage.NewMessageV1(sender, message, key))
+	return id, timestamp, err
+}
+
+func (s *Storage) createPersonalMessage(ctx context.Context, message *storage.NewMessage) (id int64, timestamp int64, err error) {
+	var textEntities any
+	textEntities, err = storage.TextEntitiesToJSON(message.Entities)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var content any
+	content, err = storage.MessageContentToJSON(message.Content)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var envelope any
+	envelope, err = storage.EncryptedEnvelopeToJSON(message.Envelope)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		reservedId int64
+		key        *dataKey
+	)
+
+	reservedId, key, err = s.newMessageKey(ctx, message.Sender)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var text string
+	text, err = key.encrypt(message.Text)
 
 	if err != nil {
 		return 0, 0, err
 	}
 
-	defer tx.Rollback()
+	var storedEntities, storedContent any
+	storedEntities, err = key.encryptJSON(textEntities)
+
+	if err == nil {
+		storedContent, err = key.encryptJSON(content)
+	}
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var tx pgx.Tx
+	tx, err = s.db.Begin(ctx)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var blocked bool
+	err = tx.QueryRow(ctx, queryCheckSenderBlocked{}.text(), message.Receiver, message.Sender).Scan(&blocked)
 
-	row := tx.Stmt(s.queries[queryCreateMessage{}]).QueryRowContext(ctx, sender, message.To, time.Now().UTC(), message.Text)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to check if sender is blocked: %w", err)
+	}
+
+	if blocked {
+		return 0, 0, &ErrSenderBlocked{recipient: message.Receiver}
+	}
+
+	err = s.acceptConversation(ctx, tx, message.Sender, message.Receiver) // replying means accepting
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var isRequest bool
+	isRequest, err = s.checkReceiverAccepts(ctx, tx, message.Sender, message.Receiver)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = s.unarchiveConversation(ctx, tx, message.Receiver, message.Sender)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	row := tx.QueryRow(ctx, queryCreateMessage{}.text(),
+		message.Sender, message.Receiver, time.Now().UTC(), text, storedEntities, isRequest, message.ClientId, storedContent, envelope,
+		message.Text, key.digest(message.Text), key.masterKeyId(), key.wrappedKey(), reservedId, key.digestJSON(textEntities))
 	err = row.Scan(&id, &timestamp)
 
+	if err == pgx.ErrNoRows {
+		return 0, 0, s.clientIdConflict(ctx, message.Sender, message.ClientId)
+	}
+
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to create new message: %w", err)
 	}
 
-	if len(message.Files) != 0 {
-		for _, fileId := range message.Files {
-			_, err = tx.Stmt(s.queries[queryCreateAttachment{}]).ExecContext(ctx, id, fileId)
+	if message.IdempotencyKey != nil {
+		err = s.saveIdempotencyKey(ctx, tx, message.Sender, message.IdempotencyKey, id, timestamp)
 
-			if err != nil {
-				return 0, 0, fmt.Errorf("failed to create attachment with file id '%s': %w", fileId, err)
-			}
+		if err != nil {
+			return 0, 0, err
 		}
 	}
 
-	_, err = tx.Stmt(s.queries[queryWriteUpdate{}]).ExecContext(ctx, sender, timestamp, id)
+	batch := &pgx.Batch{}
+	err = queueAttachments(batch, id, key, message.Files)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = s.queueFileUsage(batch, message.Files, true)
 
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to write user '%s' update: %w", sender, err)
+		return 0, 0, err
 	}
 
-	_, err = tx.Stmt(s.queries[queryWriteUpdate{}]).ExecContext(ctx, message.To, timestamp, id)
+	queueMessageUpdates(batch, id, timestamp, message.Sender)
+	queueMessageEvent(batch, &events.Event{
+		Type: events.MessageCreated, MessageId: id, Timestamp: timestamp, Sender: message.Sender, Receiver: message.Receiver,
+	})
+	err = tx.SendBatch(ctx, batch).Close()
 
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to write user '%s' update: %w", message.To, err)
+		return 0, 0, fmt.Errorf("failed to save new message data: %w", err)
 	}
 
-	err = tx.Commit()
+	err = tx.Commit(ctx)
 
 	if err != nil {
 		return 0, 0, err
@@ -84,3 +233,127 @@ func (s *Storage) CreateNewPersonalMessageV1(ctx context.Context, sender string,
 
 	return id, timestamp, nil
 }
+
+func queueAttachments(batch *pgx.Batch, messageId int64, key *dataKey, files []string) error {
+	for _, fileId := range files {
+		encrypted, err := key.encrypt(fileId)
+
+		if err != nil {
+			return fmt.Errorf("failed to create attachment with file id '%s': %w", fileId, err)
+		}
+
+		batch.Queue(queryCreateAttachment{}.text(), messageId, encrypted, key.digest(fileId))
+	}
+
+	return nil
+}
+
+// Encrypted data is bound to the message id (see messageBinding), so the id of the new message is reserved
+// to generate its data key before the message is created. Without encryption, the id is assigned on insert
+// (zero is returned) and the key is nil.
+func (s *Storage) newMessageKey(ctx context.Context, sender string) (id int64, key *dataKey, err error) {
+	if !s.keys.enabled() {
+		return 0, nil, nil
+	}
+
+	var ids []int64
+	ids, err = s.reserveMessageIds(ctx, 1)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	key, err = s.keys.newMessageKey(ids[0], sender)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return ids[0], key, nil
+}
+
+// Sequence values are not rolled back, so the ids are reserved outside of the transaction creating the messages.
+func (s *Storage) reserveMessageIds(ctx context.Context, n int) (ids []int64, err error) {
+	var rows pgx.Rows
+	rows, err = s.db.Query(ctx, queryReserveMessageIds{}.text(), n)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve message ids: %w", err)
+	}
+
+	defer rows.Close()
+
+	ids = make([]int64, 0, n)
+
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to reserve message ids: %w", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve message ids: %w", err)
+	}
+
+	return ids, nil
+}
+
+// Both sender's and receiver's timelines get the same entry, they are written in one round trip
+// along with other queued changes of the message.
+func queueMessageUpdates(batch *pgx.Batch, messageId, timestamp int64, sender string) {
+	batch.Queue(queryWriteUpdate{}.text(), sender, timestamp, messageId)
+	batch.Queue(queryWriteReceiverUpdate{}.text(), messageId, timestamp)
+}
+
+func (s *Storage) MessageIdByClientId(ctx context.Context, sender, clientId string) (id int64, err error) {
+	err = s.db.QueryRow(ctx, queryGetMessageIdByClientId{}.text(), sender, clientId).Scan(&id)
+
+	if err == pgx.ErrNoRows {
+		return 0, nil
+	}
+
+	return id, err
+}
+
+func (s *Storage) clientIdConflict(ctx context.Context, sender, clientId string) error {
+	id, err := s.MessageIdByClientId(ctx, sender, clientId)
+
+	if err != nil {
+		return fmt.Errorf("failed to get message with conflicting client id '%s': %w", clientId, err)
+	}
+
+	if id == 0 {
+		return fmt.Errorf("failed to create new message: no message with conflicting client id '%s'", clientId)
+	}
+
+	return &ErrClientIdConflict{messageId: id}
+}
+
+func (e *ErrSenderBlocked) Error() string {
+	return "sender is blocked by the receiver"
+}
+
+func (e *ErrSenderBlocked) ImplementsSenderBlockedError() {
+}
+
+func (e *ErrSenderBlocked) Recipient() string {
+	return e.recipient
+}
+
+func (e *ErrClientIdConflict) Error() string {
+	return "message with the same client id already exists"
+}
+
+func (e *ErrClientIdConflict) ImplementsClientIdConflictError() {
+}
+
+func (e *ErrClientIdConflict) MessageId() int64 {
+	return e.messageId
+}
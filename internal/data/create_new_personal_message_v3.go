@@ -0,0 +1,13 @@
+package data
+
+import (
+	"context"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+func (s *Storage) CreateNewPersonalMessageV3(ctx context.Context, sender string, message *models.NewPersonalMessageV3, key *models.IdempotencyKey) (id int64, timestamp int64, err error) {
+	id, timestamp, err = s.createPersonalMessage(ctx, storage.NewMessageV3(sender, message, key))
+	return id, timestamp, err
+}
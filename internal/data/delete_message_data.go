@@ -1,6 +1,13 @@
 package data
 
-import "context"
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/events"
+)
 
 type queryDeleteMessageData struct{}
 
@@ -20,7 +27,14 @@ func (q queryDeleteMessageData) text() string {
 			created = null,
 			edited = null,
 			is_read = null,
+			read_receipt = null,
 			message_text = null,
+			text_digest = null,
+			text_entities = null,
+			entities_digest = null,
+			content = null,
+			envelope = null,
+			text_search = null,
 			is_deleted = true
 		WHERE id = $2
 			AND COALESCE(is_deleted, false) = false
@@ -45,7 +59,28 @@ func (q queryDeleteMessageData) text() string {
 	`
 }
 
+// Attachments of the deleted message are kept, but the files are no longer used by it.
+// They cannot change unnoticed before the modification, since it checks the timestamp.
 func (s *Storage) DeleteMessageData(ctx context.Context, id, timestamp int64) (newTimestamp int64, err error) {
-	newTimestamp, err = s.modifyMessage(ctx, queryDeleteMessageData{}, timestamp, id)
+	_, key, err := s.messageKeys(ctx, id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var files []string
+	files, err = s.messageFiles(ctx, id, key)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get message files: %w", err)
+	}
+
+	deleteRelatedData := func(batch *pgx.Batch, messageId int64) error {
+		batch.Queue(queryDeleteMessageStars{}.text(), messageId)
+		batch.Queue(queryDeletePollVotes{}.text(), messageId)
+		return s.queueFileUsage(batch, files, false)
+	}
+
+	newTimestamp, err = s.modifyMessage(ctx, queryDeleteMessageData{}, events.MessageDeleted, deleteRelatedData, timestamp, id)
 	return newTimestamp, err
 }
@@ -0,0 +1,136 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/events"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+type ErrMessageEncrypted struct{}
+type ErrMessageNotEncrypted struct{}
+
+type queryGetMessageKeys struct{}
+
+func (q queryGetMessageKeys) text() string {
+	return `
+	SELECT
+		envelope IS NOT NULL,
+		sender,
+		COALESCE(key_id, ''),
+		data_key
+	FROM messages
+	WHERE id = $1;
+	`
+}
+
+type queryEditMessageEnvelope struct{}
+
+func (q queryEditMessageEnvelope) text() string {
+	return `
+	WITH update_constraints AS (
+		SELECT
+			COALESCE(is_deleted, false) AS message_deleted,
+			event_timestamp = $1 AS timestamp_match,
+			envelope IS DISTINCT FROM $2::jsonb AS envelope_modified
+		FROM messages
+		WHERE id = $3
+		FOR UPDATE
+	),
+	update_try AS (
+		UPDATE messages SET
+			event_timestamp = nextval('timeline'),
+			envelope = $2,
+			edited = $4
+		WHERE id = $3
+			AND COALESCE(is_deleted, false) = false
+			AND event_timestamp = $1
+			AND envelope IS DISTINCT FROM $2::jsonb
+		RETURNING
+			id AS id,
+			event_timestamp AS new_timestamp,
+			sender AS sender,
+			receiver AS receiver
+	)
+	SELECT
+		COALESCE(update_try.id, 0) AS id,
+		COALESCE(update_try.new_timestamp, 0) AS new_timestamp,
+		update_constraints.message_deleted AS message_deleted,
+		update_constraints.timestamp_match AS timestamp_match,
+		update_constraints.envelope_modified AS envelope_modified,
+		COALESCE(update_try.sender, '') AS sender,
+		COALESCE(update_try.receiver, '') AS receiver
+	FROM update_constraints
+		LEFT OUTER JOIN update_try
+		ON true;
+	`
+}
+
+// Encrypted counterpart of the text editing: the envelope is replaced as a whole.
+func (s *Storage) EditMessageEnvelope(ctx context.Context, id, timestamp int64, envelope *models.EncryptedEnvelope) (newTimestamp int64, err error) {
+	var encrypted bool
+	encrypted, _, err = s.messageKeys(ctx, id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if !encrypted {
+		return 0, &ErrMessageNotEncrypted{}
+	}
+
+	var data any
+	data, err = storage.EncryptedEnvelopeToJSON(envelope)
+
+	if err != nil {
+		return 0, err
+	}
+
+	newTimestamp, err = s.modifyMessage(ctx, queryEditMessageEnvelope{}, events.MessageEdited, nil, timestamp, data, id, time.Now().UTC())
+	return newTimestamp, err
+}
+
+// Message cannot be encrypted end-to-end (or decrypted) after it's created, so it's checked outside of the modification.
+// Deleted messages are not encrypted, since their envelope is removed.
+// Data key (nil for plain text) doesn't change either, but plain text messages can be encrypted at rest
+// by the key rotation, so the modification has to check that encryption state is the same.
+func (s *Storage) messageKeys(ctx context.Context, id int64) (encrypted bool, key *dataKey, err error) {
+	var sender, keyId string
+	var wrappedKey []byte
+	err = s.db.QueryRow(ctx, queryGetMessageKeys{}.text(), id).Scan(&encrypted, &sender, &keyId, &wrappedKey)
+
+	if err == pgx.ErrNoRows {
+		return false, nil, nil // let the modification handle it
+	}
+
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to get message keys: %w", err)
+	}
+
+	key, err = s.keys.openMessageKey(id, sender, keyId, wrappedKey)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	return encrypted, key, nil
+}
+
+func (e *ErrMessageEncrypted) Error() string {
+	return "message is encrypted"
+}
+
+func (e *ErrMessageEncrypted) ImplementsMessageEncryptedError() {
+}
+
+func (e *ErrMessageNotEncrypted) Error() string {
+	return "message is not encrypted"
+}
+
+func (e *ErrMessageNotEncrypted) ImplementsMessageNotEncryptedError() {
+}
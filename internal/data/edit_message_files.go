@@ -0,0 +1,112 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/events"
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+type queryEditMessageFiles struct{}
+
+func (q queryEditMessageFiles) text() string {
+	return `
+	WITH update_constraints AS (
+		SELECT
+			COALESCE(is_deleted, false) AS message_deleted,
+			event_timestamp = $1 AND (data_key IS NOT NULL) = $6 AS timestamp_match,
+			CASE WHEN data_key IS NULL
+				THEN ARRAY(SELECT file_id FROM attachments WHERE message_id = $3 ORDER BY file_id)
+					IS DISTINCT FROM ARRAY(SELECT unnest($2::varchar[]) ORDER BY 1)
+				ELSE ARRAY(SELECT file_digest FROM attachments WHERE message_id = $3 ORDER BY file_digest)
+					IS DISTINCT FROM ARRAY(SELECT unnest($5::bytea[]) ORDER BY 1) END AS files_modified
+		FROM messages
+		WHERE id = $3
+		FOR UPDATE
+	),
+	update_try AS (
+		UPDATE messages SET
+			event_timestamp = nextval('timeline'),
+			edited = $4
+		WHERE id = $3
+			AND COALESCE(is_deleted, false) = false
+			AND event_timestamp = $1
+			AND (data_key IS NOT NULL) = $6
+			AND CASE WHEN data_key IS NULL
+				THEN ARRAY(SELECT file_id FROM attachments WHERE message_id = $3 ORDER BY file_id)
+					IS DISTINCT FROM ARRAY(SELECT unnest($2::varchar[]) ORDER BY 1)
+				ELSE ARRAY(SELECT file_digest FROM attachments WHERE message_id = $3 ORDER BY file_digest)
+					IS DISTINCT FROM ARRAY(SELECT unnest($5::bytea[]) ORDER BY 1) END
+		RETURNING
+			id AS id,
+			event_timestamp AS new_timestamp,
+			sender AS sender,
+			receiver AS receiver
+	)
+	SELECT
+		COALESCE(update_try.id, 0) AS id,
+		COALESCE(update_try.new_timestamp, 0) AS new_timestamp,
+		update_constraints.message_deleted AS message_deleted,
+		update_constraints.timestamp_match AS timestamp_match,
+		update_constraints.files_modified AS files_modified,
+		COALESCE(update_try.sender, '') AS sender,
+		COALESCE(update_try.receiver, '') AS receiver
+	FROM update_constraints
+		LEFT OUTER JOIN update_try
+		ON true;
+	`
+}
+
+type queryDeleteAttachments struct{}
+
+func (q queryDeleteAttachments) text() string {
+	return `
+	DELETE FROM attachments
+	WHERE message_id = $1;
+	`
+}
+
+func (s *Storage) EditMessageFiles(ctx context.Context, id, timestamp int64, files []string) (newTimestamp int64, err error) {
+	if files == nil {
+		files = make([]string, 0) // empty array, not NULL
+	}
+
+	_, key, err := s.messageKeys(ctx, id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// Current files cannot change unnoticed before the modification, since it checks the timestamp.
+	var attached []string
+	attached, err = s.messageFiles(ctx, id, key)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get message files: %w", err)
+	}
+
+	used, unused := models.FilesDifference(attached, files)
+
+	replaceAttachments := func(batch *pgx.Batch, messageId int64) error {
+		batch.Queue(queryDeleteAttachments{}.text(), messageId)
+		err := s.queueFileUsage(batch, used, true)
+
+		if err == nil {
+			err = s.queueFileUsage(batch, unused, false)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return queueAttachments(batch, messageId, key, files)
+	}
+
+	newTimestamp, err = s.modifyMessage(ctx, queryEditMessageFiles{}, events.MessageEdited, replaceAttachments,
+		timestamp, files, id, time.Now().UTC(), key.digestAll(files), key != nil)
+	return newTimestamp, err
+}
@@ -3,6 +3,10 @@ package data
 import (
 	"context"
 	"time"
+
+	"github.com/barpav/msg-messages/internal/events"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
 )
 
 type queryEditMessageText struct{}
@@ -12,8 +16,12 @@ func (q queryEditMessageText) text() string {
 	WITH update_constraints AS (
 		SELECT
 			COALESCE(is_deleted, false) AS message_deleted,
-			event_timestamp = $1 AS timestamp_match,
-			message_text != NULLIF($2, '') AS text_modified
+			event_timestamp = $1 AND (data_key IS NOT NULL) = $7 AS timestamp_match,
+			(CASE WHEN data_key IS NULL
+				THEN message_text IS DISTINCT FROM NULLIF($2, '')
+					OR text_entities::jsonb IS DISTINCT FROM $9::jsonb
+				ELSE text_digest IS DISTINCT FROM $6::bytea
+					OR entities_digest IS DISTINCT FROM $10::bytea END) AS text_modified
 		FROM messages
 		WHERE id = $3
 		FOR UPDATE
@@ -22,11 +30,20 @@ func (q queryEditMessageText) text() string {
 		UPDATE messages SET
 			event_timestamp = nextval('timeline'),
 			message_text = NULLIF($2, ''),
+			text_digest = $6,
+			text_entities = $5,
+			entities_digest = $10,
+			text_search = searchable_text($8, $7),
 			edited = $4
 		WHERE id = $3
 			AND COALESCE(is_deleted, false) = false
 			AND event_timestamp = $1
-			AND message_text != NULLIF($2, '')
+			AND (data_key IS NOT NULL) = $7
+			AND (CASE WHEN data_key IS NULL
+				THEN message_text IS DISTINCT FROM NULLIF($2, '')
+					OR text_entities::jsonb IS DISTINCT FROM $9::jsonb
+				ELSE text_digest IS DISTINCT FROM $6::bytea
+					OR entities_digest IS DISTINCT FROM $10::bytea END)
 		RETURNING
 			id AS id,
 			event_timestamp AS new_timestamp,
@@ -47,7 +64,57 @@ func (q queryEditMessageText) text() string {
 	`
 }
 
+// Plain text replaces formatted one, so text entities (if any) are removed.
 func (s *Storage) EditMessageText(ctx context.Context, id, timestamp int64, text string) (newTimestamp int64, err error) {
-	newTimestamp, err = s.modifyMessage(ctx, queryEditMessageText{}, timestamp, text, id, time.Now().UTC())
+	newTimestamp, err = s.EditMessageTextV2(ctx, id, timestamp, text, nil)
+	return newTimestamp, err
+}
+
+func (s *Storage) EditMessageTextV2(ctx context.Context, id, timestamp int64, text string, entities []models.TextEntity) (newTimestamp int64, err error) {
+	var textEntities any
+	textEntities, err = storage.TextEntitiesToJSON(entities)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		encrypted bool
+		key       *dataKey
+	)
+
+	encrypted, key, err = s.messageKeys(ctx, id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if encrypted {
+		return 0, &ErrMessageEncrypted{}
+	}
+
+	var storedText string
+	storedText, err = key.encrypt(text)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var storedEntities any
+	storedEntities, err = key.encryptJSON(textEntities)
+
+	if err != nil {
+		return 0, err
+	}
+
+	plainEntities := textEntities // compared by digest if encrypted, so not sent as is
+
+	if key != nil {
+		plainEntities = nil
+	}
+
+	newTimestamp, err = s.modifyMessage(ctx, queryEditMessageText{}, events.MessageEdited, nil,
+		timestamp, storedText, id, time.Now().UTC(), storedEntities, key.digest(text), key != nil, text,
+		plainEntities, key.digestJSON(textEntities))
 	return newTimestamp, err
 }
@@ -0,0 +1,339 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Message text, text entities, content and attachments are encrypted with a data key generated for every message,
+// whereas the data key itself is stored encrypted (wrapped) with one of the configured master keys
+// along with its id. So rotating master keys means rewrapping data keys only.
+// Both the data and the wrapped data key are bound to the message (see binding).
+type keySet struct {
+	active string                 // id of the master key used for new messages
+	keys   map[string]cipher.AEAD // master keys by id
+}
+
+const dataKeySize = 32 // AES-256
+
+// Authenticated data binding encrypted data and its data key to the place they are stored in,
+// so they cannot be moved (e.g. to another message) by those who can write to the database.
+type binding []byte
+
+func messageBinding(messageId int64, sender string) binding {
+	return binding(fmt.Sprintf("message:%d:%s", messageId, sender))
+}
+
+// File usage events have no owner, but their data keys are used for the outbox only.
+var outboxBinding = binding("outbox")
+
+func webhookBinding(webhookId int64, userId string) binding {
+	return binding(fmt.Sprintf("webhook:%d:%s", webhookId, userId))
+}
+
+// Format: "id1:base64key,id2:base64key", every key is 32 bytes long.
+// Empty key list means that encryption is disabled and new messages are stored as plain text.
+func newKeySet(keyList, active string) (*keySet, error) {
+	k := &keySet{keys: make(map[string]cipher.AEAD)}
+
+	if strings.TrimSpace(keyList) == "" {
+		return k, nil
+	}
+
+	var lastId string
+
+	for _, item := range strings.Split(keyList, ",") {
+		id, encoded, found := strings.Cut(strings.TrimSpace(item), ":")
+
+		if !found || id == "" {
+			return nil, errors.New("encryption key must be specified as 'id:base64key'")
+		}
+
+		if _, duplicate := k.keys[id]; duplicate {
+			return nil, fmt.Errorf("encryption key '%s' is specified more than once", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+
+		if err != nil || len(key) != dataKeySize {
+			return nil, fmt.Errorf("encryption key '%s' must be base64 encoded %d bytes", id, dataKeySize)
+		}
+
+		k.keys[id], err = newAEAD(key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		lastId = id
+	}
+
+	k.active = active
+
+	if k.active == "" {
+		k.active = lastId // the newest one
+	}
+
+	if _, ok := k.keys[k.active]; !ok {
+		return nil, fmt.Errorf("active encryption key '%s' is not specified", k.active)
+	}
+
+	return k, nil
+}
+
+func (k *keySet) enabled() bool {
+	return k != nil && k.active != ""
+}
+
+// Returns nil (NULL) if encryption is disabled.
+func (k *keySet) activeKeyId() any {
+	if !k.enabled() {
+		return nil
+	}
+	return k.active
+}
+
+// Returns nil if encryption is disabled.
+func (k *keySet) newDataKey(b binding) (*dataKey, error) {
+	if !k.enabled() {
+		return nil, nil
+	}
+
+	key := make([]byte, dataKeySize)
+	_, err := rand.Read(key)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	return k.wrap(key, b)
+}
+
+func (k *keySet) newMessageKey(messageId int64, sender string) (*dataKey, error) {
+	return k.newDataKey(messageBinding(messageId, sender))
+}
+
+// Returns nil for plain text (without data key).
+func (k *keySet) openDataKey(keyId string, wrapped []byte, b binding) (*dataKey, error) {
+	if keyId == "" || len(wrapped) == 0 {
+		return nil, nil
+	}
+
+	master, ok := k.keys[keyId]
+
+	if !ok {
+		return nil, fmt.Errorf("encryption key '%s' is not configured", keyId)
+	}
+
+	key, err := open(master, wrapped, b)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key (master key '%s'): %w", keyId, err)
+	}
+
+	return newDataKey(key, keyId, wrapped, b)
+}
+
+func (k *keySet) openMessageKey(messageId int64, sender, keyId string, wrapped []byte) (*dataKey, error) {
+	return k.openDataKey(keyId, wrapped, messageBinding(messageId, sender))
+}
+
+// Wraps the key with the active master key.
+func (k *keySet) wrap(key []byte, b binding) (*dataKey, error) {
+	wrapped, err := seal(k.keys[k.active], key, b)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	return newDataKey(key, k.active, wrapped, b)
+}
+
+func newDataKey(key []byte, keyId string, wrapped []byte, b binding) (d *dataKey, err error) {
+	d = &dataKey{key: key, keyId: keyId, wrapped: wrapped, binding: b, digestKey: deriveKey(key, "digest")}
+	d.aead, err = newAEAD(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Nil data key means plain text, so all methods are safe to call on it.
+type dataKey struct {
+	key       []byte
+	aead      cipher.AEAD
+	keyId     string // master key id
+	wrapped   []byte // encrypted with master key
+	binding   binding
+	digestKey []byte
+}
+
+// Encrypted data stays the same, only the data key is wrapped with the active master key.
+func (k *keySet) rewrap(d *dataKey) (*dataKey, error) {
+	return k.wrap(d.key, d.binding)
+}
+
+func (d *dataKey) masterKeyId() any {
+	if d == nil {
+		return nil
+	}
+	return d.keyId
+}
+
+func (d *dataKey) wrappedKey() []byte {
+	if d == nil {
+		return nil
+	}
+	return d.wrapped
+}
+
+// Empty text stays empty.
+func (d *dataKey) encrypt(plaintext string) (string, error) {
+	if d == nil || plaintext == "" {
+		return plaintext, nil
+	}
+
+	sealed, err := seal(d.aead, []byte(plaintext), d.binding)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt message data: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (d *dataKey) decrypt(ciphertext string) (string, error) {
+	if d == nil || ciphertext == "" {
+		return ciphertext, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+
+	if err == nil {
+		var plaintext []byte
+		plaintext, err = open(d.aead, sealed, d.binding)
+
+		if err == nil {
+			return string(plaintext), nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to decrypt message data: %w", err)
+}
+
+func (d *dataKey) encryptAll(plaintexts []string) (ciphertexts []string, err error) {
+	ciphertexts = make([]string, 0, len(plaintexts))
+
+	for _, plaintext := range plaintexts {
+		var ciphertext string
+		ciphertext, err = d.encrypt(plaintext)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ciphertexts = append(ciphertexts, ciphertext)
+	}
+
+	return ciphertexts, nil
+}
+
+// Data serialized to JSON (see storage.TextEntitiesToJSON) is encrypted as text, NULL stays NULL.
+func (d *dataKey) encryptJSON(data any) (any, error) {
+	if data == nil {
+		return nil, nil
+	}
+	return d.encrypt(data.(string))
+}
+
+func (d *dataKey) decryptJSON(data []byte) ([]byte, error) {
+	if d == nil || len(data) == 0 {
+		return data, nil
+	}
+
+	plaintext, err := d.decrypt(string(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(plaintext), nil
+}
+
+// Encryption is not deterministic, so encrypted values are compared by digests.
+// Returns nil for plain text, since it can be compared as is.
+// Digests are calculated with a key derived from the data key rather than the data key itself.
+func (d *dataKey) digest(plaintext string) []byte {
+	if d == nil {
+		return nil
+	}
+
+	mac := hmac.New(sha256.New, d.digestKey)
+	mac.Write([]byte(plaintext))
+	return mac.Sum(nil)
+}
+
+// NULL stays NULL, so the data is compared as absent.
+func (d *dataKey) digestJSON(data any) []byte {
+	if data == nil {
+		return nil
+	}
+	return d.digest(data.(string))
+}
+
+func (d *dataKey) digestAll(plaintexts []string) [][]byte {
+	digests := make([][]byte, 0, len(plaintexts))
+
+	for _, plaintext := range plaintexts {
+		digests = append(digests, d.digest(plaintext))
+	}
+
+	return digests
+}
+
+// Keys for different purposes derived from the same key are independent (HMAC-based, like HKDF-Expand).
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Result: nonce + ciphertext.
+func seal(aead cipher.AEAD, plaintext []byte, b binding) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, err := rand.Read(nonce)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, b), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte, b binding) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, b)
+}
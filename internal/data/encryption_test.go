@@ -0,0 +1,190 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+const testEncryptionKeys = "k1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=,k2:AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+
+func TestKeySet_messageBinding(t *testing.T) {
+	keys, err := newKeySet(testEncryptionKeys, "")
+	require.NoError(t, err)
+
+	key, err := keys.newMessageKey(1, "john")
+	require.NoError(t, err)
+	require.Equal(t, "k2", key.masterKeyId())
+
+	encrypted, err := key.encrypt("Hello!")
+	require.NoError(t, err)
+
+	opened, err := keys.openMessageKey(1, "john", "k2", key.wrappedKey())
+	require.NoError(t, err)
+
+	decrypted, err := opened.decrypt(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, "Hello!", decrypted)
+
+	// Data key moved to another message cannot be unwrapped.
+	_, err = keys.openMessageKey(2, "john", "k2", key.wrappedKey())
+	require.Error(t, err)
+
+	_, err = keys.openMessageKey(1, "jane", "k2", key.wrappedKey())
+	require.Error(t, err)
+
+	_, err = keys.openDataKey("k2", key.wrappedKey(), nil)
+	require.Error(t, err)
+
+	// Data moved to another message with the same data key cannot be decrypted.
+	moved, err := keys.openDataKey("k2", key.wrappedKey(), messageBinding(1, "john"))
+	require.NoError(t, err)
+	moved.binding = messageBinding(2, "john")
+
+	_, err = moved.decrypt(encrypted)
+	require.Error(t, err)
+
+	// Rewrapped key keeps the binding.
+	keys.active = "k1"
+	rewrapped, err := keys.rewrap(opened)
+	require.NoError(t, err)
+
+	_, err = keys.openMessageKey(1, "john", "k1", rewrapped.wrappedKey())
+	require.NoError(t, err)
+
+	_, err = keys.openMessageKey(2, "john", "k1", rewrapped.wrappedKey())
+	require.Error(t, err)
+}
+
+func TestKeySet_digestKey(t *testing.T) {
+	keys, err := newKeySet(testEncryptionKeys, "")
+	require.NoError(t, err)
+
+	key, err := keys.newMessageKey(1, "john")
+	require.NoError(t, err)
+	require.False(t, bytes.Equal(key.key, key.digestKey))
+	require.Equal(t, key.digest("file"), key.digest("file"))
+	require.NotEqual(t, key.digest("file"), key.digest("another file"))
+}
+
+func TestKeySet_disabled(t *testing.T) {
+	keys, err := newKeySet("", "")
+	require.NoError(t, err)
+
+	key, err := keys.newMessageKey(1, "john")
+	require.NoError(t, err)
+	require.Nil(t, key)
+	require.Nil(t, keys.activeKeyId())
+
+	text, err := key.encrypt("Hello!")
+	require.NoError(t, err)
+	require.Equal(t, "Hello!", text)
+	require.Nil(t, key.digest("Hello!"))
+
+	entities, err := key.encryptJSON(`[{"type":"bold","offset":0,"length":5}]`)
+	require.NoError(t, err)
+	require.Equal(t, `[{"type":"bold","offset":0,"length":5}]`, entities)
+}
+
+func TestKeySet_json(t *testing.T) {
+	keys, err := newKeySet(testEncryptionKeys, "")
+	require.NoError(t, err)
+
+	key, err := keys.newMessageKey(1, "john")
+	require.NoError(t, err)
+
+	encrypted, err := key.encryptJSON(`{"type":"poll"}`)
+	require.NoError(t, err)
+	require.NotContains(t, encrypted, "poll")
+
+	decrypted, err := key.decryptJSON([]byte(encrypted.(string)))
+	require.NoError(t, err)
+	require.Equal(t, `{"type":"poll"}`, string(decrypted))
+
+	encrypted, err = key.encryptJSON(nil)
+	require.NoError(t, err)
+	require.Nil(t, encrypted) // NULL
+	require.Nil(t, key.digestJSON(nil))
+	require.Equal(t, key.digest(`{"type":"poll"}`), key.digestJSON(`{"type":"poll"}`))
+}
+
+func TestKeySet_webhookBinding(t *testing.T) {
+	keys, err := newKeySet(testEncryptionKeys, "")
+	require.NoError(t, err)
+
+	key, err := keys.newDataKey(webhookBinding(1, "jane"))
+	require.NoError(t, err)
+
+	_, err = keys.openDataKey("k2", key.wrappedKey(), webhookBinding(1, "jane"))
+	require.NoError(t, err)
+
+	_, err = keys.openDataKey("k2", key.wrappedKey(), webhookBinding(2, "jane"))
+	require.Error(t, err)
+
+	_, err = keys.openMessageKey(1, "jane", "k2", key.wrappedKey())
+	require.Error(t, err)
+}
+
+// Requires running database, skipped otherwise (see TestMigrate_initialSchemaUpgraded).
+// Checks the stored rows of both the message encrypted on creation and the one stored before
+// encryption was enabled (encrypted by the rotation), since the service itself decrypts everything.
+func TestStorage_encryptedAtRest(t *testing.T) {
+	ctx := context.Background()
+	database := createTestDatabase(t, "encrypted")
+	message := &models.NewPersonalMessageV3{
+		To:       "john",
+		Text:     "Lunch at noon?",
+		Entities: []models.TextEntity{{Type: models.TextEntityLink, Offset: 0, Length: 5, Url: "https://lunch.example.com"}},
+		Content: &models.MessageContent{Type: models.MessageContentPoll, Poll: &models.PollContent{
+			Question: "Where to have lunch?",
+			Options:  []*models.PollOption{{Text: "Pizzeria"}, {Text: "Noodle bar"}},
+		}},
+	}
+	plaintexts := []string{"Lunch at noon", "lunch.example.com", "Where to have lunch", "Pizzeria", "Noodle bar"}
+
+	stored, _, err := openTestDatabase(t, database).CreateNewPersonalMessageV3(ctx, "jane", message, nil)
+	require.NoError(t, err)
+
+	t.Setenv(envVarEncryptionKeys, testEncryptionKeys)
+	s := openTestDatabase(t, database)
+
+	_, err = s.RotateEncryptionKeys(ctx, 10)
+	require.NoError(t, err)
+
+	var created int64
+	created, _, err = s.CreateNewPersonalMessageV3(ctx, "jane", message, nil)
+	require.NoError(t, err)
+
+	db := connectTestDatabase(t, database)
+
+	for _, id := range []int64{stored, created} {
+		var text, entities, content string
+		err = db.QueryRow(ctx, "SELECT message_text, text_entities, content FROM messages WHERE id = $1;", id).
+			Scan(&text, &entities, &content)
+		require.NoError(t, err)
+
+		for _, plaintext := range plaintexts {
+			require.NotContains(t, text, plaintext)
+			require.NotContains(t, entities, plaintext)
+			require.NotContains(t, content, plaintext)
+		}
+
+		var decrypted *models.PersonalMessageV3
+		decrypted, err = s.PersonalMessageV3(ctx, "jane", id)
+		require.NoError(t, err)
+		require.Equal(t, message.Text, decrypted.Text)
+		require.Equal(t, message.Entities, decrypted.Entities)
+		require.Equal(t, message.Content.Poll.Question, decrypted.Content.Poll.Question)
+
+		// Encrypted text entities are compared by digests.
+		_, err = s.EditMessageTextV2(ctx, id, decrypted.Timestamp, message.Text, message.Entities)
+		require.IsType(t, &ErrMessageNotModified{}, err)
+
+		_, err = s.EditMessageTextV2(ctx, id, decrypted.Timestamp, message.Text, nil)
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,174 @@
+package data
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type ErrFileUsageRelayNotPaused struct{}
+
+// Attachments of deleted messages are kept, but the files are no longer used by them.
+type queryGetUsedFiles struct{}
+
+func (q queryGetUsedFiles) text() string {
+	return `
+	SELECT
+		a.message_id,
+		a.file_id,
+		m.sender,
+		COALESCE(m.key_id, ''),
+		m.data_key
+	FROM attachments AS a
+		JOIN messages AS m
+		ON m.id = a.message_id
+	WHERE COALESCE(m.is_deleted, false) = false
+	ORDER BY a.message_id;
+	`
+}
+
+type queryGetFileUsageRelayPaused struct{}
+
+func (q queryGetFileUsageRelayPaused) text() string {
+	return `
+	SELECT paused IS NOT NULL
+	FROM file_usage_relay;
+	`
+}
+
+type queryGetUndeliveredFileUsage struct{}
+
+func (q queryGetUndeliveredFileUsage) text() string {
+	return `
+	SELECT file_id, in_use, COALESCE(key_id, ''), data_key
+	FROM outbox
+	WHERE delivered IS NULL;
+	`
+}
+
+// Returns the number of uses of every file as the files usage statistics should count it now:
+// uses by the messages except the ones the statistics hasn't been notified of yet (pending outbox events).
+// Both are read from the same snapshot of the database.
+// The relay must be paused (see PauseFileUsageRelay) before the counters of the statistics are exported,
+// otherwise the events delivered between the export and the snapshot would be counted twice.
+func (s *Storage) FileUsage(ctx context.Context) (uses map[string]int, err error) {
+	var tx pgx.Tx
+	tx, err = s.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var paused bool
+	err = tx.QueryRow(ctx, queryGetFileUsageRelayPaused{}.text()).Scan(&paused)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file usage relay state: %w", err)
+	}
+
+	if !paused {
+		return nil, &ErrFileUsageRelayNotPaused{}
+	}
+
+	uses, err = s.usedFiles(ctx, tx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get used files: %w", err)
+	}
+
+	var rows pgx.Rows
+	rows, err = tx.Query(ctx, queryGetUndeliveredFileUsage{}.text())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending file usage events: %w", err)
+	}
+
+	defer rows.Close()
+
+	var (
+		fileId, keyId string
+		wrappedKey    []byte
+		inUse         bool
+		keys          = outboxKeys{keys: s.keys}
+	)
+
+	for rows.Next() {
+		err = rows.Scan(&fileId, &inUse, &keyId, &wrappedKey)
+
+		if err == nil {
+			fileId, err = keys.decrypt(fileId, keyId, wrappedKey)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pending file usage events: %w", err)
+		}
+
+		if inUse {
+			uses[fileId]--
+		} else {
+			uses[fileId]++
+		}
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending file usage events: %w", err)
+	}
+
+	return uses, nil
+}
+
+// Data key is opened once for all attachments of the message.
+func (s *Storage) usedFiles(ctx context.Context, tx pgx.Tx) (map[string]int, error) {
+	rows, err := tx.Query(ctx, queryGetUsedFiles{}.text())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var (
+		uses                    = make(map[string]int)
+		messageId, keyMessageId int64
+		fileId, sender, keyId   string
+		wrappedKey              []byte
+		key                     *dataKey
+	)
+
+	for rows.Next() {
+		err = rows.Scan(&messageId, &fileId, &sender, &keyId, &wrappedKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if messageId != keyMessageId {
+			key, err = s.keys.openMessageKey(messageId, sender, keyId, wrappedKey)
+
+			if err != nil {
+				return nil, err
+			}
+
+			keyMessageId = messageId
+		}
+
+		fileId, err = key.decrypt(fileId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		uses[fileId]++
+	}
+
+	return uses, rows.Err()
+}
+
+func (e *ErrFileUsageRelayNotPaused) Error() string {
+	return "file usage relay is not paused"
+}
@@ -0,0 +1,200 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+type ErrIdempotencyKeyUsed struct{}
+type ErrIdempotencyKeyMismatch struct{}
+
+type queryGetIdempotentMessage struct{}
+
+func (q queryGetIdempotentMessage) text() string {
+	return `
+	SELECT
+		message_id,
+		message_timestamp,
+		fingerprint
+	FROM idempotency_keys
+	WHERE sender = $1 AND idempotency_key = $2 AND created > $3;
+	`
+}
+
+type queryDeleteExpiredIdempotencyKeys struct{}
+
+func (q queryDeleteExpiredIdempotencyKeys) text() string {
+	return `
+	DELETE FROM idempotency_keys
+	WHERE sender = $1 AND created <= $2;
+	`
+}
+
+type queryCreateIdempotencyKey struct{}
+
+func (q queryCreateIdempotencyKey) text() string {
+	return `
+	INSERT INTO idempotency_keys (sender, idempotency_key, fingerprint, message_id, message_timestamp, created)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (sender, idempotency_key) DO NOTHING;
+	`
+}
+
+// Broadcast messages (see saveBroadcastIdempotencyKey) in the order of recipients.
+type queryGetIdempotentBroadcast struct{}
+
+func (q queryGetIdempotentBroadcast) text() string {
+	return `
+	SELECT
+		m.receiver,
+		k.message_id,
+		k.message_timestamp
+	FROM idempotency_key_messages AS k
+		JOIN messages AS m
+		ON m.id = k.message_id
+	WHERE k.sender = $1 AND k.idempotency_key = $2
+	ORDER BY k.message_id;
+	`
+}
+
+type queryCreateIdempotencyKeyMessages struct{}
+
+func (q queryCreateIdempotencyKeyMessages) text() string {
+	return `
+	INSERT INTO idempotency_key_messages (sender, idempotency_key, message_id, message_timestamp)
+	SELECT $1, $2, m.id, m.message_timestamp
+	FROM unnest($3::bigint[], $4::bigint[]) AS m(id, message_timestamp);
+	`
+}
+
+// Returns the message previously created by the request with the same idempotency key (if any).
+func (s *Storage) MessageByIdempotencyKey(ctx context.Context, sender string, key *models.IdempotencyKey) (id int64, timestamp int64, err error) {
+	var fingerprint string
+	notExpired := storage.IdempotencyKeysExpiredBefore(s.cfg.idempotencyKeyTTL)
+	err = s.db.QueryRow(ctx, queryGetIdempotentMessage{}.text(), sender, key.Key, notExpired).Scan(&id, &timestamp, &fingerprint)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, 0, nil
+		}
+
+		return 0, 0, err
+	}
+
+	if !storage.FingerprintMatches(fingerprint, key) {
+		return 0, 0, &ErrIdempotencyKeyMismatch{}
+	}
+
+	return id, timestamp, nil
+}
+
+// Returns the broadcast messages previously created by the request with the same idempotency key (if any).
+func (s *Storage) BroadcastByIdempotencyKey(ctx context.Context, sender string, key *models.IdempotencyKey) (*models.SentMessagesV1, error) {
+	id, _, err := s.MessageByIdempotencyKey(ctx, sender, key)
+
+	if err != nil || id == 0 {
+		return nil, err
+	}
+
+	var rows pgx.Rows
+	rows, err = s.db.Query(ctx, queryGetIdempotentBroadcast{}.text(), sender, key.Key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	sent := &models.SentMessagesV1{}
+
+	for rows.Next() {
+		info := &models.SentMessageInfoV1{}
+		err = rows.Scan(&info.To, &info.Id, &info.Timestamp)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sent.Messages = append(sent.Messages, info)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	sent.Total = len(sent.Messages)
+
+	return sent, nil
+}
+
+func (s *Storage) saveIdempotencyKey(ctx context.Context, tx pgx.Tx, sender string, key *models.IdempotencyKey, id, timestamp int64) error {
+	now := time.Now().UTC()
+	batch := &pgx.Batch{}
+	batch.Queue(queryDeleteExpiredIdempotencyKeys{}.text(), sender, now.Add(-s.cfg.idempotencyKeyTTL))
+	batch.Queue(queryCreateIdempotencyKey{}.text(), sender, key.Key, key.Fingerprint, id, timestamp, now)
+
+	results := tx.SendBatch(ctx, batch)
+	defer results.Close()
+
+	_, err := results.Exec()
+
+	if err != nil {
+		return fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+
+	var result pgconn.CommandTag
+	result, err = results.Exec()
+
+	if err != nil {
+		return fmt.Errorf("failed to save idempotency key: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return &ErrIdempotencyKeyUsed{} // concurrent request with the same key
+	}
+
+	return nil
+}
+
+// The key itself refers to the first message, whereas all the messages are saved separately.
+func (s *Storage) saveBroadcastIdempotencyKey(ctx context.Context, tx pgx.Tx, sender string, key *models.IdempotencyKey,
+	sent *models.SentMessagesV1) error {
+	err := s.saveIdempotencyKey(ctx, tx, sender, key, sent.Messages[0].Id, sent.Messages[0].Timestamp)
+
+	if err != nil {
+		return err
+	}
+
+	ids, timestamps := storage.SentMessageIds(sent)
+
+	_, err = tx.Exec(ctx, queryCreateIdempotencyKeyMessages{}.text(), sender, key.Key, ids, timestamps)
+
+	if err != nil {
+		return fmt.Errorf("failed to save idempotency key messages: %w", err)
+	}
+
+	return nil
+}
+
+func (e *ErrIdempotencyKeyUsed) Error() string {
+	return "idempotency key has already been used"
+}
+
+func (e *ErrIdempotencyKeyUsed) ImplementsIdempotencyKeyUsedError() {
+}
+
+func (e *ErrIdempotencyKeyMismatch) Error() string {
+	return "idempotency key has already been used for another request"
+}
+
+func (e *ErrIdempotencyKeyMismatch) ImplementsIdempotencyKeyMismatchError() {
+}
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/events"
+)
+
+type queryWriteMessageEvent struct{}
+
+func (q queryWriteMessageEvent) text() string {
+	return `
+	INSERT INTO message_events (event_type, message_id, event_timestamp, sender, receiver, created)
+	VALUES ($1, $2, $3, $4, $5, $6);
+	`
+}
+
+type queryWriteBroadcastEvents struct{}
+
+func (q queryWriteBroadcastEvents) text() string {
+	return `
+	INSERT INTO message_events (event_type, message_id, event_timestamp, sender, receiver, created)
+	SELECT 'MessageCreated', id, event_timestamp, sender, receiver, $2
+	FROM messages
+	WHERE id = ANY($1::bigint[])
+	ORDER BY id;
+	`
+}
+
+// Locked events are skipped, so several replicas relay different events at the same time.
+type queryGetPendingMessageEvents struct{}
+
+func (q queryGetPendingMessageEvents) text() string {
+	return `
+	SELECT id, event_type, message_id, event_timestamp, sender, receiver
+	FROM message_events
+	WHERE delivered IS NULL
+	ORDER BY id
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED;
+	`
+}
+
+type queryMarkMessageEventsDelivered struct{}
+
+func (q queryMarkMessageEventsDelivered) text() string {
+	return `
+	UPDATE message_events SET
+		delivered = $2
+	WHERE id = ANY($1::bigint[]);
+	`
+}
+
+type queryDeleteDeliveredMessageEvents struct{}
+
+func (q queryDeleteDeliveredMessageEvents) text() string {
+	return `
+	DELETE FROM message_events
+	WHERE delivered < $1;
+	`
+}
+
+func queueMessageEvent(batch *pgx.Batch, event *events.Event) {
+	batch.Queue(queryWriteMessageEvent{}.text(),
+		string(event.Type), event.MessageId, event.Timestamp, event.Sender, event.Receiver, time.Now().UTC())
+}
+
+type pendingMessageEvent struct {
+	id    int64
+	event *events.Event
+}
+
+// Events are locked while they are published, see RelayFileUsage.
+func (s *Storage) RelayMessageEvents(ctx context.Context, limit int, publish func(event *events.Event) error) (relayed int, err error) {
+	var tx pgx.Tx
+	tx, err = s.db.Begin(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var pending []pendingMessageEvent
+	pending, err = pendingMessageEvents(ctx, tx, limit)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pending message events: %w", err)
+	}
+
+	delivered := make([]int64, 0, len(pending))
+	var publishErr error
+
+	for _, p := range pending {
+		publishErr = publish(p.event)
+
+		if publishErr != nil {
+			break
+		}
+
+		delivered = append(delivered, p.id)
+	}
+
+	if len(delivered) != 0 {
+		_, err = tx.Exec(ctx, queryMarkMessageEventsDelivered{}.text(), delivered, time.Now().UTC())
+
+		if err != nil {
+			return 0, fmt.Errorf("failed to mark message events delivered: %w", err)
+		}
+
+		err = tx.Commit(ctx)
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(delivered), publishErr
+}
+
+func pendingMessageEvents(ctx context.Context, tx pgx.Tx, limit int) (pending []pendingMessageEvent, err error) {
+	var rows pgx.Rows
+	rows, err = tx.Query(ctx, queryGetPendingMessageEvents{}.text(), limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventType string
+		p := pendingMessageEvent{event: &events.Event{}}
+		err = rows.Scan(&p.id, &eventType, &p.event.MessageId, &p.event.Timestamp, &p.event.Sender, &p.event.Receiver)
+
+		if err != nil {
+			return nil, err
+		}
+
+		p.event.Type = events.Type(eventType)
+		pending = append(pending, p)
+	}
+
+	return pending, rows.Err()
+}
+
+func (s *Storage) DeleteDeliveredMessageEvents(ctx context.Context, before time.Time) error {
+	_, err := s.db.Exec(ctx, queryDeleteDeliveredMessageEvents{}.text(), before)
+	return err
+}
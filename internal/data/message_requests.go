@@ -0,0 +1,297 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+type ErrRecipientNotAccepting struct {
+	recipient string
+}
+type ErrMessageRequestNotFound struct{}
+
+// Conversation state from the point of view of the user.
+const (
+	conversationAccepted  = "accepted"
+	conversationRequested = "requested" // counterpart's messages are message requests
+	conversationDeclined  = "declined"
+)
+
+type queryGetConversationState struct{}
+
+func (q queryGetConversationState) text() string {
+	return `
+	SELECT state
+	FROM conversations
+	WHERE user_id = $1 AND counterpart = $2
+	FOR SHARE;
+	`
+}
+
+type queryGetConversationStateForUpdate struct{}
+
+func (q queryGetConversationStateForUpdate) text() string {
+	return `
+	SELECT state
+	FROM conversations
+	WHERE user_id = $1 AND counterpart = $2
+	FOR UPDATE;
+	`
+}
+
+type queryCreateConversation struct{}
+
+func (q queryCreateConversation) text() string {
+	return `
+	INSERT INTO conversations (user_id, counterpart, state, created, event_timestamp)
+	VALUES ($1, $2, $3, $4, nextval('timeline'))
+	ON CONFLICT (user_id, counterpart) DO NOTHING;
+	`
+}
+
+type queryUpdateConversationState struct{}
+
+func (q queryUpdateConversationState) text() string {
+	return `
+	UPDATE conversations SET
+		state = $3,
+		event_timestamp = nextval('timeline')
+	WHERE user_id = $1 AND counterpart = $2 AND state <> $3
+	RETURNING event_timestamp;
+	`
+}
+
+// Turns message requests into ordinary messages and writes them to the user's timeline,
+// so they are received by the user's clients while syncing.
+type queryReleaseRequestMessages struct{}
+
+func (q queryReleaseRequestMessages) text() string {
+	return `
+	WITH released AS (
+		UPDATE messages SET
+			is_request = false
+		WHERE sender = $2 AND receiver = $1 AND is_request
+		RETURNING id
+	)
+	INSERT INTO updates (user_id, event_timestamp, message_id)
+	SELECT $1, nextval('timeline'), id
+	FROM (
+		SELECT id
+		FROM released
+		ORDER BY id
+	) AS requests;
+	`
+}
+
+type queryGetMessageRequestsV1 struct{}
+
+func (q queryGetMessageRequestsV1) text() string {
+	return `
+	SELECT
+		c.counterpart,
+		COUNT(m.id),
+		c.created,
+		c.event_timestamp
+	FROM conversations AS c
+		LEFT OUTER JOIN messages AS m
+		ON m.sender = c.counterpart
+			AND m.receiver = c.user_id
+			AND m.is_request
+			AND COALESCE(m.is_deleted, false) = false
+	WHERE c.user_id = $1 AND c.state = 'requested'
+		AND NOT EXISTS (
+			SELECT 1 FROM blocks AS b
+			WHERE b.user_id = $1 AND b.blocked_user = c.counterpart
+		)
+	GROUP BY c.counterpart, c.created, c.event_timestamp
+	ORDER BY MAX(m.id) DESC NULLS LAST, c.counterpart;
+	`
+}
+
+// Checks whether the receiver accepts messages from the sender, starting a new message request if needed.
+// Must be called before the message is created.
+func (s *Storage) checkReceiverAccepts(ctx context.Context, tx pgx.Tx, sender, receiver string) (isRequest bool, err error) {
+	var setting string
+	err = tx.QueryRow(ctx, queryGetIncomingMessagesSetting{}.text(), receiver).Scan(&setting)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get incoming messages setting: %w", err)
+	}
+
+	if setting == models.IncomingMessagesNobody {
+		return false, &ErrRecipientNotAccepting{recipient: receiver}
+	}
+
+	var state string
+	err = tx.QueryRow(ctx, queryGetConversationState{}.text(), receiver, sender).Scan(&state)
+
+	switch {
+	case err == pgx.ErrNoRows:
+		if setting != models.IncomingMessagesEveryone {
+			return false, &ErrRecipientNotAccepting{recipient: receiver}
+		}
+
+		_, err = tx.Exec(ctx, queryCreateConversation{}.text(),
+			receiver, sender, conversationRequested, time.Now().UTC())
+
+		if err != nil {
+			return false, fmt.Errorf("failed to create message request: %w", err)
+		}
+
+		return true, nil
+	case err != nil:
+		return false, fmt.Errorf("failed to get conversation state: %w", err)
+	case state == conversationDeclined:
+		return false, &ErrRecipientNotAccepting{recipient: receiver}
+	}
+
+	return state == conversationRequested, nil
+}
+
+// Marks the conversation as accepted by the user. If there was a message request
+// (even declined one), its messages become ordinary ones.
+func (s *Storage) acceptConversation(ctx context.Context, tx pgx.Tx, userId, counterpart string) (err error) {
+	var timestamp int64
+	err = tx.QueryRow(ctx, queryUpdateConversationState{}.text(),
+		userId, counterpart, conversationAccepted).Scan(&timestamp)
+
+	if err == pgx.ErrNoRows {
+		_, err = tx.Exec(ctx, queryCreateConversation{}.text(),
+			userId, counterpart, conversationAccepted, time.Now().UTC())
+
+		if err != nil {
+			return fmt.Errorf("failed to create conversation: %w", err)
+		}
+
+		return nil // already accepted or there was no request
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to accept conversation: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, queryReleaseRequestMessages{}.text(), userId, counterpart)
+
+	if err != nil {
+		return fmt.Errorf("failed to release message request from '%s': %w", counterpart, err)
+	}
+
+	_, err = tx.Exec(ctx, queryWriteUserUpdate{}.text(), userId, timestamp, models.UpdateTypeRequest, counterpart)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' update: %w", userId, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) AnswerMessageRequest(ctx context.Context, userId, sender string, accepted bool) (err error) {
+	var tx pgx.Tx
+	tx, err = s.db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var state string
+	err = tx.QueryRow(ctx, queryGetConversationStateForUpdate{}.text(), userId, sender).Scan(&state)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return &ErrMessageRequestNotFound{}
+		}
+
+		return fmt.Errorf("failed to get conversation state: %w", err)
+	}
+
+	if state != conversationRequested {
+		return &ErrMessageRequestNotFound{}
+	}
+
+	if accepted {
+		err = s.acceptConversation(ctx, tx, userId, sender)
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit(ctx)
+	}
+
+	var timestamp int64
+	err = tx.QueryRow(ctx, queryUpdateConversationState{}.text(),
+		userId, sender, conversationDeclined).Scan(&timestamp)
+
+	if err != nil {
+		return fmt.Errorf("failed to decline message request: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, queryWriteUserUpdate{}.text(), userId, timestamp, models.UpdateTypeRequest, sender)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' update: %w", userId, err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *Storage) MessageRequestsV1(ctx context.Context, userId string) (*models.MessageRequestsV1, error) {
+	rows, err := s.db.Query(ctx, queryGetMessageRequestsV1{}.text(), userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	requests := &models.MessageRequestsV1{Requests: make([]*models.MessageRequestInfoV1, 0)}
+
+	for rows.Next() {
+		info := &models.MessageRequestInfoV1{}
+		var created time.Time
+		err = rows.Scan(&info.User, &info.Messages, &created, &info.Timestamp)
+
+		if err != nil {
+			return nil, err
+		}
+
+		info.Created = storage.UtcTime(&created)
+		requests.Requests = append(requests.Requests, info)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	requests.Total = len(requests.Requests)
+
+	return requests, nil
+}
+
+func (e *ErrRecipientNotAccepting) Error() string {
+	return "receiver does not accept messages from the sender"
+}
+
+func (e *ErrRecipientNotAccepting) ImplementsRecipientNotAcceptingError() {
+}
+
+func (e *ErrRecipientNotAccepting) Recipient() string {
+	return e.recipient
+}
+
+func (e *ErrMessageRequestNotFound) Error() string {
+	return "message request not found"
+}
+
+func (e *ErrMessageRequestNotFound) ImplementsMessageRequestNotFoundError() {
+}
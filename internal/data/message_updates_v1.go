@@ -11,17 +11,26 @@ type queryGetMessageUpdatesV1 struct{}
 func (q queryGetMessageUpdatesV1) text() string {
 	return `
 	SELECT
-		event_timestamp,
-		message_id
-	FROM updates
-	WHERE user_id = $1 AND event_timestamp > $2
-	ORDER BY event_timestamp ASC
+		u.event_timestamp,
+		u.message_id
+	FROM updates AS u
+		JOIN messages AS m
+		ON m.id = u.message_id
+	WHERE u.user_id = $1 AND u.event_timestamp > $2
+		AND u.entry_type = 'message'
+		AND NOT EXISTS (
+			SELECT 1 FROM blocks AS b
+			WHERE b.user_id = $1
+				AND b.hide_conversation
+				AND b.blocked_user IN (m.sender, m.receiver)
+		)
+	ORDER BY u.event_timestamp ASC
 	LIMIT $3;
 	`
 }
 
 func (s *Storage) MessageUpdatesV1(ctx context.Context, userId string, after int64, limit int) (*models.MessageUpdatesV1, error) {
-	rows, err := s.queries[queryGetMessageUpdatesV1{}].QueryContext(ctx, userId, after, limit)
+	rows, err := s.db.Query(ctx, queryGetMessageUpdatesV1{}.text(), userId, after, limit)
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,309 @@
+package data
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Database schema is defined by the migrations applied in the order of their versions,
+// file names are 'version_description.sql' (e.g. '0002_message_reactions.sql').
+// Applied migrations must never be changed, any schema change requires a new migration.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Arbitrary key of the session-level advisory lock, which serializes migrations of the service replicas.
+const migrationsLock = 4_202_306_211
+
+type migration struct {
+	version int
+	name    string
+	script  string
+}
+
+type queryLockMigrations struct{}
+
+func (q queryLockMigrations) text() string {
+	return `
+	SELECT pg_advisory_lock($1);
+	`
+}
+
+type queryUnlockMigrations struct{}
+
+func (q queryUnlockMigrations) text() string {
+	return `
+	SELECT pg_advisory_unlock($1);
+	`
+}
+
+type queryCreateMigrationsTable struct{}
+
+func (q queryCreateMigrationsTable) text() string {
+	return `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		name varchar(255) NOT NULL,
+		applied timestamp NOT NULL
+	);
+	`
+}
+
+type queryGetAppliedMigrations struct{}
+
+func (q queryGetAppliedMigrations) text() string {
+	return `
+	SELECT version
+	FROM schema_migrations;
+	`
+}
+
+// Databases created before the migrations were introduced (by init.sql of the storage image)
+// already have the initial schema, so it must not be applied again.
+type queryCheckSchemaExists struct{}
+
+func (q queryCheckSchemaExists) text() string {
+	return `
+	SELECT to_regclass('messages') IS NOT NULL;
+	`
+}
+
+type queryRecordMigration struct{}
+
+func (q queryRecordMigration) text() string {
+	return `
+	INSERT INTO schema_migrations (version, name, applied)
+	VALUES ($1, $2, (now() at time zone 'utc'));
+	`
+}
+
+// Migrate applies pending migrations to the database specified by the storage settings
+// (as Storage.Open does), so the schema can be upgraded before the service is deployed.
+func Migrate(ctx context.Context) (applied int, err error) {
+	s := &Storage{cfg: &config{}}
+	s.cfg.Read()
+
+	err = s.connectToDatabase(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer s.db.Close()
+
+	return s.migrate(ctx)
+}
+
+// Each migration is applied in its own transaction. All of them use the same connection,
+// since advisory lock belongs to the database session.
+func (s *Storage) migrate(ctx context.Context) (applied int, err error) {
+	var all []migration
+	all, err = migrations()
+
+	if err != nil {
+		return 0, err
+	}
+
+	var conn *pgxpool.Conn
+	conn, err = s.db.Acquire(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, queryLockMigrations{}.text(), migrationsLock)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock migrations: %w", err)
+	}
+
+	defer conn.Exec(context.Background(), queryUnlockMigrations{}.text(), migrationsLock)
+
+	var done map[int]bool
+	done, err = appliedMigrations(ctx, conn)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(done) == 0 {
+		err = baselineMigrations(ctx, conn, all[0], done)
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for _, m := range all {
+		if done[m.version] {
+			continue
+		}
+
+		err = applyMigration(ctx, conn, m)
+
+		if err != nil {
+			return applied, err
+		}
+
+		applied++
+		log.Info().Msg(fmt.Sprintf("Migration %04d '%s' applied.", m.version, m.name))
+	}
+
+	latest := all[len(all)-1].version
+
+	for version := range done {
+		if version > latest {
+			log.Warn().Msg(fmt.Sprintf("Database schema version %d is newer than the latest known migration %d.", version, latest))
+			break
+		}
+	}
+
+	return applied, nil
+}
+
+func appliedMigrations(ctx context.Context, conn *pgxpool.Conn) (map[int]bool, error) {
+	_, err := conn.Exec(ctx, queryCreateMigrationsTable{}.text())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var rows pgx.Rows
+	rows, err = conn.Query(ctx, queryGetAppliedMigrations{}.text())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+
+	defer rows.Close()
+
+	done := make(map[int]bool)
+
+	for rows.Next() {
+		var version int
+		err = rows.Scan(&version)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+		}
+
+		done[version] = true
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+
+	return done, nil
+}
+
+// Records the initial migration as applied if the schema exists.
+func baselineMigrations(ctx context.Context, conn *pgxpool.Conn, initial migration, done map[int]bool) error {
+	var exists bool
+	err := conn.QueryRow(ctx, queryCheckSchemaExists{}.text()).Scan(&exists)
+
+	if err != nil {
+		return fmt.Errorf("failed to check database schema: %w", err)
+	}
+
+	if !exists {
+		return nil
+	}
+
+	_, err = conn.Exec(ctx, queryRecordMigration{}.text(), initial.version, initial.name)
+
+	if err != nil {
+		return fmt.Errorf("failed to record migration %04d: %w", initial.version, err)
+	}
+
+	done[initial.version] = true
+	log.Info().Msg(fmt.Sprintf("Existing database schema is recorded as migration %04d '%s'.", initial.version, initial.name))
+
+	return nil
+}
+
+func applyMigration(ctx context.Context, conn *pgxpool.Conn, m migration) (err error) {
+	var tx pgx.Tx
+	tx, err = conn.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, m.script) // no arguments, so the script may contain multiple statements
+
+	if err == nil {
+		_, err = tx.Exec(ctx, queryRecordMigration{}.text(), m.version, m.name)
+	}
+
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to apply migration %04d '%s': %w", m.version, m.name, err)
+	}
+
+	return nil
+}
+
+// Embedded migrations ordered by version, which must be unique and consecutive starting from 1.
+func migrations() ([]migration, error) {
+	files, err := migrationFiles.ReadDir("migrations")
+
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]migration, 0, len(files))
+
+	for _, file := range files {
+		version, name, ok := strings.Cut(strings.TrimSuffix(file.Name(), ".sql"), "_")
+		m := migration{name: name}
+		m.version, err = strconv.Atoi(version)
+
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid migration file name '%s'", file.Name())
+		}
+
+		var script []byte
+		script, err = migrationFiles.ReadFile(path.Join("migrations", file.Name()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		m.script = string(script)
+		all = append(all, m)
+	}
+
+	if len(all) == 0 {
+		return nil, errors.New("no migrations found")
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].version < all[j].version })
+
+	for i, m := range all {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration %04d '%s' is out of order (expected version %d)", m.version, m.name, i+1)
+		}
+	}
+
+	return all, nil
+}
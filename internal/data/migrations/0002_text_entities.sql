@@ -0,0 +1,2 @@
+-- Formatting of message text (newPersonalMessage.v2), messages sent before have plain text only.
+ALTER TABLE messages ADD COLUMN text_entities jsonb;
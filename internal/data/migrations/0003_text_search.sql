@@ -0,0 +1,9 @@
+-- Full-text search of messages (GET /messages/search).
+ALTER TABLE messages ADD COLUMN text_search tsvector;
+
+UPDATE messages SET
+    text_search = to_tsvector('simple', message_text)
+WHERE message_text IS NOT NULL AND NOT COALESCE(is_deleted, false);
+
+CREATE INDEX messages_receiver_idx ON messages (receiver);
+CREATE INDEX messages_text_search_idx ON messages USING GIN (text_search);
@@ -0,0 +1,22 @@
+-- Shared files of conversations are listed in the order of attaching,
+-- existing attachments are numbered in the order of their messages.
+CREATE INDEX messages_conversation_idx ON messages (sender, receiver);
+
+CREATE SEQUENCE attachments_id_seq AS bigint;
+
+ALTER TABLE attachments ADD COLUMN id bigint;
+
+UPDATE attachments a SET
+    id = ordered.id
+FROM (
+    SELECT ctid, nextval('attachments_id_seq') AS id
+    FROM (SELECT ctid FROM attachments ORDER BY message_id) AS sorted
+) AS ordered
+WHERE a.ctid = ordered.ctid;
+
+ALTER TABLE attachments
+    ALTER COLUMN id SET DEFAULT nextval('attachments_id_seq'),
+    ALTER COLUMN id SET NOT NULL,
+    ADD PRIMARY KEY (id);
+
+ALTER SEQUENCE attachments_id_seq OWNED BY attachments.id;
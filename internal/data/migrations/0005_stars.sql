@@ -0,0 +1,9 @@
+-- Per-user starred messages.
+CREATE TABLE stars (
+    user_id varchar(50) NOT NULL,
+    message_id bigint REFERENCES messages(id) NOT NULL,
+    event_timestamp bigint NOT NULL,
+    PRIMARY KEY (user_id, message_id)
+);
+
+CREATE INDEX stars_timeline_idx ON stars (user_id, event_timestamp);
@@ -0,0 +1,15 @@
+-- Blocked users. Timeline gets entries of other types than messages (e.g. blocks),
+-- existing entries are messages.
+ALTER TABLE updates
+    ALTER COLUMN message_id DROP NOT NULL,
+    ADD COLUMN entry_type varchar(20) NOT NULL DEFAULT 'message',
+    ADD COLUMN counterpart varchar(50);
+
+CREATE TABLE blocks (
+    user_id varchar(50) NOT NULL,
+    blocked_user varchar(50) NOT NULL,
+    hide_conversation boolean NOT NULL,
+    created timestamp NOT NULL,
+    event_timestamp bigint NOT NULL,
+    PRIMARY KEY (user_id, blocked_user)
+);
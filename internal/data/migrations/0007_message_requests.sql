@@ -0,0 +1,33 @@
+-- Incoming messages settings and message requests, existing messages are ordinary ones.
+ALTER TABLE messages ADD COLUMN is_request boolean NOT NULL DEFAULT false;
+
+CREATE TABLE settings (
+    user_id varchar(50) PRIMARY KEY,
+    incoming_messages varchar(20) NOT NULL
+);
+
+CREATE TABLE conversations (
+    user_id varchar(50) NOT NULL,
+    counterpart varchar(50) NOT NULL,
+    state varchar(20) NOT NULL,
+    created timestamp NOT NULL,
+    event_timestamp bigint NOT NULL,
+    PRIMARY KEY (user_id, counterpart)
+);
+
+CREATE INDEX conversations_state_idx ON conversations (user_id, state);
+
+-- Existing conversations are accepted by both participants,
+-- otherwise the next message in them would become a message request.
+INSERT INTO conversations (user_id, counterpart, state, created, event_timestamp)
+SELECT user_id, counterpart, 'accepted', created, nextval('timeline')
+FROM (
+    SELECT user_id, counterpart, COALESCE(MIN(created), now() at time zone 'utc') AS created
+    FROM (
+        SELECT sender AS user_id, receiver AS counterpart, created FROM messages
+        UNION ALL
+        SELECT receiver, sender, created FROM messages
+    ) AS participants
+    GROUP BY user_id, counterpart
+    ORDER BY user_id, counterpart
+) AS pairs;
@@ -0,0 +1,5 @@
+-- Muted and archived conversations.
+ALTER TABLE conversations
+    ADD COLUMN muted boolean NOT NULL DEFAULT false,
+    ADD COLUMN muted_until timestamp,
+    ADD COLUMN archived boolean NOT NULL DEFAULT false;
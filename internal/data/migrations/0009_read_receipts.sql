@@ -0,0 +1,7 @@
+-- Read state visible to the sender (read receipts may be hidden by the receiver).
+-- Messages read before were read with the receipt, otherwise their senders would see them as unread.
+ALTER TABLE messages ADD COLUMN read_receipt boolean;
+
+UPDATE messages SET read_receipt = is_read;
+
+ALTER TABLE settings ADD COLUMN hide_read_receipts boolean NOT NULL DEFAULT false;
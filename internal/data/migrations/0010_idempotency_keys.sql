@@ -0,0 +1,21 @@
+-- Idempotency keys of sent messages (Idempotency-Key header).
+CREATE TABLE idempotency_keys (
+    sender varchar(50) NOT NULL,
+    idempotency_key varchar(255) NOT NULL,
+    fingerprint varchar(64) NOT NULL,
+    message_id bigint REFERENCES messages(id) NOT NULL,
+    message_timestamp bigint NOT NULL,
+    created timestamp NOT NULL,
+    PRIMARY KEY (sender, idempotency_key)
+);
+
+-- Messages created by the broadcast requests with idempotency keys
+-- (the key itself refers to the first of them).
+CREATE TABLE idempotency_key_messages (
+    sender varchar(50) NOT NULL,
+    idempotency_key varchar(255) NOT NULL,
+    message_id bigint REFERENCES messages(id) NOT NULL,
+    message_timestamp bigint NOT NULL,
+    PRIMARY KEY (sender, idempotency_key, message_id),
+    FOREIGN KEY (sender, idempotency_key) REFERENCES idempotency_keys ON DELETE CASCADE
+);
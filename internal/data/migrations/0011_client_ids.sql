@@ -0,0 +1,4 @@
+-- Client-generated message ids.
+ALTER TABLE messages ADD COLUMN client_id uuid;
+
+CREATE UNIQUE INDEX messages_client_id_idx ON messages (sender, client_id);
@@ -0,0 +1,9 @@
+-- Structured message content (polls, locations) and poll votes.
+ALTER TABLE messages ADD COLUMN content jsonb;
+
+CREATE TABLE poll_votes (
+    message_id bigint REFERENCES messages(id) NOT NULL,
+    user_id varchar(50) NOT NULL,
+    option_index int NOT NULL,
+    PRIMARY KEY (message_id, user_id, option_index)
+);
@@ -0,0 +1,2 @@
+-- End-to-end encrypted messages, the service stores their envelopes as is.
+ALTER TABLE messages ADD COLUMN envelope jsonb;
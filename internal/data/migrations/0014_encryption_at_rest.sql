@@ -0,0 +1,22 @@
+-- Message text, text entities, content and attachments encrypted at rest with per-message data keys wrapped with master keys.
+-- Data keys and encrypted data are bound to the message id and sender, so they cannot be moved to other messages.
+-- Existing messages stay plain text until encrypted by 'app rotate-keys'.
+
+-- Encrypted messages are not indexed for the search at all: even without positions,
+-- the words of the message could be restored from the search index.
+CREATE FUNCTION searchable_text(message_text text, encrypted boolean) RETURNS tsvector AS $$
+    SELECT CASE WHEN encrypted THEN NULL ELSE to_tsvector('simple', message_text) END;
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- Encrypted text entities and content are base64 text, so they are not stored as jsonb anymore.
+ALTER TABLE messages
+    ALTER COLUMN text_entities TYPE text,
+    ALTER COLUMN content TYPE text,
+    ADD COLUMN text_digest bytea,
+    ADD COLUMN entities_digest bytea,
+    ADD COLUMN key_id varchar(64),
+    ADD COLUMN data_key bytea;
+
+ALTER TABLE attachments
+    ALTER COLUMN file_id TYPE varchar(100),
+    ADD COLUMN file_digest bytea;
@@ -0,0 +1,25 @@
+-- File usage events are written in the same transactions as the attachments
+-- and relayed to the files usage statistics (internal/outbox). File ids are encrypted the same way
+-- as attachments, events written at once share a data key. Delivered events are deleted (MSG_OUTBOX_RETENTION).
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    file_id varchar(100) NOT NULL,
+    in_use boolean NOT NULL,
+    key_id varchar(64),
+    data_key bytea,
+    created timestamp NOT NULL,
+    delivered timestamp
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (id) WHERE delivered IS NULL;
+CREATE INDEX outbox_delivered_idx ON outbox (delivered);
+
+-- File usage events are not relayed while the relay is paused ('app pause-file-usage'), so the counters
+-- exported from the files usage statistics stay consistent with the outbox until they are reconciled.
+-- The only row is locked by the relay while it sends events, so pausing waits for the events being sent.
+CREATE TABLE file_usage_relay (
+    id boolean PRIMARY KEY DEFAULT true CHECK (id),
+    paused timestamp
+);
+
+INSERT INTO file_usage_relay DEFAULT VALUES;
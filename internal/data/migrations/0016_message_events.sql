@@ -0,0 +1,15 @@
+-- Domain events of the messages (internal/events) are written in the same transactions as the changes
+-- and relayed to the message broker (internal/outbox).
+CREATE TABLE message_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_type varchar(30) NOT NULL,
+    message_id bigint NOT NULL,
+    event_timestamp bigint NOT NULL,
+    sender varchar(50) NOT NULL,
+    receiver varchar(50) NOT NULL,
+    created timestamp NOT NULL,
+    delivered timestamp
+);
+
+CREATE INDEX message_events_pending_idx ON message_events (id) WHERE delivered IS NULL;
+CREATE INDEX message_events_delivered_idx ON message_events (delivered);
@@ -0,0 +1,34 @@
+-- Webhook subscriptions to the users' timelines (internal/webhooks). Secrets are encrypted
+-- the same way as messages (with a data key per webhook bound to it), if encryption is enabled.
+CREATE TABLE webhooks (
+    id BIGSERIAL PRIMARY KEY,
+    user_id varchar(50) NOT NULL,
+    url varchar(2000) NOT NULL,
+    secret varchar(200) NOT NULL,
+    key_id varchar(64),
+    data_key bytea,
+    enabled boolean NOT NULL DEFAULT true,
+    auto_disabled boolean NOT NULL DEFAULT false,
+    after_timestamp bigint NOT NULL,
+    failures integer NOT NULL DEFAULT 0,
+    next_attempt timestamp NOT NULL,
+    created timestamp NOT NULL
+);
+
+CREATE INDEX webhooks_user_idx ON webhooks (user_id);
+CREATE INDEX webhooks_due_idx ON webhooks (next_attempt) WHERE enabled;
+
+CREATE TABLE webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id bigint REFERENCES webhooks(id) ON DELETE CASCADE NOT NULL,
+    attempted timestamp NOT NULL,
+    after_timestamp bigint NOT NULL,
+    last_timestamp bigint NOT NULL,
+    updates integer NOT NULL,
+    delivered boolean NOT NULL,
+    status integer,
+    error text,
+    duration integer NOT NULL
+);
+
+CREATE INDEX webhook_deliveries_idx ON webhook_deliveries (webhook_id, id);
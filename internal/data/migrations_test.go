@@ -0,0 +1,188 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+func TestMigrations(t *testing.T) {
+	all, err := migrations()
+
+	require.NoError(t, err)
+	require.NotEmpty(t, all)
+	require.Equal(t, "initial_schema", all[0].name)
+
+	for i, m := range all {
+		require.Equal(t, i+1, m.version)
+		require.NotEmpty(t, m.script)
+	}
+}
+
+// Requires running database (see compose-debug.yaml), skipped otherwise. Databases are created
+// for the test only: one from the original schema (init.sql of the first storage image) with some data,
+// and an empty one, both are migrated by the storage and must end up with the same schema.
+func TestMigrate_initialSchemaUpgraded(t *testing.T) {
+	ctx := context.Background()
+	upgraded := createTestDatabase(t, "upgraded")
+	fresh := createTestDatabase(t, "fresh")
+
+	all, err := migrations()
+	require.NoError(t, err)
+
+	db := connectTestDatabase(t, upgraded)
+	_, err = db.Exec(ctx, all[0].script)
+	require.NoError(t, err)
+
+	var read, unread int64
+	read, unread = createInitialSchemaMessages(t, db)
+
+	s := openTestDatabase(t, upgraded)
+	openTestDatabase(t, fresh)
+
+	var applied int
+	err = db.QueryRow(ctx, "SELECT count(*) FROM schema_migrations;").Scan(&applied)
+	require.NoError(t, err)
+	require.Equal(t, len(all), applied)
+
+	require.Equal(t, schemaOf(t, connectTestDatabase(t, fresh)), schemaOf(t, db))
+
+	var found bool
+	err = db.QueryRow(ctx, "SELECT text_search @@ to_tsquery('simple', 'hello') FROM messages WHERE id = $1;", read).Scan(&found)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	updates, err := s.MessageUpdatesV1(ctx, "john", 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, updates.Total)
+
+	message, err := s.PersonalMessageV1(ctx, "john", unread)
+	require.NoError(t, err)
+	require.Equal(t, []string{"000000000000000000000001"}, message.Files)
+
+	// The sender sees messages read before read receipts as read.
+	message, err = s.PersonalMessageV1(ctx, "jane", read)
+	require.NoError(t, err)
+	require.True(t, message.Read)
+
+	files, err := s.SharedFilesV1(ctx, "jane", "john", 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, files.Total)
+
+	// Existing conversation is accepted, so the next message is not a message request.
+	_, _, err = s.CreateNewPersonalMessageV1(ctx, "john", &models.NewPersonalMessageV1{To: "jane", Text: "Thanks!"}, nil)
+	require.NoError(t, err)
+
+	updates, err = s.MessageUpdatesV1(ctx, "jane", 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 3, updates.Total)
+}
+
+// Messages from jane to john as the service stored them before the migrations: the read one and the unread one with attachment.
+func createInitialSchemaMessages(t *testing.T, db *pgx.Conn) (read, unread int64) {
+	ctx := context.Background()
+	created := time.Now().UTC()
+
+	for i, text := range []string{"Hello, John!", "See the file."} {
+		var id, timestamp int64
+		err := db.QueryRow(ctx, `
+		INSERT INTO messages (sender, receiver, created, is_read, message_text, is_deleted)
+		VALUES ('jane', 'john', $1, $2, $3, false)
+		RETURNING id, event_timestamp;
+		`, created, i == 0, text).Scan(&id, &timestamp)
+		require.NoError(t, err)
+
+		_, err = db.Exec(ctx, `
+		INSERT INTO updates (user_id, event_timestamp, message_id)
+		VALUES ('jane', $1, $2), ('john', $1, $2);
+		`, timestamp, id)
+		require.NoError(t, err)
+
+		if i == 0 {
+			read = id
+		} else {
+			unread = id
+		}
+	}
+
+	_, err := db.Exec(ctx, "INSERT INTO attachments (message_id, file_id) VALUES ($1, '000000000000000000000001');", unread)
+	require.NoError(t, err)
+
+	return read, unread
+}
+
+// Columns and indexes of the public schema.
+func schemaOf(t *testing.T, db *pgx.Conn) []string {
+	rows, err := db.Query(context.Background(), `
+	SELECT concat_ws(' ', table_name, column_name, data_type, is_nullable, column_default)
+	FROM information_schema.columns
+	WHERE table_schema = 'public'
+	UNION ALL
+	SELECT indexdef
+	FROM pg_indexes
+	WHERE schemaname = 'public'
+	ORDER BY 1;
+	`)
+	require.NoError(t, err)
+
+	schema, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	require.NoError(t, err)
+
+	return schema
+}
+
+func createTestDatabase(t *testing.T, name string) string {
+	admin := connectTestDatabase(t, "")
+	database := fmt.Sprintf("msg_migrations_%s_%d", name, time.Now().UnixNano())
+
+	_, err := admin.Exec(context.Background(), fmt.Sprintf("CREATE DATABASE %s;", database))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		admin.Exec(context.Background(), fmt.Sprintf("DROP DATABASE %s WITH (FORCE);", database))
+	})
+
+	return database
+}
+
+// Connects to the database configured the same way as for the service (MSG_STORAGE_* environment variables),
+// or to the specified one.
+func connectTestDatabase(t *testing.T, database string) *pgx.Conn {
+	cfg := &config{}
+	cfg.Read()
+
+	if database == "" {
+		database = cfg.database
+	}
+
+	db, err := pgx.Connect(context.Background(), cfg.databaseURL(database).String())
+
+	if err != nil {
+		t.Skipf("database is not available: %s", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close(context.Background())
+	})
+
+	return db
+}
+
+func openTestDatabase(t *testing.T, database string) *Storage {
+	t.Setenv(envVarDatabase, database)
+
+	s := &Storage{}
+	require.NoError(t, s.Open())
+
+	t.Cleanup(func() {
+		s.Close(context.Background())
+	})
+
+	return s
+}
@@ -2,39 +2,66 @@ package data
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/events"
 )
 
 type ErrMessageDeleted struct{}
+type ErrMessageNotFound struct{}
 type ErrTimestampIsNotMatch struct{}
 type ErrMessageNotModified struct{}
 
-func (s *Storage) modifyMessage(ctx context.Context, q query, args ...any) (newTimestamp int64, err error) {
-	var (
-		tx                                       *sql.Tx
-		id                                       int64
-		messageDeleted, timestampMatch, modified bool
-		sender, receiver                         string
-	)
+// Changes of the message related data (e.g. attachments) made in the same transaction
+// right after the message itself has been successfully modified. They are queued to the batch
+// which also writes the timeline entries, so the whole batch takes one round trip.
+type relatedChanges func(batch *pgx.Batch, messageId int64) error
+
+func (s *Storage) modifyMessage(ctx context.Context, q query, event events.Type, changes relatedChanges, args ...any) (newTimestamp int64, err error) {
+	var tx pgx.Tx
+	tx, err = s.db.Begin(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	newTimestamp, err = s.modifyMessageInTx(ctx, tx, q, event, changes, args...)
+
+	if err != nil {
+		return 0, err
+	}
 
-	tx, err = s.db.BeginTx(ctx, nil)
+	err = tx.Commit(ctx)
 
 	if err != nil {
 		return 0, err
 	}
 
-	defer tx.Rollback()
+	return newTimestamp, nil
+}
 
-	err = tx.Stmt(s.queries[q]).QueryRowContext(ctx, args...).Scan(
+// Modifies the message in the transaction started by the caller (e.g. after checks that must be consistent
+// with the modification), which is responsible for committing it.
+func (s *Storage) modifyMessageInTx(ctx context.Context, tx pgx.Tx, q query, event events.Type, changes relatedChanges, args ...any) (newTimestamp int64, err error) {
+	var (
+		id                                       int64
+		messageDeleted, timestampMatch, modified bool
+		sender, receiver                         string
+	)
+
+	err = tx.QueryRow(ctx, q.text(), args...).Scan(
 		&id, &newTimestamp, &messageDeleted, &timestampMatch, &modified, &sender, &receiver,
 	)
 
 	switch {
 	case err != nil:
-		if err == sql.ErrNoRows {
-			return 0, errors.New("message not found")
+		if err == pgx.ErrNoRows {
+			return 0, &ErrMessageNotFound{}
 		}
 		return 0, err
 	case messageDeleted:
@@ -47,22 +74,22 @@ func (s *Storage) modifyMessage(ctx context.Context, q query, args ...any) (newT
 		return 0, errors.New("failed to modify message")
 	}
 
-	_, err = tx.Stmt(s.queries[queryWriteUpdate{}]).ExecContext(ctx, sender, newTimestamp, id)
-
-	if err != nil {
-		return 0, fmt.Errorf("failed to write user '%s' update: %w", sender, err)
-	}
+	batch := &pgx.Batch{}
 
-	_, err = tx.Stmt(s.queries[queryWriteUpdate{}]).ExecContext(ctx, receiver, newTimestamp, id)
+	if changes != nil {
+		err = changes(batch, id)
 
-	if err != nil {
-		return 0, fmt.Errorf("failed to write user '%s' update: %w", receiver, err)
+		if err != nil {
+			return 0, err
+		}
 	}
 
-	err = tx.Commit()
+	queueMessageUpdates(batch, id, newTimestamp, sender)
+	queueMessageEvent(batch, &events.Event{Type: event, MessageId: id, Timestamp: newTimestamp, Sender: sender, Receiver: receiver})
+	err = tx.SendBatch(ctx, batch).Close()
 
 	if err != nil {
-		return 0, err
+		return 0, fmt.Errorf("failed to save message '%d' changes: %w", id, err)
 	}
 
 	return newTimestamp, nil
@@ -75,6 +102,13 @@ func (e *ErrMessageDeleted) Error() string {
 func (e *ErrMessageDeleted) ImplementsMessageDeletedError() {
 }
 
+func (e *ErrMessageNotFound) Error() string {
+	return "message not found"
+}
+
+func (e *ErrMessageNotFound) ImplementsMessageNotFoundError() {
+}
+
 func (e *ErrTimestampIsNotMatch) Error() string {
 	return "message timestamp is not match"
 }
@@ -0,0 +1,253 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Every file gets its own event, so the same file attached several times is counted several times.
+// Events written at once share the same data key (if encryption is enabled).
+type queryWriteFileUsage struct{}
+
+func (q queryWriteFileUsage) text() string {
+	return `
+	INSERT INTO outbox (file_id, in_use, created, key_id, data_key)
+	SELECT f.id, $2, $3, $4, $5
+	FROM unnest($1::varchar[]) WITH ORDINALITY AS f(id, n)
+	ORDER BY f.n;
+	`
+}
+
+// Shared lock, so replicas relay at the same time, but pausing (see PauseFileUsageRelay) waits for them.
+type queryLockFileUsageRelay struct{}
+
+func (q queryLockFileUsageRelay) text() string {
+	return `
+	SELECT paused IS NOT NULL
+	FROM file_usage_relay
+	FOR SHARE;
+	`
+}
+
+type queryPauseFileUsageRelay struct{}
+
+func (q queryPauseFileUsageRelay) text() string {
+	return `
+	UPDATE file_usage_relay SET
+		paused = COALESCE(paused, $1);
+	`
+}
+
+type queryResumeFileUsageRelay struct{}
+
+func (q queryResumeFileUsageRelay) text() string {
+	return `
+	UPDATE file_usage_relay SET
+		paused = NULL;
+	`
+}
+
+// Locked events are skipped, so several replicas relay different events at the same time.
+type queryGetPendingFileUsage struct{}
+
+func (q queryGetPendingFileUsage) text() string {
+	return `
+	SELECT id, file_id, in_use, COALESCE(key_id, ''), data_key
+	FROM outbox
+	WHERE delivered IS NULL
+	ORDER BY id
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED;
+	`
+}
+
+type queryMarkFileUsageDelivered struct{}
+
+func (q queryMarkFileUsageDelivered) text() string {
+	return `
+	UPDATE outbox SET
+		delivered = $2
+	WHERE id = ANY($1::bigint[]);
+	`
+}
+
+type queryDeleteDeliveredFileUsage struct{}
+
+func (q queryDeleteDeliveredFileUsage) text() string {
+	return `
+	DELETE FROM outbox
+	WHERE delivered < $1;
+	`
+}
+
+func (s *Storage) queueFileUsage(batch *pgx.Batch, files []string, inUse bool) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	args, err := s.fileUsageArgs(files, inUse)
+
+	if err != nil {
+		return err
+	}
+
+	batch.Queue(queryWriteFileUsage{}.text(), args...)
+	return nil
+}
+
+// File ids are encrypted the same way as in attachments, since the outbox keeps them until they are delivered.
+func (s *Storage) fileUsageArgs(files []string, inUse bool) ([]any, error) {
+	key, err := s.keys.newDataKey(outboxBinding)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files, err = key.encryptAll(files)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []any{files, inUse, time.Now().UTC(), key.masterKeyId(), key.wrappedKey()}, nil
+}
+
+// Events written at once share the same data key, so the last one opened is reused.
+type outboxKeys struct {
+	keys    *keySet
+	keyId   string
+	wrapped []byte
+	key     *dataKey
+}
+
+func (o *outboxKeys) decrypt(fileId, keyId string, wrapped []byte) (string, error) {
+	if keyId != o.keyId || !bytes.Equal(wrapped, o.wrapped) {
+		key, err := o.keys.openDataKey(keyId, wrapped, outboxBinding)
+
+		if err != nil {
+			return "", err
+		}
+
+		o.keyId, o.wrapped, o.key = keyId, wrapped, key
+	}
+
+	return o.key.decrypt(fileId)
+}
+
+type pendingFileUsage struct {
+	id     int64
+	fileId string
+	inUse  bool
+}
+
+// Events stay locked while they are sent, and the sent ones are marked delivered
+// even if sending of the next one fails, so they are not sent again.
+// Nothing is relayed while the relay is paused (see PauseFileUsageRelay).
+func (s *Storage) RelayFileUsage(ctx context.Context, limit int, send func(fileId string, inUse bool) error) (relayed int, err error) {
+	var tx pgx.Tx
+	tx, err = s.db.Begin(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var paused bool
+	err = tx.QueryRow(ctx, queryLockFileUsageRelay{}.text()).Scan(&paused)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock file usage relay: %w", err)
+	}
+
+	if paused {
+		return 0, nil
+	}
+
+	var rows pgx.Rows
+	rows, err = tx.Query(ctx, queryGetPendingFileUsage{}.text(), limit)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pending file usage events: %w", err)
+	}
+
+	var (
+		pending    []pendingFileUsage
+		keys       = outboxKeys{keys: s.keys}
+		keyId      string
+		wrappedKey []byte
+	)
+
+	for rows.Next() {
+		event := pendingFileUsage{}
+		err = rows.Scan(&event.id, &event.fileId, &event.inUse, &keyId, &wrappedKey)
+
+		if err == nil {
+			event.fileId, err = keys.decrypt(event.fileId, keyId, wrappedKey)
+		}
+
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to get pending file usage events: %w", err)
+		}
+
+		pending = append(pending, event)
+	}
+
+	rows.Close()
+	err = rows.Err()
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pending file usage events: %w", err)
+	}
+
+	delivered := make([]int64, 0, len(pending))
+	var sendErr error
+
+	for _, event := range pending {
+		sendErr = send(event.fileId, event.inUse)
+
+		if sendErr != nil {
+			break
+		}
+
+		delivered = append(delivered, event.id)
+	}
+
+	if len(delivered) != 0 {
+		_, err = tx.Exec(ctx, queryMarkFileUsageDelivered{}.text(), delivered, time.Now().UTC())
+
+		if err != nil {
+			return 0, fmt.Errorf("failed to mark file usage events delivered: %w", err)
+		}
+
+		err = tx.Commit(ctx)
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(delivered), sendErr
+}
+
+func (s *Storage) DeleteDeliveredFileUsage(ctx context.Context, before time.Time) error {
+	_, err := s.db.Exec(ctx, queryDeleteDeliveredFileUsage{}.text(), before)
+	return err
+}
+
+// Pauses relaying of file usage events by all replicas until the relay is resumed, e.g. to reconcile
+// the files usage statistics (see FileUsage). Returns after the events being sent are marked delivered.
+func (s *Storage) PauseFileUsageRelay(ctx context.Context) error {
+	_, err := s.db.Exec(ctx, queryPauseFileUsageRelay{}.text(), time.Now().UTC())
+	return err
+}
+
+func (s *Storage) ResumeFileUsageRelay(ctx context.Context) error {
+	_, err := s.db.Exec(ctx, queryResumeFileUsageRelay{}.text())
+	return err
+}
@@ -0,0 +1,169 @@
+package data
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+type queryGetPersonalMessage struct{}
+
+func (q queryGetPersonalMessage) text() string {
+	return `
+	SELECT
+		event_timestamp,
+		CASE WHEN sender = $2 THEN COALESCE(client_id::text, '') ELSE '' END,
+		CASE WHEN COALESCE(is_deleted, false) THEN '' ELSE sender END,
+		CASE WHEN COALESCE(is_deleted, false) THEN '' ELSE receiver END,
+		created,
+		edited,
+		COALESCE(CASE WHEN receiver = $2 THEN is_read ELSE read_receipt END, false),
+		EXISTS (SELECT 1 FROM stars WHERE user_id = $2 AND message_id = $1),
+		COALESCE(message_text, ''),
+		text_entities,
+		content,
+		envelope,
+		COALESCE(is_deleted, false),
+		COALESCE(key_id, ''),
+		data_key
+	FROM messages
+	WHERE id = $1
+		AND (sender = $2 OR receiver = $2);
+	`
+}
+
+type queryGetPersonalMessageAttachments struct{}
+
+func (q queryGetPersonalMessageAttachments) text() string {
+	return `
+	SELECT file_id
+	FROM attachments
+	WHERE message_id = $1;
+	`
+}
+
+func (s *Storage) personalMessage(ctx context.Context, userId string, messageId int64) (*storage.PersonalMessage, error) {
+	row := s.db.QueryRow(ctx, queryGetPersonalMessage{}.text(), messageId, userId)
+
+	var textEntities, content, envelope, wrappedKey []byte
+	var keyId string
+	message := &storage.PersonalMessage{Id: messageId, Files: make([]string, 0)}
+	err := row.Scan(
+		&message.Timestamp,
+		&message.ClientId,
+		&message.From,
+		&message.To,
+		&message.Created,
+		&message.Edited,
+		&message.Read,
+		&message.Starred,
+		&message.Text,
+		&textEntities,
+		&content,
+		&envelope,
+		&message.Deleted,
+		&keyId,
+		&wrappedKey,
+	)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if message.Deleted {
+		return message, nil
+	}
+
+	var key *dataKey
+	key, err = s.keys.openMessageKey(messageId, message.From, keyId, wrappedKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	message.Text, err = key.decrypt(message.Text)
+
+	if err != nil {
+		return nil, err
+	}
+
+	textEntities, err = key.decryptJSON(textEntities)
+
+	if err == nil {
+		content, err = key.decryptJSON(content)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	message.Entities, err = storage.TextEntitiesFromJSON(textEntities)
+
+	if err != nil {
+		return nil, err
+	}
+
+	message.Content, err = storage.MessageContentFromJSON(content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	message.Envelope, err = storage.EncryptedEnvelopeFromJSON(envelope)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if message.Content != nil && message.Content.Poll != nil {
+		err = s.countPollVotes(ctx, userId, messageId, message.Content.Poll)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	message.Files, err = s.messageFiles(ctx, messageId, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+func (s *Storage) messageFiles(ctx context.Context, messageId int64, key *dataKey) (files []string, err error) {
+	var rows pgx.Rows
+	rows, err = s.db.Query(ctx, queryGetPersonalMessageAttachments{}.text(), messageId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var fileId string
+	for rows.Next() {
+		err = rows.Scan(&fileId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		fileId, err = key.decrypt(fileId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, fileId)
+	}
+
+	return files, rows.Err()
+}
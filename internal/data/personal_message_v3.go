@@ -0,0 +1,17 @@
+package data
+
+import (
+	"context"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+func (s *Storage) PersonalMessageV3(ctx context.Context, userId string, messageId int64) (*models.PersonalMessageV3, error) {
+	message, err := s.personalMessage(ctx, userId, messageId)
+
+	if err != nil || message == nil {
+		return nil, err
+	}
+
+	return message.V3(), nil
+}
@@ -0,0 +1,528 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type queryGetMessagesToRotate struct{}
+
+func (q queryGetMessagesToRotate) text() string {
+	return `
+	SELECT
+		id,
+		sender,
+		COALESCE(key_id, ''),
+		data_key,
+		COALESCE(message_text, ''),
+		text_entities,
+		content
+	FROM messages
+	WHERE key_id IS DISTINCT FROM $1
+		AND id > $2
+	ORDER BY id
+	LIMIT $3
+	FOR UPDATE;
+	`
+}
+
+type queryRewrapDataKey struct{}
+
+func (q queryRewrapDataKey) text() string {
+	return `
+	UPDATE messages SET
+		key_id = $2,
+		data_key = $3
+	WHERE id = $1;
+	`
+}
+
+type queryEncryptMessage struct{}
+
+func (q queryEncryptMessage) text() string {
+	return `
+	UPDATE messages SET
+		key_id = $2,
+		data_key = $3,
+		message_text = NULLIF($4, ''),
+		text_digest = CASE WHEN COALESCE(is_deleted, false) THEN NULL ELSE $5::bytea END,
+		text_entities = $6,
+		entities_digest = $7,
+		content = $8,
+		text_search = NULL
+	WHERE id = $1;
+	`
+}
+
+type queryGetAttachmentsToEncrypt struct{}
+
+func (q queryGetAttachmentsToEncrypt) text() string {
+	return `
+	SELECT id, file_id
+	FROM attachments
+	WHERE message_id = $1
+	FOR UPDATE;
+	`
+}
+
+type queryEncryptAttachment struct{}
+
+func (q queryEncryptAttachment) text() string {
+	return `
+	UPDATE attachments SET
+		file_id = $2,
+		file_digest = $3
+	WHERE id = $1;
+	`
+}
+
+// Delivered events are rotated too, since they keep file ids until they are deleted.
+type queryGetFileUsageToRotate struct{}
+
+func (q queryGetFileUsageToRotate) text() string {
+	return `
+	SELECT
+		id,
+		file_id,
+		COALESCE(key_id, ''),
+		data_key
+	FROM outbox
+	WHERE key_id IS DISTINCT FROM $1
+		AND id > $2
+	ORDER BY id
+	LIMIT $3
+	FOR UPDATE;
+	`
+}
+
+type queryEncryptFileUsage struct{}
+
+func (q queryEncryptFileUsage) text() string {
+	return `
+	UPDATE outbox SET
+		file_id = $2,
+		key_id = $3,
+		data_key = $4
+	WHERE id = $1;
+	`
+}
+
+type queryGetWebhooksToRotate struct{}
+
+func (q queryGetWebhooksToRotate) text() string {
+	return `
+	SELECT
+		id,
+		user_id,
+		secret,
+		COALESCE(key_id, ''),
+		data_key
+	FROM webhooks
+	WHERE key_id IS DISTINCT FROM $1
+		AND id > $2
+	ORDER BY id
+	LIMIT $3
+	FOR UPDATE;
+	`
+}
+
+type queryEncryptWebhookSecret struct{}
+
+func (q queryEncryptWebhookSecret) text() string {
+	return `
+	UPDATE webhooks SET
+		secret = $2,
+		key_id = $3,
+		data_key = $4
+	WHERE id = $1;
+	`
+}
+
+// Rewraps data keys of the messages encrypted with other (previous) master keys with the active one,
+// and encrypts plain text messages stored before the encryption was enabled. Messages are processed
+// in batches (one transaction per batch), so the service keeps working meanwhile,
+// but all master keys in use must remain configured until the rotation is completed.
+// Modifications are not written to the timeline, since message data stays the same for users.
+// File usage events of the outbox and webhook secrets are encrypted with the active master key afterwards.
+func (s *Storage) RotateEncryptionKeys(ctx context.Context, batchSize int) (rotated int, err error) {
+	if !s.keys.enabled() {
+		return 0, errors.New("encryption keys are not specified")
+	}
+
+	rotated, err = rotateInBatches(ctx, batchSize, s.rotateEncryptionKeysBatch)
+
+	if err == nil {
+		_, err = rotateInBatches(ctx, batchSize, s.rotateFileUsageBatch)
+	}
+
+	if err == nil {
+		_, err = rotateInBatches(ctx, batchSize, s.rotateWebhookSecretsBatch)
+	}
+
+	return rotated, err
+}
+
+// Batches are taken in the order of ids, starting after the last processed one.
+func rotateInBatches(ctx context.Context, batchSize int,
+	rotateBatch func(ctx context.Context, after int64, limit int) (processed int, lastId int64, err error)) (rotated int, err error) {
+	var processed int
+	var lastId int64
+
+	for {
+		processed, lastId, err = rotateBatch(ctx, lastId, batchSize)
+		rotated += processed
+
+		if err != nil || processed < batchSize {
+			return rotated, err
+		}
+	}
+}
+
+func (s *Storage) rotateEncryptionKeysBatch(ctx context.Context, after int64, limit int) (processed int, lastId int64, err error) {
+	var tx pgx.Tx
+	tx, err = s.db.Begin(ctx)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	type message struct {
+		id         int64
+		sender     string
+		keyId      string
+		wrappedKey []byte
+		text       string
+		entities   *string // NULL if there are no text entities
+		content    *string // NULL if there is no content
+	}
+
+	var rows pgx.Rows
+	rows, err = tx.Query(ctx, queryGetMessagesToRotate{}.text(), s.keys.active, after, limit)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get messages to rotate keys: %w", err)
+	}
+
+	defer rows.Close()
+
+	batch := make([]*message, 0, limit)
+
+	for rows.Next() {
+		m := &message{}
+		err = rows.Scan(&m.id, &m.sender, &m.keyId, &m.wrappedKey, &m.text, &m.entities, &m.content)
+
+		if err != nil {
+			return 0, 0, err
+		}
+
+		batch = append(batch, m)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	rows.Close()
+
+	rewrapped := &pgx.Batch{}
+
+	for _, m := range batch {
+		var key *dataKey
+		key, err = s.keys.openMessageKey(m.id, m.sender, m.keyId, m.wrappedKey)
+
+		if err == nil {
+			if key == nil {
+				err = s.encryptMessage(ctx, tx, m.id, m.sender, m.text, jsonData(m.entities), jsonData(m.content))
+			} else {
+				err = s.rewrapDataKey(rewrapped, m.id, key)
+			}
+		}
+
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to rotate keys of message %d: %w", m.id, err)
+		}
+
+		lastId = m.id
+	}
+
+	err = tx.SendBatch(ctx, rewrapped).Close()
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to rewrap data keys: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return len(batch), lastId, nil
+}
+
+// Rewrapped keys of the whole batch of messages are written in one round trip.
+func (s *Storage) rewrapDataKey(rewrapped *pgx.Batch, messageId int64, key *dataKey) error {
+	key, err := s.keys.rewrap(key)
+
+	if err != nil {
+		return err
+	}
+
+	rewrapped.Queue(queryRewrapDataKey{}.text(), messageId, key.masterKeyId(), key.wrappedKey())
+	return nil
+}
+
+// Text entities and content are passed as stored (see storage.TextEntitiesToJSON).
+func (s *Storage) encryptMessage(ctx context.Context, tx pgx.Tx, messageId int64, sender, text string,
+	entities, content any) error {
+	key, err := s.keys.newMessageKey(messageId, sender)
+
+	if err != nil {
+		return err
+	}
+
+	var encrypted string
+	encrypted, err = key.encrypt(text)
+
+	if err != nil {
+		return err
+	}
+
+	var encryptedEntities, encryptedContent any
+	encryptedEntities, err = key.encryptJSON(entities)
+
+	if err == nil {
+		encryptedContent, err = key.encryptJSON(content)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, queryEncryptMessage{}.text(),
+		messageId, key.masterKeyId(), key.wrappedKey(), encrypted, key.digest(text),
+		encryptedEntities, key.digestJSON(entities), encryptedContent)
+
+	if err != nil {
+		return err
+	}
+
+	var rows pgx.Rows
+	rows, err = tx.Query(ctx, queryGetAttachmentsToEncrypt{}.text(), messageId)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	attachments := make(map[int64]string)
+
+	var id int64
+	var fileId string
+
+	for rows.Next() {
+		err = rows.Scan(&id, &fileId)
+
+		if err != nil {
+			return err
+		}
+
+		attachments[id] = fileId
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return err
+	}
+
+	rows.Close()
+
+	for id, fileId := range attachments {
+		encrypted, err = key.encrypt(fileId)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, queryEncryptAttachment{}.text(), id, encrypted, key.digest(fileId))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Nullable JSON column as the data serialized to JSON (nil for NULL).
+func jsonData(column *string) any {
+	if column == nil {
+		return nil
+	}
+	return *column
+}
+
+// File ids of the whole batch of events are encrypted with the same new data key.
+func (s *Storage) rotateFileUsageBatch(ctx context.Context, after int64, limit int) (processed int, lastId int64, err error) {
+	var tx pgx.Tx
+	tx, err = s.db.Begin(ctx)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var key *dataKey
+	key, err = s.keys.newDataKey(outboxBinding)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var rows pgx.Rows
+	rows, err = tx.Query(ctx, queryGetFileUsageToRotate{}.text(), s.keys.active, after, limit)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get file usage events to rotate keys: %w", err)
+	}
+
+	defer rows.Close()
+
+	var (
+		encrypted  = &pgx.Batch{}
+		oldKeys    = outboxKeys{keys: s.keys}
+		fileId     string
+		keyId      string
+		wrappedKey []byte
+	)
+
+	for rows.Next() {
+		err = rows.Scan(&lastId, &fileId, &keyId, &wrappedKey)
+
+		if err == nil {
+			fileId, err = oldKeys.decrypt(fileId, keyId, wrappedKey)
+		}
+
+		if err == nil {
+			fileId, err = key.encrypt(fileId)
+		}
+
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to rotate keys of file usage event %d: %w", lastId, err)
+		}
+
+		encrypted.Queue(queryEncryptFileUsage{}.text(), lastId, fileId, key.masterKeyId(), key.wrappedKey())
+		processed++
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	rows.Close()
+
+	err = tx.SendBatch(ctx, encrypted).Close()
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to encrypt file usage events: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return processed, lastId, nil
+}
+
+// Data keys of encrypted secrets are rewrapped (the secrets stay the same), whereas plain secrets are encrypted.
+func (s *Storage) rotateWebhookSecretsBatch(ctx context.Context, after int64, limit int) (processed int, lastId int64, err error) {
+	var tx pgx.Tx
+	tx, err = s.db.Begin(ctx)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var rows pgx.Rows
+	rows, err = tx.Query(ctx, queryGetWebhooksToRotate{}.text(), s.keys.active, after, limit)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get webhooks to rotate keys: %w", err)
+	}
+
+	defer rows.Close()
+
+	var (
+		encrypted  = &pgx.Batch{}
+		userId     string
+		secret     string
+		keyId      string
+		wrappedKey []byte
+		key        *dataKey
+	)
+
+	for rows.Next() {
+		err = rows.Scan(&lastId, &userId, &secret, &keyId, &wrappedKey)
+
+		if err == nil {
+			key, err = s.keys.openDataKey(keyId, wrappedKey, webhookBinding(lastId, userId))
+		}
+
+		if err == nil {
+			if key == nil {
+				key, err = s.keys.newDataKey(webhookBinding(lastId, userId))
+
+				if err == nil {
+					secret, err = key.encrypt(secret)
+				}
+			} else {
+				key, err = s.keys.rewrap(key)
+			}
+		}
+
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to rotate keys of webhook %d: %w", lastId, err)
+		}
+
+		encrypted.Queue(queryEncryptWebhookSecret{}.text(), lastId, secret, key.masterKeyId(), key.wrappedKey())
+		processed++
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	rows.Close()
+
+	err = tx.SendBatch(ctx, encrypted).Close()
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to encrypt webhook secrets: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return processed, lastId, nil
+}
@@ -0,0 +1,80 @@
+package data
+
+import (
+	"context"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+// Total number of the found messages is returned along with the requested page of them,
+// so there is a row (without message) even if the page is empty.
+type querySearchMessagesV1 struct{}
+
+func (q querySearchMessagesV1) text() string {
+	return `
+	WITH found AS (
+		SELECT
+			id,
+			event_timestamp,
+			ts_rank(text_search, search_query) AS rank
+		FROM messages,
+			websearch_to_tsquery('simple', $2) AS search_query
+		WHERE (sender = $1 OR receiver = $1)
+			AND COALESCE(is_deleted, false) = false
+			AND NOT (receiver = $1 AND is_request)
+			AND envelope IS NULL -- encrypted messages cannot be searched by the service
+			AND text_search @@ search_query
+			AND ($3 = '' OR (sender = $1 AND receiver = $3) OR (sender = $3 AND receiver = $1))
+			AND ($4::timestamp IS NULL OR created >= $4)
+			AND ($5::timestamp IS NULL OR created < $5)
+	)
+	SELECT
+		counted.total,
+		COALESCE(page.id, 0),
+		COALESCE(page.event_timestamp, 0),
+		COALESCE(page.rank, 0)
+	FROM (SELECT count(*) AS total FROM found) AS counted
+		LEFT JOIN (
+			SELECT *
+			FROM found
+			ORDER BY rank DESC, id DESC
+			LIMIT $6 OFFSET $7
+		) AS page
+		ON true
+	ORDER BY page.rank DESC, page.id DESC;
+	`
+}
+
+func (s *Storage) SearchMessagesV1(ctx context.Context, userId string, params *models.MessageSearchParameters) (*models.MessageSearchResultsV1, error) {
+	rows, err := s.db.Query(ctx, querySearchMessagesV1{}.text(),
+		userId, params.Query, params.With, params.Since, params.Until, params.Limit, params.Offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	results := &models.MessageSearchResultsV1{Messages: make([]*models.MessageSearchInfoV1, 0, params.Limit)}
+
+	for rows.Next() {
+		info := &models.MessageSearchInfoV1{}
+		err = rows.Scan(&results.Total, &info.Id, &info.Timestamp, &info.Rank)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Id != 0 {
+			results.Messages = append(results.Messages, info)
+		}
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
@@ -0,0 +1,128 @@
+package data
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+type ErrConversationNotFound struct{}
+
+// Unspecified settings ($3 - muted, $5 - archived) are left unchanged,
+// whereas mute expiration time ($4) is reset on any mute state change.
+type querySetConversationSettings struct{}
+
+func (q querySetConversationSettings) text() string {
+	return `
+	WITH current_settings AS (
+		SELECT
+			muted,
+			muted_until,
+			archived
+		FROM conversations
+		WHERE user_id = $1 AND counterpart = $2
+		FOR UPDATE
+	),
+	new_settings AS (
+		SELECT
+			COALESCE($3::boolean, muted) AS muted,
+			CASE
+				WHEN $3::boolean IS NULL THEN muted_until
+				WHEN $3::boolean THEN $4::timestamp
+			END AS muted_until,
+			COALESCE($5::boolean, archived) AS archived
+		FROM current_settings
+	),
+	updated_conversation AS (
+		UPDATE conversations AS c SET
+			muted = n.muted,
+			muted_until = n.muted_until,
+			archived = n.archived,
+			event_timestamp = nextval('timeline')
+		FROM current_settings AS cur, new_settings AS n
+		WHERE c.user_id = $1 AND c.counterpart = $2
+			AND (cur.muted, cur.muted_until, cur.archived) IS DISTINCT FROM (n.muted, n.muted_until, n.archived)
+		RETURNING c.event_timestamp
+	)
+	SELECT
+		EXISTS (SELECT 1 FROM current_settings),
+		COALESCE((SELECT event_timestamp FROM updated_conversation), 0);
+	`
+}
+
+type queryUnarchiveConversation struct{}
+
+func (q queryUnarchiveConversation) text() string {
+	return `
+	UPDATE conversations SET
+		archived = false,
+		event_timestamp = nextval('timeline')
+	WHERE user_id = $1 AND counterpart = $2 AND archived
+	RETURNING event_timestamp;
+	`
+}
+
+func (s *Storage) SetConversationSettings(ctx context.Context, userId, counterpart string, settings *models.ConversationSettingsV1) (err error) {
+	var tx pgx.Tx
+	tx, err = s.db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var found bool
+	var timestamp int64
+	err = tx.QueryRow(ctx, querySetConversationSettings{}.text(),
+		userId, counterpart, settings.Muted, settings.MutedUntil, settings.Archived).Scan(&found, &timestamp)
+
+	switch {
+	case err != nil:
+		return fmt.Errorf("failed to set conversation settings: %w", err)
+	case !found:
+		return &ErrConversationNotFound{}
+	case timestamp == 0:
+		return nil // not modified
+	}
+
+	_, err = tx.Exec(ctx, queryWriteUserUpdate{}.text(), userId, timestamp, models.UpdateTypeConversation, counterpart)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' update: %w", userId, err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// New incoming message brings archived conversation back.
+func (s *Storage) unarchiveConversation(ctx context.Context, tx pgx.Tx, userId, counterpart string) (err error) {
+	var timestamp int64
+	err = tx.QueryRow(ctx, queryUnarchiveConversation{}.text(), userId, counterpart).Scan(&timestamp)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil // not archived
+		}
+
+		return fmt.Errorf("failed to unarchive conversation: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, queryWriteUserUpdate{}.text(), userId, timestamp, models.UpdateTypeConversation, counterpart)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' update: %w", userId, err)
+	}
+
+	return nil
+}
+
+func (e *ErrConversationNotFound) Error() string {
+	return "conversation not found"
+}
+
+func (e *ErrConversationNotFound) ImplementsConversationNotFoundError() {
+}
@@ -2,6 +2,12 @@ package data
 
 import (
 	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/events"
 )
 
 type querySetMessageReadState struct{}
@@ -20,7 +26,8 @@ func (q querySetMessageReadState) text() string {
 	update_try AS (
 		UPDATE messages SET
 			event_timestamp = nextval('timeline'),
-			is_read = NULLIF($2, false)
+			is_read = NULLIF($2, false),
+			read_receipt = NULLIF($2, false)
 		WHERE id = $3
 			AND COALESCE(is_deleted, false) = false
 			AND event_timestamp = $1
@@ -45,7 +52,123 @@ func (q querySetMessageReadState) text() string {
 	`
 }
 
+// Changes only the receiver's read state, leaving the message timestamp
+// and the read receipt seen by the sender the same.
+type querySetMessageReadStatePrivately struct{}
+
+func (q querySetMessageReadStatePrivately) text() string {
+	return `
+	WITH update_constraints AS (
+		SELECT
+			COALESCE(is_deleted, false) AS message_deleted,
+			event_timestamp = $1 AS timestamp_match,
+			COALESCE(is_read, false) != $2 AS state_modified
+		FROM messages
+		WHERE id = $3
+		FOR UPDATE
+	),
+	update_try AS (
+		UPDATE messages SET
+			is_read = NULLIF($2, false)
+		WHERE id = $3
+			AND COALESCE(is_deleted, false) = false
+			AND event_timestamp = $1
+			AND COALESCE(is_read, false) != $2
+		RETURNING
+			receiver AS receiver
+	)
+	SELECT
+		update_constraints.message_deleted AS message_deleted,
+		update_constraints.timestamp_match AS timestamp_match,
+		update_constraints.state_modified AS state_modified,
+		COALESCE(update_try.receiver, '') AS receiver
+	FROM update_constraints
+		LEFT OUTER JOIN update_try
+		ON true;
+	`
+}
+
+type queryWritePersonalUpdate struct{}
+
+func (q queryWritePersonalUpdate) text() string {
+	return `
+	INSERT INTO updates (user_id, event_timestamp, message_id)
+	VALUES ($1, nextval('timeline'), $2);
+	`
+}
+
+// The receiver's setting is checked in the same transaction as the read state is changed (and locked),
+// so the read receipt cannot be written after the receiver has hidden read receipts.
 func (s *Storage) SetMessageReadState(ctx context.Context, id, timestamp int64, read bool) (newTimestamp int64, err error) {
-	newTimestamp, err = s.modifyMessage(ctx, querySetMessageReadState{}, timestamp, read, id)
-	return newTimestamp, err
+	var tx pgx.Tx
+	tx, err = s.db.Begin(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var hidden bool
+	err = tx.QueryRow(ctx, queryCheckReadReceiptsHidden{}.text(), id).Scan(&hidden)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to check if read receipts are hidden: %w", err)
+	}
+
+	if hidden {
+		err = s.setMessageReadStatePrivately(ctx, tx, id, timestamp, read)
+		newTimestamp = timestamp
+	} else {
+		newTimestamp, err = s.modifyMessageInTx(ctx, tx, querySetMessageReadState{}, events.MessageReadStateChanged, nil, timestamp, read, id)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newTimestamp, nil
+}
+
+// Read state is personal in this case, so the change is written only to the receiver's timeline
+// (like message stars), and the message timestamp stays the same.
+func (s *Storage) setMessageReadStatePrivately(ctx context.Context, tx pgx.Tx, id, timestamp int64, read bool) (err error) {
+	var (
+		messageDeleted, timestampMatch, modified bool
+		receiver                                 string
+	)
+
+	err = tx.QueryRow(ctx, querySetMessageReadStatePrivately{}.text(), timestamp, read, id).Scan(
+		&messageDeleted, &timestampMatch, &modified, &receiver,
+	)
+
+	switch {
+	case err != nil:
+		if err == pgx.ErrNoRows {
+			return &ErrMessageNotFound{}
+		}
+		return err
+	case messageDeleted:
+		return &ErrMessageDeleted{}
+	case !timestampMatch:
+		return &ErrTimestampIsNotMatch{}
+	case !modified:
+		return &ErrMessageNotModified{}
+	case receiver == "":
+		return errors.New("failed to modify message")
+	}
+
+	_, err = tx.Exec(ctx, queryWritePersonalUpdate{}.text(), receiver, id)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' update: %w", receiver, err)
+	}
+
+	return nil
 }
@@ -0,0 +1,132 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+// Total number of the files shared in the conversation is returned along with the requested page of them,
+// so there is a row (without file) even if the page is empty.
+type queryGetSharedFilesV1 struct{}
+
+func (q queryGetSharedFilesV1) text() string {
+	return `
+	WITH shared AS (
+		SELECT
+			a.id AS attachment_id,
+			a.file_id,
+			m.id AS message_id,
+			m.sender,
+			m.created,
+			COALESCE(m.key_id, '') AS key_id,
+			m.data_key
+		FROM messages AS m
+			JOIN attachments AS a
+			ON a.message_id = m.id
+		WHERE ((m.sender = $1 AND m.receiver = $2) OR (m.sender = $2 AND m.receiver = $1))
+			AND COALESCE(m.is_deleted, false) = false
+			AND NOT (m.receiver = $1 AND m.is_request)
+	)
+	SELECT
+		counted.total,
+		COALESCE(page.attachment_id, 0),
+		COALESCE(page.file_id, ''),
+		COALESCE(page.message_id, 0),
+		COALESCE(page.sender, ''),
+		page.created,
+		COALESCE(page.key_id, ''),
+		page.data_key
+	FROM (SELECT count(*) AS total FROM shared) AS counted
+		LEFT JOIN (
+			SELECT *
+			FROM shared
+			WHERE $3::bigint = 0 OR attachment_id < $3
+			ORDER BY attachment_id DESC
+			LIMIT $4
+		) AS page
+		ON true
+	ORDER BY page.attachment_id DESC;
+	`
+}
+
+func (s *Storage) SharedFilesV1(ctx context.Context, userId, counterpart string, before int64, limit int) (*models.SharedFilesV1, error) {
+	rows, err := s.db.Query(ctx, queryGetSharedFilesV1{}.text(), userId, counterpart, before, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	files := &models.SharedFilesV1{Files: make([]*models.SharedFileInfoV1, 0, limit)}
+
+	var (
+		attachmentId int64
+		created      *time.Time
+		keyId        string
+		wrappedKey   []byte
+		key          *dataKey
+	)
+
+	keys := make(map[int64]*dataKey) // by message id
+
+	for rows.Next() {
+		info := &models.SharedFileInfoV1{}
+		err = rows.Scan(&files.Total, &attachmentId, &info.FileId, &info.MessageId, &info.From, &created, &keyId, &wrappedKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if attachmentId == 0 {
+			continue
+		}
+
+		key, err = s.cachedDataKey(keys, info.MessageId, info.From, keyId, wrappedKey)
+
+		if err == nil {
+			info.FileId, err = key.decrypt(info.FileId)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		info.Created = storage.UtcTime(created)
+		files.Files = append(files.Files, info)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files.Files) == limit {
+		files.Next = attachmentId
+	}
+
+	return files, nil
+}
+
+// Every message may have several attachments, so its data key is unwrapped only once.
+func (s *Storage) cachedDataKey(keys map[int64]*dataKey, messageId int64, sender, keyId string,
+	wrappedKey []byte) (key *dataKey, err error) {
+	key, ok := keys[messageId]
+
+	if ok {
+		return key, nil
+	}
+
+	key, err = s.keys.openMessageKey(messageId, sender, keyId, wrappedKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys[messageId] = key
+	return key, nil
+}
@@ -2,36 +2,123 @@ package data
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
-
-	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
 type Storage struct {
-	db      *sql.DB
-	cfg     *config
-	queries map[query]*sql.Stmt
+	db   *pgxpool.Pool
+	cfg  *config
+	keys *keySet
 }
 
 type query interface {
 	text() string
 }
 
+// Queries are prepared by pgx on first use on every connection of the pool and cached
+// (MSG_STORAGE_STATEMENT_CACHE), so the list is used only to verify them on startup.
 func queriesToPrepare() []query {
 	return []query{
 		queryCreateMessage{},
+		queryReserveMessageIds{},
+		queryGetMessageIdByClientId{},
 		queryCreateAttachment{},
+		queryGetRecipientBlockingSender{},
+		queryCreateBroadcastMessages{},
+		queryWriteBroadcastUpdates{},
 		queryWriteUpdate{},
+		queryWriteReceiverUpdate{},
+		queryGetIdempotentMessage{},
+		queryDeleteExpiredIdempotencyKeys{},
+		queryCreateIdempotencyKey{},
+		queryGetIdempotentBroadcast{},
+		queryCreateIdempotencyKeyMessages{},
 		queryGetMessageUpdatesV1{},
-		queryGetPersonalMessageV1{},
-		queryGetPersonalMessageAttachmentsV1{},
+		queryGetMessageUpdatesV2{},
+		queryWriteUserUpdate{},
+		querySearchMessagesV1{},
+		queryGetSharedFilesV1{},
+		queryStarMessage{},
+		queryUnstarMessage{},
+		queryDeleteMessageStars{},
+		queryGetStarredMessagesV1{},
+		queryGetBlockForUpdate{},
+		queryCreateBlock{},
+		queryUpdateBlock{},
+		queryDeleteBlock{},
+		queryCheckSenderBlocked{},
+		queryRestoreConversationUpdates{},
+		queryGetBlockedUsersV1{},
+		queryGetBlockedUserV1{},
+		queryGetUserSettings{},
+		queryGetIncomingMessagesSetting{},
+		queryCheckReadReceiptsHidden{},
+		querySetUserSettings{},
+		queryGetConversationState{},
+		queryGetConversationStateForUpdate{},
+		queryCreateConversation{},
+		queryUpdateConversationState{},
+		queryReleaseRequestMessages{},
+		queryGetMessageRequestsV1{},
+		queryGetConversationsV1{},
+		querySetConversationSettings{},
+		queryUnarchiveConversation{},
+		queryGetPersonalMessage{},
+		queryGetPersonalMessageAttachments{},
+		queryGetPollVotes{},
 		queryEditMessageText{},
+		queryGetMessageKeys{},
+		queryEditMessageEnvelope{},
 		querySetMessageReadState{},
+		querySetMessageReadStatePrivately{},
+		queryWritePersonalUpdate{},
 		queryDeleteMessageData{},
+		queryEditMessageFiles{},
+		queryDeleteAttachments{},
+		queryVotePoll{},
+		queryDeleteUserPollVotes{},
+		queryCreatePollVotes{},
+		queryDeletePollVotes{},
+		queryGetMessagesToRotate{},
+		queryRewrapDataKey{},
+		queryEncryptMessage{},
+		queryGetAttachmentsToEncrypt{},
+		queryEncryptAttachment{},
+		queryGetFileUsageToRotate{},
+		queryEncryptFileUsage{},
+		queryGetWebhooksToRotate{},
+		queryEncryptWebhookSecret{},
+		queryWriteFileUsage{},
+		queryLockFileUsageRelay{},
+		queryPauseFileUsageRelay{},
+		queryResumeFileUsageRelay{},
+		queryGetPendingFileUsage{},
+		queryMarkFileUsageDelivered{},
+		queryDeleteDeliveredFileUsage{},
+		queryGetUsedFiles{},
+		queryGetFileUsageRelayPaused{},
+		queryGetUndeliveredFileUsage{},
+		queryWriteMessageEvent{},
+		queryWriteBroadcastEvents{},
+		queryGetPendingMessageEvents{},
+		queryMarkMessageEventsDelivered{},
+		queryDeleteDeliveredMessageEvents{},
+		queryCreateWebhook{},
+		queryReserveWebhookId{},
+		queryGetWebhooksV1{},
+		queryGetWebhookV1{},
+		querySetWebhookEnabled{},
+		queryDeleteWebhook{},
+		queryGetWebhookDeliveriesV1{},
+		queryClaimDueWebhooks{},
+		querySaveWebhookOutcome{},
+		queryWriteWebhookDelivery{},
+		queryTrimWebhookDeliveries{},
 	}
 }
 
@@ -39,72 +126,113 @@ func (s *Storage) Open() (err error) {
 	s.cfg = &config{}
 	s.cfg.Read()
 
-	err = s.connectToDatabase()
+	s.keys, err = newKeySet(s.cfg.encryptionKeys, s.cfg.encryptionKeyId)
+
+	if err != nil {
+		return fmt.Errorf("invalid encryption settings: %w", err)
+	}
+
+	if !s.keys.enabled() {
+		log.Warn().Msg("Encryption keys are not specified, message data is stored unencrypted.")
+	}
+
+	ctx := context.Background()
+	err = s.connectToDatabase(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			s.db.Close() // opening may be retried
+		}
+	}()
+
+	_, err = s.migrate(ctx)
 
 	if err != nil {
 		return err
 	}
 
-	return s.prepareQueries()
+	return s.prepareQueries(ctx)
 }
 
 func (s *Storage) Close(ctx context.Context) (err error) {
-	var closeErr error
 	closed := make(chan struct{}, 1)
 
 	go func() {
-		for _, stmt := range s.queries {
-			if stmt != nil {
-				closeErr = errors.Join(err, stmt.Close())
-			}
+		if s.db != nil { // nil if connecting to the database failed
+			s.db.Close() // waits for all acquired connections to be released
 		}
-
-		closeErr = errors.Join(err, s.db.Close())
-
 		closed <- struct{}{}
 	}()
 
 	select {
 	case <-closed:
-		err = closeErr
 	case <-ctx.Done():
-		err = ctx.Err()
+		err = fmt.Errorf("failed to disconnect from database: %w", ctx.Err())
 	}
 
+	return err
+}
+
+func (s *Storage) connectToDatabase(ctx context.Context) (err error) {
+	dbAddress := s.cfg.databaseURL(s.cfg.database)
+
+	var poolCfg *pgxpool.Config
+	poolCfg, err = pgxpool.ParseConfig(dbAddress.String())
+
 	if err != nil {
-		err = fmt.Errorf("failed to disconnect from database: %w", err)
+		return err
 	}
 
-	return err
-}
+	if s.cfg.maxConns > 0 {
+		poolCfg.MaxConns = int32(s.cfg.maxConns)
+	}
+
+	if s.cfg.minConns > 0 {
+		poolCfg.MinConns = int32(s.cfg.minConns)
+	}
 
-func (s *Storage) connectToDatabase() (err error) {
-	dbAddress := fmt.Sprintf("postgres://%s:%s@%s:%s/%s", s.cfg.user, s.cfg.password, s.cfg.host, s.cfg.port, s.cfg.database)
+	poolCfg.HealthCheckPeriod = s.cfg.healthCheckPeriod
+	poolCfg.ConnConfig.StatementCacheCapacity = s.cfg.statementCache
+
+	if s.cfg.statementCache == 0 {
+		poolCfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeDescribeExec
+	}
 
-	s.db, err = sql.Open("pgx", dbAddress)
+	s.db, err = pgxpool.NewWithConfig(ctx, poolCfg)
 
 	if err == nil {
-		err = s.db.Ping()
+		err = s.db.Ping(ctx)
+
+		if err != nil {
+			s.db.Close()
+		}
 	}
 
 	if err == nil {
-		log.Info().Msg(fmt.Sprintf("Successfully connected to DB at %s", dbAddress))
+		log.Info().Msg(fmt.Sprintf("Successfully connected to DB at %s (max %d connections)", dbAddress.Redacted(), poolCfg.MaxConns))
 	}
 
 	return err
 }
 
-func (s *Storage) prepareQueries() (err error) {
-	s.queries = make(map[query]*sql.Stmt)
+// Queries are prepared on one connection to make sure they match the database schema.
+func (s *Storage) prepareQueries(ctx context.Context) error {
+	conn, err := s.db.Acquire(ctx)
 
-	for _, q := range queriesToPrepare() {
-		err = errors.Join(err, s.prepare(q))
+	if err != nil {
+		return err
 	}
 
-	return err
-}
+	defer conn.Release()
+
+	for _, q := range queriesToPrepare() {
+		_, prepareErr := conn.Conn().Prepare(ctx, "", q.text())
+		err = errors.Join(err, prepareErr)
+	}
 
-func (s *Storage) prepare(q query) (err error) {
-	s.queries[q], err = s.db.Prepare(q.text())
 	return err
 }
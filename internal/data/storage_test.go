@@ -0,0 +1,68 @@
+package data_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/barpav/msg-messages/internal/data"
+	"github.com/barpav/msg-messages/internal/rest"
+	"github.com/barpav/msg-messages/internal/storagetest"
+)
+
+// Requires running database (see compose-debug.yaml), skipped otherwise.
+// Connection is configured the same way as for the service (MSG_STORAGE_* environment variables).
+func TestStorage_conformance(t *testing.T) {
+	s := &data.Storage{}
+
+	if err := s.Open(); err != nil {
+		t.Skipf("database is not available: %s", err)
+	}
+
+	t.Cleanup(func() {
+		s.Close(context.Background())
+	})
+
+	storagetest.Run(t, func(t *testing.T) rest.Storage {
+		return s
+	})
+}
+
+// Storage is closed on shutdown even if it failed to connect to the database.
+func TestStorage_Close_notConnected(t *testing.T) {
+	s := &data.Storage{}
+	require.NoError(t, s.Close(context.Background()))
+}
+
+// Requires running database, skipped otherwise (see TestStorage_conformance).
+func TestStorage_FileUsage_relayPaused(t *testing.T) {
+	ctx := context.Background()
+	s := &data.Storage{}
+
+	if err := s.Open(); err != nil {
+		t.Skipf("database is not available: %s", err)
+	}
+
+	t.Cleanup(func() {
+		s.ResumeFileUsageRelay(ctx)
+		s.Close(ctx)
+	})
+
+	require.NoError(t, s.ResumeFileUsageRelay(ctx))
+
+	_, err := s.FileUsage(ctx)
+	require.IsType(t, &data.ErrFileUsageRelayNotPaused{}, err)
+
+	require.NoError(t, s.PauseFileUsageRelay(ctx))
+
+	relayed, err := s.RelayFileUsage(ctx, 100, func(fileId string, inUse bool) error {
+		t.Errorf("file usage event of '%s' relayed while the relay is paused", fileId)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Zero(t, relayed)
+
+	_, err = s.FileUsage(ctx)
+	require.NoError(t, err)
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/barpav/msg-messages/internal/events"
+)
+
+type queryVotePoll struct{}
+
+func (q queryVotePoll) text() string {
+	return `
+	WITH update_constraints AS (
+		SELECT
+			COALESCE(is_deleted, false) AS message_deleted,
+			event_timestamp = $1 AS timestamp_match,
+			ARRAY(SELECT option_index FROM poll_votes WHERE message_id = $3 AND user_id = $4 ORDER BY 1)
+				IS DISTINCT FROM ARRAY(SELECT DISTINCT unnest($2::int[]) ORDER BY 1) AS votes_modified
+		FROM messages
+		WHERE id = $3
+		FOR UPDATE
+	),
+	update_try AS (
+		UPDATE messages SET
+			event_timestamp = nextval('timeline')
+		WHERE id = $3
+			AND COALESCE(is_deleted, false) = false
+			AND event_timestamp = $1
+			AND ARRAY(SELECT option_index FROM poll_votes WHERE message_id = $3 AND user_id = $4 ORDER BY 1)
+				IS DISTINCT FROM ARRAY(SELECT DISTINCT unnest($2::int[]) ORDER BY 1)
+		RETURNING
+			id AS id,
+			event_timestamp AS new_timestamp,
+			sender AS sender,
+			receiver AS receiver
+	)
+	SELECT
+		COALESCE(update_try.id, 0) AS id,
+		COALESCE(update_try.new_timestamp, 0) AS new_timestamp,
+		update_constraints.message_deleted AS message_deleted,
+		update_constraints.timestamp_match AS timestamp_match,
+		update_constraints.votes_modified AS votes_modified,
+		COALESCE(update_try.sender, '') AS sender,
+		COALESCE(update_try.receiver, '') AS receiver
+	FROM update_constraints
+		LEFT OUTER JOIN update_try
+		ON true;
+	`
+}
+
+type queryDeleteUserPollVotes struct{}
+
+func (q queryDeleteUserPollVotes) text() string {
+	return `
+	DELETE FROM poll_votes
+	WHERE message_id = $1 AND user_id = $2;
+	`
+}
+
+type queryCreatePollVotes struct{}
+
+func (q queryCreatePollVotes) text() string {
+	return `
+	INSERT INTO poll_votes (message_id, user_id, option_index)
+	SELECT DISTINCT $1::bigint, $2::varchar, unnest($3::int[]);
+	`
+}
+
+type queryDeletePollVotes struct{}
+
+func (q queryDeletePollVotes) text() string {
+	return `
+	DELETE FROM poll_votes
+	WHERE message_id = $1;
+	`
+}
+
+// Tallies are visible to both participants, so voting changes the message timestamp
+// like any other modification. Options are expected to be validated against the poll.
+func (s *Storage) VotePoll(ctx context.Context, userId string, id, timestamp int64, options []int) (newTimestamp int64, err error) {
+	if options == nil {
+		options = make([]int, 0) // empty array, not NULL
+	}
+
+	replaceVotes := func(batch *pgx.Batch, messageId int64) error {
+		batch.Queue(queryDeleteUserPollVotes{}.text(), messageId, userId)
+
+		if len(options) != 0 { // otherwise vote retracted
+			batch.Queue(queryCreatePollVotes{}.text(), messageId, userId, options)
+		}
+
+		return nil
+	}
+
+	newTimestamp, err = s.modifyMessage(ctx, queryVotePoll{}, events.MessageEdited, replaceVotes, timestamp, options, id, userId)
+	return newTimestamp, err
+}
@@ -0,0 +1,84 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/barpav/msg-messages/internal/rabbitmq"
+)
+
+// Events are published to the topic exchange with the event type as the routing key,
+// so every consumer binds its own queue to the events it needs.
+const exchangeName = "msg.messages.events"
+
+// Publisher to RabbitMQ. Event is considered published when the broker confirms it,
+// so the outbox doesn't mark lost events delivered.
+// Lost connection is redialed in the background (with backoff), and the channel closed by the broker
+// is reopened by the next publishing, so the outbox retries events failed meanwhile (see rabbitmq.Connection).
+type Broker struct {
+	conn rabbitmq.Connection // confirmations are waited one by one
+}
+
+func (b *Broker) Connect() error {
+	cfg := &config{}
+	cfg.Read()
+
+	return b.conn.Connect("message broker", fmt.Sprintf("amqp://%s:%s@%s:%s", cfg.user, cfg.password, cfg.host, cfg.port),
+		declareExchange)
+}
+
+func declareExchange(channel rabbitmq.Channel) error {
+	err := channel.ExchangeDeclare(exchangeName, amqp.ExchangeTopic, true, false, false, false, nil)
+
+	if err == nil {
+		err = channel.Confirm(false)
+	}
+
+	return err
+}
+
+func (b *Broker) Disconnect(ctx context.Context) error {
+	return b.conn.Disconnect(ctx)
+}
+
+func (b *Broker) Reconnect() error {
+	return b.conn.Reconnect()
+}
+
+func (b *Broker) Publish(ctx context.Context, event *Event) error {
+	data, err := json.Marshal(event)
+
+	if err != nil {
+		return fmt.Errorf("failed to serialize '%s' event: %w", event.Type, err)
+	}
+
+	err = b.conn.Publish(func(channel rabbitmq.Channel) error {
+		confirmation, err := channel.PublishWithDeferredConfirmWithContext(ctx, exchangeName, string(event.Type), false, false,
+			amqp.Publishing{
+				ContentType:  "application/json",
+				DeliveryMode: amqp.Persistent,
+				Body:         data,
+			})
+
+		var acked bool
+		if err == nil {
+			acked, err = confirmation.WaitContext(ctx)
+		}
+
+		if err == nil && !acked {
+			err = errors.New("not acknowledged by the broker")
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to publish '%s' event of message '%d': %w", event.Type, event.MessageId, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package events
+
+import "os"
+
+const (
+	defaultHost     = "localhost"
+	defaultPort     = "5672"
+	defaultUser     = "guest"
+	defaultPassword = "guest"
+)
+
+const (
+	envVarHost     = "MSG_EVENTS_HOST"
+	envVarPort     = "MSG_EVENTS_PORT"
+	envVarUser     = "MSG_EVENTS_USER"
+	envVarPassword = "MSG_EVENTS_PASSWORD"
+)
+
+type config struct {
+	host     string
+	port     string
+	user     string
+	password string
+}
+
+func (c *config) Read() {
+	readSetting(envVarHost, defaultHost, &c.host)
+	readSetting(envVarPort, defaultPort, &c.port)
+	readSetting(envVarUser, defaultUser, &c.user)
+	readSetting(envVarPassword, defaultPassword, &c.password)
+}
+
+func readSetting(setting, defaultValue string, result *string) {
+	*result = os.Getenv(setting)
+
+	if *result == "" {
+		*result = defaultValue
+	}
+}
@@ -0,0 +1,29 @@
+// Package events defines domain events of the messages, which are published to the message broker
+// for other services (e.g. notifications, analytics, search). Events are written by the storage
+// in the same transactions as the changes they are about and relayed by the outbox (internal/outbox).
+package events
+
+import "context"
+
+type Type string
+
+const (
+	MessageCreated          Type = "MessageCreated"
+	MessageEdited           Type = "MessageEdited"           // text, envelope, attachments or poll votes
+	MessageReadStateChanged Type = "MessageReadStateChanged" // not published when read receipts are hidden
+	MessageDeleted          Type = "MessageDeleted"
+)
+
+// Timestamp is the one the message got with the change, so consumers can skip outdated events
+// (delivery is at-least-once and events of different messages can be relayed by different replicas).
+type Event struct {
+	Type      Type   `json:"type"`
+	MessageId int64  `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+	Sender    string `json:"sender"`
+	Receiver  string `json:"receiver"`
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, event *Event) error
+}
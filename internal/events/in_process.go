@@ -0,0 +1,43 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// In-process stand-in for the message broker (e.g. for tests): events are passed to the subscribers
+// synchronously, in the order of publishing.
+type InProcess struct {
+	mu          sync.Mutex
+	subscribers []func(event *Event)
+	published   []*Event
+}
+
+func (p *InProcess) Subscribe(handler func(event *Event)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.subscribers = append(p.subscribers, handler)
+}
+
+func (p *InProcess) Publish(ctx context.Context, event *Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	published := *event
+	p.published = append(p.published, &published)
+
+	for _, handler := range p.subscribers {
+		handler(&published)
+	}
+
+	return nil
+}
+
+// Returns all events published so far.
+func (p *InProcess) Published() []*Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*Event(nil), p.published...)
+}
@@ -0,0 +1,125 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+type block struct {
+	hideConversation bool
+	created          time.Time
+	timestamp        int64
+}
+
+func (s *Storage) BlockUser(ctx context.Context, userId, blockedUser string, hideConversation bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, found := s.blocks[userPair{userId, blockedUser}]
+
+	switch {
+	case !found:
+		b = &block{hideConversation: hideConversation, created: now(), timestamp: s.nextTimestamp()}
+		s.blocks[userPair{userId, blockedUser}] = b
+	case b.hideConversation == hideConversation:
+		return nil // already blocked
+	default:
+		b.timestamp = s.nextTimestamp()
+	}
+
+	hidden := found && b.hideConversation
+	b.hideConversation = hideConversation
+	s.writeUserUpdate(userId, b.timestamp, models.UpdateTypeBlock, blockedUser)
+
+	if hidden && !hideConversation {
+		s.restoreConversationUpdates(userId, blockedUser)
+	}
+
+	return nil
+}
+
+func (s *Storage) UnblockUser(ctx context.Context, userId, blockedUser string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, found := s.blocks[userPair{userId, blockedUser}]
+
+	if !found {
+		return nil // not blocked
+	}
+
+	delete(s.blocks, userPair{userId, blockedUser})
+	s.writeUserUpdate(userId, s.nextTimestamp(), models.UpdateTypeBlock, blockedUser)
+
+	if b.hideConversation {
+		s.restoreConversationUpdates(userId, blockedUser)
+	}
+
+	return nil
+}
+
+// Writes conversation messages to the user's timeline again,
+// so previously hidden conversation is received by the user's clients while syncing.
+func (s *Storage) restoreConversationUpdates(userId, counterpart string) {
+	for _, m := range s.conversationMessages(userId, counterpart) {
+		if m.visibleTo(userId) {
+			s.writeMessageUpdate(userId, s.nextTimestamp(), m.id)
+		}
+	}
+}
+
+func (s *Storage) senderBlocked(receiver, sender string) bool {
+	_, blocked := s.blocks[userPair{receiver, sender}]
+	return blocked
+}
+
+func (s *Storage) conversationHidden(userId, counterpart string) bool {
+	b, blocked := s.blocks[userPair{userId, counterpart}]
+	return blocked && b.hideConversation
+}
+
+func (s *Storage) BlockedUsersV1(ctx context.Context, userId string) (*models.BlockedUsersV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	blocked := &models.BlockedUsersV1{Users: make([]*models.BlockedUserV1, 0)}
+
+	for pair, b := range s.blocks {
+		if pair.user == userId {
+			blocked.Users = append(blocked.Users, blockedUserV1(pair.other, b))
+		}
+	}
+
+	sort.Slice(blocked.Users, func(i, j int) bool {
+		return blocked.Users[i].User < blocked.Users[j].User
+	})
+
+	blocked.Total = len(blocked.Users)
+
+	return blocked, nil
+}
+
+func (s *Storage) BlockedUserV1(ctx context.Context, userId, blockedUser string) (*models.BlockedUserV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, found := s.blocks[userPair{userId, blockedUser}]
+
+	if !found {
+		return nil, nil
+	}
+
+	return blockedUserV1(blockedUser, b), nil
+}
+
+func blockedUserV1(userId string, b *block) *models.BlockedUserV1 {
+	return &models.BlockedUserV1{
+		User:             userId,
+		HideConversation: b.hideConversation,
+		Created:          utcTime(&b.created),
+		Timestamp:        b.timestamp,
+	}
+}
@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const defaultIdempotencyKeyTTL = "24h"
+
+const (
+	envVarIdempotencyKeyTTL = "MSG_IDEMPOTENCY_KEY_TTL"
+	envVarEncryptionKeys    = "MSG_ENCRYPTION_KEYS" // not supported, see Storage.Open
+)
+
+type config struct {
+	idempotencyKeyTTL time.Duration
+	encryptionKeys    string
+}
+
+func (c *config) Read() {
+	readDurationSetting(envVarIdempotencyKeyTTL, defaultIdempotencyKeyTTL, &c.idempotencyKeyTTL)
+	c.encryptionKeys = os.Getenv(envVarEncryptionKeys)
+}
+
+func readDurationSetting(setting, defaultValue string, result *time.Duration) {
+	value := os.Getenv(setting)
+
+	if value == "" {
+		value = defaultValue
+	}
+
+	var err error
+	*result, err = time.ParseDuration(value)
+
+	if err != nil || *result <= 0 {
+		log.Warn().Msg(fmt.Sprintf("Invalid %s value '%s', default '%s' is used.", setting, value, defaultValue))
+		*result, _ = time.ParseDuration(defaultValue)
+	}
+}
@@ -0,0 +1,281 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+// Conversation state from the point of view of the user.
+const (
+	conversationAccepted  = "accepted"
+	conversationRequested = "requested" // counterpart's messages are message requests
+	conversationDeclined  = "declined"
+)
+
+type conversation struct {
+	state      string
+	created    time.Time
+	timestamp  int64
+	muted      bool
+	mutedUntil *time.Time
+	archived   bool
+}
+
+// Checks whether the receiver accepts messages from the sender without making any changes:
+// new message request (if needed) is started by startMessageRequest.
+func (s *Storage) checkReceiverAccepts(sender, receiver string) (isRequest bool, err error) {
+	setting := s.userSettings(receiver).IncomingMessages
+
+	if setting == models.IncomingMessagesNobody {
+		return false, &ErrRecipientNotAccepting{recipient: receiver}
+	}
+
+	if sender == receiver {
+		return false, nil // conversation is accepted by sending the message
+	}
+
+	c, found := s.conversations[userPair{receiver, sender}]
+
+	switch {
+	case !found:
+		if setting != models.IncomingMessagesEveryone {
+			return false, &ErrRecipientNotAccepting{recipient: receiver}
+		}
+
+		return true, nil
+	case c.state == conversationDeclined:
+		return false, &ErrRecipientNotAccepting{recipient: receiver}
+	}
+
+	return c.state == conversationRequested, nil
+}
+
+// Must be called after checkReceiverAccepts succeeded.
+func (s *Storage) startMessageRequest(sender, receiver string) {
+	pair := userPair{receiver, sender}
+
+	if _, found := s.conversations[pair]; !found {
+		s.conversations[pair] = &conversation{state: conversationRequested, created: now(), timestamp: s.nextTimestamp()}
+	}
+}
+
+// Marks the conversation as accepted by the user. If there was a message request
+// (even declined one), its messages become ordinary ones.
+func (s *Storage) acceptConversation(userId, counterpart string) {
+	c, found := s.conversations[userPair{userId, counterpart}]
+
+	if !found {
+		s.conversations[userPair{userId, counterpart}] = &conversation{state: conversationAccepted, created: now(), timestamp: s.nextTimestamp()}
+		return
+	}
+
+	if c.state == conversationAccepted {
+		return
+	}
+
+	c.state, c.timestamp = conversationAccepted, s.nextTimestamp()
+
+	for _, m := range s.conversationMessages(userId, counterpart) {
+		if m.sender == counterpart && m.isRequest {
+			m.isRequest = false
+			s.writeMessageUpdate(userId, s.nextTimestamp(), m.id)
+		}
+	}
+
+	s.writeUserUpdate(userId, c.timestamp, models.UpdateTypeRequest, counterpart)
+}
+
+// New incoming message brings archived conversation back.
+func (s *Storage) unarchiveConversation(userId, counterpart string) {
+	c, found := s.conversations[userPair{userId, counterpart}]
+
+	if !found || !c.archived {
+		return
+	}
+
+	c.archived, c.timestamp = false, s.nextTimestamp()
+	s.writeUserUpdate(userId, c.timestamp, models.UpdateTypeConversation, counterpart)
+}
+
+func (s *Storage) AnswerMessageRequest(ctx context.Context, userId, sender string, accepted bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, found := s.conversations[userPair{userId, sender}]
+
+	if !found || c.state != conversationRequested {
+		return &ErrMessageRequestNotFound{}
+	}
+
+	if accepted {
+		s.acceptConversation(userId, sender)
+		return nil
+	}
+
+	c.state, c.timestamp = conversationDeclined, s.nextTimestamp()
+	s.writeUserUpdate(userId, c.timestamp, models.UpdateTypeRequest, sender)
+
+	return nil
+}
+
+func (s *Storage) MessageRequestsV1(ctx context.Context, userId string) (*models.MessageRequestsV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := &models.MessageRequestsV1{Requests: make([]*models.MessageRequestInfoV1, 0)}
+	lastMessages := make(map[string]int64) // last request message id by the counterpart
+
+	for pair, c := range s.conversations {
+		if pair.user != userId || c.state != conversationRequested {
+			continue
+		}
+
+		if _, blocked := s.blocks[userPair{userId, pair.other}]; blocked {
+			continue
+		}
+
+		info := &models.MessageRequestInfoV1{User: pair.other, Created: utcTime(&c.created), Timestamp: c.timestamp}
+
+		for _, m := range s.conversationMessages(userId, pair.other) {
+			if m.sender == pair.other && m.isRequest && !m.deleted {
+				info.Messages++
+				lastMessages[pair.other] = m.id
+			}
+		}
+
+		requests.Requests = append(requests.Requests, info)
+	}
+
+	sort.Slice(requests.Requests, func(i, j int) bool {
+		a, b := requests.Requests[i].User, requests.Requests[j].User
+
+		if lastMessages[a] != lastMessages[b] {
+			return lastMessages[a] > lastMessages[b] // no messages (zero) last
+		}
+
+		return a < b
+	})
+
+	requests.Total = len(requests.Requests)
+
+	return requests, nil
+}
+
+func (s *Storage) ConversationsV1(ctx context.Context, userId string) (*models.ConversationsV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conversations := &models.ConversationsV1{Conversations: make([]*models.ConversationV1, 0)}
+
+	for pair := range s.conversations {
+		if pair.user == userId && !s.conversationHidden(userId, pair.other) {
+			conversations.Conversations = append(conversations.Conversations, s.conversationV1(pair))
+		}
+	}
+
+	sort.Slice(conversations.Conversations, func(i, j int) bool {
+		a, b := conversations.Conversations[i], conversations.Conversations[j]
+
+		if a.LastMessage != b.LastMessage {
+			return a.LastMessage > b.LastMessage // no messages (zero) last
+		}
+
+		return a.User < b.User
+	})
+
+	conversations.Total = len(conversations.Conversations)
+
+	return conversations, nil
+}
+
+func (s *Storage) ConversationV1(ctx context.Context, userId, counterpart string) (*models.ConversationV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pair := userPair{userId, counterpart}
+
+	if _, found := s.conversations[pair]; !found || s.conversationHidden(userId, counterpart) {
+		return nil, nil
+	}
+
+	return s.conversationV1(pair), nil
+}
+
+func (s *Storage) conversationV1(pair userPair) *models.ConversationV1 {
+	c := s.conversations[pair]
+	conversation := &models.ConversationV1{
+		User:      pair.other,
+		State:     c.state,
+		Muted:     c.muted && (c.mutedUntil == nil || c.mutedUntil.After(time.Now())),
+		Archived:  c.archived,
+		Timestamp: c.timestamp,
+	}
+
+	if conversation.Muted {
+		conversation.MutedUntil = utcTime(c.mutedUntil)
+	}
+
+	// Deleted messages and message requests count as well.
+	if messages := s.conversationMessages(pair.user, pair.other); len(messages) != 0 {
+		conversation.LastMessage = messages[len(messages)-1].id
+	}
+
+	return conversation
+}
+
+// Unspecified settings are left unchanged, whereas mute expiration time is reset on any mute state change.
+func (s *Storage) SetConversationSettings(ctx context.Context, userId, counterpart string, settings *models.ConversationSettingsV1) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, found := s.conversations[userPair{userId, counterpart}]
+
+	if !found {
+		return &ErrConversationNotFound{}
+	}
+
+	muted, mutedUntil, archived := c.muted, c.mutedUntil, c.archived
+
+	if settings.Muted != nil {
+		muted, mutedUntil = *settings.Muted, nil
+
+		if muted && settings.MutedUntil != nil {
+			until := settings.MutedUntil.UTC().Truncate(time.Microsecond)
+			mutedUntil = &until
+		}
+	}
+
+	if settings.Archived != nil {
+		archived = *settings.Archived
+	}
+
+	if muted == c.muted && sameTime(mutedUntil, c.mutedUntil) && archived == c.archived {
+		return nil // not modified
+	}
+
+	c.muted, c.mutedUntil, c.archived = muted, mutedUntil, archived
+	c.timestamp = s.nextTimestamp()
+	s.writeUserUpdate(userId, c.timestamp, models.UpdateTypeConversation, counterpart)
+
+	return nil
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
+
+func utcTime(t *time.Time) *models.UtcTime {
+	if t == nil {
+		return nil
+	}
+
+	utc := models.UtcTime(*t)
+	return &utc
+}
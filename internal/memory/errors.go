@@ -0,0 +1,126 @@
+package memory
+
+// Error types implement the same contracts (see internal/rest) as the PostgreSQL storage errors.
+
+type ErrSenderBlocked struct {
+	recipient string
+}
+type ErrRecipientNotAccepting struct {
+	recipient string
+}
+type ErrClientIdConflict struct {
+	messageId int64
+}
+type ErrIdempotencyKeyUsed struct{}
+type ErrIdempotencyKeyMismatch struct{}
+type ErrMessageRequestNotFound struct{}
+type ErrConversationNotFound struct{}
+type ErrMessageDeleted struct{}
+type ErrMessageNotFound struct{}
+type ErrTimestampIsNotMatch struct{}
+type ErrMessageNotModified struct{}
+type ErrMessageEncrypted struct{}
+type ErrMessageNotEncrypted struct{}
+
+func (e *ErrSenderBlocked) Error() string {
+	return "sender is blocked by the receiver"
+}
+
+func (e *ErrSenderBlocked) ImplementsSenderBlockedError() {
+}
+
+func (e *ErrSenderBlocked) Recipient() string {
+	return e.recipient
+}
+
+func (e *ErrRecipientNotAccepting) Error() string {
+	return "receiver does not accept messages from the sender"
+}
+
+func (e *ErrRecipientNotAccepting) ImplementsRecipientNotAcceptingError() {
+}
+
+func (e *ErrRecipientNotAccepting) Recipient() string {
+	return e.recipient
+}
+
+func (e *ErrClientIdConflict) Error() string {
+	return "message with the same client id already exists"
+}
+
+func (e *ErrClientIdConflict) ImplementsClientIdConflictError() {
+}
+
+func (e *ErrClientIdConflict) MessageId() int64 {
+	return e.messageId
+}
+
+func (e *ErrIdempotencyKeyUsed) Error() string {
+	return "idempotency key has already been used"
+}
+
+func (e *ErrIdempotencyKeyUsed) ImplementsIdempotencyKeyUsedError() {
+}
+
+func (e *ErrIdempotencyKeyMismatch) Error() string {
+	return "idempotency key has already been used for another request"
+}
+
+func (e *ErrIdempotencyKeyMismatch) ImplementsIdempotencyKeyMismatchError() {
+}
+
+func (e *ErrMessageRequestNotFound) Error() string {
+	return "message request not found"
+}
+
+func (e *ErrMessageRequestNotFound) ImplementsMessageRequestNotFoundError() {
+}
+
+func (e *ErrConversationNotFound) Error() string {
+	return "conversation not found"
+}
+
+func (e *ErrConversationNotFound) ImplementsConversationNotFoundError() {
+}
+
+func (e *ErrMessageDeleted) Error() string {
+	return "message deleted"
+}
+
+func (e *ErrMessageDeleted) ImplementsMessageDeletedError() {
+}
+
+func (e *ErrMessageNotFound) Error() string {
+	return "message not found"
+}
+
+func (e *ErrMessageNotFound) ImplementsMessageNotFoundError() {
+}
+
+func (e *ErrTimestampIsNotMatch) Error() string {
+	return "message timestamp is not match"
+}
+
+func (e *ErrTimestampIsNotMatch) ImplementsTimestampIsNotMatchError() {
+}
+
+func (e *ErrMessageNotModified) Error() string {
+	return "message has not been modified"
+}
+
+func (e *ErrMessageNotModified) ImplementsMessageNotModifiedError() {
+}
+
+func (e *ErrMessageEncrypted) Error() string {
+	return "message is encrypted"
+}
+
+func (e *ErrMessageEncrypted) ImplementsMessageEncryptedError() {
+}
+
+func (e *ErrMessageNotEncrypted) Error() string {
+	return "message is not encrypted"
+}
+
+func (e *ErrMessageNotEncrypted) ImplementsMessageNotEncryptedError() {
+}
@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+type idempotencyKey struct {
+	fingerprint string
+	messageId   int64
+	timestamp   int64 // message timestamp
+	created     time.Time
+	broadcast   []*models.SentMessageInfoV1 // all the messages of the broadcast, the first one is referred above
+}
+
+// Returns the message previously created by the request with the same idempotency key (if any).
+func (s *Storage) MessageByIdempotencyKey(ctx context.Context, sender string, key *models.IdempotencyKey) (id int64, timestamp int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := s.idempotencyKeys[userPair{sender, key.Key}]
+
+	if saved == nil || s.idempotencyKeyExpired(saved) {
+		return 0, 0, nil
+	}
+
+	if saved.fingerprint != key.Fingerprint {
+		return 0, 0, &ErrIdempotencyKeyMismatch{}
+	}
+
+	return saved.messageId, saved.timestamp, nil
+}
+
+// Returns the broadcast messages previously created by the request with the same idempotency key (if any).
+func (s *Storage) BroadcastByIdempotencyKey(ctx context.Context, sender string, key *models.IdempotencyKey) (*models.SentMessagesV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := s.idempotencyKeys[userPair{sender, key.Key}]
+
+	if saved == nil || s.idempotencyKeyExpired(saved) {
+		return nil, nil
+	}
+
+	if saved.fingerprint != key.Fingerprint {
+		return nil, &ErrIdempotencyKeyMismatch{}
+	}
+
+	sent := &models.SentMessagesV1{Total: len(saved.broadcast)}
+
+	for _, info := range saved.broadcast {
+		sent.Messages = append(sent.Messages, &models.SentMessageInfoV1{To: info.To, Id: info.Id, Timestamp: info.Timestamp})
+	}
+
+	return sent, nil
+}
+
+func (s *Storage) idempotencyKeyUsed(sender string, key *models.IdempotencyKey) bool {
+	saved := s.idempotencyKeys[userPair{sender, key.Key}]
+	return saved != nil && !s.idempotencyKeyExpired(saved)
+}
+
+func (s *Storage) idempotencyKeyExpired(key *idempotencyKey) bool {
+	return !key.created.After(now().Add(-s.cfg.idempotencyKeyTTL))
+}
+
+func (s *Storage) saveIdempotencyKey(sender string, key *models.IdempotencyKey, id, timestamp int64) {
+	for pair, saved := range s.idempotencyKeys {
+		if pair.user == sender && s.idempotencyKeyExpired(saved) {
+			delete(s.idempotencyKeys, pair)
+		}
+	}
+
+	s.idempotencyKeys[userPair{sender, key.Key}] = &idempotencyKey{
+		fingerprint: key.Fingerprint,
+		messageId:   id,
+		timestamp:   timestamp,
+		created:     now(),
+	}
+}
+
+func (s *Storage) saveBroadcastIdempotencyKey(sender string, key *models.IdempotencyKey, sent *models.SentMessagesV1) {
+	s.saveIdempotencyKey(sender, key, sent.Messages[0].Id, sent.Messages[0].Timestamp)
+	saved := s.idempotencyKeys[userPair{sender, key.Key}]
+
+	for _, info := range sent.Messages {
+		saved.broadcast = append(saved.broadcast, &models.SentMessageInfoV1{To: info.To, Id: info.Id, Timestamp: info.Timestamp})
+	}
+}
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/events"
+)
+
+type messageEvent struct {
+	id        int64
+	event     events.Event
+	delivered *time.Time
+}
+
+func (s *Storage) writeMessageEvent(eventType events.Type, m *message) {
+	s.lastEventId++
+	s.messageEvents = append(s.messageEvents, &messageEvent{
+		id: s.lastEventId,
+		event: events.Event{
+			Type:      eventType,
+			MessageId: m.id,
+			Timestamp: m.timestamp,
+			Sender:    m.sender,
+			Receiver:  m.receiver,
+		},
+	})
+}
+
+// Events are published without holding the lock, see RelayFileUsage.
+func (s *Storage) RelayMessageEvents(ctx context.Context, limit int, publish func(event *events.Event) error) (relayed int, err error) {
+	s.mu.Lock()
+	pending := make([]messageEvent, 0, limit)
+
+	for _, e := range s.messageEvents {
+		if len(pending) == limit {
+			break
+		}
+
+		if e.delivered == nil {
+			pending = append(pending, *e)
+		}
+	}
+
+	s.mu.Unlock()
+
+	delivered := make(map[int64]struct{}, len(pending))
+
+	for _, e := range pending {
+		err = publish(&e.event)
+
+		if err != nil {
+			break
+		}
+
+		delivered[e.id] = struct{}{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveredAt := now()
+
+	for _, e := range s.messageEvents {
+		if _, ok := delivered[e.id]; ok {
+			e.delivered = &deliveredAt
+		}
+	}
+
+	return len(delivered), err
+}
+
+func (s *Storage) DeleteDeliveredMessageEvents(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.messageEvents[:0]
+
+	for _, e := range s.messageEvents {
+		if e.delivered == nil || !e.delivered.Before(before) {
+			kept = append(kept, e)
+		}
+	}
+
+	s.messageEvents = kept
+
+	return nil
+}
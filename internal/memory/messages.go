@@ -0,0 +1,319 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/events"
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+type message struct {
+	id          int64
+	timestamp   int64
+	sender      string
+	receiver    string
+	clientId    string
+	created     *time.Time
+	edited      *time.Time
+	read        bool // by the receiver
+	readReceipt bool // seen by the sender
+	text        string
+	entities    []models.TextEntity
+	content     *models.MessageContent
+	envelope    *models.EncryptedEnvelope
+	files       []*attachment
+	votes       map[string][]int // poll option indexes by user
+	isRequest   bool
+	deleted     bool
+}
+
+type attachment struct {
+	id     int64
+	fileId string
+}
+
+// Message data common for all versions of the new message schema.
+type newMessage struct {
+	sender         string
+	receiver       string
+	text           string
+	entities       []models.TextEntity
+	content        *models.MessageContent    // optional
+	envelope       *models.EncryptedEnvelope // optional, instead of text and content
+	files          []string
+	clientId       string                 // optional
+	idempotencyKey *models.IdempotencyKey // optional
+}
+
+func (s *Storage) CreateNewPersonalMessageV1(ctx context.Context, sender string, message *models.NewPersonalMessageV1, key *models.IdempotencyKey) (id int64, timestamp int64, err error) {
+	id, timestamp, err = s.createPersonalMessage(&newMessage{
+		sender:         sender,
+		receiver:       message.To,
+		text:           message.Text,
+		files:          message.Files,
+		clientId:       message.ClientId,
+		idempotencyKey: key,
+	})
+	return id, timestamp, err
+}
+
+func (s *Storage) CreateNewPersonalMessageV2(ctx context.Context, sender string, message *models.NewPersonalMessageV2, key *models.IdempotencyKey) (id int64, timestamp int64, err error) {
+	id, timestamp, err = s.createPersonalMessage(&newMessage{
+		sender:         sender,
+		receiver:       message.To,
+		text:           message.Text,
+		entities:       message.Entities,
+		files:          message.Files,
+		clientId:       message.ClientId,
+		idempotencyKey: key,
+	})
+	return id, timestamp, err
+}
+
+func (s *Storage) CreateNewPersonalMessageV3(ctx context.Context, sender string, message *models.NewPersonalMessageV3, key *models.IdempotencyKey) (id int64, timestamp int64, err error) {
+	id, timestamp, err = s.createPersonalMessage(&newMessage{
+		sender:         sender,
+		receiver:       message.To,
+		text:           message.Text,
+		entities:       message.Entities,
+		content:        message.Content,
+		files:          message.Files,
+		clientId:       message.ClientId,
+		idempotencyKey: key,
+	})
+	return id, timestamp, err
+}
+
+func (s *Storage) CreateNewPersonalMessageV4(ctx context.Context, sender string, message *models.NewPersonalMessageV4, key *models.IdempotencyKey) (id int64, timestamp int64, err error) {
+	id, timestamp, err = s.createPersonalMessage(&newMessage{
+		sender:         sender,
+		receiver:       message.To,
+		envelope:       message.Envelope,
+		files:          message.Files,
+		clientId:       message.ClientId,
+		idempotencyKey: key,
+	})
+	return id, timestamp, err
+}
+
+// There are no transactions to roll back, so everything that may fail is checked before any change is made.
+func (s *Storage) createPersonalMessage(data *newMessage) (id int64, timestamp int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var m *message
+	m, err = newStoredMessage(data)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if s.senderBlocked(data.receiver, data.sender) {
+		return 0, 0, &ErrSenderBlocked{recipient: data.receiver}
+	}
+
+	var isRequest bool
+	isRequest, err = s.checkReceiverAccepts(data.sender, data.receiver)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if data.clientId != "" {
+		id, exists := s.clientIds[userPair{data.sender, data.clientId}]
+
+		if exists {
+			return 0, 0, &ErrClientIdConflict{messageId: id}
+		}
+	}
+
+	if data.idempotencyKey != nil && s.idempotencyKeyUsed(data.sender, data.idempotencyKey) {
+		return 0, 0, &ErrIdempotencyKeyUsed{} // concurrent request with the same key
+	}
+
+	s.acceptConversation(data.sender, data.receiver) // replying means accepting
+	s.startMessageRequest(data.sender, data.receiver)
+	s.unarchiveConversation(data.receiver, data.sender)
+
+	m.isRequest = isRequest
+	s.insertMessage(m, data.files)
+	s.writeFileUsage(data.files, true)
+
+	if data.idempotencyKey != nil {
+		s.saveIdempotencyKey(data.sender, data.idempotencyKey, m.id, m.timestamp)
+	}
+
+	s.writeMessageUpdate(m.sender, m.timestamp, m.id)
+	s.writeReceiverUpdate(m, m.timestamp)
+	s.writeMessageEvent(events.MessageCreated, m)
+
+	return m.id, m.timestamp, nil
+}
+
+// Recipients are checked one by one (the same way as for a personal message) before any message is created.
+func (s *Storage) CreateNewBroadcastMessageV1(ctx context.Context, sender string, data *models.NewBroadcastMessageV1,
+	idempotencyKey *models.IdempotencyKey) (*models.SentMessagesV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, receiver := range data.To {
+		if s.senderBlocked(receiver, sender) {
+			return nil, &ErrSenderBlocked{recipient: receiver}
+		}
+	}
+
+	requests := make([]bool, len(data.To))
+
+	for i, receiver := range data.To {
+		var err error
+		requests[i], err = s.checkReceiverAccepts(sender, receiver)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if idempotencyKey != nil && s.idempotencyKeyUsed(sender, idempotencyKey) {
+		return nil, &ErrIdempotencyKeyUsed{} // concurrent request with the same key
+	}
+
+	for _, receiver := range data.To {
+		s.acceptConversation(sender, receiver)
+		s.startMessageRequest(sender, receiver)
+		s.unarchiveConversation(receiver, sender)
+	}
+
+	created := make([]*message, 0, len(data.To))
+
+	for i, receiver := range data.To {
+		m, err := newStoredMessage(&newMessage{sender: sender, receiver: receiver, text: data.Text})
+
+		if err != nil {
+			return nil, err
+		}
+
+		m.isRequest = requests[i]
+		s.insertMessage(m, nil)
+		created = append(created, m)
+	}
+
+	sent := &models.SentMessagesV1{Messages: make([]*models.SentMessageInfoV1, 0, len(created))}
+
+	for _, m := range created {
+		s.attachFiles(m, data.Files)
+		s.writeFileUsage(data.Files, true) // every message has its own attachments
+		s.writeMessageUpdate(m.sender, m.timestamp, m.id)
+		s.writeReceiverUpdate(m, m.timestamp)
+		s.writeMessageEvent(events.MessageCreated, m)
+		sent.Messages = append(sent.Messages, &models.SentMessageInfoV1{To: m.receiver, Id: m.id, Timestamp: m.timestamp})
+	}
+
+	sent.Total = len(sent.Messages)
+
+	if idempotencyKey != nil {
+		s.saveBroadcastIdempotencyKey(sender, idempotencyKey, sent)
+	}
+
+	return sent, nil
+}
+
+func newStoredMessage(data *newMessage) (m *message, err error) {
+	created := now()
+	m = &message{
+		sender:   data.sender,
+		receiver: data.receiver,
+		clientId: data.clientId,
+		created:  &created,
+		text:     data.text,
+	}
+
+	m.entities, err = storedTextEntities(data.entities)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if data.content != nil {
+		m.content, err = clone(data.content)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if data.envelope != nil {
+		m.envelope, err = clone(data.envelope)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Plain text is stored without text entities (as NULL in the database).
+func storedTextEntities(entities []models.TextEntity) ([]models.TextEntity, error) {
+	if len(entities) == 0 {
+		return nil, nil
+	}
+
+	return clone(entities)
+}
+
+func (s *Storage) insertMessage(m *message, files []string) {
+	s.lastMessageId++
+	m.id = s.lastMessageId
+	m.timestamp = s.nextTimestamp()
+	s.messages[m.id] = m
+
+	if m.clientId != "" {
+		s.clientIds[userPair{m.sender, m.clientId}] = m.id
+	}
+
+	s.attachFiles(m, files)
+}
+
+func (s *Storage) attachFiles(m *message, files []string) {
+	m.files = make([]*attachment, 0, len(files))
+
+	for _, fileId := range files {
+		s.lastFileId++
+		m.files = append(m.files, &attachment{id: s.lastFileId, fileId: fileId})
+	}
+}
+
+func (s *Storage) MessageIdByClientId(ctx context.Context, sender, clientId string) (id int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.clientIds[userPair{sender, clientId}], nil
+}
+
+// Messages between the users in order of creation, from the point of view of the first one.
+func (s *Storage) conversationMessages(userId, counterpart string) []*message {
+	messages := make([]*message, 0)
+
+	for _, m := range s.messages {
+		if m.between(userId, counterpart) {
+			messages = append(messages, m)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].id < messages[j].id
+	})
+
+	return messages
+}
+
+func (m *message) between(userId, counterpart string) bool {
+	return (m.sender == userId && m.receiver == counterpart) || (m.sender == counterpart && m.receiver == userId)
+}
+
+// Message requests are not a part of the receiver's conversation until accepted.
+func (m *message) visibleTo(userId string) bool {
+	return !(m.receiver == userId && m.isRequest)
+}
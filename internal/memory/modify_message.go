@@ -0,0 +1,277 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/barpav/msg-messages/internal/events"
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+// Analogue of the conditional update of the PostgreSQL storage: the message is changed (by apply)
+// only if it's not deleted, its timestamp matches the expected one and the change modifies it.
+// The modified message gets new timestamp, which is written to the timelines of both participants.
+func (s *Storage) modifyMessage(id, timestamp int64, event events.Type, modified func(m *message) bool, apply func(m *message)) (newTimestamp int64, err error) {
+	m, found := s.messages[id]
+
+	switch {
+	case !found:
+		return 0, &ErrMessageNotFound{}
+	case m.deleted:
+		return 0, &ErrMessageDeleted{}
+	case m.timestamp != timestamp:
+		return 0, &ErrTimestampIsNotMatch{}
+	case !modified(m):
+		return 0, &ErrMessageNotModified{}
+	}
+
+	m.timestamp = s.nextTimestamp()
+	apply(m)
+
+	s.writeMessageUpdate(m.sender, m.timestamp, m.id)
+	s.writeReceiverUpdate(m, m.timestamp)
+	s.writeMessageEvent(event, m)
+
+	return m.timestamp, nil
+}
+
+// Plain text replaces formatted one, so text entities (if any) are removed.
+func (s *Storage) EditMessageText(ctx context.Context, id, timestamp int64, text string) (newTimestamp int64, err error) {
+	newTimestamp, err = s.EditMessageTextV2(ctx, id, timestamp, text, nil)
+	return newTimestamp, err
+}
+
+func (s *Storage) EditMessageTextV2(ctx context.Context, id, timestamp int64, text string, entities []models.TextEntity) (newTimestamp int64, err error) {
+	entities, err = storedTextEntities(entities)
+
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m, found := s.messages[id]; found && m.envelope != nil {
+		return 0, &ErrMessageEncrypted{}
+	}
+
+	newTimestamp, err = s.modifyMessage(id, timestamp, events.MessageEdited,
+		func(m *message) bool {
+			return m.text != text || !sameJSON(m.entities, entities)
+		},
+		func(m *message) {
+			edited := now()
+			m.text, m.entities, m.edited = text, entities, &edited
+		},
+	)
+
+	return newTimestamp, err
+}
+
+// Encrypted counterpart of the text editing: the envelope is replaced as a whole.
+// Deleted messages are not encrypted, since their envelope is removed.
+func (s *Storage) EditMessageEnvelope(ctx context.Context, id, timestamp int64, envelope *models.EncryptedEnvelope) (newTimestamp int64, err error) {
+	envelope, err = clone(envelope)
+
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m, found := s.messages[id]; !found || m.envelope == nil {
+		return 0, &ErrMessageNotEncrypted{}
+	}
+
+	newTimestamp, err = s.modifyMessage(id, timestamp, events.MessageEdited,
+		func(m *message) bool {
+			return !sameJSON(m.envelope, envelope)
+		},
+		func(m *message) {
+			edited := now()
+			m.envelope, m.edited = envelope, &edited
+		},
+	)
+
+	return newTimestamp, err
+}
+
+func (s *Storage) EditMessageFiles(ctx context.Context, id, timestamp int64, files []string) (newTimestamp int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newTimestamp, err = s.modifyMessage(id, timestamp, events.MessageEdited,
+		func(m *message) bool {
+			return !sameStrings(attachedFiles(m), files)
+		},
+		func(m *message) {
+			edited := now()
+			m.edited = &edited
+
+			used, unused := models.FilesDifference(attachedFiles(m), files)
+			s.writeFileUsage(used, true)
+			s.writeFileUsage(unused, false)
+
+			s.attachFiles(m, files)
+		},
+	)
+
+	return newTimestamp, err
+}
+
+func attachedFiles(m *message) []string {
+	files := make([]string, 0, len(m.files))
+
+	for _, a := range m.files {
+		files = append(files, a.fileId)
+	}
+
+	return files
+}
+
+// Compares the values regardless of their order.
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	sortedA := append(make([]string, 0, len(a)), a...)
+	sortedB := append(make([]string, 0, len(b)), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Storage) SetMessageReadState(ctx context.Context, id, timestamp int64, read bool) (newTimestamp int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m, found := s.messages[id]; found && s.userSettings(m.receiver).HideReadReceipts {
+		return s.setMessageReadStatePrivately(id, timestamp, read)
+	}
+
+	newTimestamp, err = s.modifyMessage(id, timestamp, events.MessageReadStateChanged,
+		func(m *message) bool {
+			return m.read != read
+		},
+		func(m *message) {
+			m.read, m.readReceipt = read, read
+		},
+	)
+
+	return newTimestamp, err
+}
+
+// Read state is personal in this case, so the change is written only to the receiver's timeline
+// (like message stars), and the message timestamp is returned as is.
+func (s *Storage) setMessageReadStatePrivately(id, timestamp int64, read bool) (newTimestamp int64, err error) {
+	m := s.messages[id]
+
+	switch {
+	case m.deleted:
+		return 0, &ErrMessageDeleted{}
+	case m.timestamp != timestamp:
+		return 0, &ErrTimestampIsNotMatch{}
+	case m.read == read:
+		return 0, &ErrMessageNotModified{}
+	}
+
+	m.read = read
+	s.writeMessageUpdate(m.receiver, s.nextTimestamp(), m.id)
+
+	return timestamp, nil
+}
+
+// Tallies are visible to both participants, so voting changes the message timestamp
+// like any other modification. Options are expected to be validated against the poll.
+func (s *Storage) VotePoll(ctx context.Context, userId string, id, timestamp int64, options []int) (newTimestamp int64, err error) {
+	votes := distinctInts(options)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newTimestamp, err = s.modifyMessage(id, timestamp, events.MessageEdited,
+		func(m *message) bool {
+			current := m.votes[userId]
+
+			if len(current) != len(votes) {
+				return true
+			}
+
+			for i := range current {
+				if current[i] != votes[i] {
+					return true
+				}
+			}
+
+			return false
+		},
+		func(m *message) {
+			if len(votes) == 0 {
+				delete(m.votes, userId) // vote retracted
+				return
+			}
+
+			if m.votes == nil {
+				m.votes = make(map[string][]int)
+			}
+
+			m.votes[userId] = votes
+		},
+	)
+
+	return newTimestamp, err
+}
+
+// Returns sorted unique values.
+func distinctInts(values []int) []int {
+	unique := make(map[int]struct{}, len(values))
+	result := make([]int, 0, len(values))
+
+	for _, value := range values {
+		if _, duplicate := unique[value]; !duplicate {
+			unique[value] = struct{}{}
+			result = append(result, value)
+		}
+	}
+
+	sort.Ints(result)
+
+	return result
+}
+
+func (s *Storage) DeleteMessageData(ctx context.Context, id, timestamp int64) (newTimestamp int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newTimestamp, err = s.modifyMessage(id, timestamp, events.MessageDeleted,
+		func(m *message) bool {
+			return true
+		},
+		func(m *message) {
+			m.created, m.edited = nil, nil
+			m.read, m.readReceipt = false, false
+			m.text, m.entities, m.content, m.envelope = "", nil, nil, nil
+			m.votes = nil
+			m.deleted = true
+
+			s.writeFileUsage(attachedFiles(m), false) // attachments are kept, but no longer used
+
+			for key := range s.stars {
+				if key.messageId == m.id {
+					delete(s.stars, key)
+				}
+			}
+		},
+	)
+
+	return newTimestamp, err
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"time"
+)
+
+// File usage event of the outbox (see internal/outbox).
+type fileUsage struct {
+	id        int64
+	fileId    string
+	inUse     bool
+	created   time.Time
+	delivered *time.Time
+}
+
+func (s *Storage) writeFileUsage(files []string, inUse bool) {
+	created := now()
+
+	for _, fileId := range files {
+		s.lastEventId++
+		s.outbox = append(s.outbox, &fileUsage{id: s.lastEventId, fileId: fileId, inUse: inUse, created: created})
+	}
+}
+
+// Events are sent without holding the lock, the only relay of the process doesn't send them concurrently.
+func (s *Storage) RelayFileUsage(ctx context.Context, limit int, send func(fileId string, inUse bool) error) (relayed int, err error) {
+	s.mu.Lock()
+	pending := make([]fileUsage, 0, limit)
+
+	for _, event := range s.outbox {
+		if len(pending) == limit {
+			break
+		}
+
+		if event.delivered == nil {
+			pending = append(pending, *event)
+		}
+	}
+
+	s.mu.Unlock()
+
+	delivered := make(map[int64]struct{}, len(pending))
+
+	for _, event := range pending {
+		err = send(event.fileId, event.inUse)
+
+		if err != nil {
+			break
+		}
+
+		delivered[event.id] = struct{}{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveredAt := now()
+
+	for _, event := range s.outbox {
+		if _, ok := delivered[event.id]; ok {
+			event.delivered = &deliveredAt
+		}
+	}
+
+	return len(delivered), err
+}
+
+func (s *Storage) DeleteDeliveredFileUsage(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.outbox[:0]
+
+	for _, event := range s.outbox {
+		if event.delivered == nil || !event.delivered.Before(before) {
+			kept = append(kept, event)
+		}
+	}
+
+	s.outbox = kept
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+// Message data common for all versions of the personal message schema.
+type personalMessage struct {
+	id        int64
+	clientId  string
+	timestamp int64
+	from      string
+	to        string
+	created   *time.Time
+	edited    *time.Time
+	read      bool
+	starred   bool
+	text      string
+	entities  []models.TextEntity
+	content   *models.MessageContent
+	envelope  *models.EncryptedEnvelope
+	files     []string
+	deleted   bool
+}
+
+func (s *Storage) PersonalMessageV1(ctx context.Context, userId string, messageId int64) (*models.PersonalMessageV1, error) {
+	message, err := s.personalMessage(userId, messageId)
+
+	if err != nil || message == nil {
+		return nil, err
+	}
+
+	return &models.PersonalMessageV1{
+		Id:        message.id,
+		ClientId:  message.clientId,
+		Timestamp: message.timestamp,
+		From:      message.from,
+		To:        message.to,
+		Created:   utcTime(message.created),
+		Edited:    utcTime(message.edited),
+		Read:      message.read,
+		Starred:   message.starred,
+		Text:      message.text,
+		Files:     message.files,
+		Deleted:   message.deleted,
+	}, nil
+}
+
+func (s *Storage) PersonalMessageV2(ctx context.Context, userId string, messageId int64) (*models.PersonalMessageV2, error) {
+	message, err := s.personalMessage(userId, messageId)
+
+	if err != nil || message == nil {
+		return nil, err
+	}
+
+	return &models.PersonalMessageV2{
+		Id:        message.id,
+		ClientId:  message.clientId,
+		Timestamp: message.timestamp,
+		From:      message.from,
+		To:        message.to,
+		Created:   utcTime(message.created),
+		Edited:    utcTime(message.edited),
+		Read:      message.read,
+		Starred:   message.starred,
+		Text:      message.text,
+		Entities:  message.entities,
+		Files:     message.files,
+		Deleted:   message.deleted,
+	}, nil
+}
+
+func (s *Storage) PersonalMessageV3(ctx context.Context, userId string, messageId int64) (*models.PersonalMessageV3, error) {
+	message, err := s.personalMessage(userId, messageId)
+
+	if err != nil || message == nil {
+		return nil, err
+	}
+
+	return &models.PersonalMessageV3{
+		Id:        message.id,
+		ClientId:  message.clientId,
+		Timestamp: message.timestamp,
+		From:      message.from,
+		To:        message.to,
+		Created:   utcTime(message.created),
+		Edited:    utcTime(message.edited),
+		Read:      message.read,
+		Starred:   message.starred,
+		Text:      message.text,
+		Entities:  message.entities,
+		Content:   message.content,
+		Files:     message.files,
+		Deleted:   message.deleted,
+	}, nil
+}
+
+func (s *Storage) PersonalMessageV4(ctx context.Context, userId string, messageId int64) (*models.PersonalMessageV4, error) {
+	message, err := s.personalMessage(userId, messageId)
+
+	if err != nil || message == nil {
+		return nil, err
+	}
+
+	return &models.PersonalMessageV4{
+		Id:        message.id,
+		ClientId:  message.clientId,
+		Timestamp: message.timestamp,
+		From:      message.from,
+		To:        message.to,
+		Created:   utcTime(message.created),
+		Edited:    utcTime(message.edited),
+		Read:      message.read,
+		Starred:   message.starred,
+		Text:      message.text,
+		Entities:  message.entities,
+		Content:   message.content,
+		Envelope:  message.envelope,
+		Files:     message.files,
+		Deleted:   message.deleted,
+	}, nil
+}
+
+// Returns nil if the message doesn't exist or the user is not its participant.
+func (s *Storage) personalMessage(userId string, messageId int64) (message *personalMessage, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, found := s.messages[messageId]
+
+	if !found || (m.sender != userId && m.receiver != userId) {
+		return nil, nil
+	}
+
+	message = &personalMessage{id: m.id, timestamp: m.timestamp, files: make([]string, 0), deleted: m.deleted}
+
+	if m.sender == userId {
+		message.clientId = m.clientId // for the sender only
+	}
+
+	if m.deleted {
+		return message, nil
+	}
+
+	message.from, message.to = m.sender, m.receiver
+	message.created, message.edited = m.created, m.edited
+	message.text = m.text
+	_, message.starred = s.stars[star{userId, m.id}]
+
+	if m.receiver == userId {
+		message.read = m.read
+	} else {
+		message.read = m.readReceipt
+	}
+
+	message.entities, err = storedTextEntities(m.entities)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if m.content != nil {
+		message.content, err = clone(m.content)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if message.content.Poll != nil {
+			countPollVotes(userId, m.votes, message.content.Poll)
+		}
+	}
+
+	if m.envelope != nil {
+		message.envelope, err = clone(m.envelope)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, a := range m.files {
+		message.files = append(message.files, a.fileId)
+	}
+
+	return message, nil
+}
+
+// Poll tallies are not stored in the content itself, they are calculated from the votes.
+func countPollVotes(userId string, votes map[string][]int, poll *models.PollContent) {
+	for voter, options := range votes {
+		for _, option := range options {
+			if option >= 0 && option < len(poll.Options) {
+				poll.Options[option].Votes++
+				poll.Options[option].Voted = poll.Options[option].Voted || voter == userId
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+func (s *Storage) SearchMessagesV1(ctx context.Context, userId string, params *models.MessageSearchParameters) (*models.MessageSearchResultsV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := parseSearchQuery(params.Query)
+	found := make([]*models.MessageSearchInfoV1, 0)
+
+	for _, m := range s.messages {
+		switch {
+		case m.sender != userId && m.receiver != userId,
+			m.deleted,
+			!m.visibleTo(userId),
+			m.envelope != nil, // encrypted messages cannot be searched by the service
+			params.With != "" && !m.between(userId, params.With),
+			params.Since != nil && m.created.Before(*params.Since),
+			params.Until != nil && !m.created.Before(*params.Until):
+			continue
+		}
+
+		if matched, rank := query.match(m.text); matched {
+			found = append(found, &models.MessageSearchInfoV1{Id: m.id, Timestamp: m.timestamp, Rank: rank})
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Rank != found[j].Rank {
+			return found[i].Rank > found[j].Rank
+		}
+
+		return found[i].Id > found[j].Id
+	})
+
+	results := &models.MessageSearchResultsV1{Total: len(found), Messages: make([]*models.MessageSearchInfoV1, 0, params.Limit)}
+
+	if params.Offset < len(found) {
+		found = found[params.Offset:]
+
+		if len(found) > params.Limit {
+			found = found[:params.Limit]
+		}
+
+		results.Messages = append(results.Messages, found...)
+	}
+
+	return results, nil
+}
+
+// Simplified analogue of websearch_to_tsquery('simple', ...): all words are required,
+// except alternatives separated by 'or', and words prefixed with '-' must be absent.
+type searchQuery [][]searchTerm // conjunction of disjunctions
+
+type searchTerm struct {
+	word    string
+	negated bool
+}
+
+func parseSearchQuery(text string) searchQuery {
+	query := make(searchQuery, 0)
+	alternative := false
+
+	for _, field := range strings.Fields(text) {
+		if strings.EqualFold(field, "or") && len(query) != 0 {
+			alternative = true
+			continue
+		}
+
+		negated := strings.HasPrefix(field, "-")
+
+		for i, word := range searchWords(field) {
+			term := searchTerm{word: word, negated: negated}
+
+			if alternative && i == 0 {
+				query[len(query)-1] = append(query[len(query)-1], term)
+			} else {
+				query = append(query, []searchTerm{term})
+			}
+		}
+
+		alternative = false
+	}
+
+	return query
+}
+
+// Rank is an approximation of ts_rank: the share of the text words found by the query.
+func (q searchQuery) match(text string) (matched bool, rank float32) {
+	if len(q) == 0 {
+		return false, 0
+	}
+
+	words := searchWords(text)
+	occurrences := make(map[string]int, len(words))
+
+	for _, word := range words {
+		occurrences[word]++
+	}
+
+	found := 0
+	counted := make(map[string]bool) // every word is counted once
+
+	for _, alternatives := range q {
+		satisfied := false
+
+		for _, term := range alternatives {
+			count := occurrences[term.word]
+
+			if term.negated {
+				satisfied = satisfied || count == 0
+				continue
+			}
+
+			satisfied = satisfied || count != 0
+
+			if !counted[term.word] {
+				found += count
+				counted[term.word] = true
+			}
+		}
+
+		if !satisfied {
+			return false, 0
+		}
+	}
+
+	if found == 0 {
+		return true, 0
+	}
+
+	return true, float32(found) / float32(len(words))
+}
+
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,34 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+func (s *Storage) UserSettingsV1(ctx context.Context, userId string) (*models.UserSettingsV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings := s.userSettings(userId)
+	return &settings, nil
+}
+
+func (s *Storage) SetUserSettings(ctx context.Context, userId string, settings *models.UserSettingsV1) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settings[userId] = *settings
+	return nil
+}
+
+// Users who haven't changed their settings have the default ones.
+func (s *Storage) userSettings(userId string) models.UserSettingsV1 {
+	settings, found := s.settings[userId]
+
+	if !found {
+		settings = models.UserSettingsV1{IncomingMessages: models.IncomingMessagesEveryone}
+	}
+
+	return settings
+}
@@ -0,0 +1,61 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+func (s *Storage) SharedFilesV1(ctx context.Context, userId, counterpart string, before int64, limit int) (*models.SharedFilesV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type sharedFile struct {
+		attachment *attachment
+		message    *message
+	}
+
+	found := make([]sharedFile, 0)
+
+	for _, m := range s.conversationMessages(userId, counterpart) {
+		if m.deleted || !m.visibleTo(userId) {
+			continue
+		}
+
+		for _, a := range m.files {
+			found = append(found, sharedFile{a, m})
+		}
+	}
+
+	files := &models.SharedFilesV1{Total: len(found), Files: make([]*models.SharedFileInfoV1, 0, limit)}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].attachment.id > found[j].attachment.id
+	})
+
+	if before != 0 {
+		found = found[sort.Search(len(found), func(i int) bool {
+			return found[i].attachment.id < before
+		}):]
+	}
+
+	if len(found) > limit {
+		found = found[:limit]
+	}
+
+	for _, f := range found {
+		files.Files = append(files.Files, &models.SharedFileInfoV1{
+			FileId:    f.attachment.fileId,
+			MessageId: f.message.id,
+			From:      f.message.sender,
+			Created:   utcTime(f.message.created),
+		})
+	}
+
+	if len(files.Files) == limit && limit != 0 {
+		files.Next = found[len(found)-1].attachment.id
+	}
+
+	return files, nil
+}
@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+// Stars are personal, so the change is written only to the user's timeline:
+// the message itself (and its timestamp) stays the same for both participants.
+func (s *Storage) SetMessageStar(ctx context.Context, userId string, messageId int64, starred bool) (timestamp int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.messages[messageId]; !found {
+		return 0, &ErrMessageNotFound{}
+	}
+
+	key := star{userId, messageId}
+
+	if _, exists := s.stars[key]; exists == starred {
+		return 0, &ErrMessageNotModified{}
+	}
+
+	timestamp = s.nextTimestamp()
+
+	if starred {
+		s.stars[key] = timestamp
+	} else {
+		delete(s.stars, key)
+	}
+
+	s.writeMessageUpdate(userId, timestamp, messageId)
+
+	return timestamp, nil
+}
+
+func (s *Storage) StarredMessagesV1(ctx context.Context, userId string, before int64, limit int) (*models.StarredMessagesV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type starredMessage struct {
+		starTimestamp int64
+		message       *message
+	}
+
+	found := make([]starredMessage, 0)
+
+	for key, timestamp := range s.stars {
+		m := s.messages[key.messageId]
+
+		if key.user == userId && (before == 0 || timestamp < before) && !m.deleted {
+			found = append(found, starredMessage{timestamp, m})
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].starTimestamp > found[j].starTimestamp
+	})
+
+	if len(found) > limit {
+		found = found[:limit]
+	}
+
+	starred := &models.StarredMessagesV1{Messages: make([]*models.StarredMessageInfoV1, 0, limit)}
+
+	for _, f := range found {
+		starred.Messages = append(starred.Messages, &models.StarredMessageInfoV1{Id: f.message.id, Timestamp: f.message.timestamp})
+	}
+
+	starred.Total = len(starred.Messages)
+
+	if starred.Total == limit && limit != 0 {
+		starred.Next = found[len(found)-1].starTimestamp
+	}
+
+	return starred, nil
+}
@@ -0,0 +1,148 @@
+// Package memory implements the service storage in memory, so the service can be run
+// (and tested end-to-end) without a database. It reproduces the behaviour of the PostgreSQL storage
+// (internal/data): the global timeline, users' updates and optimistic concurrency of message modifications.
+// Data is lost when the service stops.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+// Storage is safe for concurrent use: every operation is performed under a single lock,
+// which makes it serializable the same way as database transactions.
+type Storage struct {
+	mu  sync.Mutex
+	cfg *config
+
+	timeline      int64 // the last timestamp
+	lastMessageId int64
+	lastFileId    int64 // attachment ids define order of shared files
+	lastEventId   int64
+	lastWebhookId int64
+
+	messages        map[int64]*message
+	clientIds       map[userPair]int64 // message id by sender and client id
+	updates         map[string][]*update
+	stars           map[star]int64 // star timestamp
+	blocks          map[userPair]*block
+	settings        map[string]models.UserSettingsV1
+	conversations   map[userPair]*conversation
+	idempotencyKeys map[userPair]*idempotencyKey // by sender and key
+	outbox          []*fileUsage                 // in the order of writing
+	messageEvents   []*messageEvent              // in the order of writing
+	webhooks        map[int64]*webhook
+}
+
+// Ordered pair of users (or user and some value), e.g. user and counterpart.
+type userPair struct {
+	user  string
+	other string
+}
+
+type star struct {
+	user      string
+	messageId int64
+}
+
+type update struct {
+	timestamp   int64
+	entryType   string
+	messageId   int64
+	counterpart string
+}
+
+// Data is not encrypted, so the storage refuses to start with encryption keys
+// rather than keep the data unencrypted contrary to the settings.
+func (s *Storage) Open() error {
+	s.cfg = &config{}
+	s.cfg.Read()
+
+	if s.cfg.encryptionKeys != "" {
+		return fmt.Errorf("encryption at rest is not supported by the in-memory storage (%s must not be specified)", envVarEncryptionKeys)
+	}
+
+	s.messages = make(map[int64]*message)
+	s.clientIds = make(map[userPair]int64)
+	s.updates = make(map[string][]*update)
+	s.stars = make(map[star]int64)
+	s.blocks = make(map[userPair]*block)
+	s.settings = make(map[string]models.UserSettingsV1)
+	s.conversations = make(map[userPair]*conversation)
+	s.idempotencyKeys = make(map[userPair]*idempotencyKey)
+	s.webhooks = make(map[int64]*webhook)
+
+	return nil
+}
+
+func (s *Storage) Close(ctx context.Context) error {
+	return nil
+}
+
+// Analogue of nextval('timeline').
+func (s *Storage) nextTimestamp() int64 {
+	s.timeline++
+	return s.timeline
+}
+
+func (s *Storage) writeUpdate(userId string, u *update) {
+	s.updates[userId] = append(s.updates[userId], u)
+}
+
+// Timestamps of updates written in the same operation are not necessarily ascending.
+func (s *Storage) userUpdates(userId string) []*update {
+	updates := s.updates[userId]
+	sort.SliceStable(updates, func(i, j int) bool {
+		return updates[i].timestamp < updates[j].timestamp
+	})
+	return updates
+}
+
+func (s *Storage) writeMessageUpdate(userId string, timestamp, messageId int64) {
+	s.writeUpdate(userId, &update{timestamp: timestamp, entryType: models.UpdateTypeMessage, messageId: messageId})
+}
+
+func (s *Storage) writeUserUpdate(userId string, timestamp int64, entryType, counterpart string) {
+	s.writeUpdate(userId, &update{timestamp: timestamp, entryType: entryType, counterpart: counterpart})
+}
+
+// Message requests are written to the receiver's timeline as separate entry type.
+func (s *Storage) writeReceiverUpdate(m *message, timestamp int64) {
+	if m.isRequest {
+		s.writeUpdate(m.receiver, &update{timestamp: timestamp, entryType: models.UpdateTypeRequest, messageId: m.id, counterpart: m.sender})
+		return
+	}
+
+	s.writeMessageUpdate(m.receiver, timestamp, m.id)
+}
+
+// Time is stored with the same (microsecond) precision as in the database.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// Stored data must not share memory with the callers' data, like it doesn't in the database.
+func clone[T any](value T) (T, error) {
+	var result T
+	data, err := json.Marshal(value)
+
+	if err != nil {
+		return result, err
+	}
+
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+// Compares values the same way as JSONB columns.
+func sameJSON(a, b any) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(dataA) == string(dataB)
+}
@@ -0,0 +1,25 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/barpav/msg-messages/internal/memory"
+	"github.com/barpav/msg-messages/internal/rest"
+	"github.com/barpav/msg-messages/internal/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) rest.Storage {
+		s := &memory.Storage{}
+		require.NoError(t, s.Open())
+		return s
+	})
+}
+
+func TestStorage_Open_encryptionKeys(t *testing.T) {
+	t.Setenv("MSG_ENCRYPTION_KEYS", "1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")
+
+	s := &memory.Storage{}
+	require.Error(t, s.Open())
+}
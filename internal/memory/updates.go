@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+func (s *Storage) MessageUpdatesV1(ctx context.Context, userId string, after int64, limit int) (*models.MessageUpdatesV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updates := &models.MessageUpdatesV1{Messages: make([]*models.MessageUpdateInfoV1, 0, limit)}
+
+	for _, u := range s.userUpdates(userId) {
+		if len(updates.Messages) == limit {
+			break
+		}
+
+		if u.timestamp <= after || u.entryType != models.UpdateTypeMessage || s.updateHidden(userId, u) {
+			continue
+		}
+
+		updates.Messages = append(updates.Messages, &models.MessageUpdateInfoV1{Id: u.messageId, Timestamp: u.timestamp})
+	}
+
+	updates.Total = len(updates.Messages)
+
+	return updates, nil
+}
+
+func (s *Storage) MessageUpdatesV2(ctx context.Context, userId string, after int64, limit int) (*models.MessageUpdatesV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updates := &models.MessageUpdatesV2{Updates: make([]*models.UpdateInfoV2, 0, limit)}
+
+	for _, u := range s.userUpdates(userId) {
+		if len(updates.Updates) == limit {
+			break
+		}
+
+		if u.timestamp <= after || s.updateHidden(userId, u) {
+			continue
+		}
+
+		updates.Updates = append(updates.Updates, &models.UpdateInfoV2{
+			Type:      u.entryType,
+			Timestamp: u.timestamp,
+			Id:        u.messageId,
+			User:      u.counterpart,
+		})
+	}
+
+	updates.Total = len(updates.Updates)
+
+	return updates, nil
+}
+
+// Messages of the conversations hidden by the user's blocks are not synced.
+func (s *Storage) updateHidden(userId string, u *update) bool {
+	if u.messageId == 0 {
+		return false
+	}
+
+	m := s.messages[u.messageId]
+
+	return s.conversationHidden(userId, m.sender) || s.conversationHidden(userId, m.receiver)
+}
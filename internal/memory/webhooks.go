@@ -0,0 +1,231 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/webhooks"
+)
+
+type webhook struct {
+	id           int64
+	userId       string
+	url          string
+	secret       string
+	enabled      bool
+	autoDisabled bool
+	after        int64
+	failures     int
+	nextAttempt  time.Time
+	created      time.Time
+	deliveries   []models.WebhookDeliveryV1 // in the order of attempts
+}
+
+func (w *webhook) v1() *models.WebhookV1 {
+	return &models.WebhookV1{
+		Id:           w.id,
+		Url:          w.url,
+		Enabled:      w.enabled,
+		AutoDisabled: w.autoDisabled,
+		Failures:     w.failures,
+		After:        w.after,
+		Created:      utcTime(&w.created),
+	}
+}
+
+// New webhook receives only the updates written after its creation.
+func (s *Storage) CreateWebhook(ctx context.Context, userId string, newWebhook *models.NewWebhookV1, secret string) (*models.WebhookV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var after int64
+
+	if updates := s.userUpdates(userId); len(updates) != 0 {
+		after = updates[len(updates)-1].timestamp
+	}
+
+	s.lastWebhookId++
+	created := time.Now().UTC()
+	w := &webhook{
+		id:          s.lastWebhookId,
+		userId:      userId,
+		url:         newWebhook.Url,
+		secret:      secret,
+		enabled:     true,
+		after:       after,
+		nextAttempt: created,
+		created:     created,
+	}
+	s.webhooks[w.id] = w
+
+	result := w.v1()
+	result.Secret = secret
+
+	return result, nil
+}
+
+func (s *Storage) WebhooksV1(ctx context.Context, userId string) (*models.WebhooksV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &models.WebhooksV1{Webhooks: make([]*models.WebhookV1, 0)}
+
+	for _, w := range s.webhooks {
+		if w.userId == userId {
+			result.Webhooks = append(result.Webhooks, w.v1())
+		}
+	}
+
+	sort.Slice(result.Webhooks, func(i, j int) bool {
+		return result.Webhooks[i].Id < result.Webhooks[j].Id
+	})
+
+	result.Total = len(result.Webhooks)
+
+	return result, nil
+}
+
+func (s *Storage) WebhookV1(ctx context.Context, userId string, id int64) (*models.WebhookV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.userWebhook(userId, id)
+
+	if w == nil {
+		return nil, nil
+	}
+
+	return w.v1(), nil
+}
+
+func (s *Storage) userWebhook(userId string, id int64) *webhook {
+	w := s.webhooks[id]
+
+	if w == nil || w.userId != userId {
+		return nil
+	}
+
+	return w
+}
+
+// Enabled webhook is delivered right away, starting from the first undelivered update.
+func (s *Storage) SetWebhookEnabled(ctx context.Context, userId string, id int64, enabled bool) (found bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.userWebhook(userId, id)
+
+	if w == nil {
+		return false, nil
+	}
+
+	w.enabled, w.autoDisabled, w.nextAttempt = enabled, false, time.Now().UTC()
+
+	if enabled {
+		w.failures = 0
+	}
+
+	return true, nil
+}
+
+func (s *Storage) DeleteWebhook(ctx context.Context, userId string, id int64) (found bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userWebhook(userId, id) == nil {
+		return false, nil
+	}
+
+	delete(s.webhooks, id)
+
+	return true, nil
+}
+
+func (s *Storage) WebhookDeliveriesV1(ctx context.Context, userId string, id int64) (*models.WebhookDeliveriesV1, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.userWebhook(userId, id)
+
+	if w == nil {
+		return nil, nil
+	}
+
+	result := &models.WebhookDeliveriesV1{Deliveries: make([]*models.WebhookDeliveryV1, 0, len(w.deliveries))}
+
+	for i := len(w.deliveries) - 1; i >= 0; i-- {
+		delivery := w.deliveries[i]
+		result.Deliveries = append(result.Deliveries, &delivery)
+	}
+
+	result.Total = len(result.Deliveries)
+
+	return result, nil
+}
+
+func (s *Storage) ClaimDueWebhooks(ctx context.Context, limit int, lease time.Duration) ([]*webhooks.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	due := make([]*webhook, 0)
+
+	for _, w := range s.webhooks {
+		if w.enabled && !w.nextAttempt.After(now) {
+			due = append(due, w)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].nextAttempt.Before(due[j].nextAttempt)
+	})
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]*webhooks.Subscription, 0, len(due))
+
+	for _, w := range due {
+		w.nextAttempt = now.Add(lease)
+		claimed = append(claimed, &webhooks.Subscription{
+			Id:       w.id,
+			UserId:   w.userId,
+			Url:      w.url,
+			Secret:   w.secret,
+			After:    w.after,
+			Failures: w.failures,
+		})
+	}
+
+	return claimed, nil
+}
+
+func (s *Storage) SaveWebhookOutcome(ctx context.Context, outcome *webhooks.Outcome) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.webhooks[outcome.WebhookId]
+
+	if w == nil {
+		return nil // deleted meanwhile
+	}
+
+	w.after, w.failures, w.nextAttempt = outcome.After, outcome.Failures, outcome.NextAttempt.UTC()
+
+	if outcome.Disable && w.enabled {
+		w.enabled, w.autoDisabled = false, true
+	}
+
+	if outcome.Delivery != nil {
+		w.deliveries = append(w.deliveries, *outcome.Delivery)
+
+		if len(w.deliveries) > webhooks.DeliveryLogSize {
+			w.deliveries = w.deliveries[len(w.deliveries)-webhooks.DeliveryLogSize:]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package outbox
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultPollInterval = "1s"
+	defaultBatchSize    = 100
+	defaultRetention    = "24h"
+)
+
+const (
+	envVarPollInterval = "MSG_OUTBOX_POLL_INTERVAL" // how often pending events are checked when there are none
+	envVarBatchSize    = "MSG_OUTBOX_BATCH"         // events relayed in one storage transaction
+	envVarRetention    = "MSG_OUTBOX_RETENTION"     // how long delivered events are kept
+)
+
+type config struct {
+	pollInterval time.Duration
+	batchSize    int
+	retention    time.Duration
+}
+
+func (c *config) Read() {
+	readDurationSetting(envVarPollInterval, defaultPollInterval, &c.pollInterval)
+	readIntSetting(envVarBatchSize, defaultBatchSize, &c.batchSize)
+	readDurationSetting(envVarRetention, defaultRetention, &c.retention)
+}
+
+func readDurationSetting(setting, defaultValue string, result *time.Duration) {
+	value := os.Getenv(setting)
+
+	if value == "" {
+		value = defaultValue
+	}
+
+	var err error
+	*result, err = time.ParseDuration(value)
+
+	if err != nil || *result <= 0 {
+		log.Warn().Msg(fmt.Sprintf("Invalid %s value '%s', default '%s' is used.", setting, value, defaultValue))
+		*result, _ = time.ParseDuration(defaultValue)
+	}
+}
+
+func readIntSetting(setting string, defaultValue int, result *int) {
+	*result = defaultValue
+	value := os.Getenv(setting)
+
+	if value == "" {
+		return
+	}
+
+	parsed, err := strconv.Atoi(value)
+
+	if err != nil || parsed <= 0 {
+		log.Warn().Msg(fmt.Sprintf("Invalid %s value '%s', default '%d' is used.", setting, value, defaultValue))
+		return
+	}
+
+	*result = parsed
+}
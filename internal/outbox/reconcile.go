@@ -0,0 +1,112 @@
+package outbox
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Difference between the number of file uses counted by the storage and reported by the files usage statistics.
+type FileUsageDifference struct {
+	FileId   string
+	Expected int
+	Reported int
+}
+
+// Statistics only increments and decrements the counters, so the difference is corrected
+// by the same events as the regular ones: used for missing uses, unused for extra ones.
+func (d *FileUsageDifference) Correction() (inUse bool, events int) {
+	if d.Expected > d.Reported {
+		return true, d.Expected - d.Reported
+	}
+
+	return false, d.Reported - d.Expected
+}
+
+// Files missing in one of the sources have no uses there. Differences are sorted by file id.
+func FileUsageDifferences(expected, reported map[string]int) []*FileUsageDifference {
+	var differences []*FileUsageDifference
+
+	for fileId, uses := range expected {
+		if reported[fileId] != uses {
+			differences = append(differences, &FileUsageDifference{FileId: fileId, Expected: uses, Reported: reported[fileId]})
+		}
+	}
+
+	for fileId, uses := range reported {
+		if _, found := expected[fileId]; !found && uses != 0 {
+			differences = append(differences, &FileUsageDifference{FileId: fileId, Reported: uses})
+		}
+	}
+
+	sort.Slice(differences, func(i, j int) bool {
+		return differences[i].FileId < differences[j].FileId
+	})
+
+	return differences
+}
+
+// Reads the counters of the files usage statistics exported as CSV with file id and uses columns, e.g.
+// 'mongoexport --db=msg --collection=allocatedFiles --type=csv --fields=_id,uses'.
+// The header is optional, file ids may be written as 'ObjectId(...)'.
+func ReadFileUsage(r io.Reader) (map[string]int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	uses := make(map[string]int)
+
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			return uses, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file usage: %w", err)
+		}
+
+		fileId := strings.TrimSuffix(strings.TrimPrefix(record[0], "ObjectId("), ")")
+
+		count := 0
+
+		if record[1] != "" { // files that have never been used have no counter
+			count, err = strconv.Atoi(record[1])
+		}
+
+		if err != nil {
+			if line == 1 {
+				continue // header
+			}
+
+			return nil, fmt.Errorf("invalid uses of file '%s' (line %d): %w", fileId, line, err)
+		}
+
+		uses[fileId] += count
+	}
+}
+
+// Sends corrective events of all the differences. Sending stops at the first failure,
+// the number of sent events is returned anyway, so the rest can be corrected by the next reconciliation.
+func Reconcile(ctx context.Context, fileStats FileStats, differences []*FileUsageDifference) (sent int, err error) {
+	for _, d := range differences {
+		inUse, events := d.Correction()
+
+		for i := 0; i < events; i++ {
+			err = fileStats.SendUsage(ctx, d.FileId, inUse)
+
+			if err != nil {
+				return sent, fmt.Errorf("failed to correct file '%s' usage: %w", d.FileId, err)
+			}
+
+			sent++
+		}
+	}
+
+	return sent, nil
+}
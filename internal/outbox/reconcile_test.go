@@ -0,0 +1,78 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/barpav/msg-messages/internal/outbox"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileUsageDifferences(t *testing.T) {
+	expected := map[string]int{"a": 2, "b": 1, "c": 1}
+	reported := map[string]int{"a": 2, "b": 3, "d": 1, "e": 0}
+
+	differences := outbox.FileUsageDifferences(expected, reported)
+
+	require.Equal(t, []*outbox.FileUsageDifference{
+		{FileId: "b", Expected: 1, Reported: 3},
+		{FileId: "c", Expected: 1, Reported: 0},
+		{FileId: "d", Expected: 0, Reported: 1},
+	}, differences)
+
+	inUse, events := differences[0].Correction()
+	require.False(t, inUse)
+	require.Equal(t, 2, events)
+
+	inUse, events = differences[1].Correction()
+	require.True(t, inUse)
+	require.Equal(t, 1, events)
+}
+
+func TestReadFileUsage(t *testing.T) {
+	uses, err := outbox.ReadFileUsage(strings.NewReader(
+		"_id,uses\nObjectId(000000000000000000000001),2\n000000000000000000000002,\n000000000000000000000003,-1\n",
+	))
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{
+		"000000000000000000000001": 2,
+		"000000000000000000000002": 0,
+		"000000000000000000000003": -1,
+	}, uses)
+
+	_, err = outbox.ReadFileUsage(strings.NewReader("000000000000000000000001,2\n000000000000000000000002,two\n"))
+	require.Error(t, err)
+}
+
+type failingFileStats struct {
+	fileStats
+	failOn int
+}
+
+func (f *failingFileStats) SendUsage(ctx context.Context, fileId string, inUse bool) error {
+	if len(f.sentFiles()) == f.failOn {
+		return errors.New("files usage statistics unavailable")
+	}
+
+	return f.fileStats.SendUsage(ctx, fileId, inUse)
+}
+
+func TestReconcile(t *testing.T) {
+	differences := []*outbox.FileUsageDifference{
+		{FileId: "a", Expected: 3, Reported: 1},
+		{FileId: "b", Expected: 0, Reported: 1},
+	}
+
+	stats := &fileStats{}
+	sent, err := outbox.Reconcile(context.Background(), stats, differences)
+	require.NoError(t, err)
+	require.Equal(t, 3, sent)
+	require.Equal(t, []string{"a", "a", "b"}, stats.sentFiles())
+
+	failing := &failingFileStats{failOn: 1}
+	sent, err = outbox.Reconcile(context.Background(), failing, differences)
+	require.Error(t, err)
+	require.Equal(t, 1, sent)
+}
@@ -0,0 +1,214 @@
+// Package outbox relays the events written by the storage in the same transactions as the data
+// they are about (transactional outbox), so the events are not lost when the service stops
+// or the broker is unavailable: every event is delivered at least once, in the order of writing.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/barpav/msg-messages/internal/events"
+)
+
+const (
+	maxRetryDelay   = time.Minute
+	cleanupInterval = time.Hour
+)
+
+// Every kind of events is relayed independently, so unavailable files usage statistics
+// don't delay message events and vice versa.
+type Relay struct {
+	cfg     *config
+	streams []*stream
+}
+
+type Storage interface {
+	// Passes up to limit pending file usage events to send (in the order of writing) and marks sent ones
+	// delivered. Sending stops at the first failure, which is returned along with the number of sent events.
+	RelayFileUsage(ctx context.Context, limit int, send func(fileId string, inUse bool) error) (relayed int, err error)
+	DeleteDeliveredFileUsage(ctx context.Context, before time.Time) error
+	// The same as RelayFileUsage for message events.
+	RelayMessageEvents(ctx context.Context, limit int, publish func(event *events.Event) error) (relayed int, err error)
+	DeleteDeliveredMessageEvents(ctx context.Context, before time.Time) error
+}
+
+type FileStats interface {
+	SendUsage(ctx context.Context, fileId string, inUse bool) error
+}
+
+// Implemented by the clients keeping connection to RabbitMQ (see rabbitmq.Connection).
+type reconnecter interface {
+	Reconnect() error
+}
+
+type stream struct {
+	name      string
+	relay     func(ctx context.Context, limit int) (relayed int, err error)
+	cleanup   func(ctx context.Context, before time.Time) error
+	reconnect func() error // optional, see reconnectIfClosed
+	stop      chan context.Context
+	stopped   chan struct{}
+}
+
+func (r *Relay) Start(storage Storage, fileStats FileStats, publisher events.Publisher) {
+	r.cfg = &config{}
+	r.cfg.Read()
+
+	r.streams = []*stream{
+		{
+			name: "file usage",
+			relay: func(ctx context.Context, limit int) (int, error) {
+				return storage.RelayFileUsage(ctx, limit, func(fileId string, inUse bool) error {
+					return fileStats.SendUsage(ctx, fileId, inUse)
+				})
+			},
+			cleanup:   storage.DeleteDeliveredFileUsage,
+			reconnect: reconnectOf(fileStats),
+		},
+		{
+			name: "message",
+			relay: func(ctx context.Context, limit int) (int, error) {
+				return storage.RelayMessageEvents(ctx, limit, func(event *events.Event) error {
+					return publisher.Publish(ctx, event)
+				})
+			},
+			cleanup:   storage.DeleteDeliveredMessageEvents,
+			reconnect: reconnectOf(publisher),
+		},
+	}
+
+	for _, s := range r.streams {
+		s.stop = make(chan context.Context, 1)
+		s.stopped = make(chan struct{})
+
+		go s.run(r.cfg)
+	}
+}
+
+func reconnectOf(client any) func() error {
+	if r, ok := client.(reconnecter); ok {
+		return r.Reconnect
+	}
+	return nil
+}
+
+// Pending events are delivered before the relay stops, unless the context is done earlier.
+func (r *Relay) Stop(ctx context.Context) (err error) {
+	for _, s := range r.streams {
+		s.stop <- ctx
+	}
+
+	for _, s := range r.streams {
+		select {
+		case <-s.stopped:
+		case <-ctx.Done():
+			err = errors.Join(err, fmt.Errorf("failed to deliver pending %s events: %w", s.name, ctx.Err()))
+		}
+	}
+
+	return err
+}
+
+func (s *stream) run(cfg *config) {
+	defer close(s.stopped)
+
+	var (
+		delay       time.Duration
+		failures    int
+		lastCleanup time.Time
+	)
+
+	for {
+		select {
+		case ctx := <-s.stop:
+			s.drain(ctx, cfg.batchSize)
+			return
+		case <-time.After(delay):
+		}
+
+		ctx := context.Background()
+		relayed, err := s.relay(ctx, cfg.batchSize)
+
+		switch {
+		case err != nil:
+			failures++
+			delay = retryDelay(cfg.pollInterval, failures)
+
+			if s.reconnectIfClosed(err) {
+				delay = cfg.pollInterval
+			}
+
+			log.Err(err).Msg(fmt.Sprintf("Failed to relay %s events (%d relayed), retrying in %s.", s.name, relayed, delay))
+		case relayed == cfg.batchSize:
+			failures, delay = 0, 0 // there may be more
+		default:
+			failures, delay = 0, cfg.pollInterval
+
+			if time.Since(lastCleanup) >= cleanupInterval {
+				lastCleanup = time.Now()
+				s.deleteDelivered(ctx, cfg.retention)
+			}
+		}
+	}
+}
+
+// Publishing to the closed connection or channel fails with amqp.ErrClosed until it is reopened, so it is reopened
+// at once and the events are retried without backoff. Backoff is still applied while the connection is being redialed.
+func (s *stream) reconnectIfClosed(err error) (reconnected bool) {
+	if s.reconnect == nil || !errors.Is(err, amqp.ErrClosed) {
+		return false
+	}
+
+	err = s.reconnect()
+
+	if err != nil {
+		log.Warn().Msg(fmt.Sprintf("Failed to reconnect to relay %s events: %s", s.name, err))
+		return false
+	}
+
+	return true
+}
+
+// Relays until there are no pending events, the first failure or the context is done.
+func (s *stream) drain(ctx context.Context, batchSize int) {
+	for ctx.Err() == nil {
+		relayed, err := s.relay(ctx, batchSize)
+
+		if err != nil {
+			log.Err(err).Msg(fmt.Sprintf("Failed to relay pending %s events on shutdown, they will be relayed on next start.", s.name))
+			return
+		}
+
+		if relayed < batchSize {
+			return
+		}
+	}
+}
+
+func (s *stream) deleteDelivered(ctx context.Context, retention time.Duration) {
+	err := s.cleanup(ctx, time.Now().UTC().Add(-retention))
+
+	if err != nil {
+		log.Err(err).Msg(fmt.Sprintf("Failed to delete delivered %s events.", s.name))
+	}
+}
+
+// Exponential backoff starting from the poll interval.
+func retryDelay(pollInterval time.Duration, failures int) time.Duration {
+	delay := pollInterval
+
+	for i := 1; i < failures && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	return delay
+}
@@ -0,0 +1,124 @@
+package outbox_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/events"
+	"github.com/barpav/msg-messages/internal/memory"
+	"github.com/barpav/msg-messages/internal/outbox"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+type fileStats struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (f *fileStats) SendUsage(ctx context.Context, fileId string, inUse bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sent = append(f.sent, fileId)
+	return nil
+}
+
+func (f *fileStats) sentFiles() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.sent...)
+}
+
+func TestRelay_Stop(t *testing.T) {
+	t.Setenv("MSG_OUTBOX_POLL_INTERVAL", "1h") // pending events are delivered on stop only
+
+	storage := &memory.Storage{}
+	require.NoError(t, storage.Open())
+
+	stats := &fileStats{}
+	publisher := &events.InProcess{}
+	relay := &outbox.Relay{}
+	relay.Start(storage, stats, publisher)
+
+	ctx := context.Background()
+	id, timestamp, err := storage.CreateNewPersonalMessageV1(ctx, "jane", &models.NewPersonalMessageV1{
+		To:    "john",
+		Files: []string{"000000000000000000000001", "000000000000000000000002"},
+	}, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	require.NoError(t, relay.Stop(ctx))
+	require.Equal(t, []string{"000000000000000000000001", "000000000000000000000002"}, stats.sentFiles())
+	require.Equal(t, []*events.Event{
+		{Type: events.MessageCreated, MessageId: id, Timestamp: timestamp, Sender: "jane", Receiver: "john"},
+	}, publisher.Published())
+}
+
+func TestRelay_Stop_notStarted(t *testing.T) {
+	relay := &outbox.Relay{}
+	require.NoError(t, relay.Stop(context.Background()))
+}
+
+// Files usage statistics with the channel closed until reconnected.
+type closedFileStats struct {
+	fileStats
+	reconnected bool
+	reconnects  int
+}
+
+func (f *closedFileStats) SendUsage(ctx context.Context, fileId string, inUse bool) error {
+	f.mu.Lock()
+	reconnected := f.reconnected
+	f.mu.Unlock()
+
+	if !reconnected {
+		return amqp.ErrClosed
+	}
+
+	return f.fileStats.SendUsage(ctx, fileId, inUse)
+}
+
+func (f *closedFileStats) Reconnect() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.reconnected = true
+	f.reconnects++
+	return nil
+}
+
+func TestRelay_reconnectClosed(t *testing.T) {
+	t.Setenv("MSG_OUTBOX_POLL_INTERVAL", "10ms")
+
+	storage := &memory.Storage{}
+	require.NoError(t, storage.Open())
+
+	_, _, err := storage.CreateNewPersonalMessageV1(context.Background(), "jane", &models.NewPersonalMessageV1{
+		To:    "john",
+		Files: []string{"000000000000000000000001"},
+	}, nil)
+	require.NoError(t, err)
+
+	stats := &closedFileStats{}
+	relay := &outbox.Relay{}
+	relay.Start(storage, stats, &events.InProcess{})
+
+	t.Cleanup(func() {
+		relay.Stop(context.Background())
+	})
+
+	require.Eventually(t, func() bool {
+		return len(stats.sentFiles()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	require.Equal(t, 1, stats.reconnects)
+}
@@ -0,0 +1,50 @@
+package rabbitmq
+
+import (
+	"net"
+	"net/url"
+	"os"
+)
+
+const (
+	defaultHost     = "localhost"
+	defaultPort     = "5672"
+	defaultUser     = "guest"
+	defaultPassword = "guest"
+)
+
+// The same settings as the files usage statistics (github.com/barpav/msg-files) has.
+const (
+	envVarFileStatsHost     = "MSG_FILES_STAT_HOST"
+	envVarFileStatsPort     = "MSG_FILES_STAT_PORT"
+	envVarFileStatsUser     = "MSG_FILES_STAT_USER"
+	envVarFileStatsPassword = "MSG_FILES_STAT_PASSWORD"
+)
+
+type config struct {
+	host     string
+	port     string
+	user     string
+	password string
+}
+
+func (c *config) Read() {
+	readSetting(envVarFileStatsHost, defaultHost, &c.host)
+	readSetting(envVarFileStatsPort, defaultPort, &c.port)
+	readSetting(envVarFileStatsUser, defaultUser, &c.user)
+	readSetting(envVarFileStatsPassword, defaultPassword, &c.password)
+}
+
+// Credentials are escaped, so they may contain any characters.
+func (c *config) url() string {
+	u := &url.URL{Scheme: "amqp", User: url.UserPassword(c.user, c.password), Host: net.JoinHostPort(c.host, c.port)}
+	return u.String()
+}
+
+func readSetting(setting, defaultValue string, result *string) {
+	*result = os.Getenv(setting)
+
+	if *result == "" {
+		*result = defaultValue
+	}
+}
@@ -0,0 +1,291 @@
+// Package rabbitmq keeps the connections of the publishers to RabbitMQ (message events, files usage statistics).
+// Lost connection is redialed in the background (with backoff), and the channel closed by the broker
+// is reopened by the next publishing, so the outbox retries the events failed meanwhile.
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/barpav/msg-messages/internal/backoff"
+)
+
+// Methods of *amqp.Channel used by the publishers.
+type Channel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	Confirm(noWait bool) error
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool,
+		msg amqp.Publishing) (*amqp.DeferredConfirmation, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	IsClosed() bool
+	Close() error
+}
+
+// Methods of *amqp.Connection used by Connection (see amqpConnection).
+type connection interface {
+	Channel() (Channel, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	IsClosed() bool
+	Close() error
+}
+
+type amqpConnection struct {
+	*amqp.Connection
+}
+
+func (c amqpConnection) Channel() (Channel, error) {
+	channel, err := c.Connection.Channel()
+
+	if err != nil {
+		return nil, err // not a typed nil
+	}
+
+	return channel, nil
+}
+
+type Connection struct {
+	name      string // for logs and errors, e.g. "message broker"
+	dial      func() (connection, error)
+	setup     func(channel Channel) error // declares what the publisher uses, called for every opened channel
+	mu        sync.Mutex                  // publishings are made one by one, guards the connection and the channel
+	conn      connection
+	channel   Channel       // nil after it is closed, until Publish reopens it
+	redialing bool          // the only redialing at a time, whoever has noticed the connection is lost
+	closing   chan struct{} // closed by Disconnect, stops redialing
+}
+
+func (c *Connection) Connect(name, url string, setup func(channel Channel) error) error {
+	return c.connect(name, func() (connection, error) {
+		conn, err := amqp.Dial(url)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return amqpConnection{conn}, nil
+	}, setup)
+}
+
+func (c *Connection) connect(name string, dial func() (connection, error), setup func(channel Channel) error) (err error) {
+	c.name, c.dial, c.setup = name, dial, setup
+	c.closing = make(chan struct{})
+
+	err = c.redial()
+
+	if err == nil {
+		c.mu.Lock()
+		err = c.openChannel()
+		c.mu.Unlock()
+	}
+
+	if err != nil {
+		return fmt.Errorf("can't connect to %s: %w", c.name, err)
+	}
+
+	return nil
+}
+
+func (c *Connection) redial() error {
+	conn, err := c.dial()
+
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.closing:
+		conn.Close() // redialed while disconnecting
+		return nil
+	default:
+	}
+
+	c.conn, c.channel = conn, nil
+
+	go c.watchConnection(conn.NotifyClose(make(chan *amqp.Error, 1))) // closed at once if the connection is already lost
+	return nil
+}
+
+// Connection closed by Disconnect is not redialed.
+func (c *Connection) watchConnection(closeErrs chan *amqp.Error) {
+	closeErr := <-closeErrs
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.closing:
+		return
+	default:
+	}
+
+	log.Warn().Msg(fmt.Sprintf("Connection to %s lost, redialing: %v", c.name, closeErr))
+	c.startRedialing()
+}
+
+// Must be called with the mutex locked.
+func (c *Connection) startRedialing() {
+	if !c.redialing {
+		c.redialing = true
+		go c.redialWithBackoff()
+	}
+}
+
+func (c *Connection) redialWithBackoff() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-c.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := backoff.Connect(ctx, c.name, c.redial, nil)
+
+	if err != nil && ctx.Err() == nil {
+		log.Err(err).Msg(fmt.Sprintf("Failed to redial %s.", c.name))
+	}
+
+	c.mu.Lock()
+	c.redialing = false
+	c.mu.Unlock()
+}
+
+// Channel is also closed when its connection is lost.
+func (c *Connection) watchChannel(channel Channel, closeErrs chan *amqp.Error) {
+	closeErr, closed := <-closeErrs
+
+	if closed {
+		log.Warn().Msg(fmt.Sprintf("Channel of %s closed, it will be reopened: %s", c.name, closeErr))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.channel == channel {
+		c.channel = nil
+	}
+}
+
+// Must be called with the mutex locked.
+func (c *Connection) openChannel() error {
+	if c.conn == nil || c.conn.IsClosed() {
+		return fmt.Errorf("not connected to %s (redialing)", c.name)
+	}
+
+	channel, err := c.conn.Channel()
+
+	if err != nil {
+		return err
+	}
+
+	err = c.setup(channel)
+
+	if err != nil {
+		channel.Close()
+		return err
+	}
+
+	c.channel = channel
+	go c.watchChannel(channel, channel.NotifyClose(make(chan *amqp.Error, 1)))
+	return nil
+}
+
+// Publishes with the open channel, reopening it if it has been closed.
+func (c *Connection) Publish(publish func(channel Channel) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.channel == nil || c.channel.IsClosed() {
+		err := c.openChannel()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return publish(c.channel)
+}
+
+// Replaces the channel at once and starts redialing if the connection is lost, for publishers which have got
+// amqp.ErrClosed before the connection or the channel is noticed closed (see watchConnection, watchChannel).
+func (c *Connection) Reconnect() error {
+	if c.closing == nil {
+		return errors.New("not connected")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.closing:
+		return fmt.Errorf("disconnected from %s", c.name)
+	default:
+	}
+
+	if c.conn == nil || c.conn.IsClosed() {
+		c.startRedialing()
+		return fmt.Errorf("not connected to %s (redialing)", c.name)
+	}
+
+	if c.channel != nil {
+		c.channel.Close() // already closed by the broker most likely
+		c.channel = nil
+	}
+
+	return c.openChannel()
+}
+
+func (c *Connection) Disconnect(ctx context.Context) (err error) {
+	if c.closing != nil {
+		select {
+		case <-c.closing:
+		default:
+			close(c.closing)
+		}
+	}
+
+	var closeErr error
+	closed := make(chan struct{}, 1)
+
+	go func() {
+		c.mu.Lock() // waits for the publishing in progress
+		conn, channel := c.conn, c.channel
+		c.mu.Unlock()
+
+		if channel != nil && !channel.IsClosed() {
+			closeErr = errors.Join(closeErr, channel.Close())
+		}
+
+		if conn != nil && !conn.IsClosed() {
+			closeErr = errors.Join(closeErr, conn.Close())
+		}
+
+		closed <- struct{}{}
+	}()
+
+	select {
+	case <-closed:
+		err = closeErr
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to disconnect from %s: %w", c.name, err)
+	}
+
+	return err
+}
@@ -0,0 +1,55 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/barpav/msg-files/statistics"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Queue of the files usage statistics (github.com/barpav/msg-files), usage is sent to it as statistics.FileUsage.
+const fileStatsQueue = "msg.files.statistics"
+
+// Sender of file usage to the files usage statistics. Unlike statistics.Client, it keeps working
+// after the connection is lost or the channel is closed by the broker (see Connection).
+type FileStats struct {
+	conn Connection
+}
+
+func (f *FileStats) Connect() error {
+	cfg := &config{}
+	cfg.Read()
+
+	return f.conn.Connect("files usage statistics", cfg.url(), declareFileStatsQueue)
+}
+
+func declareFileStatsQueue(channel Channel) error {
+	_, err := channel.QueueDeclare(fileStatsQueue, true, false, false, false, nil)
+	return err
+}
+
+func (f *FileStats) Disconnect(ctx context.Context) error {
+	return f.conn.Disconnect(ctx)
+}
+
+func (f *FileStats) Reconnect() error {
+	return f.conn.Reconnect()
+}
+
+func (f *FileStats) SendUsage(ctx context.Context, fileId string, inUse bool) error {
+	data, err := json.Marshal(&statistics.FileUsage{FileId: fileId, InUse: inUse})
+
+	if err == nil {
+		err = f.conn.Publish(func(channel Channel) error {
+			return channel.PublishWithContext(ctx, "", fileStatsQueue, false, false, amqp.Publishing{Body: data})
+		})
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to send usage of file '%s': %w", fileId, err)
+	}
+
+	return nil
+}
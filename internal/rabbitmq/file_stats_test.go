@@ -0,0 +1,310 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/barpav/msg-files/statistics"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStats_connectionLost(t *testing.T) {
+	ctx := context.Background()
+	broker := &fakeBroker{}
+	stats := connectFileStats(t, broker)
+
+	require.NoError(t, stats.SendUsage(ctx, "000000000000000000000001", true))
+
+	broker.loseConnection()
+
+	require.Eventually(t, func() bool {
+		return stats.SendUsage(ctx, "000000000000000000000002", false) == nil
+	}, 5*time.Second, 10*time.Millisecond, "delivery resumed after redialing")
+
+	require.Equal(t, []statistics.FileUsage{
+		{FileId: "000000000000000000000001", InUse: true},
+		{FileId: "000000000000000000000002", InUse: false},
+	}, broker.sentUsage())
+	require.Equal(t, 2, broker.dialed())
+	require.Equal(t, []string{fileStatsQueue, fileStatsQueue}, broker.declaredQueues())
+}
+
+func TestFileStats_channelClosed(t *testing.T) {
+	ctx := context.Background()
+	broker := &fakeBroker{}
+	stats := connectFileStats(t, broker)
+
+	broker.closeChannels()
+
+	require.NoError(t, stats.SendUsage(ctx, "000000000000000000000001", true), "channel reopened")
+	require.Len(t, broker.sentUsage(), 1)
+	require.Equal(t, 1, broker.dialed())
+	require.Equal(t, []string{fileStatsQueue, fileStatsQueue}, broker.declaredQueues())
+}
+
+// Publishing fails with amqp.ErrClosed before the closing is noticed (notified), so the relay asks to reconnect.
+func TestFileStats_Reconnect(t *testing.T) {
+	ctx := context.Background()
+	broker := &fakeBroker{}
+	stats := connectFileStats(t, broker)
+
+	broker.breakChannels()
+
+	err := stats.SendUsage(ctx, "000000000000000000000001", true)
+	require.ErrorIs(t, err, amqp.ErrClosed)
+
+	require.NoError(t, stats.Reconnect())
+	require.NoError(t, stats.SendUsage(ctx, "000000000000000000000001", true))
+	require.Equal(t, 1, broker.dialed())
+	require.Equal(t, []string{fileStatsQueue, fileStatsQueue}, broker.declaredQueues(), "channel replaced")
+
+	broker.breakConnections()
+
+	require.Error(t, stats.Reconnect(), "redialing")
+	require.Eventually(t, func() bool {
+		return stats.SendUsage(ctx, "000000000000000000000002", true) == nil
+	}, 5*time.Second, 10*time.Millisecond, "delivery resumed after redialing")
+	require.Equal(t, 2, broker.dialed())
+}
+
+func TestFileStats_disconnected(t *testing.T) {
+	broker := &fakeBroker{}
+	stats := connectFileStats(t, broker)
+
+	require.NoError(t, stats.Disconnect(context.Background()))
+
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 1, broker.dialed(), "connection closed by Disconnect is not redialed")
+}
+
+func connectFileStats(t *testing.T, broker *fakeBroker) *FileStats {
+	stats := &FileStats{}
+	require.NoError(t, stats.conn.connect("files usage statistics", broker.dial, declareFileStatsQueue))
+
+	t.Cleanup(func() {
+		stats.Disconnect(context.Background())
+	})
+
+	return stats
+}
+
+// RabbitMQ for the connections and channels of the tests, which can be lost (closed with an error) at any time.
+type fakeBroker struct {
+	mu       sync.Mutex
+	conns    []*fakeConnection
+	channels []*fakeChannel
+	queues   []string
+	sent     []statistics.FileUsage
+}
+
+func (b *fakeBroker) dial() (connection, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	conn := &fakeConnection{broker: b}
+	b.conns = append(b.conns, conn)
+	return conn, nil
+}
+
+func (b *fakeBroker) dialed() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.conns)
+}
+
+func (b *fakeBroker) declaredQueues() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.queues...)
+}
+
+func (b *fakeBroker) sentUsage() []statistics.FileUsage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]statistics.FileUsage(nil), b.sent...)
+}
+
+func (b *fakeBroker) loseConnection() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, channel := range b.channels {
+		channel.closeLocked(amqp.ErrClosed)
+	}
+
+	for _, conn := range b.conns {
+		conn.closeLocked(amqp.ErrClosed)
+	}
+}
+
+func (b *fakeBroker) closeChannels() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, channel := range b.channels {
+		channel.closeLocked(&amqp.Error{Code: amqp.PreconditionFailed, Reason: "test"})
+	}
+}
+
+// Closed by the broker, but not noticed by the client yet.
+func (b *fakeBroker) breakChannels() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, channel := range b.channels {
+		channel.broken = true
+	}
+}
+
+// Closed without notifying yet.
+func (b *fakeBroker) breakConnections() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, channel := range b.channels {
+		channel.closed = true
+	}
+
+	for _, conn := range b.conns {
+		conn.closed = true
+	}
+}
+
+// Receivers get the error (if any) and are closed, the same way as by amqp.
+type notifier struct {
+	closed    bool
+	receivers []chan *amqp.Error
+}
+
+func (n *notifier) notifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	if n.closed {
+		close(receiver)
+	} else {
+		n.receivers = append(n.receivers, receiver)
+	}
+
+	return receiver
+}
+
+func (n *notifier) closeLocked(err *amqp.Error) {
+	if n.closed {
+		return
+	}
+
+	n.closed = true
+
+	for _, receiver := range n.receivers {
+		if err != nil {
+			receiver <- err
+		}
+
+		close(receiver)
+	}
+}
+
+type fakeConnection struct {
+	broker *fakeBroker
+	notifier
+}
+
+func (c *fakeConnection) Channel() (Channel, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+
+	channel := &fakeChannel{broker: c.broker}
+	c.broker.channels = append(c.broker.channels, channel)
+	return channel, nil
+}
+
+func (c *fakeConnection) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	return c.notifyClose(receiver)
+}
+
+func (c *fakeConnection) IsClosed() bool {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	return c.closed
+}
+
+func (c *fakeConnection) Close() error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.closeLocked(nil)
+	return nil
+}
+
+type fakeChannel struct {
+	broker *fakeBroker
+	broken bool
+	notifier
+}
+
+func (c *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+
+	c.broker.queues = append(c.broker.queues, name)
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+
+	if c.closed || c.broken {
+		return amqp.ErrClosed
+	}
+
+	usage := statistics.FileUsage{}
+	err := json.Unmarshal(msg.Body, &usage)
+
+	if err != nil {
+		return err
+	}
+
+	c.broker.sent = append(c.broker.sent, usage)
+	return nil
+}
+
+func (c *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return errors.New("not supported")
+}
+
+func (c *fakeChannel) Confirm(noWait bool) error {
+	return errors.New("not supported")
+}
+
+func (c *fakeChannel) PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool,
+	msg amqp.Publishing) (*amqp.DeferredConfirmation, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeChannel) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	return c.notifyClose(receiver)
+}
+
+func (c *fakeChannel) IsClosed() bool {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	return c.closed
+}
+
+func (c *fakeChannel) Close() error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.closeLocked(nil)
+	return nil
+}
@@ -0,0 +1,114 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/go-chi/chi/v5"
+)
+
+const mimeTypeBlockedUsersV1 = "application/vnd.blockedUsers.v1+json"
+const mimeTypeBlockedUserV1 = "application/vnd.blockedUser.v1+json"
+const mimeTypeUserBlockV1 = "application/vnd.userBlock.v1+json"
+
+func (s *Service) getBlockedUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get("Accept") {
+	case "", mimeTypeBlockedUsersV1: // including if not specified
+		s.getBlockedUsersV1(w, r)
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+}
+
+func (s *Service) getBlockedUsersV1(w http.ResponseWriter, r *http.Request) {
+	blocked, err := s.storage.BlockedUsersV1(r.Context(), authenticatedUser(r))
+
+	if err == nil {
+		w.Header().Set("Content-Type", mimeTypeBlockedUsersV1)
+		err = json.NewEncoder(w).Encode(blocked)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get blocked users (v1)")
+		return
+	}
+}
+
+func (s *Service) getBlockedUser(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get("Accept") {
+	case "", mimeTypeBlockedUserV1: // including if not specified
+		s.getBlockedUserV1(w, r)
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+}
+
+func (s *Service) getBlockedUserV1(w http.ResponseWriter, r *http.Request) {
+	blocked, err := s.storage.BlockedUserV1(r.Context(), authenticatedUser(r), chi.URLParam(r, "userId"))
+
+	if err == nil {
+		if blocked == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", mimeTypeBlockedUserV1)
+		err = json.NewEncoder(w).Encode(blocked)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get blocked user (v1)")
+		return
+	}
+}
+
+// Block data is optional: by default, conversation with the blocked user stays visible.
+func (s *Service) blockUser(w http.ResponseWriter, r *http.Request) {
+	block := models.UserBlockV1{}
+
+	switch r.Header.Get("Content-Type") {
+	case "":
+	case mimeTypeUserBlockV1:
+		err := block.Deserialize(r.Body)
+
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	userId := authenticatedUser(r)
+	blockedUser := strings.TrimSpace(chi.URLParam(r, "userId"))
+
+	if blockedUser == "" || blockedUser == userId {
+		http.Error(w, "User cannot block themselves.", 400)
+		return
+	}
+
+	err := s.storage.BlockUser(r.Context(), userId, blockedUser, block.HideConversation)
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to block user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) unblockUser(w http.ResponseWriter, r *http.Request) {
+	err := s.storage.UnblockUser(r.Context(), authenticatedUser(r), strings.TrimSpace(chi.URLParam(r, "userId")))
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to unblock user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
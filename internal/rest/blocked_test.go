@@ -0,0 +1,499 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/barpav/msg-messages/internal/rest/mocks"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_getBlockedUsers(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantBody    *models.BlockedUsersV1
+		wantStatus  int
+	}{
+		{
+			name: "Blocked users received (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/blocked", nil)
+					r.Header.Set("Accept", "application/vnd.blockedUsers.v1+json")
+					return r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("BlockedUsersV1", mock.Anything, "jane").Return(
+						&models.BlockedUsersV1{
+							Total: 1,
+							Users: []*models.BlockedUserV1{{User: "john", HideConversation: true, Timestamp: 77}},
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.blockedUsers.v1+json",
+			},
+			wantBody: &models.BlockedUsersV1{
+				Total: 1,
+				Users: []*models.BlockedUserV1{{User: "john", HideConversation: true, Timestamp: 77}},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Not acceptable (406)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/blocked", nil)
+					r.Header.Set("Accept", "application/json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotAcceptable,
+		},
+		{
+			name: "Server-side issue (500)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/blocked", nil)
+					r.Header.Set("request-id", "test-request-id")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("BlockedUsersV1", mock.Anything, mock.Anything).Return(nil, errors.New("test error"))
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"issue": "test-request-id",
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.getBlockedUsers(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+
+			if tt.wantBody == nil {
+				return
+			}
+
+			var body *models.BlockedUsersV1
+			decoded := models.BlockedUsersV1{}
+			err := json.NewDecoder(tt.args.w.Body).Decode(&decoded)
+
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+
+			if err == nil {
+				body = &decoded
+			}
+
+			require.Equal(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestService_getBlockedUser(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantStatus  int
+	}{
+		{
+			name: "Blocked user received (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/blocked/{userId}", nil)
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("BlockedUserV1", mock.Anything, "jane", "john").Return(&models.BlockedUserV1{User: "john"}, nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.blockedUser.v1+json",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "User is not blocked (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/blocked/{userId}", nil)
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("BlockedUserV1", mock.Anything, "jane", "john").Return(nil, nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.getBlockedUser(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+		})
+	}
+}
+
+func TestService_blockUser(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantStatus  int
+	}{
+		{
+			name: "User blocked - default (204)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PUT", "/blocked/{userId}", nil)
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("BlockUser", mock.Anything, "jane", "john", false).Return(nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNoContent,
+		},
+		{
+			name: "User blocked - conversation hidden (204)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.UserBlockV1{
+						HideConversation: true,
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("PUT", "/blocked/{userId}", &buf)
+					r.Header.Set("Content-Type", "application/vnd.userBlock.v1+json")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("BlockUser", mock.Anything, "jane", "john", true).Return(nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNoContent,
+		},
+		{
+			name: "Blocking themselves (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PUT", "/blocked/{userId}", nil)
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "jane")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Unsupported block data (415)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PUT", "/blocked/{userId}", bytes.NewBufferString("{}"))
+					r.Header.Set("Content-Type", "application/json")
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "Server-side issue (500)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PUT", "/blocked/{userId}", nil)
+					r.Header.Set("request-id", "test-request-id")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("BlockUser", mock.Anything, "jane", "john", false).Return(errors.New("test error"))
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"issue": "test-request-id",
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.blockUser(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+		})
+	}
+}
+
+func TestService_unblockUser(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantStatus  int
+	}{
+		{
+			name: "User unblocked (204)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("DELETE", "/blocked/{userId}", nil)
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("UnblockUser", mock.Anything, "jane", "john").Return(nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNoContent,
+		},
+		{
+			name: "User id with spaces unblocked (204)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("DELETE", "/blocked/{userId}", nil)
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", " john ")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("UnblockUser", mock.Anything, "jane", "john").Return(nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNoContent,
+		},
+		{
+			name: "Server-side issue (500)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("DELETE", "/blocked/{userId}", nil)
+					r.Header.Set("request-id", "test-request-id")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("UnblockUser", mock.Anything, "jane", "john").Return(errors.New("test error"))
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"issue": "test-request-id",
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.unblockUser(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+		})
+	}
+}
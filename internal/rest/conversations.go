@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/go-chi/chi/v5"
+)
+
+const mimeTypeConversationsV1 = "application/vnd.conversations.v1+json"
+const mimeTypeConversationV1 = "application/vnd.conversation.v1+json"
+const mimeTypeConversationSettingsV1 = "application/vnd.conversationSettings.v1+json"
+
+type ErrConversationNotFound interface {
+	Error() string
+	ImplementsConversationNotFoundError()
+}
+
+func (s *Service) getConversations(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get("Accept") {
+	case "", mimeTypeConversationsV1: // including if not specified
+		s.getConversationsV1(w, r)
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+}
+
+func (s *Service) getConversationsV1(w http.ResponseWriter, r *http.Request) {
+	conversations, err := s.storage.ConversationsV1(r.Context(), authenticatedUser(r))
+
+	if err == nil {
+		w.Header().Set("Content-Type", mimeTypeConversationsV1)
+		err = json.NewEncoder(w).Encode(conversations)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get conversations (v1)")
+		return
+	}
+}
+
+func (s *Service) getConversation(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get("Accept") {
+	case "", mimeTypeConversationV1: // including if not specified
+		s.getConversationV1(w, r)
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+}
+
+func (s *Service) getConversationV1(w http.ResponseWriter, r *http.Request) {
+	conversation, err := s.storage.ConversationV1(r.Context(), authenticatedUser(r), chi.URLParam(r, "userId"))
+
+	if err == nil {
+		if conversation == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", mimeTypeConversationV1)
+		err = json.NewEncoder(w).Encode(conversation)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get conversation (v1)")
+		return
+	}
+}
+
+func (s *Service) setConversationSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != mimeTypeConversationSettingsV1 {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	settings := models.ConversationSettingsV1{}
+	err := settings.Deserialize(r.Body)
+
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	err = s.storage.SetConversationSettings(r.Context(), authenticatedUser(r), chi.URLParam(r, "userId"), &settings)
+
+	if err != nil {
+		if _, ok := err.(ErrConversationNotFound); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		logAndReturnErrorWithIssue(w, r, err, "Failed to set conversation settings")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,432 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/barpav/msg-messages/internal/rest/mocks"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_getConversations(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantBody    *models.ConversationsV1
+		wantStatus  int
+	}{
+		{
+			name: "Conversations received (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/conversations", nil)
+					r.Header.Set("Accept", "application/vnd.conversations.v1+json")
+					return r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("ConversationsV1", mock.Anything, "jane").Return(
+						&models.ConversationsV1{
+							Total: 2,
+							Conversations: []*models.ConversationV1{
+								{User: "john", State: "accepted", Muted: true, LastMessage: 42, Timestamp: 99},
+								{User: "bob", State: "accepted", Archived: true, LastMessage: 40, Timestamp: 97},
+							},
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.conversations.v1+json",
+			},
+			wantBody: &models.ConversationsV1{
+				Total: 2,
+				Conversations: []*models.ConversationV1{
+					{User: "john", State: "accepted", Muted: true, LastMessage: 42, Timestamp: 99},
+					{User: "bob", State: "accepted", Archived: true, LastMessage: 40, Timestamp: 97},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Not acceptable (406)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/conversations", nil)
+					r.Header.Set("Accept", "application/json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotAcceptable,
+		},
+		{
+			name: "Server-side issue (500)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/conversations", nil)
+					r.Header.Set("request-id", "test-request-id")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("ConversationsV1", mock.Anything, mock.Anything).Return(nil, errors.New("test error"))
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"issue": "test-request-id",
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.getConversations(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+
+			if tt.wantBody == nil {
+				return
+			}
+
+			var body *models.ConversationsV1
+			decoded := models.ConversationsV1{}
+			err := json.NewDecoder(tt.args.w.Body).Decode(&decoded)
+
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+
+			if err == nil {
+				body = &decoded
+			}
+
+			require.Equal(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestService_getConversation(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantStatus  int
+	}{
+		{
+			name: "Conversation received (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/conversations/{userId}", nil)
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("ConversationV1", mock.Anything, "jane", "john").Return(&models.ConversationV1{User: "john"}, nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.conversation.v1+json",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Conversation not found (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/conversations/{userId}", nil)
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("ConversationV1", mock.Anything, "jane", "john").Return(nil, nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.getConversation(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+		})
+	}
+}
+
+func TestService_setConversationSettings(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantStatus  int
+	}{
+		{
+			name: "Conversation archived (204)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PATCH", "/conversations/{userId}", bytes.NewBufferString(`{"archived": true}`))
+					r.Header.Set("Content-Type", "application/vnd.conversationSettings.v1+json")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("SetConversationSettings", mock.Anything, "jane", "john",
+						mock.MatchedBy(func(settings *models.ConversationSettingsV1) bool {
+							return settings.Muted == nil && settings.Archived != nil && *settings.Archived
+						})).Return(nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNoContent,
+		},
+		{
+			name: "Conversation muted until (204)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PATCH", "/conversations/{userId}",
+						bytes.NewBufferString(`{"muted": true, "mutedUntil": "2999-01-01T00:00:00Z"}`))
+					r.Header.Set("Content-Type", "application/vnd.conversationSettings.v1+json")
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("SetConversationSettings", mock.Anything, mock.Anything, "john",
+						mock.MatchedBy(func(settings *models.ConversationSettingsV1) bool {
+							return settings.Muted != nil && *settings.Muted && settings.MutedUntil.Year() == 2999
+						})).Return(nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNoContent,
+		},
+		{
+			name: "Mute expiration time in the past (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PATCH", "/conversations/{userId}",
+						bytes.NewBufferString(`{"muted": true, "mutedUntil": "2000-01-01T00:00:00Z"}`))
+					r.Header.Set("Content-Type", "application/vnd.conversationSettings.v1+json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "No settings specified (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PATCH", "/conversations/{userId}", bytes.NewBufferString(`{}`))
+					r.Header.Set("Content-Type", "application/vnd.conversationSettings.v1+json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Conversation not found (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PATCH", "/conversations/{userId}", bytes.NewBufferString(`{"muted": false}`))
+					r.Header.Set("Content-Type", "application/vnd.conversationSettings.v1+json")
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("SetConversationSettings", mock.Anything, mock.Anything, "john", mock.Anything).Return(&ErrConversationNotFoundTest{})
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotFound,
+		},
+		{
+			name: "Unsupported settings data (415)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PATCH", "/conversations/{userId}", bytes.NewBufferString(`{"muted": false}`))
+					r.Header.Set("Content-Type", "application/json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "Server-side issue (500)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PATCH", "/conversations/{userId}", bytes.NewBufferString(`{"muted": false}`))
+					r.Header.Set("Content-Type", "application/vnd.conversationSettings.v1+json")
+					r.Header.Set("request-id", "test-request-id")
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("SetConversationSettings", mock.Anything, mock.Anything, "john", mock.Anything).Return(errors.New("test error"))
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"issue": "test-request-id",
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.setConversationSettings(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+		})
+	}
+}
+
+type ErrConversationNotFoundTest struct{}
+
+func (e *ErrConversationNotFoundTest) Error() string {
+	return "conversation not found"
+}
+
+func (e *ErrConversationNotFoundTest) ImplementsConversationNotFoundError() {
+}
@@ -1,14 +1,12 @@
 package rest
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/barpav/msg-messages/internal/rest/models"
 	"github.com/go-chi/chi/v5"
-	"github.com/rs/zerolog/log"
 )
 
 // https://barpav.github.io/msg-api-spec/#/messages/delete_messages__id_
@@ -57,23 +55,14 @@ func (s *Service) deleteMessageData(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if _, ok := err.(ErrMessageNotFound); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
 		logAndReturnErrorWithIssue(w, r, err, "Failed to delete message data")
 		return
 	}
 
-	if len(message.Files) != 0 {
-		go func() {
-			ctx := context.Background()
-
-			for _, fileId := range message.Files {
-				err = s.fileStats.SendUsage(ctx, fileId, false)
-
-				if err != nil {
-					log.Err(err).Msg(fmt.Sprintf("Failed to send unused file '%s' statistics.", fileId))
-				}
-			}
-		}()
-	}
-
 	w.Header()["ETag"] = []string{fmt.Sprintf("%d", newTimestamp)}
 }
@@ -184,6 +184,39 @@ func TestService_deleteMessageData(t *testing.T) {
 			wantHeaders: map[string]string{},
 			wantStatus:  http.StatusGone,
 		},
+		{
+			name: "Message not found by storage (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("DELETE", "/{id}", nil)
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV1", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV1{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Text:      "Hello",
+						},
+						nil)
+					s.On("DeleteMessageData", mock.Anything, int64(42), int64(55)).Return(int64(0),
+						&ErrMessageNotFoundTest{})
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotFound,
+		},
 		{
 			name: "Server-side issue (500)",
 			args: args{
@@ -0,0 +1,272 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/barpav/msg-messages/internal/memory"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/stretchr/testify/require"
+)
+
+// End-to-end tests: requests pass through the whole router (including authentication)
+// to the in-memory storage, so the handlers are tested along with the storage semantics.
+func TestService_endToEnd(t *testing.T) {
+	tests := []struct {
+		name     string
+		scenario func(t *testing.T, c *testClient)
+	}{
+		{
+			name: "Message sent, synced and marked as read",
+			scenario: func(t *testing.T, c *testClient) {
+				c.do("john", "POST", "/", models.NewPersonalMessageV1{To: "jane", Text: "Hi!"}, contentType(mimeTypeNewPersonalMessageV1)).
+					expect(http.StatusCreated)
+
+				sent := c.do("jane", "POST", "/", models.NewPersonalMessageV1{To: "john", Text: "Hello!"}, contentType(mimeTypeNewPersonalMessageV1)).
+					expect(http.StatusCreated)
+				id, timestamp := sent.location(), sent.etag()
+
+				updates := models.MessageUpdatesV1{}
+				c.do("john", "GET", "/", nil).expect(http.StatusOK).decode(&updates)
+				require.Equal(t, 2, updates.Total)
+				require.Equal(t, models.MessageUpdateInfoV1{Id: id, Timestamp: timestamp}, *updates.Messages[1])
+
+				message := receivedMessage{}
+				c.get("john", id, mimeTypePersonalMessageV1).expect(http.StatusOK).decode(&message)
+				require.Equal(t, "jane", message.From)
+				require.Equal(t, "Hello!", message.Text)
+				require.False(t, message.Read)
+
+				read := c.do("john", "PATCH", path(id), models.MessageReadMarkV1{Read: true},
+					contentType(mimeTypeMessageReadMarkV1), ifMatch(timestamp)).expect(http.StatusOK)
+				require.Greater(t, read.etag(), timestamp)
+
+				updates = models.MessageUpdatesV1{}
+				c.do("jane", "GET", "/?after="+strconv.FormatInt(timestamp, 10), nil).expect(http.StatusOK).decode(&updates)
+				require.Equal(t, 1, updates.Total)
+				require.Equal(t, models.MessageUpdateInfoV1{Id: id, Timestamp: read.etag()}, *updates.Messages[0])
+
+				message = receivedMessage{}
+				c.get("jane", id, mimeTypePersonalMessageV1).expect(http.StatusOK).decode(&message)
+				require.True(t, message.Read)
+				require.Equal(t, read.etag(), message.Timestamp)
+
+				c.get("bob", id, mimeTypePersonalMessageV1).expect(http.StatusNotFound)
+			},
+		},
+		{
+			name: "Optimistic locking of message modifications",
+			scenario: func(t *testing.T, c *testClient) {
+				c.do("john", "POST", "/", models.NewPersonalMessageV1{To: "jane", Text: "Hi!"}, contentType(mimeTypeNewPersonalMessageV1)).
+					expect(http.StatusCreated)
+
+				sent := c.do("jane", "POST", "/", models.NewPersonalMessageV1{To: "john", Text: "Hello!"}, contentType(mimeTypeNewPersonalMessageV1)).
+					expect(http.StatusCreated)
+				id, timestamp := sent.location(), sent.etag()
+
+				editText := func(text string, timestamp int64) *testResponse {
+					return c.do("jane", "PATCH", path(id), models.EditedMessageTextV1{Text: text},
+						contentType(mimeTypeEditedMessageTextV1), ifMatch(timestamp))
+				}
+
+				edited := editText("Hello, John!", timestamp).expect(http.StatusOK)
+
+				editText("Hi, John!", timestamp).expect(http.StatusPreconditionFailed)
+				editText("Hello, John!", edited.etag()).expect(http.StatusNotModified)
+				c.do("jane", "DELETE", path(id), nil, ifMatch(timestamp)).expect(http.StatusPreconditionFailed)
+
+				deleted := c.do("jane", "DELETE", path(id), nil, ifMatch(edited.etag())).expect(http.StatusOK)
+
+				c.do("jane", "DELETE", path(id), nil, ifMatch(deleted.etag())).expect(http.StatusGone)
+
+				message := receivedMessage{}
+				c.get("john", id, mimeTypePersonalMessageV1).expect(http.StatusOK).decode(&message)
+				require.Equal(t, receivedMessage{Id: id, Timestamp: deleted.etag(), Deleted: true}, message)
+			},
+		},
+		{
+			name: "Message request accepted",
+			scenario: func(t *testing.T, c *testClient) {
+				sent := c.do("jane", "POST", "/", models.NewPersonalMessageV1{To: "john", Text: "Hello!"}, contentType(mimeTypeNewPersonalMessageV1)).
+					expect(http.StatusCreated)
+				id := sent.location()
+
+				updates := models.MessageUpdatesV2{}
+				c.do("john", "GET", "/", nil, accept(mimeTypeMessageUpdatesV2)).expect(http.StatusOK).decode(&updates)
+				require.Equal(t, 1, updates.Total)
+				require.Equal(t, models.UpdateInfoV2{Type: models.UpdateTypeRequest, Timestamp: sent.etag(), Id: id, User: "jane"},
+					*updates.Updates[0])
+
+				requests := receivedRequests{}
+				c.do("john", "GET", "/requests", nil, accept(mimeTypeMessageRequestsV1)).expect(http.StatusOK).decode(&requests)
+				require.Equal(t, 1, requests.Total)
+				require.Equal(t, 1, requests.Requests[0].Messages)
+
+				c.do("john", "PATCH", "/requests/jane", models.MessageRequestAnswerV1{Accepted: true}, contentType(mimeTypeMessageRequestAnswerV1)).
+					expect(http.StatusNoContent)
+				c.do("john", "PATCH", "/requests/jane", models.MessageRequestAnswerV1{Accepted: true}, contentType(mimeTypeMessageRequestAnswerV1)).
+					expect(http.StatusNotFound)
+
+				updates = models.MessageUpdatesV2{}
+				c.do("john", "GET", "/?after="+strconv.FormatInt(sent.etag(), 10), nil, accept(mimeTypeMessageUpdatesV2)).
+					expect(http.StatusOK).decode(&updates)
+				require.Equal(t, 2, updates.Total)
+				require.Equal(t, models.UpdateInfoV2{Type: models.UpdateTypeRequest, Timestamp: updates.Updates[0].Timestamp, User: "jane"},
+					*updates.Updates[0])
+				require.Equal(t, models.UpdateInfoV2{Type: models.UpdateTypeMessage, Timestamp: updates.Updates[1].Timestamp, Id: id},
+					*updates.Updates[1]) // released message request
+
+				requests = receivedRequests{}
+				c.do("john", "GET", "/requests", nil, accept(mimeTypeMessageRequestsV1)).expect(http.StatusOK).decode(&requests)
+				require.Equal(t, 0, requests.Total)
+			},
+		},
+		{
+			name: "Messages of blocked sender are rejected",
+			scenario: func(t *testing.T, c *testClient) {
+				c.do("john", "PUT", "/blocked/jane", models.UserBlockV1{}, contentType(mimeTypeUserBlockV1)).expect(http.StatusNoContent)
+				c.do("jane", "POST", "/", models.NewPersonalMessageV1{To: "john", Text: "Hello!"}, contentType(mimeTypeNewPersonalMessageV1)).
+					expect(http.StatusForbidden)
+				c.do("john", "DELETE", "/blocked/jane", nil).expect(http.StatusNoContent)
+				c.do("jane", "POST", "/", models.NewPersonalMessageV1{To: "john", Text: "Hello!"}, contentType(mimeTypeNewPersonalMessageV1)).
+					expect(http.StatusCreated)
+			},
+		},
+		{
+			name: "Message resent with the same client id",
+			scenario: func(t *testing.T, c *testClient) {
+				m := models.NewPersonalMessageV1{To: "john", Text: "Hello!", ClientId: "0d5bd2a4-7a6c-4f70-8a39-d1bd13a4bd3e"}
+				sent := c.do("jane", "POST", "/", m, contentType(mimeTypeNewPersonalMessageV1)).expect(http.StatusCreated)
+				resent := c.do("jane", "POST", "/", m, contentType(mimeTypeNewPersonalMessageV1)).expect(http.StatusConflict)
+				require.Equal(t, sent.location(), resent.location())
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &memory.Storage{}
+			require.NoError(t, storage.Open())
+
+			s := &Service{auth: &testAuthenticator{}, storage: storage}
+			tt.scenario(t, &testClient{t: t, handler: s.operations()})
+		})
+	}
+}
+
+// Received data without time fields (models.UtcTime is serialization only).
+type receivedMessage struct {
+	Id        int64
+	Timestamp int64
+	From      string
+	To        string
+	Read      bool
+	Text      string
+	Deleted   bool
+}
+
+type receivedRequests struct {
+	Total    int
+	Requests []struct {
+		User     string
+		Messages int
+	}
+}
+
+// Session key is the user id.
+type testAuthenticator struct{}
+
+func (a *testAuthenticator) ValidateSession(ctx context.Context, key, ip, agent string) (userId string, err error) {
+	return key, nil
+}
+
+type testClient struct {
+	t       *testing.T
+	handler http.Handler
+}
+
+type testResponse struct {
+	t *testing.T
+	w *httptest.ResponseRecorder
+}
+
+type requestOption func(r *http.Request)
+
+func contentType(mimeType string) requestOption {
+	return func(r *http.Request) {
+		r.Header.Set("Content-Type", mimeType)
+	}
+}
+
+func accept(mimeType string) requestOption {
+	return func(r *http.Request) {
+		r.Header.Set("Accept", mimeType)
+	}
+}
+
+func ifMatch(timestamp int64) requestOption {
+	return func(r *http.Request) {
+		r.Header.Set("If-Match", strconv.FormatInt(timestamp, 10))
+	}
+}
+
+// Request body (if any) is encoded to JSON.
+func (c *testClient) do(userId, method, target string, body any, options ...requestOption) *testResponse {
+	var buf bytes.Buffer
+
+	if body != nil {
+		err := json.NewEncoder(&buf).Encode(body)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	r := httptest.NewRequest(method, target, &buf)
+	r.Header.Set("Authorization", "Bearer "+userId)
+
+	for _, option := range options {
+		option(r)
+	}
+
+	w := httptest.NewRecorder()
+	c.handler.ServeHTTP(w, r)
+
+	return &testResponse{t: c.t, w: w}
+}
+
+func (c *testClient) get(userId string, id int64, mimeType string) *testResponse {
+	return c.do(userId, "GET", path(id), nil, accept(mimeType))
+}
+
+func (r *testResponse) expect(status int) *testResponse {
+	require.Equal(r.t, status, r.w.Code, r.w.Body.String())
+	return r
+}
+
+func (r *testResponse) decode(v any) {
+	require.NoError(r.t, json.NewDecoder(r.w.Body).Decode(v))
+}
+
+func (r *testResponse) location() int64 {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.w.Header().Get("Location"), "/"), 10, 0)
+	require.NoError(r.t, err)
+	return id
+}
+
+func (r *testResponse) etag() int64 {
+	etag := r.w.Header()["ETag"] // non-canonical header
+	require.Len(r.t, etag, 1)
+	timestamp, err := strconv.ParseInt(etag[0], 10, 0)
+	require.NoError(r.t, err)
+	return timestamp
+}
+
+func path(id int64) string {
+	return "/" + strconv.FormatInt(id, 10)
+}
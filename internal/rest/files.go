@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+const mimeTypeSharedFilesV1 = "application/vnd.sharedFiles.v1+json"
+
+func (s *Service) getSharedFiles(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get("Accept") {
+	case "", mimeTypeSharedFilesV1: // including if not specified
+		s.getSharedFilesV1(w, r)
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+}
+
+func (s *Service) getSharedFilesV1(w http.ResponseWriter, r *http.Request) {
+	with, before, limit, err := getSharedFilesV1Parameters(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	var files *models.SharedFilesV1
+	files, err = s.storage.SharedFilesV1(r.Context(), authenticatedUser(r), with, before, limit)
+
+	if err == nil {
+		w.Header().Set("Content-Type", mimeTypeSharedFilesV1)
+		err = json.NewEncoder(w).Encode(files)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get shared files (v1)")
+		return
+	}
+}
+
+func getSharedFilesV1Parameters(r *http.Request) (with string, before int64, limit int, err error) {
+	with = strings.TrimSpace(r.URL.Query().Get("with"))
+
+	if with == "" {
+		return "", 0, 0, errors.New("Parameter 'with' must be specified.")
+	}
+
+	var param string
+	param = r.URL.Query().Get("before")
+
+	if param != "" {
+		before, err = strconv.ParseInt(param, 10, 0)
+
+		if err != nil {
+			return "", 0, 0, errors.New("Parameter 'before' must be an integer type.")
+		}
+	}
+
+	param = r.URL.Query().Get("limit")
+
+	if param == "" {
+		return with, before, 50, nil
+	}
+
+	limit, err = strconv.Atoi(param)
+
+	if err != nil {
+		return "", 0, 0, errors.New("Parameter 'limit' must be an integer type.")
+	}
+
+	const limitMin = 1
+	const limitMax = 100
+
+	if limit < limitMin || limit > limitMax {
+		return "", 0, 0, fmt.Errorf("Invalid parameter 'limit': min %d, max %d.", limitMin, limitMax)
+	}
+
+	return with, before, limit, nil
+}
@@ -0,0 +1,207 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/barpav/msg-messages/internal/rest/mocks"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_getSharedFiles(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantBody    *models.SharedFilesV1
+		wantStatus  int
+	}{
+		{
+			name: "Files received - default parameters (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/files?with=john", nil)
+					r.Header.Set("Accept", "application/vnd.sharedFiles.v1+json")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("SharedFilesV1", mock.Anything, mock.Anything, "john", int64(0), 50).Return(
+						&models.SharedFilesV1{
+							Total: 1,
+							Files: []*models.SharedFileInfoV1{
+								{FileId: "64f85a5e2c5c6c2d5a6e6f0a", MessageId: 100, From: "john"},
+							},
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.sharedFiles.v1+json",
+			},
+			wantBody: &models.SharedFilesV1{
+				Total: 1,
+				Files: []*models.SharedFileInfoV1{
+					{FileId: "64f85a5e2c5c6c2d5a6e6f0a", MessageId: 100, From: "john"},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Files received - custom parameters (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/files?with=john&before=300&limit=1", nil)
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("SharedFilesV1", mock.Anything, mock.Anything, "john", int64(300), 1).Return(
+						&models.SharedFilesV1{
+							Total: 1,
+							Files: []*models.SharedFileInfoV1{
+								{FileId: "64f85a5e2c5c6c2d5a6e6f0a", MessageId: 100, From: "jane"},
+							},
+							Next: 250,
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.sharedFiles.v1+json",
+			},
+			wantBody: &models.SharedFilesV1{
+				Total: 1,
+				Files: []*models.SharedFileInfoV1{
+					{FileId: "64f85a5e2c5c6c2d5a6e6f0a", MessageId: 100, From: "jane"},
+				},
+				Next: 250,
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Counterpart not specified (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/files", nil)
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Invalid parameter 'before' (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/files?with=john&before=last", nil)
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Not acceptable (406)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/files?with=john", nil)
+					r.Header.Set("Accept", "application/json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotAcceptable,
+		},
+		{
+			name: "Server-side issue (500)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/files?with=john", nil)
+					r.Header.Set("request-id", "test-request-id")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("SharedFilesV1", mock.Anything, mock.Anything, "john", int64(0), 50).Return(nil, errors.New("test error"))
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"issue": "test-request-id",
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.getSharedFiles(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+
+			if tt.wantBody == nil {
+				return
+			}
+
+			var body *models.SharedFilesV1
+			decoded := models.SharedFilesV1{}
+			err := json.NewDecoder(tt.args.w.Body).Decode(&decoded)
+
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+
+			if err == nil {
+				body = &decoded
+			}
+
+			require.Equal(t, body, tt.wantBody)
+		})
+	}
+}
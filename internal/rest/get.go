@@ -4,18 +4,43 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/barpav/msg-messages/internal/rest/models"
 	"github.com/go-chi/chi/v5"
 )
 
 const mimeTypePersonalMessageV1 = "application/vnd.personalMessage.v1+json"
+const mimeTypePersonalMessageV2 = "application/vnd.personalMessage.v2+json"
+const mimeTypePersonalMessageV3 = "application/vnd.personalMessage.v3+json"
+const mimeTypePersonalMessageV4 = "application/vnd.personalMessage.v4+json"
 
 // https://barpav.github.io/msg-api-spec/#/messages/get_messages__id_
 func (s *Service) getMessageData(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 0)
+	switch r.Header.Get("Accept") {
+	case "", mimeTypePersonalMessageV1: // including if not specified
+		s.getPersonalMessageV1(w, r)
+	case mimeTypePersonalMessageV2:
+		s.getPersonalMessageV2(w, r)
+	case mimeTypePersonalMessageV3:
+		s.getPersonalMessageV3(w, r)
+	case mimeTypePersonalMessageV4:
+		s.getPersonalMessageV4(w, r)
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+}
+
+func (s *Service) getPersonalMessageV1(w http.ResponseWriter, r *http.Request) {
+	id, err := s.requestedMessageId(r)
 
 	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get message id by client id")
+		return
+	}
+
+	if id == 0 {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
@@ -38,3 +63,119 @@ func (s *Service) getMessageData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func (s *Service) getPersonalMessageV2(w http.ResponseWriter, r *http.Request) {
+	id, err := s.requestedMessageId(r)
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get message id by client id")
+		return
+	}
+
+	if id == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var message *models.PersonalMessageV2
+	message, err = s.storage.PersonalMessageV2(r.Context(), authenticatedUser(r), id)
+
+	if err == nil {
+		if message == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", mimeTypePersonalMessageV2)
+		err = json.NewEncoder(w).Encode(message)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get message data (v2)")
+		return
+	}
+}
+
+func (s *Service) getPersonalMessageV3(w http.ResponseWriter, r *http.Request) {
+	id, err := s.requestedMessageId(r)
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get message id by client id")
+		return
+	}
+
+	if id == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var message *models.PersonalMessageV3
+	message, err = s.storage.PersonalMessageV3(r.Context(), authenticatedUser(r), id)
+
+	if err == nil {
+		if message == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", mimeTypePersonalMessageV3)
+		err = json.NewEncoder(w).Encode(message)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get message data (v3)")
+		return
+	}
+}
+
+func (s *Service) getPersonalMessageV4(w http.ResponseWriter, r *http.Request) {
+	id, err := s.requestedMessageId(r)
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get message id by client id")
+		return
+	}
+
+	if id == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var message *models.PersonalMessageV4
+	message, err = s.storage.PersonalMessageV4(r.Context(), authenticatedUser(r), id)
+
+	if err == nil {
+		if message == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", mimeTypePersonalMessageV4)
+		err = json.NewEncoder(w).Encode(message)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get message data (v4)")
+		return
+	}
+}
+
+// Message can be requested either by its id or by the client id specified by the sender.
+// Returns zero id if the message is not found.
+func (s *Service) requestedMessageId(r *http.Request) (id int64, err error) {
+	if clientId := strings.ToLower(chi.URLParam(r, "clientId")); clientId != "" {
+		if !models.ValidClientId(clientId) {
+			return 0, nil
+		}
+
+		return s.storage.MessageIdByClientId(r.Context(), authenticatedUser(r), clientId)
+	}
+
+	id, err = strconv.ParseInt(chi.URLParam(r, "id"), 10, 0)
+
+	if err != nil {
+		return 0, nil
+	}
+
+	return id, nil
+}
@@ -66,6 +66,77 @@ func TestService_getMessageData(t *testing.T) {
 			},
 			wantStatus: http.StatusOK,
 		},
+		{
+			name: "OK - by client id (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/client/{clientId}", nil)
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("clientId", "0F5C7A3E-9B1D-4C2E-8A4F-6D3B2E1C0A9B")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("MessageIdByClientId", mock.Anything, "jane", "0f5c7a3e-9b1d-4c2e-8a4f-6d3b2e1c0a9b").Return(int64(42), nil)
+					s.On("PersonalMessageV1", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV1{
+							Id:        42,
+							ClientId:  "0f5c7a3e-9b1d-4c2e-8a4f-6d3b2e1c0a9b",
+							Timestamp: 67,
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.personalMessage.v1+json",
+			},
+			wantBody: &models.PersonalMessageV1{
+				Id:        42,
+				ClientId:  "0f5c7a3e-9b1d-4c2e-8a4f-6d3b2e1c0a9b",
+				Timestamp: 67,
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Not found - unknown client id (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/client/{clientId}", nil)
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("clientId", "0f5c7a3e-9b1d-4c2e-8a4f-6d3b2e1c0a9b")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("MessageIdByClientId", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotFound,
+		},
+		{
+			name: "Not found - bad client id (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/client/{clientId}", nil)
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("clientId", "bad-client-id")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotFound,
+		},
 		{
 			name: "Not found - bad id (404)",
 			args: args{
@@ -170,3 +241,413 @@ func TestService_getMessageData(t *testing.T) {
 		})
 	}
 }
+
+func TestService_getMessageDataV2(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantBody    *models.PersonalMessageV2
+		wantStatus  int
+	}{
+		{
+			name: "OK (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/{id}", nil)
+					r.Header.Set("Accept", "application/vnd.personalMessage.v2+json")
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV2", mock.Anything, mock.Anything, int64(42)).Return(
+						&models.PersonalMessageV2{
+							Id:        42,
+							Timestamp: 67,
+							From:      "jane",
+							To:        "john",
+							Text:      "Hello",
+							Entities:  []models.TextEntity{{Type: models.TextEntityBold, Offset: 0, Length: 5}},
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.personalMessage.v2+json",
+			},
+			wantBody: &models.PersonalMessageV2{
+				Id:        42,
+				Timestamp: 67,
+				From:      "jane",
+				To:        "john",
+				Text:      "Hello",
+				Entities:  []models.TextEntity{{Type: models.TextEntityBold, Offset: 0, Length: 5}},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Not found (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/{id}", nil)
+					r.Header.Set("Accept", "application/vnd.personalMessage.v2+json")
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV2", mock.Anything, mock.Anything, int64(42)).Return(nil, nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotFound,
+		},
+		{
+			name: "Not acceptable (406)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/{id}", nil)
+					r.Header.Set("Accept", "application/json")
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotAcceptable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.getMessageData(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+
+			if tt.wantBody == nil {
+				return
+			}
+
+			var body *models.PersonalMessageV2
+			decoded := models.PersonalMessageV2{}
+			err := json.NewDecoder(tt.args.w.Body).Decode(&decoded)
+
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+
+			if err == nil {
+				body = &decoded
+			}
+
+			require.Equal(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestService_getMessageDataV3(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantBody    *models.PersonalMessageV3
+		wantStatus  int
+	}{
+		{
+			name: "OK (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/{id}", nil)
+					r.Header.Set("Accept", "application/vnd.personalMessage.v3+json")
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV3", mock.Anything, mock.Anything, int64(42)).Return(
+						&models.PersonalMessageV3{
+							Id:        42,
+							Timestamp: 67,
+							From:      "jane",
+							To:        "john",
+							Content: &models.MessageContent{
+								Type: models.MessageContentPoll,
+								Poll: &models.PollContent{
+									Question: "Lunch?",
+									Options:  []*models.PollOption{{Text: "Yes", Votes: 1, Voted: true}, {Text: "No"}},
+								},
+							},
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.personalMessage.v3+json",
+			},
+			wantBody: &models.PersonalMessageV3{
+				Id:        42,
+				Timestamp: 67,
+				From:      "jane",
+				To:        "john",
+				Content: &models.MessageContent{
+					Type: models.MessageContentPoll,
+					Poll: &models.PollContent{
+						Question: "Lunch?",
+						Options:  []*models.PollOption{{Text: "Yes", Votes: 1, Voted: true}, {Text: "No"}},
+					},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Not found (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/{id}", nil)
+					r.Header.Set("Accept", "application/vnd.personalMessage.v3+json")
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV3", mock.Anything, mock.Anything, int64(42)).Return(nil, nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.getMessageData(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+
+			if tt.wantBody == nil {
+				return
+			}
+
+			var body *models.PersonalMessageV3
+			decoded := models.PersonalMessageV3{}
+			err := json.NewDecoder(tt.args.w.Body).Decode(&decoded)
+
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+
+			if err == nil {
+				body = &decoded
+			}
+
+			require.Equal(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestService_getMessageDataV4(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantBody    *models.PersonalMessageV4
+		wantStatus  int
+	}{
+		{
+			name: "OK (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/{id}", nil)
+					r.Header.Set("Accept", "application/vnd.personalMessage.v4+json")
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, mock.Anything, int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 67,
+							From:      "jane",
+							To:        "john",
+							Envelope: &models.EncryptedEnvelope{
+								Algorithm:      "x25519-xsalsa20-poly1305",
+								RecipientKeyId: "john-key-1",
+								SenderDeviceId: "jane-phone",
+								Nonce:          "AAECAwQFBgcICQoLDA0ODxAREhMUFRYX",
+								Ciphertext:     "c2VjcmV0IG1lc3NhZ2U=",
+							},
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.personalMessage.v4+json",
+			},
+			wantBody: &models.PersonalMessageV4{
+				Id:        42,
+				Timestamp: 67,
+				From:      "jane",
+				To:        "john",
+				Envelope: &models.EncryptedEnvelope{
+					Algorithm:      "x25519-xsalsa20-poly1305",
+					RecipientKeyId: "john-key-1",
+					SenderDeviceId: "jane-phone",
+					Nonce:          "AAECAwQFBgcICQoLDA0ODxAREhMUFRYX",
+					Ciphertext:     "c2VjcmV0IG1lc3NhZ2U=",
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Not found (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/{id}", nil)
+					r.Header.Set("Accept", "application/vnd.personalMessage.v4+json")
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, mock.Anything, int64(42)).Return(nil, nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.getMessageData(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+
+			if tt.wantBody == nil {
+				return
+			}
+
+			var body *models.PersonalMessageV4
+			decoded := models.PersonalMessageV4{}
+			err := json.NewDecoder(tt.args.w.Body).Decode(&decoded)
+
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+
+			if err == nil {
+				body = &decoded
+			}
+
+			require.Equal(t, body, tt.wantBody)
+		})
+	}
+}
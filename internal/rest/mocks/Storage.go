@@ -14,30 +14,307 @@ type Storage struct {
 	mock.Mock
 }
 
-// CreateNewPersonalMessageV1 provides a mock function with given fields: ctx, sender, data
-func (_m *Storage) CreateNewPersonalMessageV1(ctx context.Context, sender string, data *models.NewPersonalMessageV1) (int64, int64, error) {
-	ret := _m.Called(ctx, sender, data)
+// AnswerMessageRequest provides a mock function with given fields: ctx, userId, sender, accepted
+func (_m *Storage) AnswerMessageRequest(ctx context.Context, userId string, sender string, accepted bool) error {
+	ret := _m.Called(ctx, userId, sender, accepted)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, bool) error); ok {
+		r0 = rf(ctx, userId, sender, accepted)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// BlockUser provides a mock function with given fields: ctx, userId, blockedUser, hideConversation
+func (_m *Storage) BlockUser(ctx context.Context, userId string, blockedUser string, hideConversation bool) error {
+	ret := _m.Called(ctx, userId, blockedUser, hideConversation)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, bool) error); ok {
+		r0 = rf(ctx, userId, blockedUser, hideConversation)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// BlockedUserV1 provides a mock function with given fields: ctx, userId, blockedUser
+func (_m *Storage) BlockedUserV1(ctx context.Context, userId string, blockedUser string) (*models.BlockedUserV1, error) {
+	ret := _m.Called(ctx, userId, blockedUser)
+
+	var r0 *models.BlockedUserV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (*models.BlockedUserV1, error)); ok {
+		return rf(ctx, userId, blockedUser)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *models.BlockedUserV1); ok {
+		r0 = rf(ctx, userId, blockedUser)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.BlockedUserV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, userId, blockedUser)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// BlockedUsersV1 provides a mock function with given fields: ctx, userId
+func (_m *Storage) BlockedUsersV1(ctx context.Context, userId string) (*models.BlockedUsersV1, error) {
+	ret := _m.Called(ctx, userId)
+
+	var r0 *models.BlockedUsersV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (*models.BlockedUsersV1, error)); ok {
+		return rf(ctx, userId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) *models.BlockedUsersV1); ok {
+		r0 = rf(ctx, userId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.BlockedUsersV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// BroadcastByIdempotencyKey provides a mock function with given fields: ctx, sender, key
+func (_m *Storage) BroadcastByIdempotencyKey(ctx context.Context, sender string, key *models.IdempotencyKey) (*models.SentMessagesV1, error) {
+	ret := _m.Called(ctx, sender, key)
+
+	var r0 *models.SentMessagesV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.IdempotencyKey) (*models.SentMessagesV1, error)); ok {
+		return rf(ctx, sender, key)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.IdempotencyKey) *models.SentMessagesV1); ok {
+		r0 = rf(ctx, sender, key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.SentMessagesV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, *models.IdempotencyKey) error); ok {
+		r1 = rf(ctx, sender, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ConversationV1 provides a mock function with given fields: ctx, userId, counterpart
+func (_m *Storage) ConversationV1(ctx context.Context, userId string, counterpart string) (*models.ConversationV1, error) {
+	ret := _m.Called(ctx, userId, counterpart)
+
+	var r0 *models.ConversationV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (*models.ConversationV1, error)); ok {
+		return rf(ctx, userId, counterpart)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *models.ConversationV1); ok {
+		r0 = rf(ctx, userId, counterpart)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.ConversationV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, userId, counterpart)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ConversationsV1 provides a mock function with given fields: ctx, userId
+func (_m *Storage) ConversationsV1(ctx context.Context, userId string) (*models.ConversationsV1, error) {
+	ret := _m.Called(ctx, userId)
+
+	var r0 *models.ConversationsV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (*models.ConversationsV1, error)); ok {
+		return rf(ctx, userId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) *models.ConversationsV1); ok {
+		r0 = rf(ctx, userId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.ConversationsV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateNewBroadcastMessageV1 provides a mock function with given fields: ctx, sender, data, key
+func (_m *Storage) CreateNewBroadcastMessageV1(ctx context.Context, sender string, data *models.NewBroadcastMessageV1, key *models.IdempotencyKey) (*models.SentMessagesV1, error) {
+	ret := _m.Called(ctx, sender, data, key)
+
+	var r0 *models.SentMessagesV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.NewBroadcastMessageV1, *models.IdempotencyKey) (*models.SentMessagesV1, error)); ok {
+		return rf(ctx, sender, data, key)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.NewBroadcastMessageV1, *models.IdempotencyKey) *models.SentMessagesV1); ok {
+		r0 = rf(ctx, sender, data, key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.SentMessagesV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, *models.NewBroadcastMessageV1, *models.IdempotencyKey) error); ok {
+		r1 = rf(ctx, sender, data, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateNewPersonalMessageV1 provides a mock function with given fields: ctx, sender, data, key
+func (_m *Storage) CreateNewPersonalMessageV1(ctx context.Context, sender string, data *models.NewPersonalMessageV1, key *models.IdempotencyKey) (int64, int64, error) {
+	ret := _m.Called(ctx, sender, data, key)
+
+	var r0 int64
+	var r1 int64
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.NewPersonalMessageV1, *models.IdempotencyKey) (int64, int64, error)); ok {
+		return rf(ctx, sender, data, key)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.NewPersonalMessageV1, *models.IdempotencyKey) int64); ok {
+		r0 = rf(ctx, sender, data, key)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, *models.NewPersonalMessageV1, *models.IdempotencyKey) int64); ok {
+		r1 = rf(ctx, sender, data, key)
+	} else {
+		r1 = ret.Get(1).(int64)
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string, *models.NewPersonalMessageV1, *models.IdempotencyKey) error); ok {
+		r2 = rf(ctx, sender, data, key)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// CreateNewPersonalMessageV2 provides a mock function with given fields: ctx, sender, data, key
+func (_m *Storage) CreateNewPersonalMessageV2(ctx context.Context, sender string, data *models.NewPersonalMessageV2, key *models.IdempotencyKey) (int64, int64, error) {
+	ret := _m.Called(ctx, sender, data, key)
+
+	var r0 int64
+	var r1 int64
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.NewPersonalMessageV2, *models.IdempotencyKey) (int64, int64, error)); ok {
+		return rf(ctx, sender, data, key)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.NewPersonalMessageV2, *models.IdempotencyKey) int64); ok {
+		r0 = rf(ctx, sender, data, key)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, *models.NewPersonalMessageV2, *models.IdempotencyKey) int64); ok {
+		r1 = rf(ctx, sender, data, key)
+	} else {
+		r1 = ret.Get(1).(int64)
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string, *models.NewPersonalMessageV2, *models.IdempotencyKey) error); ok {
+		r2 = rf(ctx, sender, data, key)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// CreateNewPersonalMessageV3 provides a mock function with given fields: ctx, sender, data, key
+func (_m *Storage) CreateNewPersonalMessageV3(ctx context.Context, sender string, data *models.NewPersonalMessageV3, key *models.IdempotencyKey) (int64, int64, error) {
+	ret := _m.Called(ctx, sender, data, key)
+
+	var r0 int64
+	var r1 int64
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.NewPersonalMessageV3, *models.IdempotencyKey) (int64, int64, error)); ok {
+		return rf(ctx, sender, data, key)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.NewPersonalMessageV3, *models.IdempotencyKey) int64); ok {
+		r0 = rf(ctx, sender, data, key)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, *models.NewPersonalMessageV3, *models.IdempotencyKey) int64); ok {
+		r1 = rf(ctx, sender, data, key)
+	} else {
+		r1 = ret.Get(1).(int64)
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string, *models.NewPersonalMessageV3, *models.IdempotencyKey) error); ok {
+		r2 = rf(ctx, sender, data, key)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// CreateNewPersonalMessageV4 provides a mock function with given fields: ctx, sender, data, key
+func (_m *Storage) CreateNewPersonalMessageV4(ctx context.Context, sender string, data *models.NewPersonalMessageV4, key *models.IdempotencyKey) (int64, int64, error) {
+	ret := _m.Called(ctx, sender, data, key)
 
 	var r0 int64
 	var r1 int64
 	var r2 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, *models.NewPersonalMessageV1) (int64, int64, error)); ok {
-		return rf(ctx, sender, data)
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.NewPersonalMessageV4, *models.IdempotencyKey) (int64, int64, error)); ok {
+		return rf(ctx, sender, data, key)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, *models.NewPersonalMessageV1) int64); ok {
-		r0 = rf(ctx, sender, data)
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.NewPersonalMessageV4, *models.IdempotencyKey) int64); ok {
+		r0 = rf(ctx, sender, data, key)
 	} else {
 		r0 = ret.Get(0).(int64)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, *models.NewPersonalMessageV1) int64); ok {
-		r1 = rf(ctx, sender, data)
+	if rf, ok := ret.Get(1).(func(context.Context, string, *models.NewPersonalMessageV4, *models.IdempotencyKey) int64); ok {
+		r1 = rf(ctx, sender, data, key)
 	} else {
 		r1 = ret.Get(1).(int64)
 	}
 
-	if rf, ok := ret.Get(2).(func(context.Context, string, *models.NewPersonalMessageV1) error); ok {
-		r2 = rf(ctx, sender, data)
+	if rf, ok := ret.Get(2).(func(context.Context, string, *models.NewPersonalMessageV4, *models.IdempotencyKey) error); ok {
+		r2 = rf(ctx, sender, data, key)
 	} else {
 		r2 = ret.Error(2)
 	}
@@ -45,6 +322,32 @@ func (_m *Storage) CreateNewPersonalMessageV1(ctx context.Context, sender string
 	return r0, r1, r2
 }
 
+// CreateWebhook provides a mock function with given fields: ctx, userId, webhook, secret
+func (_m *Storage) CreateWebhook(ctx context.Context, userId string, webhook *models.NewWebhookV1, secret string) (*models.WebhookV1, error) {
+	ret := _m.Called(ctx, userId, webhook, secret)
+
+	var r0 *models.WebhookV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.NewWebhookV1, string) (*models.WebhookV1, error)); ok {
+		return rf(ctx, userId, webhook, secret)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.NewWebhookV1, string) *models.WebhookV1); ok {
+		r0 = rf(ctx, userId, webhook, secret)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.WebhookV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, *models.NewWebhookV1, string) error); ok {
+		r1 = rf(ctx, userId, webhook, secret)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DeleteMessageData provides a mock function with given fields: ctx, id, timestamp
 func (_m *Storage) DeleteMessageData(ctx context.Context, id int64, timestamp int64) (int64, error) {
 	ret := _m.Called(ctx, id, timestamp)
@@ -69,23 +372,47 @@ func (_m *Storage) DeleteMessageData(ctx context.Context, id int64, timestamp in
 	return r0, r1
 }
 
-// EditMessageText provides a mock function with given fields: ctx, id, timestamp, text
-func (_m *Storage) EditMessageText(ctx context.Context, id int64, timestamp int64, text string) (int64, error) {
-	ret := _m.Called(ctx, id, timestamp, text)
+// DeleteWebhook provides a mock function with given fields: ctx, userId, id
+func (_m *Storage) DeleteWebhook(ctx context.Context, userId string, id int64) (bool, error) {
+	ret := _m.Called(ctx, userId, id)
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) (bool, error)); ok {
+		return rf(ctx, userId, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) bool); ok {
+		r0 = rf(ctx, userId, id)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64) error); ok {
+		r1 = rf(ctx, userId, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// EditMessageEnvelope provides a mock function with given fields: ctx, id, timestamp, envelope
+func (_m *Storage) EditMessageEnvelope(ctx context.Context, id int64, timestamp int64, envelope *models.EncryptedEnvelope) (int64, error) {
+	ret := _m.Called(ctx, id, timestamp, envelope)
 
 	var r0 int64
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, string) (int64, error)); ok {
-		return rf(ctx, id, timestamp, text)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, *models.EncryptedEnvelope) (int64, error)); ok {
+		return rf(ctx, id, timestamp, envelope)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, string) int64); ok {
-		r0 = rf(ctx, id, timestamp, text)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, *models.EncryptedEnvelope) int64); ok {
+		r0 = rf(ctx, id, timestamp, envelope)
 	} else {
 		r0 = ret.Get(0).(int64)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, int64, int64, string) error); ok {
-		r1 = rf(ctx, id, timestamp, text)
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64, *models.EncryptedEnvelope) error); ok {
+		r1 = rf(ctx, id, timestamp, envelope)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -93,25 +420,23 @@ func (_m *Storage) EditMessageText(ctx context.Context, id int64, timestamp int6
 	return r0, r1
 }
 
-// MessageUpdatesV1 provides a mock function with given fields: ctx, userId, after, limit
-func (_m *Storage) MessageUpdatesV1(ctx context.Context, userId string, after int64, limit int) (*models.MessageUpdatesV1, error) {
-	ret := _m.Called(ctx, userId, after, limit)
+// EditMessageFiles provides a mock function with given fields: ctx, id, timestamp, files
+func (_m *Storage) EditMessageFiles(ctx context.Context, id int64, timestamp int64, files []string) (int64, error) {
+	ret := _m.Called(ctx, id, timestamp, files)
 
-	var r0 *models.MessageUpdatesV1
+	var r0 int64
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int) (*models.MessageUpdatesV1, error)); ok {
-		return rf(ctx, userId, after, limit)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, []string) (int64, error)); ok {
+		return rf(ctx, id, timestamp, files)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int) *models.MessageUpdatesV1); ok {
-		r0 = rf(ctx, userId, after, limit)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, []string) int64); ok {
+		r0 = rf(ctx, id, timestamp, files)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*models.MessageUpdatesV1)
-		}
+		r0 = ret.Get(0).(int64)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, int64, int) error); ok {
-		r1 = rf(ctx, userId, after, limit)
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64, []string) error); ok {
+		r1 = rf(ctx, id, timestamp, files)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -119,25 +444,23 @@ func (_m *Storage) MessageUpdatesV1(ctx context.Context, userId string, after in
 	return r0, r1
 }
 
-// PersonalMessageV1 provides a mock function with given fields: ctx, userId, messageId
-func (_m *Storage) PersonalMessageV1(ctx context.Context, userId string, messageId int64) (*models.PersonalMessageV1, error) {
-	ret := _m.Called(ctx, userId, messageId)
+// EditMessageText provides a mock function with given fields: ctx, id, timestamp, text
+func (_m *Storage) EditMessageText(ctx context.Context, id int64, timestamp int64, text string) (int64, error) {
+	ret := _m.Called(ctx, id, timestamp, text)
 
-	var r0 *models.PersonalMessageV1
+	var r0 int64
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, int64) (*models.PersonalMessageV1, error)); ok {
-		return rf(ctx, userId, messageId)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, string) (int64, error)); ok {
+		return rf(ctx, id, timestamp, text)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, int64) *models.PersonalMessageV1); ok {
-		r0 = rf(ctx, userId, messageId)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, string) int64); ok {
+		r0 = rf(ctx, id, timestamp, text)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*models.PersonalMessageV1)
-		}
+		r0 = ret.Get(0).(int64)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, int64) error); ok {
-		r1 = rf(ctx, userId, messageId)
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64, string) error); ok {
+		r1 = rf(ctx, id, timestamp, text)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -145,23 +468,580 @@ func (_m *Storage) PersonalMessageV1(ctx context.Context, userId string, message
 	return r0, r1
 }
 
-// SetMessageReadState provides a mock function with given fields: ctx, id, timestamp, read
-func (_m *Storage) SetMessageReadState(ctx context.Context, id int64, timestamp int64, read bool) (int64, error) {
-	ret := _m.Called(ctx, id, timestamp, read)
+// EditMessageTextV2 provides a mock function with given fields: ctx, id, timestamp, text, entities
+func (_m *Storage) EditMessageTextV2(ctx context.Context, id int64, timestamp int64, text string, entities []models.TextEntity) (int64, error) {
+	ret := _m.Called(ctx, id, timestamp, text, entities)
 
 	var r0 int64
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, bool) (int64, error)); ok {
-		return rf(ctx, id, timestamp, read)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, string, []models.TextEntity) (int64, error)); ok {
+		return rf(ctx, id, timestamp, text, entities)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, bool) int64); ok {
-		r0 = rf(ctx, id, timestamp, read)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, string, []models.TextEntity) int64); ok {
+		r0 = rf(ctx, id, timestamp, text, entities)
 	} else {
 		r0 = ret.Get(0).(int64)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, int64, int64, bool) error); ok {
-		r1 = rf(ctx, id, timestamp, read)
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64, string, []models.TextEntity) error); ok {
+		r1 = rf(ctx, id, timestamp, text, entities)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MessageByIdempotencyKey provides a mock function with given fields: ctx, sender, key
+func (_m *Storage) MessageByIdempotencyKey(ctx context.Context, sender string, key *models.IdempotencyKey) (int64, int64, error) {
+	ret := _m.Called(ctx, sender, key)
+
+	var r0 int64
+	var r1 int64
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.IdempotencyKey) (int64, int64, error)); ok {
+		return rf(ctx, sender, key)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.IdempotencyKey) int64); ok {
+		r0 = rf(ctx, sender, key)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, *models.IdempotencyKey) int64); ok {
+		r1 = rf(ctx, sender, key)
+	} else {
+		r1 = ret.Get(1).(int64)
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string, *models.IdempotencyKey) error); ok {
+		r2 = rf(ctx, sender, key)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// MessageIdByClientId provides a mock function with given fields: ctx, sender, clientId
+func (_m *Storage) MessageIdByClientId(ctx context.Context, sender string, clientId string) (int64, error) {
+	ret := _m.Called(ctx, sender, clientId)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (int64, error)); ok {
+		return rf(ctx, sender, clientId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) int64); ok {
+		r0 = rf(ctx, sender, clientId)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, sender, clientId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MessageRequestsV1 provides a mock function with given fields: ctx, userId
+func (_m *Storage) MessageRequestsV1(ctx context.Context, userId string) (*models.MessageRequestsV1, error) {
+	ret := _m.Called(ctx, userId)
+
+	var r0 *models.MessageRequestsV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (*models.MessageRequestsV1, error)); ok {
+		return rf(ctx, userId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) *models.MessageRequestsV1); ok {
+		r0 = rf(ctx, userId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.MessageRequestsV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MessageUpdatesV1 provides a mock function with given fields: ctx, userId, after, limit
+func (_m *Storage) MessageUpdatesV1(ctx context.Context, userId string, after int64, limit int) (*models.MessageUpdatesV1, error) {
+	ret := _m.Called(ctx, userId, after, limit)
+
+	var r0 *models.MessageUpdatesV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int) (*models.MessageUpdatesV1, error)); ok {
+		return rf(ctx, userId, after, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int) *models.MessageUpdatesV1); ok {
+		r0 = rf(ctx, userId, after, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.MessageUpdatesV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, int) error); ok {
+		r1 = rf(ctx, userId, after, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MessageUpdatesV2 provides a mock function with given fields: ctx, userId, after, limit
+func (_m *Storage) MessageUpdatesV2(ctx context.Context, userId string, after int64, limit int) (*models.MessageUpdatesV2, error) {
+	ret := _m.Called(ctx, userId, after, limit)
+
+	var r0 *models.MessageUpdatesV2
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int) (*models.MessageUpdatesV2, error)); ok {
+		return rf(ctx, userId, after, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int) *models.MessageUpdatesV2); ok {
+		r0 = rf(ctx, userId, after, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.MessageUpdatesV2)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, int) error); ok {
+		r1 = rf(ctx, userId, after, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PersonalMessageV1 provides a mock function with given fields: ctx, userId, messageId
+func (_m *Storage) PersonalMessageV1(ctx context.Context, userId string, messageId int64) (*models.PersonalMessageV1, error) {
+	ret := _m.Called(ctx, userId, messageId)
+
+	var r0 *models.PersonalMessageV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) (*models.PersonalMessageV1, error)); ok {
+		return rf(ctx, userId, messageId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) *models.PersonalMessageV1); ok {
+		r0 = rf(ctx, userId, messageId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.PersonalMessageV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64) error); ok {
+		r1 = rf(ctx, userId, messageId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PersonalMessageV2 provides a mock function with given fields: ctx, userId, messageId
+func (_m *Storage) PersonalMessageV2(ctx context.Context, userId string, messageId int64) (*models.PersonalMessageV2, error) {
+	ret := _m.Called(ctx, userId, messageId)
+
+	var r0 *models.PersonalMessageV2
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) (*models.PersonalMessageV2, error)); ok {
+		return rf(ctx, userId, messageId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) *models.PersonalMessageV2); ok {
+		r0 = rf(ctx, userId, messageId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.PersonalMessageV2)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64) error); ok {
+		r1 = rf(ctx, userId, messageId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PersonalMessageV3 provides a mock function with given fields: ctx, userId, messageId
+func (_m *Storage) PersonalMessageV3(ctx context.Context, userId string, messageId int64) (*models.PersonalMessageV3, error) {
+	ret := _m.Called(ctx, userId, messageId)
+
+	var r0 *models.PersonalMessageV3
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) (*models.PersonalMessageV3, error)); ok {
+		return rf(ctx, userId, messageId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) *models.PersonalMessageV3); ok {
+		r0 = rf(ctx, userId, messageId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.PersonalMessageV3)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64) error); ok {
+		r1 = rf(ctx, userId, messageId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PersonalMessageV4 provides a mock function with given fields: ctx, userId, messageId
+func (_m *Storage) PersonalMessageV4(ctx context.Context, userId string, messageId int64) (*models.PersonalMessageV4, error) {
+	ret := _m.Called(ctx, userId, messageId)
+
+	var r0 *models.PersonalMessageV4
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) (*models.PersonalMessageV4, error)); ok {
+		return rf(ctx, userId, messageId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) *models.PersonalMessageV4); ok {
+		r0 = rf(ctx, userId, messageId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.PersonalMessageV4)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64) error); ok {
+		r1 = rf(ctx, userId, messageId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SearchMessagesV1 provides a mock function with given fields: ctx, userId, params
+func (_m *Storage) SearchMessagesV1(ctx context.Context, userId string, params *models.MessageSearchParameters) (*models.MessageSearchResultsV1, error) {
+	ret := _m.Called(ctx, userId, params)
+
+	var r0 *models.MessageSearchResultsV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.MessageSearchParameters) (*models.MessageSearchResultsV1, error)); ok {
+		return rf(ctx, userId, params)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.MessageSearchParameters) *models.MessageSearchResultsV1); ok {
+		r0 = rf(ctx, userId, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.MessageSearchResultsV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, *models.MessageSearchParameters) error); ok {
+		r1 = rf(ctx, userId, params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetConversationSettings provides a mock function with given fields: ctx, userId, counterpart, settings
+func (_m *Storage) SetConversationSettings(ctx context.Context, userId string, counterpart string, settings *models.ConversationSettingsV1) error {
+	ret := _m.Called(ctx, userId, counterpart, settings)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *models.ConversationSettingsV1) error); ok {
+		r0 = rf(ctx, userId, counterpart, settings)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetMessageReadState provides a mock function with given fields: ctx, id, timestamp, read
+func (_m *Storage) SetMessageReadState(ctx context.Context, id int64, timestamp int64, read bool) (int64, error) {
+	ret := _m.Called(ctx, id, timestamp, read)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, bool) (int64, error)); ok {
+		return rf(ctx, id, timestamp, read)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, bool) int64); ok {
+		r0 = rf(ctx, id, timestamp, read)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64, bool) error); ok {
+		r1 = rf(ctx, id, timestamp, read)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetMessageStar provides a mock function with given fields: ctx, userId, messageId, starred
+func (_m *Storage) SetMessageStar(ctx context.Context, userId string, messageId int64, starred bool) (int64, error) {
+	ret := _m.Called(ctx, userId, messageId, starred)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, bool) (int64, error)); ok {
+		return rf(ctx, userId, messageId, starred)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, bool) int64); ok {
+		r0 = rf(ctx, userId, messageId, starred)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, bool) error); ok {
+		r1 = rf(ctx, userId, messageId, starred)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetUserSettings provides a mock function with given fields: ctx, userId, settings
+func (_m *Storage) SetUserSettings(ctx context.Context, userId string, settings *models.UserSettingsV1) error {
+	ret := _m.Called(ctx, userId, settings)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.UserSettingsV1) error); ok {
+		r0 = rf(ctx, userId, settings)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetWebhookEnabled provides a mock function with given fields: ctx, userId, id, enabled
+func (_m *Storage) SetWebhookEnabled(ctx context.Context, userId string, id int64, enabled bool) (bool, error) {
+	ret := _m.Called(ctx, userId, id, enabled)
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, bool) (bool, error)); ok {
+		return rf(ctx, userId, id, enabled)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, bool) bool); ok {
+		r0 = rf(ctx, userId, id, enabled)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, bool) error); ok {
+		r1 = rf(ctx, userId, id, enabled)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SharedFilesV1 provides a mock function with given fields: ctx, userId, counterpart, before, limit
+func (_m *Storage) SharedFilesV1(ctx context.Context, userId string, counterpart string, before int64, limit int) (*models.SharedFilesV1, error) {
+	ret := _m.Called(ctx, userId, counterpart, before, limit)
+
+	var r0 *models.SharedFilesV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64, int) (*models.SharedFilesV1, error)); ok {
+		return rf(ctx, userId, counterpart, before, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64, int) *models.SharedFilesV1); ok {
+		r0 = rf(ctx, userId, counterpart, before, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.SharedFilesV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int64, int) error); ok {
+		r1 = rf(ctx, userId, counterpart, before, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// StarredMessagesV1 provides a mock function with given fields: ctx, userId, before, limit
+func (_m *Storage) StarredMessagesV1(ctx context.Context, userId string, before int64, limit int) (*models.StarredMessagesV1, error) {
+	ret := _m.Called(ctx, userId, before, limit)
+
+	var r0 *models.StarredMessagesV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int) (*models.StarredMessagesV1, error)); ok {
+		return rf(ctx, userId, before, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int) *models.StarredMessagesV1); ok {
+		r0 = rf(ctx, userId, before, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.StarredMessagesV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, int) error); ok {
+		r1 = rf(ctx, userId, before, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UnblockUser provides a mock function with given fields: ctx, userId, blockedUser
+func (_m *Storage) UnblockUser(ctx context.Context, userId string, blockedUser string) error {
+	ret := _m.Called(ctx, userId, blockedUser)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, userId, blockedUser)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UserSettingsV1 provides a mock function with given fields: ctx, userId
+func (_m *Storage) UserSettingsV1(ctx context.Context, userId string) (*models.UserSettingsV1, error) {
+	ret := _m.Called(ctx, userId)
+
+	var r0 *models.UserSettingsV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (*models.UserSettingsV1, error)); ok {
+		return rf(ctx, userId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) *models.UserSettingsV1); ok {
+		r0 = rf(ctx, userId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.UserSettingsV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// VotePoll provides a mock function with given fields: ctx, userId, id, timestamp, options
+func (_m *Storage) VotePoll(ctx context.Context, userId string, id int64, timestamp int64, options []int) (int64, error) {
+	ret := _m.Called(ctx, userId, id, timestamp, options)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int64, []int) (int64, error)); ok {
+		return rf(ctx, userId, id, timestamp, options)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int64, []int) int64); ok {
+		r0 = rf(ctx, userId, id, timestamp, options)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, int64, []int) error); ok {
+		r1 = rf(ctx, userId, id, timestamp, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WebhookDeliveriesV1 provides a mock function with given fields: ctx, userId, id
+func (_m *Storage) WebhookDeliveriesV1(ctx context.Context, userId string, id int64) (*models.WebhookDeliveriesV1, error) {
+	ret := _m.Called(ctx, userId, id)
+
+	var r0 *models.WebhookDeliveriesV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) (*models.WebhookDeliveriesV1, error)); ok {
+		return rf(ctx, userId, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) *models.WebhookDeliveriesV1); ok {
+		r0 = rf(ctx, userId, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.WebhookDeliveriesV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64) error); ok {
+		r1 = rf(ctx, userId, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WebhookV1 provides a mock function with given fields: ctx, userId, id
+func (_m *Storage) WebhookV1(ctx context.Context, userId string, id int64) (*models.WebhookV1, error) {
+	ret := _m.Called(ctx, userId, id)
+
+	var r0 *models.WebhookV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) (*models.WebhookV1, error)); ok {
+		return rf(ctx, userId, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) *models.WebhookV1); ok {
+		r0 = rf(ctx, userId, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.WebhookV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64) error); ok {
+		r1 = rf(ctx, userId, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WebhooksV1 provides a mock function with given fields: ctx, userId
+func (_m *Storage) WebhooksV1(ctx context.Context, userId string) (*models.WebhooksV1, error) {
+	ret := _m.Called(ctx, userId)
+
+	var r0 *models.WebhooksV1
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (*models.WebhooksV1, error)); ok {
+		return rf(ctx, userId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) *models.WebhooksV1); ok {
+		r0 = rf(ctx, userId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.WebhooksV1)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userId)
 	} else {
 		r1 = ret.Error(1)
 	}
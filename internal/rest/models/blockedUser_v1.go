@@ -0,0 +1,9 @@
+package models
+
+// Schema: blockedUser.v1
+type BlockedUserV1 struct {
+	User             string   `json:"user"`
+	HideConversation bool     `json:"hideConversation,omitempty"`
+	Created          *UtcTime `json:"created,omitempty"`
+	Timestamp        int64    `json:"timestamp"`
+}
@@ -0,0 +1,7 @@
+package models
+
+// Schema: blockedUsers.v1
+type BlockedUsersV1 struct {
+	Total int              `json:"total"`
+	Users []*BlockedUserV1 `json:"users,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "strings"
+
+// Message identifier generated by the client (UUID), so the message can be referred to before it's sent.
+func ValidClientId(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+
+	for i, c := range id {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// Schema: conversationSettings.v1
+// Omitted fields are left unchanged.
+type ConversationSettingsV1 struct {
+	Muted      *bool      `json:"muted"`
+	MutedUntil *time.Time `json:"mutedUntil"` // muted forever if not specified
+	Archived   *bool      `json:"archived"`
+}
+
+func (m *ConversationSettingsV1) Deserialize(data io.Reader) error {
+	if json.NewDecoder(data).Decode(m) != nil {
+		return errors.New("Conversation settings data violates 'conversationSettings.v1' schema.")
+	}
+
+	return m.validate()
+}
+
+func (m *ConversationSettingsV1) validate() error {
+	if m.Muted == nil && m.Archived == nil {
+		return errors.New("Either 'muted' or 'archived' conversation setting must be specified.")
+	}
+
+	if m.MutedUntil != nil {
+		if m.Muted == nil || !*m.Muted {
+			return errors.New("Mute expiration time can be specified only for muted conversation.")
+		}
+
+		if !m.MutedUntil.After(time.Now()) {
+			return errors.New("Mute expiration time must be in the future.")
+		}
+
+		utc := m.MutedUntil.UTC()
+		m.MutedUntil = &utc
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package models
+
+// Schema: conversations.v1
+type ConversationsV1 struct {
+	Total         int               `json:"total"`
+	Conversations []*ConversationV1 `json:"conversations,omitempty"`
+}
+
+// Schema: conversation.v1
+type ConversationV1 struct {
+	User        string   `json:"user"`
+	State       string   `json:"state"`
+	Muted       bool     `json:"muted,omitempty"`
+	MutedUntil  *UtcTime `json:"mutedUntil,omitempty"`
+	Archived    bool     `json:"archived,omitempty"`
+	LastMessage int64    `json:"lastMessage,omitempty"`
+	Timestamp   int64    `json:"timestamp"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Schema: editedMessageEnvelope.v1
+type EditedMessageEnvelopeV1 struct {
+	Envelope *EncryptedEnvelope
+}
+
+func (m *EditedMessageEnvelopeV1) Deserialize(data io.Reader) error {
+	if json.NewDecoder(data).Decode(m) != nil {
+		return errors.New("Edited message data violates 'editedMessageEnvelope.v1' schema.")
+	}
+
+	if m.Envelope == nil {
+		return errors.New("Message envelope must be specified.")
+	}
+
+	return m.Envelope.validate()
+}
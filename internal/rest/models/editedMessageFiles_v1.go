@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Schema: editedMessageFiles.v1
+type EditedMessageFilesV1 struct {
+	Files []string
+}
+
+func (m *EditedMessageFilesV1) Deserialize(data io.Reader) error {
+	if json.NewDecoder(data).Decode(m) != nil {
+		return errors.New("New message data violates 'editedMessageFiles.v1' schema.")
+	}
+
+	return m.validate()
+}
+
+func (m *EditedMessageFilesV1) validate() error {
+	for _, fileId := range m.Files {
+		if len(fileId) != 24 {
+			return errors.New("Attached file id must be 24 character long.")
+		}
+	}
+
+	return nil
+}
+
+// Files are compared as multisets, since the same file can be attached to the message several times
+// and every attachment is counted in the file usage statistics.
+func FilesDifference(before, after []string) (added, removed []string) {
+	attached := make(map[string]int, len(before))
+
+	for _, fileId := range before {
+		attached[fileId]++
+	}
+
+	for _, fileId := range after {
+		if attached[fileId] > 0 {
+			attached[fileId]--
+			continue
+		}
+
+		added = append(added, fileId)
+	}
+
+	for _, fileId := range before {
+		if attached[fileId] > 0 {
+			attached[fileId]--
+			removed = append(removed, fileId)
+		}
+	}
+
+	return added, removed
+}
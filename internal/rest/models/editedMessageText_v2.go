@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Schema: editedMessageText.v2
+type EditedMessageTextV2 struct {
+	Text     string
+	Entities []TextEntity
+}
+
+func (m *EditedMessageTextV2) Deserialize(data io.Reader) error {
+	if json.NewDecoder(data).Decode(m) != nil {
+		return errors.New("New message data violates 'editedMessageText.v2' schema.")
+	}
+
+	m.Text, m.Entities = trimFormattedText(m.Text, m.Entities)
+
+	return validateTextEntities(m.Text, m.Entities)
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// End-to-end encrypted message body. The service stores and relays it as is,
+// so only sizes and encodings are validated.
+type EncryptedEnvelope struct {
+	Algorithm      string `json:"algorithm"`
+	RecipientKeyId string `json:"recipientKeyId"`
+	SenderDeviceId string `json:"senderDeviceId"`
+	Nonce          string `json:"nonce"`      // base64
+	Ciphertext     string `json:"ciphertext"` // base64
+}
+
+const (
+	envelopeIdMaxLength        = 128
+	envelopeNonceMaxSize       = 64
+	envelopeCiphertextMaxSize  = 64 * 1024
+	envelopeAlgorithmMaxLength = 64
+)
+
+// Characters allowed in the algorithm and the ids of the envelope.
+const envelopeTokenCharacters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.+/"
+
+func (e *EncryptedEnvelope) validate() (err error) {
+	if !validEnvelopeToken(e.Algorithm, envelopeAlgorithmMaxLength) {
+		err = errors.Join(err, fmt.Errorf("Envelope algorithm must be specified (up to %d characters: letters, digits, '-_.+/').", envelopeAlgorithmMaxLength))
+	}
+
+	if !validEnvelopeToken(e.RecipientKeyId, envelopeIdMaxLength) {
+		err = errors.Join(err, fmt.Errorf("Envelope recipient key id must be specified (up to %d characters: letters, digits, '-_.+/').", envelopeIdMaxLength))
+	}
+
+	if !validEnvelopeToken(e.SenderDeviceId, envelopeIdMaxLength) {
+		err = errors.Join(err, fmt.Errorf("Envelope sender device id must be specified (up to %d characters: letters, digits, '-_.+/').", envelopeIdMaxLength))
+	}
+
+	if size, ok := base64Size(e.Nonce); !ok || size == 0 || size > envelopeNonceMaxSize {
+		err = errors.Join(err, fmt.Errorf("Envelope nonce must be base64 encoded (up to %d bytes).", envelopeNonceMaxSize))
+	}
+
+	if size, ok := base64Size(e.Ciphertext); !ok || size == 0 || size > envelopeCiphertextMaxSize {
+		err = errors.Join(err, fmt.Errorf("Envelope ciphertext must be base64 encoded (up to %d bytes).", envelopeCiphertextMaxSize))
+	}
+
+	return err
+}
+
+func validEnvelopeToken(token string, maxLength int) bool {
+	if token == "" || len(token) > maxLength {
+		return false
+	}
+
+	for _, c := range token {
+		if !strings.ContainsRune(envelopeTokenCharacters, c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns size of the decoded data.
+func base64Size(encoded string) (size int, ok bool) {
+	if len(encoded) > base64.StdEncoding.EncodedLen(envelopeCiphertextMaxSize) {
+		return 0, false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return 0, false
+	}
+
+	return len(decoded), true
+}
@@ -0,0 +1,7 @@
+package models
+
+// Identifies the request, so it can be safely retried by the client.
+type IdempotencyKey struct {
+	Key         string
+	Fingerprint string // request data hash
+}
@@ -0,0 +1,198 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Structured message content, in addition to (or instead of) the message text.
+type MessageContent struct {
+	Type     string           `json:"type"`
+	Location *LocationContent `json:"location,omitempty"`
+	Contact  *ContactContent  `json:"contact,omitempty"`
+	Poll     *PollContent     `json:"poll,omitempty"`
+}
+
+const (
+	MessageContentLocation = "location"
+	MessageContentContact  = "contact"
+	MessageContentPoll     = "poll"
+)
+
+type LocationContent struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Title     string  `json:"title,omitempty"`
+	Address   string  `json:"address,omitempty"`
+}
+
+type ContactContent struct {
+	Name  string `json:"name"`
+	Phone string `json:"phone,omitempty"`
+	Email string `json:"email,omitempty"`
+	User  string `json:"user,omitempty"` // messenger user id
+}
+
+type PollContent struct {
+	Question        string        `json:"question"`
+	Options         []*PollOption `json:"options"`
+	MultipleAnswers bool          `json:"multipleAnswers,omitempty"`
+}
+
+// Votes are calculated by the service, so they are ignored in the new message data.
+type PollOption struct {
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+	Voted bool   `json:"voted,omitempty"` // by the user who requested the message
+}
+
+const (
+	contentTitleMaxLength  = 256
+	pollQuestionMaxLength  = 300
+	pollOptionMaxLength    = 100
+	pollOptionsMinQuantity = 2
+	pollOptionsMaxQuantity = 10
+)
+
+func (c *MessageContent) normalize() {
+	if c.Location != nil {
+		c.Location.Title = strings.TrimSpace(c.Location.Title)
+		c.Location.Address = strings.TrimSpace(c.Location.Address)
+	}
+
+	if c.Contact != nil {
+		c.Contact.Name = strings.TrimSpace(c.Contact.Name)
+		c.Contact.Phone = strings.TrimSpace(c.Contact.Phone)
+		c.Contact.Email = strings.TrimSpace(c.Contact.Email)
+		c.Contact.User = strings.TrimSpace(c.Contact.User)
+	}
+
+	if c.Poll != nil {
+		c.Poll.Question = strings.TrimSpace(c.Poll.Question)
+
+		for _, option := range c.Poll.Options {
+			if option != nil {
+				option.Text = strings.TrimSpace(option.Text)
+				option.Votes, option.Voted = 0, false
+			}
+		}
+	}
+}
+
+func (c *MessageContent) validate() error {
+	payloads := 0
+
+	for _, specified := range []bool{c.Location != nil, c.Contact != nil, c.Poll != nil} {
+		if specified {
+			payloads++
+		}
+	}
+
+	if payloads != 1 {
+		return errors.New("Message content must contain exactly one of: 'location', 'contact', 'poll'.")
+	}
+
+	switch c.Type {
+	case MessageContentLocation:
+		if c.Location == nil {
+			break
+		}
+		return c.Location.validate()
+	case MessageContentContact:
+		if c.Contact == nil {
+			break
+		}
+		return c.Contact.validate()
+	case MessageContentPoll:
+		if c.Poll == nil {
+			break
+		}
+		return c.Poll.validate()
+	default:
+		return fmt.Errorf("Message content has unknown type '%s'.", c.Type)
+	}
+
+	return fmt.Errorf("Message content of type '%s' must contain '%s'.", c.Type, c.Type)
+}
+
+func (l *LocationContent) validate() (err error) {
+	if l.Latitude < -90 || l.Latitude > 90 {
+		err = errors.Join(err, errors.New("Location latitude must be in range [-90, 90]."))
+	}
+
+	if l.Longitude < -180 || l.Longitude > 180 {
+		err = errors.Join(err, errors.New("Location longitude must be in range [-180, 180]."))
+	}
+
+	if len(l.Title) > contentTitleMaxLength || len(l.Address) > contentTitleMaxLength {
+		err = errors.Join(err, fmt.Errorf("Location title and address must be up to %d bytes long.", contentTitleMaxLength))
+	}
+
+	return err
+}
+
+func (c *ContactContent) validate() (err error) {
+	if c.Name == "" || len(c.Name) > contentTitleMaxLength {
+		err = errors.Join(err, fmt.Errorf("Contact name must be specified (up to %d bytes long).", contentTitleMaxLength))
+	}
+
+	if c.Phone == "" && c.Email == "" && c.User == "" {
+		err = errors.Join(err, errors.New("Contact phone, email or user must be specified."))
+	}
+
+	if len(c.Phone) > 32 {
+		err = errors.Join(err, errors.New("Contact phone is too long: max 32 bytes."))
+	}
+
+	if c.Email != "" && (len(c.Email) > contentTitleMaxLength || !strings.Contains(c.Email, "@")) {
+		err = errors.Join(err, errors.New("Contact email is incorrect."))
+	}
+
+	if len(c.User) > 50 {
+		err = errors.Join(err, errors.New("Contact user id is too long: max 50 characters."))
+	}
+
+	return err
+}
+
+func (p *PollContent) validate() (err error) {
+	if p.Question == "" || len(p.Question) > pollQuestionMaxLength {
+		err = errors.Join(err, fmt.Errorf("Poll question must be specified (up to %d bytes long).", pollQuestionMaxLength))
+	}
+
+	if len(p.Options) < pollOptionsMinQuantity || len(p.Options) > pollOptionsMaxQuantity {
+		err = errors.Join(err, fmt.Errorf("Poll must have from %d to %d options.", pollOptionsMinQuantity, pollOptionsMaxQuantity))
+	}
+
+	for i, option := range p.Options {
+		if option == nil || option.Text == "" || len(option.Text) > pollOptionMaxLength {
+			err = errors.Join(err, fmt.Errorf("Poll option #%d must have text (up to %d bytes long).", i, pollOptionMaxLength))
+		}
+	}
+
+	return err
+}
+
+// Checks indexes of the chosen poll options. No options means the vote is retracted.
+func (p *PollContent) ValidateVote(options []int) error {
+	if len(options) > 1 && !p.MultipleAnswers {
+		return errors.New("Only one option can be chosen in this poll.")
+	}
+
+	chosen := make(map[int]struct{}, len(options))
+
+	for _, option := range options {
+		if option < 0 || option >= len(p.Options) {
+			return fmt.Errorf("Poll has no option #%d.", option)
+		}
+
+		if _, duplicate := chosen[option]; duplicate {
+			return fmt.Errorf("Poll option #%d is chosen more than once.", option)
+		}
+
+		chosen[option] = struct{}{}
+	}
+
+	return nil
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Schema: messageRequestAnswer.v1
+type MessageRequestAnswerV1 struct {
+	Accepted bool
+}
+
+func (m *MessageRequestAnswerV1) Deserialize(data io.Reader) error {
+	if json.NewDecoder(data).Decode(m) != nil {
+		return errors.New("Message request answer violates 'messageRequestAnswer.v1' schema.")
+	}
+	return nil
+}
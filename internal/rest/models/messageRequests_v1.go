@@ -0,0 +1,14 @@
+package models
+
+// Schema: messageRequests.v1
+type MessageRequestsV1 struct {
+	Total    int                     `json:"total"`
+	Requests []*MessageRequestInfoV1 `json:"requests,omitempty"`
+}
+
+type MessageRequestInfoV1 struct {
+	User      string   `json:"user"`
+	Messages  int      `json:"messages"`
+	Created   *UtcTime `json:"created,omitempty"`
+	Timestamp int64    `json:"timestamp"`
+}
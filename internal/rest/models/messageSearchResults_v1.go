@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Schema: messageSearchResults.v1
+type MessageSearchResultsV1 struct {
+	Total    int                    `json:"total"`
+	Messages []*MessageSearchInfoV1 `json:"messages,omitempty"`
+}
+
+type MessageSearchInfoV1 struct {
+	Id        int64   `json:"id"`
+	Timestamp int64   `json:"timestamp"`
+	Rank      float32 `json:"rank"`
+}
+
+type MessageSearchParameters struct {
+	Query  string
+	With   string     // optional: counterpart of the conversation, not the user
+	Since  *time.Time // optional: created at or after
+	Until  *time.Time // optional: created before
+	Offset int
+	Limit  int
+}
@@ -0,0 +1,23 @@
+package models
+
+// Schema: messageUpdates.v2
+type MessageUpdatesV2 struct {
+	Total   int             `json:"total"`
+	Updates []*UpdateInfoV2 `json:"updates,omitempty"`
+}
+
+// Besides messages, the timeline contains changes of user's data related to other users
+// (e.g. block list), identified by the user id.
+type UpdateInfoV2 struct {
+	Type      string `json:"type"`
+	Timestamp int64  `json:"timestamp"`
+	Id        int64  `json:"id,omitempty"`
+	User      string `json:"user,omitempty"`
+}
+
+const (
+	UpdateTypeMessage      = "message"
+	UpdateTypeBlock        = "block"
+	UpdateTypeRequest      = "request" // message request (with message id) or its state change (without)
+	UpdateTypeConversation = "conversation"
+)
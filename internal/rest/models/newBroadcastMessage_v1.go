@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const broadcastMaxRecipients = 100
+
+// Schema: newBroadcastMessage.v1
+// The same message is sent to every recipient as a separate personal message.
+type NewBroadcastMessageV1 struct {
+	To    []string
+	Text  string
+	Files []string
+}
+
+func (m *NewBroadcastMessageV1) Deserialize(data io.Reader) error {
+	if json.NewDecoder(data).Decode(m) != nil {
+		return errors.New("New message data violates 'newBroadcastMessage.v1' schema.")
+	}
+
+	recipients := make([]string, 0, len(m.To))
+	unique := make(map[string]struct{}, len(m.To))
+
+	for _, userId := range m.To {
+		userId = strings.TrimSpace(userId)
+
+		if _, duplicate := unique[userId]; duplicate {
+			continue
+		}
+
+		unique[userId] = struct{}{}
+		recipients = append(recipients, userId)
+	}
+
+	m.To = recipients
+	m.Text = strings.TrimSpace(m.Text)
+
+	return m.validate()
+}
+
+func (m *NewBroadcastMessageV1) validate() (err error) {
+	if len(m.To) == 0 {
+		err = errors.Join(err, errors.New("Message recipients must be specified."))
+	}
+
+	if len(m.To) > broadcastMaxRecipients {
+		err = errors.Join(err, fmt.Errorf("Too many message recipients: max %d.", broadcastMaxRecipients))
+	}
+
+	for _, userId := range m.To {
+		if userId == "" {
+			err = errors.Join(err, errors.New("Message recipient cannot be empty."))
+			break
+		}
+	}
+
+	if m.Text == "" && len(m.Files) == 0 {
+		err = errors.Join(err, errors.New("Message text or attached files must be specified."))
+	}
+
+	for _, fileId := range m.Files {
+		if len(fileId) != 24 {
+			err = errors.Join(err, errors.New("Attached file id must be 24 character long."))
+			break
+		}
+	}
+
+	return err
+}
@@ -7,11 +7,16 @@ import (
 	"strings"
 )
 
+// Data of new messages of any version (including broadcasts) is limited, the largest valid one
+// (e.g. newPersonalMessage.v4 with the envelope of the maximum size) is well below the limit.
+const NewMessageMaxSize = 1024 * 1024
+
 // Schema: newPersonalMessage.v1
 type NewPersonalMessageV1 struct {
-	To    string
-	Text  string
-	Files []string
+	To       string
+	Text     string
+	Files    []string
+	ClientId string // optional
 }
 
 func (m *NewPersonalMessageV1) Deserialize(data io.Reader) error {
@@ -21,6 +26,7 @@ func (m *NewPersonalMessageV1) Deserialize(data io.Reader) error {
 
 	m.To = strings.TrimSpace(m.To)
 	m.Text = strings.TrimSpace(m.Text)
+	m.ClientId = strings.ToLower(strings.TrimSpace(m.ClientId))
 
 	return m.validate()
 }
@@ -34,6 +40,10 @@ func (m *NewPersonalMessageV1) validate() (err error) {
 		err = errors.Join(err, errors.New("Message text or attached files must be specified."))
 	}
 
+	if m.ClientId != "" && !ValidClientId(m.ClientId) {
+		err = errors.Join(err, errors.New("Message client id must be UUID."))
+	}
+
 	for _, fileId := range m.Files {
 		if len(fileId) != 24 {
 			err = errors.Join(err, errors.New("Attached file id must be 24 character long."))
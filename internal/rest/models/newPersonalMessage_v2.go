@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Schema: newPersonalMessage.v2
+type NewPersonalMessageV2 struct {
+	To       string
+	Text     string
+	Entities []TextEntity
+	Files    []string
+	ClientId string // optional
+}
+
+func (m *NewPersonalMessageV2) Deserialize(data io.Reader) error {
+	if json.NewDecoder(data).Decode(m) != nil {
+		return errors.New("New message data violates 'newPersonalMessage.v2' schema.")
+	}
+
+	m.To = strings.TrimSpace(m.To)
+	m.Text, m.Entities = trimFormattedText(m.Text, m.Entities)
+	m.ClientId = strings.ToLower(strings.TrimSpace(m.ClientId))
+
+	return m.validate()
+}
+
+func (m *NewPersonalMessageV2) validate() (err error) {
+	if m.To == "" {
+		err = errors.Join(err, errors.New("Message recipient must be specified."))
+	}
+
+	if m.Text == "" && len(m.Files) == 0 {
+		err = errors.Join(err, errors.New("Message text or attached files must be specified."))
+	}
+
+	err = errors.Join(err, validateTextEntities(m.Text, m.Entities))
+
+	if m.ClientId != "" && !ValidClientId(m.ClientId) {
+		err = errors.Join(err, errors.New("Message client id must be UUID."))
+	}
+
+	for _, fileId := range m.Files {
+		if len(fileId) != 24 {
+			err = errors.Join(err, errors.New("Attached file id must be 24 character long."))
+			break
+		}
+	}
+
+	return err
+}
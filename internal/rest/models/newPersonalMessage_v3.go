@@ -0,0 +1,63 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Schema: newPersonalMessage.v3
+type NewPersonalMessageV3 struct {
+	To       string
+	Text     string
+	Entities []TextEntity
+	Content  *MessageContent
+	Files    []string
+	ClientId string // optional
+}
+
+func (m *NewPersonalMessageV3) Deserialize(data io.Reader) error {
+	if json.NewDecoder(data).Decode(m) != nil {
+		return errors.New("New message data violates 'newPersonalMessage.v3' schema.")
+	}
+
+	m.To = strings.TrimSpace(m.To)
+	m.Text, m.Entities = trimFormattedText(m.Text, m.Entities)
+	m.ClientId = strings.ToLower(strings.TrimSpace(m.ClientId))
+
+	if m.Content != nil {
+		m.Content.normalize()
+	}
+
+	return m.validate()
+}
+
+func (m *NewPersonalMessageV3) validate() (err error) {
+	if m.To == "" {
+		err = errors.Join(err, errors.New("Message recipient must be specified."))
+	}
+
+	if m.Text == "" && len(m.Files) == 0 && m.Content == nil {
+		err = errors.Join(err, errors.New("Message text, content or attached files must be specified."))
+	}
+
+	err = errors.Join(err, validateTextEntities(m.Text, m.Entities))
+
+	if m.Content != nil {
+		err = errors.Join(err, m.Content.validate())
+	}
+
+	if m.ClientId != "" && !ValidClientId(m.ClientId) {
+		err = errors.Join(err, errors.New("Message client id must be UUID."))
+	}
+
+	for _, fileId := range m.Files {
+		if len(fileId) != 24 {
+			err = errors.Join(err, errors.New("Attached file id must be 24 character long."))
+			break
+		}
+	}
+
+	return err
+}
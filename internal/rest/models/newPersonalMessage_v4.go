@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Schema: newPersonalMessage.v4
+type NewPersonalMessageV4 struct {
+	To       string
+	Envelope *EncryptedEnvelope // instead of text and content
+	Files    []string
+	ClientId string // optional
+}
+
+func (m *NewPersonalMessageV4) Deserialize(data io.Reader) error {
+	if json.NewDecoder(data).Decode(m) != nil {
+		return errors.New("New message data violates 'newPersonalMessage.v4' schema.")
+	}
+
+	m.To = strings.TrimSpace(m.To)
+	m.ClientId = strings.ToLower(strings.TrimSpace(m.ClientId))
+
+	return m.validate()
+}
+
+func (m *NewPersonalMessageV4) validate() (err error) {
+	if m.To == "" {
+		err = errors.Join(err, errors.New("Message recipient must be specified."))
+	}
+
+	if m.Envelope == nil {
+		err = errors.Join(err, errors.New("Message envelope must be specified."))
+	} else {
+		err = errors.Join(err, m.Envelope.validate())
+	}
+
+	if m.ClientId != "" && !ValidClientId(m.ClientId) {
+		err = errors.Join(err, errors.New("Message client id must be UUID."))
+	}
+
+	for _, fileId := range m.Files {
+		if len(fileId) != 24 {
+			err = errors.Join(err, errors.New("Attached file id must be 24 character long."))
+			break
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+)
+
+const webhookUrlMaxLength = 2000
+
+// Schema: newWebhook.v1
+type NewWebhookV1 struct {
+	Url string `json:"url"`
+}
+
+func (m *NewWebhookV1) Deserialize(data io.Reader) error {
+	if json.NewDecoder(data).Decode(m) != nil {
+		return errors.New("New webhook data violates 'newWebhook.v1' schema.")
+	}
+
+	return m.validate()
+}
+
+func (m *NewWebhookV1) validate() error {
+	if len(m.Url) > webhookUrlMaxLength {
+		return errors.New("Webhook URL must not be longer than 2000 characters.")
+	}
+
+	u, err := url.Parse(m.Url)
+
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("Webhook URL must be an absolute HTTP(S) URL.")
+	}
+
+	if u.User != nil || u.Fragment != "" {
+		return errors.New("Webhook URL must not contain user info or fragment.")
+	}
+
+	return nil
+}
@@ -3,12 +3,14 @@ package models
 // Schema: personalMessage.v1
 type PersonalMessageV1 struct {
 	Id        int64    `json:"id"`
+	ClientId  string   `json:"clientId,omitempty"` // for the sender only
 	Timestamp int64    `json:"timestamp"`
 	From      string   `json:"from,omitempty"`
 	To        string   `json:"to,omitempty"`
 	Created   *UtcTime `json:"created,omitempty"`
 	Edited    *UtcTime `json:"edited,omitempty"`
 	Read      bool     `json:"read,omitempty"`
+	Starred   bool     `json:"starred,omitempty"`
 	Text      string   `json:"text,omitempty"`
 	Files     []string `json:"files,omitempty"`
 	Deleted   bool     `json:"deleted,omitempty"`
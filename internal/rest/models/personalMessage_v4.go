@@ -0,0 +1,20 @@
+package models
+
+// Schema: personalMessage.v4
+type PersonalMessageV4 struct {
+	Id        int64              `json:"id"`
+	ClientId  string             `json:"clientId,omitempty"` // for the sender only
+	Timestamp int64              `json:"timestamp"`
+	From      string             `json:"from,omitempty"`
+	To        string             `json:"to,omitempty"`
+	Created   *UtcTime           `json:"created,omitempty"`
+	Edited    *UtcTime           `json:"edited,omitempty"`
+	Read      bool               `json:"read,omitempty"`
+	Starred   bool               `json:"starred,omitempty"`
+	Text      string             `json:"text,omitempty"`
+	Entities  []TextEntity       `json:"entities,omitempty"`
+	Content   *MessageContent    `json:"content,omitempty"`
+	Envelope  *EncryptedEnvelope `json:"envelope,omitempty"`
+	Files     []string           `json:"files,omitempty"`
+	Deleted   bool               `json:"deleted,omitempty"`
+}
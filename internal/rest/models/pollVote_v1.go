@@ -0,0 +1,19 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Schema: pollVote.v1
+type PollVoteV1 struct {
+	Options []int // indexes of the chosen options, empty to retract the vote
+}
+
+func (m *PollVoteV1) Deserialize(data io.Reader) error {
+	if json.NewDecoder(data).Decode(m) != nil {
+		return errors.New("Poll vote data violates 'pollVote.v1' schema.")
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package models
+
+// Schema: sentMessages.v1
+type SentMessagesV1 struct {
+	Total    int                  `json:"total"`
+	Messages []*SentMessageInfoV1 `json:"messages,omitempty"`
+}
+
+type SentMessageInfoV1 struct {
+	To        string `json:"to"`
+	Id        int64  `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// Schema: sharedFiles.v1
+type SharedFilesV1 struct {
+	Total int                 `json:"total"`
+	Files []*SharedFileInfoV1 `json:"files,omitempty"`
+	Next  int64               `json:"next,omitempty"` // 'before' parameter of the next page
+}
+
+type SharedFileInfoV1 struct {
+	FileId    string   `json:"fileId"`
+	MessageId int64    `json:"messageId"`
+	From      string   `json:"from"`
+	Created   *UtcTime `json:"created,omitempty"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// Schema: starredMessages.v1
+type StarredMessagesV1 struct {
+	Total    int                     `json:"total"`
+	Messages []*StarredMessageInfoV1 `json:"messages,omitempty"`
+	Next     int64                   `json:"next,omitempty"` // 'before' parameter of the next page
+}
+
+type StarredMessageInfoV1 struct {
+	Id        int64 `json:"id"`
+	Timestamp int64 `json:"timestamp"`
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Text entities mark up ranges of the message text. Offset and length are measured
+// in Unicode code points of the text (after surrounding whitespace is trimmed).
+type TextEntity struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	Url    string `json:"url,omitempty"`
+	User   string `json:"user,omitempty"`
+}
+
+const (
+	TextEntityBold    = "bold"
+	TextEntityItalic  = "italic"
+	TextEntityCode    = "code"
+	TextEntityLink    = "link"
+	TextEntityMention = "mention"
+)
+
+const maxTextEntities = 100
+
+var allowedLinkSchemes = map[string]struct{}{
+	"http":   {},
+	"https":  {},
+	"mailto": {},
+}
+
+// Trims whitespace around the text the same way as plain text is trimmed
+// and shifts entities accordingly, so they keep pointing to the same characters.
+func trimFormattedText(text string, entities []TextEntity) (string, []TextEntity) {
+	trimmedLeft := strings.TrimLeftFunc(text, unicode.IsSpace)
+	shift := utf8.RuneCountInString(text) - utf8.RuneCountInString(trimmedLeft)
+
+	for i := range entities {
+		entities[i].Offset -= shift
+		entities[i].Url = strings.TrimSpace(entities[i].Url)
+		entities[i].User = strings.TrimSpace(entities[i].User)
+	}
+
+	return strings.TrimRightFunc(trimmedLeft, unicode.IsSpace), entities
+}
+
+func validateTextEntities(text string, entities []TextEntity) (err error) {
+	if len(entities) > maxTextEntities {
+		return fmt.Errorf("Text cannot contain more than %d entities.", maxTextEntities)
+	}
+
+	textLength := utf8.RuneCountInString(text)
+
+	for i, e := range entities {
+		if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > textLength {
+			err = errors.Join(err, fmt.Errorf("Text entity #%d is out of the text range.", i))
+		}
+
+		switch e.Type {
+		case TextEntityBold, TextEntityItalic, TextEntityCode:
+			if e.Url != "" || e.User != "" {
+				err = errors.Join(err, fmt.Errorf("Text entity #%d of type '%s' cannot have url or user.", i, e.Type))
+			}
+		case TextEntityLink:
+			if e.User != "" {
+				err = errors.Join(err, fmt.Errorf("Text entity #%d of type 'link' cannot have user.", i))
+			}
+
+			if !isAllowedLink(e.Url) {
+				err = errors.Join(err, fmt.Errorf("Text entity #%d must have valid http, https or mailto url.", i))
+			}
+		case TextEntityMention:
+			if e.Url != "" {
+				err = errors.Join(err, fmt.Errorf("Text entity #%d of type 'mention' cannot have url.", i))
+			}
+
+			if e.User == "" || len(e.User) > 50 {
+				err = errors.Join(err, fmt.Errorf("Text entity #%d must have mentioned user id (max 50 characters).", i))
+			}
+		default:
+			err = errors.Join(err, fmt.Errorf("Text entity #%d has unknown type '%s'.", i, e.Type))
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for i := range entities {
+		for j := i + 1; j < len(entities); j++ {
+			if !compatibleTextEntities(entities[i], entities[j]) {
+				err = errors.Join(err, fmt.Errorf("Text entities #%d and #%d overlap.", i, j))
+			}
+		}
+	}
+
+	return err
+}
+
+// Bold and italic can be combined with any other entity except code,
+// whereas code, links and mentions cannot overlap with each other.
+func compatibleTextEntities(a, b TextEntity) bool {
+	if a.Offset+a.Length <= b.Offset || b.Offset+b.Length <= a.Offset {
+		return true
+	}
+
+	if a.Type == b.Type || a.Type == TextEntityCode || b.Type == TextEntityCode {
+		return false
+	}
+
+	return isTextStyle(a) || isTextStyle(b)
+}
+
+func isTextStyle(e TextEntity) bool {
+	return e.Type == TextEntityBold || e.Type == TextEntityItalic
+}
+
+func isAllowedLink(link string) bool {
+	u, err := url.Parse(link)
+
+	if err != nil {
+		return false
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+
+	if _, ok := allowedLinkSchemes[scheme]; !ok {
+		return false
+	}
+
+	if scheme == "mailto" {
+		return u.Opaque != ""
+	}
+
+	return u.Host != ""
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Schema: userBlock.v1
+type UserBlockV1 struct {
+	HideConversation bool
+}
+
+func (m *UserBlockV1) Deserialize(data io.Reader) error {
+	if json.NewDecoder(data).Decode(m) != nil {
+		return errors.New("User block data violates 'userBlock.v1' schema.")
+	}
+	return nil
+}
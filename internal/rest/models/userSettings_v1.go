@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Schema: userSettings.v1
+type UserSettingsV1 struct {
+	IncomingMessages string `json:"incomingMessages"`
+	HideReadReceipts bool   `json:"hideReadReceipts"` // senders don't see that their messages have been read
+}
+
+// Who may send messages to the user.
+const (
+	IncomingMessagesEveryone = "everyone" // messages from unknown senders become message requests
+	IncomingMessagesContacts = "contacts" // messages from unknown senders are rejected
+	IncomingMessagesNobody   = "nobody"   // all messages are rejected
+)
+
+func (m *UserSettingsV1) Deserialize(data io.Reader) error {
+	if json.NewDecoder(data).Decode(m) != nil {
+		return errors.New("User settings data violates 'userSettings.v1' schema.")
+	}
+
+	return m.validate()
+}
+
+func (m *UserSettingsV1) validate() error {
+	switch m.IncomingMessages {
+	case IncomingMessagesEveryone, IncomingMessagesContacts, IncomingMessagesNobody:
+		return nil
+	default:
+		return errors.New("Incoming messages setting must be one of: 'everyone', 'contacts', 'nobody'.")
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+// Schema: webhookDeliveries.v1
+// The latest deliveries go first.
+type WebhookDeliveriesV1 struct {
+	Total      int                  `json:"total"`
+	Deliveries []*WebhookDeliveryV1 `json:"deliveries,omitempty"`
+}
+
+// Every attempt to deliver updates of the timeline (from 'after' exclusive up to 'last' inclusive).
+type WebhookDeliveryV1 struct {
+	Attempted *UtcTime `json:"attempted"`
+	After     int64    `json:"after"`
+	Last      int64    `json:"last"`
+	Updates   int      `json:"updates"`
+	Delivered bool     `json:"delivered"`
+	Status    int      `json:"status,omitempty"` // HTTP status, if the endpoint responded
+	Error     string   `json:"error,omitempty"`
+	Duration  int64    `json:"duration"` // milliseconds
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Schema: webhookState.v1
+type WebhookStateV1 struct {
+	Enabled *bool `json:"enabled"`
+}
+
+func (m *WebhookStateV1) Deserialize(data io.Reader) error {
+	if json.NewDecoder(data).Decode(m) != nil {
+		return errors.New("Webhook state data violates 'webhookState.v1' schema.")
+	}
+
+	if m.Enabled == nil {
+		return errors.New("Webhook state 'enabled' must be specified.")
+	}
+
+	return nil
+}
@@ -0,0 +1,14 @@
+package models
+
+// Schema: webhook.v1
+// Secret is returned only once, when the webhook is created.
+type WebhookV1 struct {
+	Id           int64    `json:"id"`
+	Url          string   `json:"url"`
+	Secret       string   `json:"secret,omitempty"`
+	Enabled      bool     `json:"enabled"`
+	AutoDisabled bool     `json:"autoDisabled,omitempty"` // disabled by the service after persistent failures
+	Failures     int      `json:"failures,omitempty"`     // consecutive failed deliveries
+	After        int64    `json:"after"`                  // timestamp of the last delivered update
+	Created      *UtcTime `json:"created,omitempty"`
+}
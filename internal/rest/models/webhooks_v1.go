@@ -0,0 +1,7 @@
+package models
+
+// Schema: webhooks.v1
+type WebhooksV1 struct {
+	Total    int          `json:"total"`
+	Webhooks []*WebhookV1 `json:"webhooks,omitempty"`
+}
@@ -10,7 +10,11 @@ import (
 )
 
 const mimeTypeEditedMessageTextV1 = "application/vnd.editedMessageText.v1+json"
+const mimeTypeEditedMessageTextV2 = "application/vnd.editedMessageText.v2+json"
 const mimeTypeMessageReadMarkV1 = "application/vnd.messageReadMark.v1+json"
+const mimeTypeEditedMessageFilesV1 = "application/vnd.editedMessageFiles.v1+json"
+const mimeTypePollVoteV1 = "application/vnd.pollVote.v1+json"
+const mimeTypeEditedMessageEnvelopeV1 = "application/vnd.editedMessageEnvelope.v1+json"
 
 type ErrTimestampIsNotMatch interface {
 	Error() string
@@ -27,11 +31,29 @@ type ErrMessageDeleted interface {
 	ImplementsMessageDeletedError()
 }
 
+type ErrMessageNotFound interface {
+	Error() string
+	ImplementsMessageNotFoundError()
+}
+
+type ErrMessageEncrypted interface {
+	Error() string
+	ImplementsMessageEncryptedError()
+}
+
+type ErrMessageNotEncrypted interface {
+	Error() string
+	ImplementsMessageNotEncryptedError()
+}
+
 // https://barpav.github.io/msg-api-spec/#/messages/patch_messages__id_
 func (s *Service) modifyMessage(w http.ResponseWriter, r *http.Request) {
 	mimeType := r.Header.Get("Content-Type")
 
-	if mimeType != mimeTypeEditedMessageTextV1 && mimeType != mimeTypeMessageReadMarkV1 {
+	switch mimeType {
+	case mimeTypeEditedMessageTextV1, mimeTypeEditedMessageTextV2, mimeTypeMessageReadMarkV1, mimeTypeEditedMessageFilesV1, mimeTypePollVoteV1,
+		mimeTypeEditedMessageEnvelopeV1:
+	default:
 		w.WriteHeader(http.StatusUnsupportedMediaType)
 		return
 	}
@@ -53,12 +75,12 @@ func (s *Service) modifyMessage(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 	userId := authenticatedUser(r)
-	var message *models.PersonalMessageV1
+	var message *models.PersonalMessageV4
 
-	message, err = s.storage.PersonalMessageV1(ctx, userId, id)
+	message, err = s.storage.PersonalMessageV4(ctx, userId, id)
 
 	if err != nil {
-		logAndReturnErrorWithIssue(w, r, err, "Failed to receive personal message data (v1)")
+		logAndReturnErrorWithIssue(w, r, err, "Failed to receive personal message data (v4)")
 		return
 	}
 
@@ -84,12 +106,32 @@ func (s *Service) modifyMessage(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if editedData.Text == "" && len(message.Files) == 0 {
-			http.Error(w, "Text in a message without attachments cannot be empty.", 400)
+		if editedData.Text == "" && len(message.Files) == 0 && message.Content == nil {
+			http.Error(w, "Text in a message without attachments or content cannot be empty.", 400)
 			return
 		}
 
 		newTimestamp, err = s.storage.EditMessageText(ctx, id, clientTimestamp, editedData.Text)
+	case mimeTypeEditedMessageTextV2:
+		editedData := models.EditedMessageTextV2{}
+		err = editedData.Deserialize(r.Body)
+
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		if userId != message.From {
+			http.Error(w, "Only sender of the message can edit its text.", 400)
+			return
+		}
+
+		if editedData.Text == "" && len(message.Files) == 0 && message.Content == nil {
+			http.Error(w, "Text in a message without attachments or content cannot be empty.", 400)
+			return
+		}
+
+		newTimestamp, err = s.storage.EditMessageTextV2(ctx, id, clientTimestamp, editedData.Text, editedData.Entities)
 	case mimeTypeMessageReadMarkV1:
 		editedData := models.MessageReadMarkV1{}
 		err = editedData.Deserialize(r.Body)
@@ -105,6 +147,68 @@ func (s *Service) modifyMessage(w http.ResponseWriter, r *http.Request) {
 		}
 
 		newTimestamp, err = s.storage.SetMessageReadState(ctx, id, clientTimestamp, editedData.Read)
+	case mimeTypeEditedMessageEnvelopeV1:
+		editedData := models.EditedMessageEnvelopeV1{}
+		err = editedData.Deserialize(r.Body)
+
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		if userId != message.From {
+			http.Error(w, "Only sender of the message can edit its envelope.", 400)
+			return
+		}
+
+		newTimestamp, err = s.storage.EditMessageEnvelope(ctx, id, clientTimestamp, editedData.Envelope)
+	case mimeTypeEditedMessageFilesV1:
+		editedData := models.EditedMessageFilesV1{}
+		err = editedData.Deserialize(r.Body)
+
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		if userId != message.From {
+			http.Error(w, "Only sender of the message can edit its attachments.", 400)
+			return
+		}
+
+		if len(editedData.Files) == 0 && message.Text == "" && message.Content == nil && message.Envelope == nil {
+			http.Error(w, "Attachments of a message without text, content or envelope cannot be empty.", 400)
+			return
+		}
+
+		newTimestamp, err = s.storage.EditMessageFiles(ctx, id, clientTimestamp, editedData.Files)
+	case mimeTypePollVoteV1:
+		editedData := models.PollVoteV1{}
+		err = editedData.Deserialize(r.Body)
+
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		if message.Deleted {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+
+		if message.Content == nil || message.Content.Poll == nil {
+			http.Error(w, "Only polls can be voted.", 400)
+			return
+		}
+
+		err = message.Content.Poll.ValidateVote(editedData.Options)
+
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		newTimestamp, err = s.storage.VotePoll(ctx, userId, id, clientTimestamp, editedData.Options)
 	}
 
 	if err != nil {
@@ -123,6 +227,21 @@ func (s *Service) modifyMessage(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if _, ok := err.(ErrMessageNotFound); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if _, ok := err.(ErrMessageEncrypted); ok {
+			http.Error(w, "Text of encrypted message cannot be edited, its envelope can be.", 400)
+			return
+		}
+
+		if _, ok := err.(ErrMessageNotEncrypted); ok {
+			http.Error(w, "Message is not encrypted, its text can be edited instead.", 400)
+			return
+		}
+
 		logAndReturnErrorWithIssue(w, r, err, "Failed to modify message")
 		return
 	}
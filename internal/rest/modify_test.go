@@ -56,8 +56,8 @@ func TestService_modifyMessage(t *testing.T) {
 			testService: testService{
 				storage: func() *mocks.Storage {
 					s := mocks.NewStorage(t)
-					s.On("PersonalMessageV1", mock.Anything, "jane", int64(42)).Return(
-						&models.PersonalMessageV1{
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
 							Id:        42,
 							Timestamp: 55,
 							From:      "jane",
@@ -74,6 +74,51 @@ func TestService_modifyMessage(t *testing.T) {
 			},
 			wantStatus: http.StatusOK,
 		},
+		{
+			name: "Modified - formatted text (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.EditedMessageTextV2{
+						Text:     "  Hi!",
+						Entities: []models.TextEntity{{Type: models.TextEntityItalic, Offset: 2, Length: 2}},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("PATCH", "/{id}", &buf)
+					r.Header.Set("Content-Type", "application/vnd.editedMessageText.v2+json")
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Text:      "Hello",
+						},
+						nil)
+					s.On("EditMessageTextV2", mock.Anything, int64(42), int64(55), "Hi!",
+						[]models.TextEntity{{Type: models.TextEntityItalic, Offset: 0, Length: 2}}).Return(int64(60), nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"ETag": "60",
+			},
+			wantStatus: http.StatusOK,
+		},
 		{
 			name: "Invalid id (404)",
 			args: args{
@@ -149,7 +194,7 @@ func TestService_modifyMessage(t *testing.T) {
 			testService: testService{
 				storage: func() *mocks.Storage {
 					s := mocks.NewStorage(t)
-					s.On("PersonalMessageV1", mock.Anything, "jane", int64(42)).Return(nil, nil)
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(nil, nil)
 					return s
 				}(),
 			},
@@ -181,8 +226,8 @@ func TestService_modifyMessage(t *testing.T) {
 			testService: testService{
 				storage: func() *mocks.Storage {
 					s := mocks.NewStorage(t)
-					s.On("PersonalMessageV1", mock.Anything, "jane", int64(42)).Return(
-						&models.PersonalMessageV1{
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
 							Id:        42,
 							Timestamp: 55,
 							From:      "jane",
@@ -221,8 +266,8 @@ func TestService_modifyMessage(t *testing.T) {
 			testService: testService{
 				storage: func() *mocks.Storage {
 					s := mocks.NewStorage(t)
-					s.On("PersonalMessageV1", mock.Anything, "john", int64(42)).Return(
-						&models.PersonalMessageV1{
+					s.On("PersonalMessageV4", mock.Anything, "john", int64(42)).Return(
+						&models.PersonalMessageV4{
 							Id:        42,
 							Timestamp: 55,
 							From:      "jane",
@@ -261,8 +306,8 @@ func TestService_modifyMessage(t *testing.T) {
 			testService: testService{
 				storage: func() *mocks.Storage {
 					s := mocks.NewStorage(t)
-					s.On("PersonalMessageV1", mock.Anything, "jane", int64(42)).Return(
-						&models.PersonalMessageV1{
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
 							Id:        42,
 							Timestamp: 55,
 							From:      "jane",
@@ -301,8 +346,8 @@ func TestService_modifyMessage(t *testing.T) {
 			testService: testService{
 				storage: func() *mocks.Storage {
 					s := mocks.NewStorage(t)
-					s.On("PersonalMessageV1", mock.Anything, "jane", int64(42)).Return(
-						&models.PersonalMessageV1{
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
 							Id:        42,
 							Timestamp: 56,
 							From:      "jane",
@@ -343,8 +388,8 @@ func TestService_modifyMessage(t *testing.T) {
 			testService: testService{
 				storage: func() *mocks.Storage {
 					s := mocks.NewStorage(t)
-					s.On("PersonalMessageV1", mock.Anything, "jane", int64(42)).Return(
-						&models.PersonalMessageV1{
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
 							Id:        42,
 							Timestamp: 55,
 							From:      "jane",
@@ -385,8 +430,8 @@ func TestService_modifyMessage(t *testing.T) {
 			testService: testService{
 				storage: func() *mocks.Storage {
 					s := mocks.NewStorage(t)
-					s.On("PersonalMessageV1", mock.Anything, "jane", int64(42)).Return(
-						&models.PersonalMessageV1{
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
 							Id:        42,
 							Timestamp: 55,
 							From:      "jane",
@@ -402,6 +447,48 @@ func TestService_modifyMessage(t *testing.T) {
 			wantHeaders: map[string]string{},
 			wantStatus:  http.StatusGone,
 		},
+		{
+			name: "Message not found by storage (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.EditedMessageTextV1{
+						Text: "Hello",
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("PATCH", "/{id}", &buf)
+					r.Header.Set("Content-Type", "application/vnd.editedMessageText.v1+json")
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Text:      "Hello",
+						},
+						nil)
+					s.On("EditMessageText", mock.Anything, int64(42), int64(55), "Hello").Return(int64(0),
+						&ErrMessageNotFoundTest{})
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotFound,
+		},
 		{
 			name: "Modified - read (200)",
 			args: args{
@@ -427,8 +514,8 @@ func TestService_modifyMessage(t *testing.T) {
 			testService: testService{
 				storage: func() *mocks.Storage {
 					s := mocks.NewStorage(t)
-					s.On("PersonalMessageV1", mock.Anything, "john", int64(42)).Return(
-						&models.PersonalMessageV1{
+					s.On("PersonalMessageV4", mock.Anything, "john", int64(42)).Return(
+						&models.PersonalMessageV4{
 							Id:        42,
 							Timestamp: 55,
 							From:      "jane",
@@ -470,8 +557,404 @@ func TestService_modifyMessage(t *testing.T) {
 			testService: testService{
 				storage: func() *mocks.Storage {
 					s := mocks.NewStorage(t)
-					s.On("PersonalMessageV1", mock.Anything, "jane", int64(42)).Return(
-						&models.PersonalMessageV1{
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Text:      "Hello",
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Modified - files (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.EditedMessageFilesV1{
+						Files: []string{"64f85a5e2c5c6c2d5a6e6f0b"},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("PATCH", "/{id}", &buf)
+					r.Header.Set("Content-Type", "application/vnd.editedMessageFiles.v1+json")
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Files:     []string{"64f85a5e2c5c6c2d5a6e6f0a"},
+						},
+						nil)
+					s.On("EditMessageFiles", mock.Anything, int64(42), int64(55), []string{"64f85a5e2c5c6c2d5a6e6f0b"}).Return(int64(60), nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"ETag": "60",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Only sender can edit message files (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.EditedMessageFilesV1{
+						Files: []string{"64f85a5e2c5c6c2d5a6e6f0b"},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("PATCH", "/{id}", &buf)
+					r.Header.Set("Content-Type", "application/vnd.editedMessageFiles.v1+json")
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "john"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, "john", int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Files:     []string{"64f85a5e2c5c6c2d5a6e6f0a"},
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Message without text and files (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.EditedMessageFilesV1{
+						Files: []string{},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("PATCH", "/{id}", &buf)
+					r.Header.Set("Content-Type", "application/vnd.editedMessageFiles.v1+json")
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Files:     []string{"64f85a5e2c5c6c2d5a6e6f0a"},
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Modified - files of encrypted message removed (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.EditedMessageFilesV1{
+						Files: []string{},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("PATCH", "/{id}", &buf)
+					r.Header.Set("Content-Type", "application/vnd.editedMessageFiles.v1+json")
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Envelope: &models.EncryptedEnvelope{
+								Algorithm:      "x25519-aes256gcm",
+								RecipientKeyId: "key-1",
+								SenderDeviceId: "device-1",
+								Nonce:          "bm9uY2U=",
+								Ciphertext:     "Y2lwaGVydGV4dA==",
+							},
+							Files: []string{"64f85a5e2c5c6c2d5a6e6f0a"},
+						},
+						nil)
+					s.On("EditMessageFiles", mock.Anything, int64(42), int64(55), []string{}).Return(int64(60), nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"ETag": "60",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Modified - text of poll without attachments removed (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PATCH", "/{id}", bytes.NewBufferString(`{"text": ""}`))
+					r.Header.Set("Content-Type", "application/vnd.editedMessageText.v1+json")
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Text:      "Lunch?",
+							Content: &models.MessageContent{
+								Type: models.MessageContentPoll,
+								Poll: &models.PollContent{
+									Question: "Where?",
+									Options:  []*models.PollOption{{Text: "Here"}, {Text: "There"}},
+								},
+							},
+						},
+						nil)
+					s.On("EditMessageText", mock.Anything, int64(42), int64(55), "").Return(int64(60), nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"ETag": "60",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Modified - poll vote (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.PollVoteV1{
+						Options: []int{1},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("PATCH", "/{id}", &buf)
+					r.Header.Set("Content-Type", "application/vnd.pollVote.v1+json")
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "john"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, "john", int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Content: &models.MessageContent{
+								Type: models.MessageContentPoll,
+								Poll: &models.PollContent{
+									Question: "Lunch?",
+									Options:  []*models.PollOption{{Text: "Yes"}, {Text: "No"}},
+								},
+							},
+						},
+						nil)
+					s.On("VotePoll", mock.Anything, "john", int64(42), int64(55), []int{1}).Return(int64(60), nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"ETag": "60",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Vote for several options in single answer poll (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.PollVoteV1{
+						Options: []int{0, 1},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("PATCH", "/{id}", &buf)
+					r.Header.Set("Content-Type", "application/vnd.pollVote.v1+json")
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "john"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, "john", int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Content: &models.MessageContent{
+								Type: models.MessageContentPoll,
+								Poll: &models.PollContent{
+									Question: "Lunch?",
+									Options:  []*models.PollOption{{Text: "Yes"}, {Text: "No"}},
+								},
+							},
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Vote for unknown poll option (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.PollVoteV1{
+						Options: []int{2},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("PATCH", "/{id}", &buf)
+					r.Header.Set("Content-Type", "application/vnd.pollVote.v1+json")
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "john"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, "john", int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Content: &models.MessageContent{
+								Type: models.MessageContentPoll,
+								Poll: &models.PollContent{
+									Question: "Lunch?",
+									Options:  []*models.PollOption{{Text: "Yes"}, {Text: "No"}},
+								},
+							},
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Vote in message without poll (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.PollVoteV1{
+						Options: []int{0},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("PATCH", "/{id}", &buf)
+					r.Header.Set("Content-Type", "application/vnd.pollVote.v1+json")
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "john"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, "john", int64(42)).Return(
+						&models.PersonalMessageV4{
 							Id:        42,
 							Timestamp: 55,
 							From:      "jane",
@@ -485,6 +968,140 @@ func TestService_modifyMessage(t *testing.T) {
 			wantHeaders: map[string]string{},
 			wantStatus:  http.StatusBadRequest,
 		},
+		{
+			name: "Modified - envelope (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.EditedMessageEnvelopeV1{
+						Envelope: &models.EncryptedEnvelope{
+							Algorithm:      "x25519-xsalsa20-poly1305",
+							RecipientKeyId: "john-key-1",
+							SenderDeviceId: "jane-phone",
+							Nonce:          "AAECAwQFBgcICQoLDA0ODxAREhMUFRYX",
+							Ciphertext:     "ZWRpdGVkIHNlY3JldA==",
+						},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("PATCH", "/{id}", &buf)
+					r.Header.Set("Content-Type", "application/vnd.editedMessageEnvelope.v1+json")
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+						},
+						nil)
+					s.On("EditMessageEnvelope", mock.Anything, int64(42), int64(55), mock.Anything).Return(int64(60), nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"ETag": "60",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Envelope of not encrypted message (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.EditedMessageEnvelopeV1{
+						Envelope: &models.EncryptedEnvelope{
+							Algorithm:      "x25519-xsalsa20-poly1305",
+							RecipientKeyId: "john-key-1",
+							SenderDeviceId: "jane-phone",
+							Nonce:          "AAECAwQFBgcICQoLDA0ODxAREhMUFRYX",
+							Ciphertext:     "ZWRpdGVkIHNlY3JldA==",
+						},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("PATCH", "/{id}", &buf)
+					r.Header.Set("Content-Type", "application/vnd.editedMessageEnvelope.v1+json")
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+						},
+						nil)
+					s.On("EditMessageEnvelope", mock.Anything, int64(42), int64(55), mock.Anything).Return(int64(0), &ErrMessageNotEncryptedTest{})
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Text of encrypted message (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.EditedMessageTextV1{
+						Text: "Hi!",
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("PATCH", "/{id}", &buf)
+					r.Header.Set("Content-Type", "application/vnd.editedMessageText.v1+json")
+					r.Header.Set("If-Match", "55")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV4", mock.Anything, "jane", int64(42)).Return(
+						&models.PersonalMessageV4{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+						},
+						nil)
+					s.On("EditMessageText", mock.Anything, int64(42), int64(55), "Hi!").Return(int64(0), &ErrMessageEncryptedTest{})
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -516,6 +1133,9 @@ func TestService_modifyMessage(t *testing.T) {
 type ErrMessageDeletedTest struct{}
 type ErrTimestampIsNotMatchTest struct{}
 type ErrMessageNotModifiedTest struct{}
+type ErrMessageEncryptedTest struct{}
+type ErrMessageNotFoundTest struct{}
+type ErrMessageNotEncryptedTest struct{}
 
 func (e *ErrMessageDeletedTest) Error() string {
 	return "message deleted"
@@ -537,3 +1157,24 @@ func (e *ErrMessageNotModifiedTest) Error() string {
 
 func (e *ErrMessageNotModifiedTest) ImplementsMessageNotModifiedError() {
 }
+
+func (e *ErrMessageEncryptedTest) Error() string {
+	return "message is encrypted"
+}
+
+func (e *ErrMessageEncryptedTest) ImplementsMessageEncryptedError() {
+}
+
+func (e *ErrMessageNotEncryptedTest) Error() string {
+	return "message is not encrypted"
+}
+
+func (e *ErrMessageNotEncryptedTest) ImplementsMessageNotEncryptedError() {
+}
+
+func (e *ErrMessageNotFoundTest) Error() string {
+	return "message not found"
+}
+
+func (e *ErrMessageNotFoundTest) ImplementsMessageNotFoundError() {
+}
@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/go-chi/chi/v5"
+)
+
+const mimeTypeMessageRequestsV1 = "application/vnd.messageRequests.v1+json"
+const mimeTypeMessageRequestAnswerV1 = "application/vnd.messageRequestAnswer.v1+json"
+
+type ErrMessageRequestNotFound interface {
+	Error() string
+	ImplementsMessageRequestNotFoundError()
+}
+
+func (s *Service) getMessageRequests(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get("Accept") {
+	case "", mimeTypeMessageRequestsV1: // including if not specified
+		s.getMessageRequestsV1(w, r)
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+}
+
+func (s *Service) getMessageRequestsV1(w http.ResponseWriter, r *http.Request) {
+	requests, err := s.storage.MessageRequestsV1(r.Context(), authenticatedUser(r))
+
+	if err == nil {
+		w.Header().Set("Content-Type", mimeTypeMessageRequestsV1)
+		err = json.NewEncoder(w).Encode(requests)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get message requests (v1)")
+		return
+	}
+}
+
+func (s *Service) answerMessageRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != mimeTypeMessageRequestAnswerV1 {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	answer := models.MessageRequestAnswerV1{}
+	err := answer.Deserialize(r.Body)
+
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	err = s.storage.AnswerMessageRequest(r.Context(), authenticatedUser(r), chi.URLParam(r, "userId"), answer.Accepted)
+
+	if err != nil {
+		if _, ok := err.(ErrMessageRequestNotFound); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		logAndReturnErrorWithIssue(w, r, err, "Failed to answer message request")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
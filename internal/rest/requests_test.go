@@ -0,0 +1,317 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/barpav/msg-messages/internal/rest/mocks"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_getMessageRequests(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantBody    *models.MessageRequestsV1
+		wantStatus  int
+	}{
+		{
+			name: "Message requests received (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/requests", nil)
+					r.Header.Set("Accept", "application/vnd.messageRequests.v1+json")
+					return r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("MessageRequestsV1", mock.Anything, "jane").Return(
+						&models.MessageRequestsV1{
+							Total:    1,
+							Requests: []*models.MessageRequestInfoV1{{User: "john", Messages: 2, Timestamp: 90}},
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.messageRequests.v1+json",
+			},
+			wantBody: &models.MessageRequestsV1{
+				Total:    1,
+				Requests: []*models.MessageRequestInfoV1{{User: "john", Messages: 2, Timestamp: 90}},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Not acceptable (406)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/requests", nil)
+					r.Header.Set("Accept", "application/json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotAcceptable,
+		},
+		{
+			name: "Server-side issue (500)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/requests", nil)
+					r.Header.Set("request-id", "test-request-id")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("MessageRequestsV1", mock.Anything, mock.Anything).Return(nil, errors.New("test error"))
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"issue": "test-request-id",
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.getMessageRequests(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+
+			if tt.wantBody == nil {
+				return
+			}
+
+			var body *models.MessageRequestsV1
+			decoded := models.MessageRequestsV1{}
+			err := json.NewDecoder(tt.args.w.Body).Decode(&decoded)
+
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+
+			if err == nil {
+				body = &decoded
+			}
+
+			require.Equal(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestService_answerMessageRequest(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantStatus  int
+	}{
+		{
+			name: "Message request accepted (204)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PATCH", "/requests/{userId}", bytes.NewBufferString(`{"accepted": true}`))
+					r.Header.Set("Content-Type", "application/vnd.messageRequestAnswer.v1+json")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("AnswerMessageRequest", mock.Anything, "jane", "john", true).Return(nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNoContent,
+		},
+		{
+			name: "Message request declined (204)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PATCH", "/requests/{userId}", bytes.NewBufferString(`{"accepted": false}`))
+					r.Header.Set("Content-Type", "application/vnd.messageRequestAnswer.v1+json")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("AnswerMessageRequest", mock.Anything, "jane", "john", false).Return(nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNoContent,
+		},
+		{
+			name: "Incorrect answer (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PATCH", "/requests/{userId}", bytes.NewBufferString(`{"accepted": "yes"}`))
+					r.Header.Set("Content-Type", "application/vnd.messageRequestAnswer.v1+json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Message request not found (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PATCH", "/requests/{userId}", bytes.NewBufferString(`{"accepted": true}`))
+					r.Header.Set("Content-Type", "application/vnd.messageRequestAnswer.v1+json")
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("AnswerMessageRequest", mock.Anything, mock.Anything, "john", true).Return(&ErrMessageRequestNotFoundTest{})
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotFound,
+		},
+		{
+			name: "Unsupported answer data (415)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PATCH", "/requests/{userId}", bytes.NewBufferString(`{"accepted": true}`))
+					r.Header.Set("Content-Type", "application/json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "Server-side issue (500)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PATCH", "/requests/{userId}", bytes.NewBufferString(`{"accepted": true}`))
+					r.Header.Set("Content-Type", "application/vnd.messageRequestAnswer.v1+json")
+					r.Header.Set("request-id", "test-request-id")
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("userId", "john")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("AnswerMessageRequest", mock.Anything, mock.Anything, "john", true).Return(errors.New("test error"))
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"issue": "test-request-id",
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.answerMessageRequest(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+		})
+	}
+}
+
+type ErrMessageRequestNotFoundTest struct{}
+
+func (e *ErrMessageRequestNotFoundTest) Error() string {
+	return "message request not found"
+}
+
+func (e *ErrMessageRequestNotFoundTest) ImplementsMessageRequestNotFoundError() {
+}
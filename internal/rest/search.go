@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+const mimeTypeMessageSearchResultsV1 = "application/vnd.messageSearchResults.v1+json"
+
+func (s *Service) searchMessages(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get("Accept") {
+	case "", mimeTypeMessageSearchResultsV1: // including if not specified
+		s.getMessageSearchResultsV1(w, r)
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+}
+
+func (s *Service) getMessageSearchResultsV1(w http.ResponseWriter, r *http.Request) {
+	params, err := getMessageSearchResultsV1Parameters(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	var results *models.MessageSearchResultsV1
+	results, err = s.storage.SearchMessagesV1(r.Context(), authenticatedUser(r), params)
+
+	if err == nil {
+		w.Header().Set("Content-Type", mimeTypeMessageSearchResultsV1)
+		err = json.NewEncoder(w).Encode(results)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get message search results (v1)")
+		return
+	}
+}
+
+func getMessageSearchResultsV1Parameters(r *http.Request) (params *models.MessageSearchParameters, err error) {
+	query := r.URL.Query()
+	params = &models.MessageSearchParameters{
+		Query: strings.TrimSpace(query.Get("q")),
+		With:  strings.TrimSpace(query.Get("with")),
+		Limit: 50,
+	}
+
+	const queryMaxLength = 256
+
+	if params.Query == "" {
+		return nil, errors.New("Parameter 'q' must be specified.")
+	}
+
+	if len(params.Query) > queryMaxLength {
+		return nil, fmt.Errorf("Parameter 'q' is too long: max %d bytes.", queryMaxLength)
+	}
+
+	if params.With != "" && params.With == authenticatedUser(r) {
+		return nil, errors.New("Parameter 'with' must be another user.")
+	}
+
+	params.Since, err = timeParameter(r, "since")
+
+	if err != nil {
+		return nil, err
+	}
+
+	params.Until, err = timeParameter(r, "until")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if param := query.Get("offset"); param != "" {
+		params.Offset, err = strconv.Atoi(param)
+
+		if err != nil || params.Offset < 0 {
+			return nil, errors.New("Parameter 'offset' must be a non-negative integer.")
+		}
+	}
+
+	if param := query.Get("limit"); param != "" {
+		params.Limit, err = strconv.Atoi(param)
+
+		if err != nil {
+			return nil, errors.New("Parameter 'limit' must be an integer type.")
+		}
+
+		const limitMin = 1
+		const limitMax = 100
+
+		if params.Limit < limitMin || params.Limit > limitMax {
+			return nil, fmt.Errorf("Invalid parameter 'limit': min %d, max %d.", limitMin, limitMax)
+		}
+	}
+
+	return params, nil
+}
+
+// Accepts both date (2006-01-02) and date-time (2006-01-02T15:04:05Z07:00) formats.
+func timeParameter(r *http.Request, name string) (*time.Time, error) {
+	param := r.URL.Query().Get(name)
+
+	if param == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		t, err := time.Parse(layout, param)
+
+		if err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Parameter '%s' must be a date (YYYY-MM-DD) or date-time (RFC 3339).", name)
+}
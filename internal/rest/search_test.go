@@ -0,0 +1,233 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/mocks"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_searchMessages(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantBody    *models.MessageSearchResultsV1
+		wantStatus  int
+	}{
+		{
+			name: "Messages found - default parameters (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/search?q=hello", nil)
+					r.Header.Set("Accept", "application/vnd.messageSearchResults.v1+json")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("SearchMessagesV1", mock.Anything, mock.Anything, &models.MessageSearchParameters{
+						Query: "hello",
+						Limit: 50,
+					}).Return(
+						&models.MessageSearchResultsV1{
+							Total: 2,
+							Messages: []*models.MessageSearchInfoV1{
+								{Id: 110, Timestamp: 215, Rank: 0.1},
+								{Id: 100, Timestamp: 240, Rank: 0.05},
+							},
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.messageSearchResults.v1+json",
+			},
+			wantBody: &models.MessageSearchResultsV1{
+				Total: 2,
+				Messages: []*models.MessageSearchInfoV1{
+					{Id: 110, Timestamp: 215, Rank: 0.1},
+					{Id: 100, Timestamp: 240, Rank: 0.05},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Messages found - all parameters (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/search?q=hello&with=john&since=2023-09-01&until=2023-09-02T12:00:00Z&offset=10&limit=5", nil)
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					since := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+					until := time.Date(2023, 9, 2, 12, 0, 0, 0, time.UTC)
+					s.On("SearchMessagesV1", mock.Anything, mock.Anything, &models.MessageSearchParameters{
+						Query:  "hello",
+						With:   "john",
+						Since:  &since,
+						Until:  &until,
+						Offset: 10,
+						Limit:  5,
+					}).Return(&models.MessageSearchResultsV1{}, nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.messageSearchResults.v1+json",
+			},
+			wantBody:   &models.MessageSearchResultsV1{},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Query not specified (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/search?q=%20", nil)
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Search in conversation with themself (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/search?q=hello&with=jane", nil)
+					return r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Invalid date (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/search?q=hello&since=yesterday", nil)
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Invalid limit (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/search?q=hello&limit=101", nil)
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Not acceptable (406)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/search?q=hello", nil)
+					r.Header.Set("Accept", "application/json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotAcceptable,
+		},
+		{
+			name: "Server-side issue (500)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/search?q=hello", nil)
+					r.Header.Set("request-id", "test-request-id")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("SearchMessagesV1", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("test error"))
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"issue": "test-request-id",
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.searchMessages(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+
+			if tt.wantBody == nil {
+				return
+			}
+
+			var body *models.MessageSearchResultsV1
+			decoded := models.MessageSearchResultsV1{}
+			err := json.NewDecoder(tt.args.w.Body).Decode(&decoded)
+
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+
+			if err == nil {
+				body = &decoded
+			}
+
+			require.Equal(t, body, tt.wantBody)
+		})
+	}
+}
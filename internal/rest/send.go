@@ -1,27 +1,128 @@
 package rest
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/barpav/msg-messages/internal/rest/models"
 	"github.com/rs/zerolog/log"
 )
 
+const mimeTypeNewPersonalMessageV1 = "application/vnd.newPersonalMessage.v1+json"
+const mimeTypeNewPersonalMessageV2 = "application/vnd.newPersonalMessage.v2+json"
+const mimeTypeNewPersonalMessageV3 = "application/vnd.newPersonalMessage.v3+json"
+const mimeTypeNewPersonalMessageV4 = "application/vnd.newPersonalMessage.v4+json"
+const mimeTypeNewBroadcastMessageV1 = "application/vnd.newBroadcastMessage.v1+json"
+const mimeTypeSentMessagesV1 = "application/vnd.sentMessages.v1+json"
+
+const idempotencyKeyMaxLength = 255
+
+type ErrSenderBlocked interface {
+	Error() string
+	ImplementsSenderBlockedError()
+	Recipient() string
+}
+
+type ErrRecipientNotAccepting interface {
+	Error() string
+	ImplementsRecipientNotAcceptingError()
+	Recipient() string
+}
+
+type ErrClientIdConflict interface {
+	Error() string
+	ImplementsClientIdConflictError()
+	MessageId() int64
+}
+
+type ErrIdempotencyKeyUsed interface {
+	Error() string
+	ImplementsIdempotencyKeyUsedError()
+}
+
+type ErrIdempotencyKeyMismatch interface {
+	Error() string
+	ImplementsIdempotencyKeyMismatchError()
+}
+
 // https://barpav.github.io/msg-api-spec/#/messages/post_messages
 func (s *Service) sendNewMessage(w http.ResponseWriter, r *http.Request) {
-	switch r.Header.Get("Content-Type") {
-	case "application/vnd.newPersonalMessage.v1+json":
-		s.sendPersonalMessageV1(w, r)
+	mimeType := r.Header.Get("Content-Type")
+
+	switch mimeType {
+	case mimeTypeNewPersonalMessageV1, mimeTypeNewPersonalMessageV2, mimeTypeNewPersonalMessageV3, mimeTypeNewPersonalMessageV4,
+		mimeTypeNewBroadcastMessageV1:
 	default:
 		w.WriteHeader(http.StatusUnsupportedMediaType)
 		return
 	}
+
+	body, ok := readNewMessageData(w, r)
+
+	if !ok {
+		return
+	}
+
+	key, err := idempotencyKey(r, body)
+
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if key != nil && s.replayIdempotentRequest(w, r, key) {
+		return
+	}
+
+	switch mimeType {
+	case mimeTypeNewPersonalMessageV1:
+		s.sendPersonalMessageV1(w, r, key)
+	case mimeTypeNewPersonalMessageV2:
+		s.sendPersonalMessageV2(w, r, key)
+	case mimeTypeNewPersonalMessageV3:
+		s.sendPersonalMessageV3(w, r, key)
+	case mimeTypeNewPersonalMessageV4:
+		s.sendPersonalMessageV4(w, r, key)
+	case mimeTypeNewBroadcastMessageV1:
+		s.sendBroadcastMessageV1(w, r, key)
+	}
+}
+
+func (s *Service) sendPersonalMessageV1(w http.ResponseWriter, r *http.Request, key *models.IdempotencyKey) {
+	sendPersonalMessage(s, w, r, key, "v1", Storage.CreateNewPersonalMessageV1)
 }
 
-func (s *Service) sendPersonalMessageV1(w http.ResponseWriter, r *http.Request) {
-	message := models.NewPersonalMessageV1{}
+func (s *Service) sendPersonalMessageV2(w http.ResponseWriter, r *http.Request, key *models.IdempotencyKey) {
+	sendPersonalMessage(s, w, r, key, "v2", Storage.CreateNewPersonalMessageV2)
+}
+
+func (s *Service) sendPersonalMessageV3(w http.ResponseWriter, r *http.Request, key *models.IdempotencyKey) {
+	sendPersonalMessage(s, w, r, key, "v3", Storage.CreateNewPersonalMessageV3)
+}
+
+func (s *Service) sendPersonalMessageV4(w http.ResponseWriter, r *http.Request, key *models.IdempotencyKey) {
+	sendPersonalMessage(s, w, r, key, "v4", Storage.CreateNewPersonalMessageV4)
+}
+
+// Data of a new personal message (a pointer to one of its versions, e.g. *models.NewPersonalMessageV1).
+type newPersonalMessage[T any] interface {
+	*T
+	Deserialize(data io.Reader) error
+}
+
+// Versions of personal messages differ in their data only, which is passed to the storage method of the version
+// (method expression, e.g. Storage.CreateNewPersonalMessageV1).
+func sendPersonalMessage[T any, M newPersonalMessage[T]](s *Service, w http.ResponseWriter, r *http.Request,
+	key *models.IdempotencyKey, version string,
+	create func(storage Storage, ctx context.Context, sender string, data M, key *models.IdempotencyKey) (id int64, timestamp int64, err error)) {
+	message := M(new(T))
 	err := message.Deserialize(r.Body)
 
 	if err != nil {
@@ -30,28 +131,184 @@ func (s *Service) sendPersonalMessageV1(w http.ResponseWriter, r *http.Request)
 	}
 
 	var id, timestamp int64
-	id, timestamp, err = s.storage.CreateNewPersonalMessageV1(r.Context(), authenticatedUser(r), &message)
+	id, timestamp, err = create(s.storage, r.Context(), authenticatedUser(r), message, key)
 
 	if err != nil {
-		logAndReturnErrorWithIssue(w, r, err, "Failed to send new personal message (v1)")
+		s.handleSendingError(w, r, err, key, fmt.Sprintf("Failed to send new personal message (%s)", version))
 		return
 	}
 
-	if len(message.Files) != 0 {
-		go func() {
-			ctx := context.Background()
+	w.Header().Set("Location", fmt.Sprintf("/%d", id))
+	w.Header()["ETag"] = []string{fmt.Sprintf("%d", timestamp)}
+	w.WriteHeader(http.StatusCreated)
+}
 
-			for _, fileId := range message.Files {
-				err = s.fileStats.SendUsage(ctx, fileId, true)
+// Recipients are named in the errors, since the sender cannot tell otherwise which of them rejected the message.
+func (s *Service) sendBroadcastMessageV1(w http.ResponseWriter, r *http.Request, key *models.IdempotencyKey) {
+	message := models.NewBroadcastMessageV1{}
+	err := message.Deserialize(r.Body)
 
-				if err != nil {
-					log.Err(err).Msg(fmt.Sprintf("Failed to send used file '%s' statistics.", fileId))
-				}
-			}
-		}()
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	sender := authenticatedUser(r)
+
+	for _, userId := range message.To {
+		if userId == sender {
+			http.Error(w, "Sender cannot be among message recipients.", 400)
+			return
+		}
+	}
+
+	var sent *models.SentMessagesV1
+	sent, err = s.storage.CreateNewBroadcastMessageV1(r.Context(), sender, &message, key)
+
+	if e, ok := err.(ErrSenderBlocked); ok {
+		http.Error(w, fmt.Sprintf("Message recipient '%s' has blocked the sender.", e.Recipient()), http.StatusForbidden)
+		return
+	}
+
+	if e, ok := err.(ErrRecipientNotAccepting); ok {
+		http.Error(w, fmt.Sprintf("Message recipient '%s' does not accept messages from the sender.", e.Recipient()), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		s.handleSendingError(w, r, err, key, "Failed to send new broadcast message (v1)")
+		return
+	}
+
+	writeSentMessagesV1(w, sent)
+}
+
+func writeSentMessagesV1(w http.ResponseWriter, sent *models.SentMessagesV1) {
+	w.Header().Set("Content-Type", mimeTypeSentMessagesV1)
+	w.WriteHeader(http.StatusCreated)
+	err := json.NewEncoder(w).Encode(sent)
+
+	if err != nil {
+		log.Err(err).Msg("Failed to send broadcast message results (v1).")
+	}
+}
+
+func (s *Service) handleSendingError(w http.ResponseWriter, r *http.Request, err error, key *models.IdempotencyKey, logMsg string) {
+	if _, ok := err.(ErrSenderBlocked); ok {
+		http.Error(w, "Message recipient has blocked the sender.", http.StatusForbidden)
+		return
+	}
+
+	if _, ok := err.(ErrRecipientNotAccepting); ok {
+		http.Error(w, "Message recipient does not accept messages from the sender.", http.StatusForbidden)
+		return
+	}
+
+	if e, ok := err.(ErrClientIdConflict); ok {
+		w.Header().Set("Location", fmt.Sprintf("/%d", e.MessageId()))
+		http.Error(w, "Message with the same client id has already been sent.", http.StatusConflict)
+		return
+	}
+
+	if _, ok := err.(ErrIdempotencyKeyUsed); ok && key != nil && s.replayIdempotentRequest(w, r, key) {
+		return // the same request has been processed concurrently
+	}
+
+	logAndReturnErrorWithIssue(w, r, err, logMsg)
+}
+
+// Responds the same way as to the original request if it has already been processed.
+func (s *Service) replayIdempotentRequest(w http.ResponseWriter, r *http.Request, key *models.IdempotencyKey) (replayed bool) {
+	if r.Header.Get("Content-Type") == mimeTypeNewBroadcastMessageV1 {
+		return s.replayIdempotentBroadcast(w, r, key)
+	}
+
+	id, timestamp, err := s.storage.MessageByIdempotencyKey(r.Context(), authenticatedUser(r), key)
+
+	if err != nil {
+		if _, ok := err.(ErrIdempotencyKeyMismatch); ok {
+			http.Error(w, "Idempotency key has already been used for another request.", http.StatusUnprocessableEntity)
+			return true
+		}
+
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get message by idempotency key")
+		return true
+	}
+
+	if id == 0 {
+		return false
 	}
 
 	w.Header().Set("Location", fmt.Sprintf("/%d", id))
 	w.Header()["ETag"] = []string{fmt.Sprintf("%d", timestamp)}
 	w.WriteHeader(http.StatusCreated)
+
+	return true
+}
+
+func (s *Service) replayIdempotentBroadcast(w http.ResponseWriter, r *http.Request, key *models.IdempotencyKey) (replayed bool) {
+	sent, err := s.storage.BroadcastByIdempotencyKey(r.Context(), authenticatedUser(r), key)
+
+	if err != nil {
+		if _, ok := err.(ErrIdempotencyKeyMismatch); ok {
+			http.Error(w, "Idempotency key has already been used for another request.", http.StatusUnprocessableEntity)
+			return true
+		}
+
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get broadcast messages by idempotency key")
+		return true
+	}
+
+	if sent == nil {
+		return false
+	}
+
+	writeSentMessagesV1(w, sent)
+
+	return true
+}
+
+// Message data is read in advance (e.g. to calculate the fingerprint of the idempotency key),
+// so the request body is replaced with the read copy. The data is limited before it's read,
+// since the limits of the message models are checked only after that.
+func readNewMessageData(w http.ResponseWriter, r *http.Request) (body []byte, ok bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, models.NewMessageMaxSize))
+
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Message data is too large: max %d bytes.", models.NewMessageMaxSize),
+				http.StatusRequestEntityTooLarge)
+			return nil, false
+		}
+
+		http.Error(w, "Failed to read request data.", 400)
+		return nil, false
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+func idempotencyKey(r *http.Request, body []byte) (*models.IdempotencyKey, error) {
+	key := r.Header.Get("Idempotency-Key")
+
+	if key == "" {
+		return nil, nil
+	}
+
+	if len(key) > idempotencyKeyMaxLength {
+		return nil, fmt.Errorf("Idempotency key is too long: max %d bytes.", idempotencyKeyMaxLength)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(r.Header.Get("Content-Type")))
+	hash.Write([]byte{'\n'})
+	hash.Write(body)
+
+	return &models.IdempotencyKey{
+		Key:         key,
+		Fingerprint: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
 }
@@ -2,11 +2,13 @@ package rest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/barpav/msg-messages/internal/rest/mocks"
@@ -29,6 +31,7 @@ func TestService_sendNewMessage(t *testing.T) {
 		args        args
 		wantHeaders map[string]string
 		wantStatus  int
+		wantBody    string // if specified
 	}{
 		{
 			name: "Message sent (201)",
@@ -52,7 +55,7 @@ func TestService_sendNewMessage(t *testing.T) {
 			testService: testService{
 				storage: func() *mocks.Storage {
 					s := mocks.NewStorage(t)
-					s.On("CreateNewPersonalMessageV1", mock.Anything, mock.Anything, mock.Anything).Return(int64(123), int64(456), nil)
+					s.On("CreateNewPersonalMessageV1", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(int64(123), int64(456), nil)
 					return s
 				}(),
 			},
@@ -83,6 +86,540 @@ func TestService_sendNewMessage(t *testing.T) {
 			wantHeaders: map[string]string{},
 			wantStatus:  http.StatusBadRequest,
 		},
+		{
+			name: "Message with formatted text sent (201)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.NewPersonalMessageV2{
+						To:   "john",
+						Text: "Hello, John!",
+						Entities: []models.TextEntity{
+							{Type: models.TextEntityBold, Offset: 0, Length: 5},
+							{Type: models.TextEntityMention, Offset: 7, Length: 4, User: "john"},
+						},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("POST", "/", &buf)
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v2+json")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("CreateNewPersonalMessageV2", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(int64(123), int64(456), nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Location": "/123",
+				"ETag":     "456",
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "Message with poll sent (201)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.NewPersonalMessageV3{
+						To: "john",
+						Content: &models.MessageContent{
+							Type: models.MessageContentPoll,
+							Poll: &models.PollContent{
+								Question: " Lunch? ",
+								Options:  []*models.PollOption{{Text: "Yes", Votes: 10}, {Text: "No"}},
+							},
+						},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("POST", "/", &buf)
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v3+json")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("CreateNewPersonalMessageV3", mock.Anything, mock.Anything,
+						&models.NewPersonalMessageV3{
+							To: "john",
+							Content: &models.MessageContent{
+								Type: models.MessageContentPoll,
+								Poll: &models.PollContent{
+									Question: "Lunch?",
+									Options:  []*models.PollOption{{Text: "Yes"}, {Text: "No"}},
+								},
+							},
+						},
+						mock.Anything).Return(int64(123), int64(456), nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Location": "/123",
+				"ETag":     "456",
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "Incorrect message content (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.NewPersonalMessageV3{
+						To: "john",
+						Content: &models.MessageContent{
+							Type:     models.MessageContentContact,
+							Location: &models.LocationContent{Latitude: 91, Longitude: 0},
+						},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("POST", "/", &buf)
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v3+json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Encrypted message sent (201)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.NewPersonalMessageV4{
+						To: "john",
+						Envelope: &models.EncryptedEnvelope{
+							Algorithm:      "x25519-xsalsa20-poly1305",
+							RecipientKeyId: "john-key-1",
+							SenderDeviceId: "jane-phone",
+							Nonce:          "AAECAwQFBgcICQoLDA0ODxAREhMUFRYX",
+							Ciphertext:     "c2VjcmV0IG1lc3NhZ2U=",
+						},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("POST", "/", &buf)
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v4+json")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("CreateNewPersonalMessageV4", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(int64(123), int64(456), nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Location": "/123",
+				"ETag":     "456",
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "Incorrect message envelope (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.NewPersonalMessageV4{
+						To: "john",
+						Envelope: &models.EncryptedEnvelope{
+							Algorithm:      "x25519 xsalsa20",
+							RecipientKeyId: "john-key-1",
+							SenderDeviceId: "jane-phone",
+							Nonce:          "not base64!",
+							Ciphertext:     "c2VjcmV0IG1lc3NhZ2U=",
+						},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("POST", "/", &buf)
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v4+json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Incorrect text entities (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.NewPersonalMessageV2{
+						To:   "john",
+						Text: "Hello!",
+						Entities: []models.TextEntity{
+							{Type: models.TextEntityLink, Offset: 0, Length: 5, Url: "javascript:alert(1)"},
+							{Type: models.TextEntityCode, Offset: 2, Length: 10},
+						},
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("POST", "/", &buf)
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v2+json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Sender is blocked by recipient (403)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.NewPersonalMessageV1{
+						To:   "john",
+						Text: "Hello!",
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("POST", "/", &buf)
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v1+json")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("CreateNewPersonalMessageV1", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(int64(0), int64(0),
+						&ErrSenderBlockedTest{})
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusForbidden,
+		},
+		{
+			name: "Recipient does not accept messages (403)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					m := models.NewPersonalMessageV1{
+						To:   "john",
+						Text: "Hello!",
+					}
+					var buf bytes.Buffer
+					err := json.NewEncoder(&buf).Encode(m)
+					if err != nil {
+						log.Fatal(err)
+					}
+					r := httptest.NewRequest("POST", "/", &buf)
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v1+json")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("CreateNewPersonalMessageV1", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(int64(0), int64(0),
+						&ErrRecipientNotAcceptingTest{})
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusForbidden,
+		},
+		{
+			name: "Message sent with idempotency key (201)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"to": "john", "text": "Hello!"}`))
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v1+json")
+					r.Header.Set("Idempotency-Key", "7f1c0ac5-9bd4-4a3e-8f3e-2f8d4d1b6c11")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("MessageByIdempotencyKey", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), int64(0), nil)
+					s.On("CreateNewPersonalMessageV1", mock.Anything, mock.Anything, mock.Anything,
+						mock.MatchedBy(func(key *models.IdempotencyKey) bool {
+							return key.Key == "7f1c0ac5-9bd4-4a3e-8f3e-2f8d4d1b6c11" && len(key.Fingerprint) == 64
+						})).Return(int64(123), int64(456), nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Location": "/123",
+				"ETag":     "456",
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "Message data too large (413)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					text := strings.Repeat("a", models.NewMessageMaxSize)
+					r := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"to": "john", "text": "`+text+`"}`))
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v1+json")
+					r.Header.Set("Idempotency-Key", "7f1c0ac5-9bd4-4a3e-8f3e-2f8d4d1b6c11")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "Retried request replayed (201)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"to": "john", "text": "Hello!"}`))
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v1+json")
+					r.Header.Set("Idempotency-Key", "7f1c0ac5-9bd4-4a3e-8f3e-2f8d4d1b6c11")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("MessageByIdempotencyKey", mock.Anything, mock.Anything, mock.Anything).Return(int64(123), int64(456), nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Location": "/123",
+				"ETag":     "456",
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "Concurrently retried request replayed (201)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"to": "john", "text": "Hello!"}`))
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v1+json")
+					r.Header.Set("Idempotency-Key", "7f1c0ac5-9bd4-4a3e-8f3e-2f8d4d1b6c11")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("MessageByIdempotencyKey", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), int64(0), nil).Once()
+					s.On("CreateNewPersonalMessageV1", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(int64(0), int64(0),
+						&ErrIdempotencyKeyUsedTest{})
+					s.On("MessageByIdempotencyKey", mock.Anything, mock.Anything, mock.Anything).Return(int64(123), int64(456), nil).Once()
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Location": "/123",
+				"ETag":     "456",
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "Idempotency key used for another request (422)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"to": "john", "text": "Hello!"}`))
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v1+json")
+					r.Header.Set("Idempotency-Key", "7f1c0ac5-9bd4-4a3e-8f3e-2f8d4d1b6c11")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("MessageByIdempotencyKey", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), int64(0),
+						&ErrIdempotencyKeyMismatchTest{})
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusUnprocessableEntity,
+		},
+		{
+			name: "Incorrect client id (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"to": "john", "text": "Hello!", "clientId": "42"}`))
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v1+json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Message with the same client id already sent (409)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("POST", "/",
+						bytes.NewBufferString(`{"to": "john", "text": "Hello!", "clientId": "0f5c7a3e-9b1d-4c2e-8a4f-6d3b2e1c0a9b"}`))
+					r.Header.Set("Content-Type", "application/vnd.newPersonalMessage.v2+json")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("CreateNewPersonalMessageV2", mock.Anything, mock.Anything,
+						mock.MatchedBy(func(m *models.NewPersonalMessageV2) bool {
+							return m.ClientId == "0f5c7a3e-9b1d-4c2e-8a4f-6d3b2e1c0a9b"
+						}), mock.Anything).Return(int64(0), int64(0), &ErrClientIdConflictTest{messageId: 123})
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Location": "/123",
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "Broadcast message sent (201)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"to": ["john", "bob", "john"], "text": "Hello!"}`))
+					r.Header.Set("Content-Type", "application/vnd.newBroadcastMessage.v1+json")
+					return r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("CreateNewBroadcastMessageV1", mock.Anything, "jane",
+						&models.NewBroadcastMessageV1{To: []string{"john", "bob"}, Text: "Hello!"}, (*models.IdempotencyKey)(nil)).Return(
+						&models.SentMessagesV1{
+							Total: 2,
+							Messages: []*models.SentMessageInfoV1{
+								{To: "john", Id: 123, Timestamp: 456},
+								{To: "bob", Id: 124, Timestamp: 457},
+							},
+						}, nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.sentMessages.v1+json",
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "Broadcast message to the sender (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"to": ["john", "jane"], "text": "Hello!"}`))
+					r.Header.Set("Content-Type", "application/vnd.newBroadcastMessage.v1+json")
+					return r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Broadcast message with idempotency key sent (201)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"to": ["john"], "text": "Hello!"}`))
+					r.Header.Set("Content-Type", "application/vnd.newBroadcastMessage.v1+json")
+					r.Header.Set("Idempotency-Key", "7f1c0ac5-9bd4-4a3e-8f3e-2f8d4d1b6c11")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("BroadcastByIdempotencyKey", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+					s.On("CreateNewBroadcastMessageV1", mock.Anything, mock.Anything, mock.Anything,
+						mock.MatchedBy(func(key *models.IdempotencyKey) bool {
+							return key.Key == "7f1c0ac5-9bd4-4a3e-8f3e-2f8d4d1b6c11" && key.Fingerprint != ""
+						})).Return(&models.SentMessagesV1{Total: 1, Messages: []*models.SentMessageInfoV1{{To: "john", Id: 123, Timestamp: 456}}}, nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.sentMessages.v1+json",
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "Broadcast message retried with idempotency key (201)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"to": ["john"], "text": "Hello!"}`))
+					r.Header.Set("Content-Type", "application/vnd.newBroadcastMessage.v1+json")
+					r.Header.Set("Idempotency-Key", "7f1c0ac5-9bd4-4a3e-8f3e-2f8d4d1b6c11")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("BroadcastByIdempotencyKey", mock.Anything, mock.Anything, mock.Anything).Return(
+						&models.SentMessagesV1{Total: 1, Messages: []*models.SentMessageInfoV1{{To: "john", Id: 123, Timestamp: 456}}}, nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.sentMessages.v1+json",
+			},
+			wantStatus: http.StatusCreated,
+			wantBody:   `{"total":1,"messages":[{"to":"john","id":123,"timestamp":456}]}` + "\n",
+		},
+		{
+			name: "Broadcast message recipient blocked the sender (403)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"to": ["john", "bob"], "text": "Hello!"}`))
+					r.Header.Set("Content-Type", "application/vnd.newBroadcastMessage.v1+json")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("CreateNewBroadcastMessageV1", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil,
+						&ErrSenderBlockedTest{recipient: "bob"})
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusForbidden,
+			wantBody:    "Message recipient 'bob' has blocked the sender.\n",
+		},
 		{
 			name: "Unsupported message data (415)",
 			args: args{
@@ -128,7 +665,7 @@ func TestService_sendNewMessage(t *testing.T) {
 			testService: testService{
 				storage: func() *mocks.Storage {
 					s := mocks.NewStorage(t)
-					s.On("CreateNewPersonalMessageV1", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), int64(0),
+					s.On("CreateNewPersonalMessageV1", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(int64(0), int64(0),
 						errors.New("test error"))
 					return s
 				}(),
@@ -162,6 +699,73 @@ func TestService_sendNewMessage(t *testing.T) {
 			}
 
 			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+
+			if tt.wantBody != "" {
+				require.Equal(t, tt.wantBody, tt.args.w.Body.String())
+			}
 		})
 	}
 }
+
+type ErrSenderBlockedTest struct {
+	recipient string
+}
+
+func (e *ErrSenderBlockedTest) Error() string {
+	return "sender is blocked by the receiver"
+}
+
+func (e *ErrSenderBlockedTest) ImplementsSenderBlockedError() {
+}
+
+func (e *ErrSenderBlockedTest) Recipient() string {
+	return e.recipient
+}
+
+type ErrRecipientNotAcceptingTest struct {
+	recipient string
+}
+
+func (e *ErrRecipientNotAcceptingTest) Error() string {
+	return "receiver does not accept messages from the sender"
+}
+
+func (e *ErrRecipientNotAcceptingTest) ImplementsRecipientNotAcceptingError() {
+}
+
+func (e *ErrRecipientNotAcceptingTest) Recipient() string {
+	return e.recipient
+}
+
+type ErrIdempotencyKeyUsedTest struct{}
+
+func (e *ErrIdempotencyKeyUsedTest) Error() string {
+	return "idempotency key has already been used"
+}
+
+func (e *ErrIdempotencyKeyUsedTest) ImplementsIdempotencyKeyUsedError() {
+}
+
+type ErrIdempotencyKeyMismatchTest struct{}
+
+func (e *ErrIdempotencyKeyMismatchTest) Error() string {
+	return "idempotency key has already been used for another request"
+}
+
+func (e *ErrIdempotencyKeyMismatchTest) ImplementsIdempotencyKeyMismatchError() {
+}
+
+type ErrClientIdConflictTest struct {
+	messageId int64
+}
+
+func (e *ErrClientIdConflictTest) Error() string {
+	return "message with the same client id already exists"
+}
+
+func (e *ErrClientIdConflictTest) ImplementsClientIdConflictError() {
+}
+
+func (e *ErrClientIdConflictTest) MessageId() int64 {
+	return e.messageId
+}
@@ -11,12 +11,11 @@ import (
 )
 
 type Service struct {
-	Shutdown  chan struct{}
-	cfg       *config
-	server    *http.Server
-	auth      Authenticator
-	storage   Storage
-	fileStats FileStats
+	Shutdown chan struct{}
+	cfg      *config
+	server   *http.Server
+	auth     Authenticator
+	storage  Storage
 }
 
 type Authenticator interface {
@@ -25,23 +24,55 @@ type Authenticator interface {
 
 //go:generate mockery --name Storage
 type Storage interface {
-	CreateNewPersonalMessageV1(ctx context.Context, sender string, data *models.NewPersonalMessageV1) (id int64, timestamp int64, err error)
+	CreateNewPersonalMessageV1(ctx context.Context, sender string, data *models.NewPersonalMessageV1, key *models.IdempotencyKey) (id int64, timestamp int64, err error)
+	CreateNewPersonalMessageV2(ctx context.Context, sender string, data *models.NewPersonalMessageV2, key *models.IdempotencyKey) (id int64, timestamp int64, err error)
+	CreateNewPersonalMessageV3(ctx context.Context, sender string, data *models.NewPersonalMessageV3, key *models.IdempotencyKey) (id int64, timestamp int64, err error)
+	CreateNewPersonalMessageV4(ctx context.Context, sender string, data *models.NewPersonalMessageV4, key *models.IdempotencyKey) (id int64, timestamp int64, err error)
+	CreateNewBroadcastMessageV1(ctx context.Context, sender string, data *models.NewBroadcastMessageV1, key *models.IdempotencyKey) (*models.SentMessagesV1, error)
+	MessageIdByClientId(ctx context.Context, sender, clientId string) (id int64, err error)
+	MessageByIdempotencyKey(ctx context.Context, sender string, key *models.IdempotencyKey) (id int64, timestamp int64, err error)
+	BroadcastByIdempotencyKey(ctx context.Context, sender string, key *models.IdempotencyKey) (*models.SentMessagesV1, error)
 	MessageUpdatesV1(ctx context.Context, userId string, after int64, limit int) (*models.MessageUpdatesV1, error)
+	MessageUpdatesV2(ctx context.Context, userId string, after int64, limit int) (*models.MessageUpdatesV2, error)
+	SetMessageStar(ctx context.Context, userId string, messageId int64, starred bool) (timestamp int64, err error)
+	StarredMessagesV1(ctx context.Context, userId string, before int64, limit int) (*models.StarredMessagesV1, error)
+	BlockUser(ctx context.Context, userId, blockedUser string, hideConversation bool) error
+	UnblockUser(ctx context.Context, userId, blockedUser string) error
+	BlockedUsersV1(ctx context.Context, userId string) (*models.BlockedUsersV1, error)
+	BlockedUserV1(ctx context.Context, userId, blockedUser string) (*models.BlockedUserV1, error)
+	UserSettingsV1(ctx context.Context, userId string) (*models.UserSettingsV1, error)
+	SetUserSettings(ctx context.Context, userId string, settings *models.UserSettingsV1) error
+	MessageRequestsV1(ctx context.Context, userId string) (*models.MessageRequestsV1, error)
+	AnswerMessageRequest(ctx context.Context, userId, sender string, accepted bool) error
+	ConversationsV1(ctx context.Context, userId string) (*models.ConversationsV1, error)
+	ConversationV1(ctx context.Context, userId, counterpart string) (*models.ConversationV1, error)
+	SetConversationSettings(ctx context.Context, userId, counterpart string, settings *models.ConversationSettingsV1) error
+	SharedFilesV1(ctx context.Context, userId, counterpart string, before int64, limit int) (*models.SharedFilesV1, error)
+	SearchMessagesV1(ctx context.Context, userId string, params *models.MessageSearchParameters) (*models.MessageSearchResultsV1, error)
 	PersonalMessageV1(ctx context.Context, userId string, messageId int64) (*models.PersonalMessageV1, error)
+	PersonalMessageV2(ctx context.Context, userId string, messageId int64) (*models.PersonalMessageV2, error)
+	PersonalMessageV3(ctx context.Context, userId string, messageId int64) (*models.PersonalMessageV3, error)
+	PersonalMessageV4(ctx context.Context, userId string, messageId int64) (*models.PersonalMessageV4, error)
 	EditMessageText(ctx context.Context, id, timestamp int64, text string) (newTimestamp int64, err error)
+	EditMessageTextV2(ctx context.Context, id, timestamp int64, text string, entities []models.TextEntity) (newTimestamp int64, err error)
 	SetMessageReadState(ctx context.Context, id, timestamp int64, read bool) (newTimestamp int64, err error)
+	EditMessageEnvelope(ctx context.Context, id, timestamp int64, envelope *models.EncryptedEnvelope) (newTimestamp int64, err error)
+	EditMessageFiles(ctx context.Context, id, timestamp int64, files []string) (newTimestamp int64, err error)
+	VotePoll(ctx context.Context, userId string, id, timestamp int64, options []int) (newTimestamp int64, err error)
 	DeleteMessageData(ctx context.Context, id, timestamp int64) (newTimestamp int64, err error)
+	CreateWebhook(ctx context.Context, userId string, webhook *models.NewWebhookV1, secret string) (*models.WebhookV1, error)
+	WebhooksV1(ctx context.Context, userId string) (*models.WebhooksV1, error)
+	WebhookV1(ctx context.Context, userId string, id int64) (*models.WebhookV1, error)
+	SetWebhookEnabled(ctx context.Context, userId string, id int64, enabled bool) (found bool, err error)
+	DeleteWebhook(ctx context.Context, userId string, id int64) (found bool, err error)
+	WebhookDeliveriesV1(ctx context.Context, userId string, id int64) (*models.WebhookDeliveriesV1, error)
 }
 
-type FileStats interface {
-	SendUsage(ctx context.Context, fileId string, inUse bool) error
-}
-
-func (s *Service) Start(auth Authenticator, storage Storage, fileStats FileStats) {
+func (s *Service) Start(auth Authenticator, storage Storage) {
 	s.cfg = &config{}
 	s.cfg.Read()
 
-	s.auth, s.storage, s.fileStats = auth, storage, fileStats
+	s.auth, s.storage = auth, storage
 
 	s.server = &http.Server{
 		Addr:    fmt.Sprintf(":%s", s.cfg.port),
@@ -81,6 +112,29 @@ func (s *Service) operations() *chi.Mux {
 	// Public endpoint is the concern of the api gateway
 	ops.Post("/", s.sendNewMessage)
 	ops.Get("/", s.syncMessages)
+	ops.Get("/search", s.searchMessages)
+	ops.Get("/files", s.getSharedFiles)
+	ops.Get("/starred", s.getStarredMessages)
+	ops.Put("/starred/{id}", s.starMessage)
+	ops.Delete("/starred/{id}", s.unstarMessage)
+	ops.Get("/blocked", s.getBlockedUsers)
+	ops.Get("/blocked/{userId}", s.getBlockedUser)
+	ops.Put("/blocked/{userId}", s.blockUser)
+	ops.Delete("/blocked/{userId}", s.unblockUser)
+	ops.Get("/settings", s.getUserSettings)
+	ops.Put("/settings", s.setUserSettings)
+	ops.Get("/requests", s.getMessageRequests)
+	ops.Patch("/requests/{userId}", s.answerMessageRequest)
+	ops.Get("/conversations", s.getConversations)
+	ops.Get("/conversations/{userId}", s.getConversation)
+	ops.Patch("/conversations/{userId}", s.setConversationSettings)
+	ops.Post("/webhooks", s.createWebhook)
+	ops.Get("/webhooks", s.getWebhooks)
+	ops.Get("/webhooks/{id}", s.getWebhook)
+	ops.Patch("/webhooks/{id}", s.setWebhookState)
+	ops.Delete("/webhooks/{id}", s.deleteWebhook)
+	ops.Get("/webhooks/{id}/deliveries", s.getWebhookDeliveries)
+	ops.Get("/client/{clientId}", s.getMessageData)
 	ops.Get("/{id}", s.getMessageData)
 	ops.Patch("/{id}", s.modifyMessage)
 	ops.Delete("/{id}", s.deleteMessageData)
@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+const mimeTypeUserSettingsV1 = "application/vnd.userSettings.v1+json"
+
+func (s *Service) getUserSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get("Accept") {
+	case "", mimeTypeUserSettingsV1: // including if not specified
+		s.getUserSettingsV1(w, r)
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+}
+
+func (s *Service) getUserSettingsV1(w http.ResponseWriter, r *http.Request) {
+	settings, err := s.storage.UserSettingsV1(r.Context(), authenticatedUser(r))
+
+	if err == nil {
+		w.Header().Set("Content-Type", mimeTypeUserSettingsV1)
+		err = json.NewEncoder(w).Encode(settings)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get user settings (v1)")
+		return
+	}
+}
+
+func (s *Service) setUserSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != mimeTypeUserSettingsV1 {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	settings := models.UserSettingsV1{}
+	err := settings.Deserialize(r.Body)
+
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	err = s.storage.SetUserSettings(r.Context(), authenticatedUser(r), &settings)
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to set user settings")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,130 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/go-chi/chi/v5"
+)
+
+const mimeTypeStarredMessagesV1 = "application/vnd.starredMessages.v1+json"
+
+func (s *Service) getStarredMessages(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get("Accept") {
+	case "", mimeTypeStarredMessagesV1: // including if not specified
+		s.getStarredMessagesV1(w, r)
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+}
+
+func (s *Service) getStarredMessagesV1(w http.ResponseWriter, r *http.Request) {
+	before, limit, err := getStarredMessagesV1Parameters(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	var starred *models.StarredMessagesV1
+	starred, err = s.storage.StarredMessagesV1(r.Context(), authenticatedUser(r), before, limit)
+
+	if err == nil {
+		w.Header().Set("Content-Type", mimeTypeStarredMessagesV1)
+		err = json.NewEncoder(w).Encode(starred)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get starred messages (v1)")
+		return
+	}
+}
+
+func getStarredMessagesV1Parameters(r *http.Request) (before int64, limit int, err error) {
+	var param string
+	param = r.URL.Query().Get("before")
+
+	if param != "" {
+		before, err = strconv.ParseInt(param, 10, 0)
+
+		if err != nil {
+			return 0, 0, errors.New("Parameter 'before' must be an integer type.")
+		}
+	}
+
+	param = r.URL.Query().Get("limit")
+
+	if param == "" {
+		return before, 50, nil
+	}
+
+	limit, err = strconv.Atoi(param)
+
+	if err != nil {
+		return 0, 0, errors.New("Parameter 'limit' must be an integer type.")
+	}
+
+	const limitMin = 1
+	const limitMax = 100
+
+	if limit < limitMin || limit > limitMax {
+		return 0, 0, fmt.Errorf("Invalid parameter 'limit': min %d, max %d.", limitMin, limitMax)
+	}
+
+	return before, limit, nil
+}
+
+func (s *Service) starMessage(w http.ResponseWriter, r *http.Request) {
+	s.setMessageStar(w, r, true)
+}
+
+func (s *Service) unstarMessage(w http.ResponseWriter, r *http.Request) {
+	s.setMessageStar(w, r, false)
+}
+
+// Both starring and unstarring are idempotent: repeated request is not an error.
+func (s *Service) setMessageStar(w http.ResponseWriter, r *http.Request, starred bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 0)
+
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	userId := authenticatedUser(r)
+	var message *models.PersonalMessageV1
+
+	message, err = s.storage.PersonalMessageV1(ctx, userId, id)
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to receive personal message data (v1)")
+		return
+	}
+
+	if message == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if message.Deleted && starred {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	_, err = s.storage.SetMessageStar(ctx, userId, id, starred)
+
+	if err != nil {
+		if _, ok := err.(ErrMessageNotModified); !ok {
+			logAndReturnErrorWithIssue(w, r, err, "Failed to change message star")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,347 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/barpav/msg-messages/internal/rest/mocks"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_getStarredMessages(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantBody    *models.StarredMessagesV1
+		wantStatus  int
+	}{
+		{
+			name: "Starred messages received (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/starred?before=500&limit=2", nil)
+					r.Header.Set("Accept", "application/vnd.starredMessages.v1+json")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("StarredMessagesV1", mock.Anything, mock.Anything, int64(500), 2).Return(
+						&models.StarredMessagesV1{
+							Total: 2,
+							Messages: []*models.StarredMessageInfoV1{
+								{Id: 100, Timestamp: 200},
+								{Id: 110, Timestamp: 215},
+							},
+							Next: 300,
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.starredMessages.v1+json",
+			},
+			wantBody: &models.StarredMessagesV1{
+				Total: 2,
+				Messages: []*models.StarredMessageInfoV1{
+					{Id: 100, Timestamp: 200},
+					{Id: 110, Timestamp: 215},
+				},
+				Next: 300,
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Invalid limit (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/starred?limit=0", nil)
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Server-side issue (500)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/starred", nil)
+					r.Header.Set("request-id", "test-request-id")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("StarredMessagesV1", mock.Anything, mock.Anything, int64(0), 50).Return(nil, errors.New("test error"))
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"issue": "test-request-id",
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.getStarredMessages(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+
+			if tt.wantBody == nil {
+				return
+			}
+
+			var body *models.StarredMessagesV1
+			decoded := models.StarredMessagesV1{}
+			err := json.NewDecoder(tt.args.w.Body).Decode(&decoded)
+
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+
+			if err == nil {
+				body = &decoded
+			}
+
+			require.Equal(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestService_setMessageStar(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w       *httptest.ResponseRecorder
+		r       *http.Request
+		starred bool
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantStatus  int
+	}{
+		{
+			name: "Message starred (204)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PUT", "/starred/{id}", nil)
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "john"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+				starred: true,
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV1", mock.Anything, "john", int64(42)).Return(
+						&models.PersonalMessageV1{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Text:      "Hello",
+						},
+						nil)
+					s.On("SetMessageStar", mock.Anything, "john", int64(42), true).Return(int64(60), nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNoContent,
+		},
+		{
+			name: "Message already unstarred (204)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("DELETE", "/starred/{id}", nil)
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "john"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+				starred: false,
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV1", mock.Anything, "john", int64(42)).Return(
+						&models.PersonalMessageV1{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Text:      "Hello",
+						},
+						nil)
+					s.On("SetMessageStar", mock.Anything, "john", int64(42), false).Return(int64(0), &ErrMessageNotModifiedTest{})
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNoContent,
+		},
+		{
+			name: "Message not found (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PUT", "/starred/{id}", nil)
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "john"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+				starred: true,
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV1", mock.Anything, "john", int64(42)).Return(nil, nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusNotFound,
+		},
+		{
+			name: "Message deleted (410)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PUT", "/starred/{id}", nil)
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "john"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+				starred: true,
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV1", mock.Anything, "john", int64(42)).Return(
+						&models.PersonalMessageV1{
+							Id:        42,
+							Timestamp: 55,
+							Deleted:   true,
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusGone,
+		},
+		{
+			name: "Server-side issue (500)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("PUT", "/starred/{id}", nil)
+					r.Header.Set("request-id", "test-request-id")
+					r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "john"))
+					ctx := chi.NewRouteContext()
+					ctx.URLParams.Add("id", "42")
+					return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+				}(),
+				starred: true,
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("PersonalMessageV1", mock.Anything, "john", int64(42)).Return(
+						&models.PersonalMessageV1{
+							Id:        42,
+							Timestamp: 55,
+							From:      "jane",
+							To:        "john",
+							Text:      "Hello",
+						},
+						nil)
+					s.On("SetMessageStar", mock.Anything, "john", int64(42), true).Return(int64(0), errors.New("test error"))
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"issue": "test-request-id",
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.setMessageStar(tt.args.w, tt.args.r, tt.args.starred)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+		})
+	}
+}
@@ -11,12 +11,15 @@ import (
 )
 
 const mimeTypeMessageUpdatesV1 = "application/vnd.messageUpdates.v1+json"
+const mimeTypeMessageUpdatesV2 = "application/vnd.messageUpdates.v2+json"
 
 // https://barpav.github.io/msg-api-spec/#/messages/get_messages
 func (s *Service) syncMessages(w http.ResponseWriter, r *http.Request) {
 	switch r.Header.Get("Accept") {
 	case "", mimeTypeMessageUpdatesV1: // including if not specified
 		s.getMessageUpdatesV1(w, r)
+	case mimeTypeMessageUpdatesV2:
+		s.getMessageUpdatesV2(w, r)
 	default:
 		w.WriteHeader(http.StatusNotAcceptable)
 		return
@@ -45,6 +48,28 @@ func (s *Service) getMessageUpdatesV1(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *Service) getMessageUpdatesV2(w http.ResponseWriter, r *http.Request) {
+	after, limit, err := getMessageUpdatesV1Parameters(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	var updates *models.MessageUpdatesV2
+	updates, err = s.storage.MessageUpdatesV2(r.Context(), authenticatedUser(r), after, limit)
+
+	if err == nil {
+		w.Header().Set("Content-Type", mimeTypeMessageUpdatesV2)
+		err = json.NewEncoder(w).Encode(updates)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get message updates (v2)")
+		return
+	}
+}
+
 func getMessageUpdatesV1Parameters(r *http.Request) (after int64, limit int, err error) {
 	var param string
 	param = r.URL.Query().Get("after")
@@ -202,3 +202,125 @@ func TestService_syncMessages(t *testing.T) {
 		})
 	}
 }
+
+func TestService_syncMessagesV2(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantBody    *models.MessageUpdatesV2
+		wantStatus  int
+	}{
+		{
+			name: "Updates received (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/?after=150&limit=10", nil)
+					r.Header.Set("Accept", "application/vnd.messageUpdates.v2+json")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("MessageUpdatesV2", mock.Anything, mock.Anything, int64(150), 10).Return(
+						&models.MessageUpdatesV2{
+							Total: 2,
+							Updates: []*models.UpdateInfoV2{
+								{Type: models.UpdateTypeMessage, Timestamp: 200, Id: 100},
+								{Type: models.UpdateTypeBlock, Timestamp: 215, User: "john"},
+							},
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.messageUpdates.v2+json",
+			},
+			wantBody: &models.MessageUpdatesV2{
+				Total: 2,
+				Updates: []*models.UpdateInfoV2{
+					{Type: models.UpdateTypeMessage, Timestamp: 200, Id: 100},
+					{Type: models.UpdateTypeBlock, Timestamp: 215, User: "john"},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Server-side issue (500)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("GET", "/", nil)
+					r.Header.Set("Accept", "application/vnd.messageUpdates.v2+json")
+					r.Header.Set("request-id", "test-request-id")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("MessageUpdatesV2", mock.Anything, mock.Anything, int64(0), 50).Return(nil, errors.New("test error"))
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"issue": "test-request-id",
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.syncMessages(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+
+			if tt.wantBody == nil {
+				return
+			}
+
+			var body *models.MessageUpdatesV2
+			decoded := models.MessageUpdatesV2{}
+			err := json.NewDecoder(tt.args.w.Body).Decode(&decoded)
+
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+
+			if err == nil {
+				body = &decoded
+			}
+
+			require.Equal(t, body, tt.wantBody)
+		})
+	}
+}
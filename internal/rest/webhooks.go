@@ -0,0 +1,238 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+const mimeTypeNewWebhookV1 = "application/vnd.newWebhook.v1+json"
+const mimeTypeWebhookV1 = "application/vnd.webhook.v1+json"
+const mimeTypeWebhooksV1 = "application/vnd.webhooks.v1+json"
+const mimeTypeWebhookStateV1 = "application/vnd.webhookState.v1+json"
+const mimeTypeWebhookDeliveriesV1 = "application/vnd.webhookDeliveries.v1+json"
+
+const maxWebhooksPerUser = 10
+
+// The secret is returned only once, in the response to the webhook creation.
+func (s *Service) createWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != mimeTypeNewWebhookV1 {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	newWebhook := models.NewWebhookV1{}
+	err := newWebhook.Deserialize(r.Body)
+
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	ctx := r.Context()
+	userId := authenticatedUser(r)
+	var existing *models.WebhooksV1
+	existing, err = s.storage.WebhooksV1(ctx, userId)
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get webhooks (v1)")
+		return
+	}
+
+	if existing.Total >= maxWebhooksPerUser {
+		http.Error(w, fmt.Sprintf("User cannot have more than %d webhooks.", maxWebhooksPerUser), 400)
+		return
+	}
+
+	var secret string
+	secret, err = webhooks.NewSecret()
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to generate webhook secret")
+		return
+	}
+
+	var webhook *models.WebhookV1
+	webhook, err = s.storage.CreateWebhook(ctx, userId, &newWebhook, secret)
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to create webhook")
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/webhooks/%d", webhook.Id))
+	w.Header().Set("Content-Type", mimeTypeWebhookV1)
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(webhook)
+
+	if err != nil {
+		log.Err(err).Msg("Failed to send created webhook (v1).")
+	}
+}
+
+func (s *Service) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get("Accept") {
+	case "", mimeTypeWebhooksV1: // including if not specified
+		s.getWebhooksV1(w, r)
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+}
+
+func (s *Service) getWebhooksV1(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := s.storage.WebhooksV1(r.Context(), authenticatedUser(r))
+
+	if err == nil {
+		w.Header().Set("Content-Type", mimeTypeWebhooksV1)
+		err = json.NewEncoder(w).Encode(webhooks)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get webhooks (v1)")
+		return
+	}
+}
+
+func (s *Service) getWebhook(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get("Accept") {
+	case "", mimeTypeWebhookV1: // including if not specified
+		s.getWebhookV1(w, r)
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+}
+
+func (s *Service) getWebhookV1(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 0)
+
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var webhook *models.WebhookV1
+	webhook, err = s.storage.WebhookV1(r.Context(), authenticatedUser(r), id)
+
+	if err == nil {
+		if webhook == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", mimeTypeWebhookV1)
+		err = json.NewEncoder(w).Encode(webhook)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get webhook (v1)")
+		return
+	}
+}
+
+// Enabling the webhook (including automatically disabled one) resets its failures.
+func (s *Service) setWebhookState(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != mimeTypeWebhookStateV1 {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 0)
+
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	state := models.WebhookStateV1{}
+	err = state.Deserialize(r.Body)
+
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	var found bool
+	found, err = s.storage.SetWebhookEnabled(r.Context(), authenticatedUser(r), id, *state.Enabled)
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to change webhook state")
+		return
+	}
+
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 0)
+
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var found bool
+	found, err = s.storage.DeleteWebhook(r.Context(), authenticatedUser(r), id)
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to delete webhook")
+		return
+	}
+
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get("Accept") {
+	case "", mimeTypeWebhookDeliveriesV1: // including if not specified
+		s.getWebhookDeliveriesV1(w, r)
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+}
+
+// The latest deliveries come first.
+func (s *Service) getWebhookDeliveriesV1(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 0)
+
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var deliveries *models.WebhookDeliveriesV1
+	deliveries, err = s.storage.WebhookDeliveriesV1(r.Context(), authenticatedUser(r), id)
+
+	if err == nil {
+		if deliveries == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", mimeTypeWebhookDeliveriesV1)
+		err = json.NewEncoder(w).Encode(deliveries)
+	}
+
+	if err != nil {
+		logAndReturnErrorWithIssue(w, r, err, "Failed to get webhook deliveries (v1)")
+		return
+	}
+}
@@ -0,0 +1,398 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/barpav/msg-messages/internal/rest/mocks"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_createWebhook(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	newRequest := func(url string) *http.Request {
+		var buf bytes.Buffer
+		err := json.NewEncoder(&buf).Encode(models.NewWebhookV1{Url: url})
+		if err != nil {
+			log.Fatal(err)
+		}
+		r := httptest.NewRequest("POST", "/webhooks", &buf)
+		r.Header.Set("Content-Type", "application/vnd.newWebhook.v1+json")
+		return r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantHeaders map[string]string
+		wantStatus  int
+	}{
+		{
+			name: "Webhook created (201)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("https://example.com/hook"),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("WebhooksV1", mock.Anything, "jane").Return(
+						&models.WebhooksV1{Webhooks: make([]*models.WebhookV1, 0)}, nil)
+					s.On("CreateWebhook", mock.Anything, "jane", &models.NewWebhookV1{Url: "https://example.com/hook"},
+						mock.MatchedBy(func(secret string) bool { return len(secret) == 64 })).Return(
+						&models.WebhookV1{Id: 7, Url: "https://example.com/hook", Secret: "test secret", Enabled: true}, nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"Content-Type": "application/vnd.webhook.v1+json",
+				"Location":     "/webhooks/7",
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "Invalid URL (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("ftp://example.com/hook"),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Too many webhooks (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("https://example.com/hook"),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("WebhooksV1", mock.Anything, "jane").Return(&models.WebhooksV1{Total: maxWebhooksPerUser}, nil)
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Unsupported media type (415)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest("POST", "/webhooks", strings.NewReader(`{"url": "https://example.com/hook"}`))
+					r.Header.Set("Content-Type", "application/json")
+					return r
+				}(),
+			},
+			wantHeaders: map[string]string{},
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "Server-side issue (500)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := newRequest("https://example.com/hook")
+					r.Header.Set("request-id", "test-request-id")
+					return r
+				}(),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("WebhooksV1", mock.Anything, "jane").Return(&models.WebhooksV1{}, nil)
+					s.On("CreateWebhook", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("test error"))
+					return s
+				}(),
+			},
+			wantHeaders: map[string]string{
+				"issue": "test-request-id",
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.createWebhook(tt.args.w, tt.args.r)
+
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, func() string {
+					h := tt.args.w.Result().Header
+					if h == nil {
+						return ""
+					}
+					v := h[k]
+					if len(v) == 0 {
+						return ""
+					}
+					return v[0]
+				}())
+			}
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+		})
+	}
+}
+
+func TestService_setWebhookState(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	newRequest := func(id, body string) *http.Request {
+		r := httptest.NewRequest("PATCH", "/webhooks/{id}", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/vnd.webhookState.v1+json")
+		r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("id", id)
+		return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantStatus  int
+	}{
+		{
+			name: "Webhook enabled (204)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("7", `{"enabled": true}`),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("SetWebhookEnabled", mock.Anything, "jane", int64(7), true).Return(true, nil)
+					return s
+				}(),
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "State not specified (400)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("7", `{}`),
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Webhook not found (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("7", `{"enabled": false}`),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("SetWebhookEnabled", mock.Anything, "jane", int64(7), false).Return(false, nil)
+					return s
+				}(),
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "Invalid webhook id (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("hook", `{"enabled": false}`),
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.setWebhookState(tt.args.w, tt.args.r)
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+		})
+	}
+}
+
+func TestService_deleteWebhook(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	newRequest := func(id string) *http.Request {
+		r := httptest.NewRequest("DELETE", "/webhooks/{id}", nil)
+		r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("id", id)
+		return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantStatus  int
+	}{
+		{
+			name: "Webhook deleted (204)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("7"),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("DeleteWebhook", mock.Anything, "jane", int64(7)).Return(true, nil)
+					return s
+				}(),
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "Webhook not found (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("7"),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("DeleteWebhook", mock.Anything, "jane", int64(7)).Return(false, nil)
+					return s
+				}(),
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.deleteWebhook(tt.args.w, tt.args.r)
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+		})
+	}
+}
+
+func TestService_getWebhookDeliveries(t *testing.T) {
+	type testService struct {
+		storage Storage
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	newRequest := func(id string) *http.Request {
+		r := httptest.NewRequest("GET", "/webhooks/{id}/deliveries", nil)
+		r.Header.Set("Accept", "application/vnd.webhookDeliveries.v1+json")
+		r = r.WithContext(context.WithValue(r.Context(), authenticatedUserId{}, "jane"))
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("id", id)
+		return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
+	}
+	tests := []struct {
+		name        string
+		testService testService
+		args        args
+		wantBody    *models.WebhookDeliveriesV1
+		wantStatus  int
+	}{
+		{
+			name: "Deliveries received (200)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("7"),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("WebhookDeliveriesV1", mock.Anything, "jane", int64(7)).Return(
+						&models.WebhookDeliveriesV1{
+							Total:      1,
+							Deliveries: []*models.WebhookDeliveryV1{{After: 10, Last: 12, Updates: 2, Status: 503, Error: "test error"}},
+						},
+						nil)
+					return s
+				}(),
+			},
+			wantBody: &models.WebhookDeliveriesV1{
+				Total:      1,
+				Deliveries: []*models.WebhookDeliveryV1{{After: 10, Last: 12, Updates: 2, Status: 503, Error: "test error"}},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Webhook not found (404)",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("7"),
+			},
+			testService: testService{
+				storage: func() *mocks.Storage {
+					s := mocks.NewStorage(t)
+					s.On("WebhookDeliveriesV1", mock.Anything, "jane", int64(7)).Return(nil, nil)
+					return s
+				}(),
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				storage: tt.testService.storage,
+			}
+			s.getWebhookDeliveries(tt.args.w, tt.args.r)
+
+			require.Equal(t, tt.wantStatus, tt.args.w.Code)
+
+			if tt.wantBody == nil {
+				return
+			}
+
+			var body *models.WebhookDeliveriesV1
+			decoded := models.WebhookDeliveriesV1{}
+			err := json.NewDecoder(tt.args.w.Body).Decode(&decoded)
+
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+
+			if err == nil {
+				body = &decoded
+			}
+
+			require.Equal(t, body, tt.wantBody)
+		})
+	}
+}
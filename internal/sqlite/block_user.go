@@ -0,0 +1,191 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+type queryGetBlock struct{}
+
+func (q queryGetBlock) text() string {
+	return `
+	SELECT hide_conversation
+	FROM blocks
+	WHERE user_id = $1 AND blocked_user = $2;
+	`
+}
+
+type queryCreateBlock struct{}
+
+func (q queryCreateBlock) text() string {
+	return `
+	INSERT INTO blocks (user_id, blocked_user, hide_conversation, created, event_timestamp)
+	VALUES ($1, $2, $3, $4, $5);
+	`
+}
+
+type queryUpdateBlock struct{}
+
+func (q queryUpdateBlock) text() string {
+	return `
+	UPDATE blocks SET
+		hide_conversation = $3,
+		event_timestamp = $4
+	WHERE user_id = $1 AND blocked_user = $2;
+	`
+}
+
+type queryDeleteBlock struct{}
+
+func (q queryDeleteBlock) text() string {
+	return `
+	DELETE FROM blocks
+	WHERE user_id = $1 AND blocked_user = $2
+	RETURNING hide_conversation;
+	`
+}
+
+type queryCheckSenderBlocked struct{}
+
+func (q queryCheckSenderBlocked) text() string {
+	return `
+	SELECT EXISTS (
+		SELECT 1 FROM blocks
+		WHERE user_id = $1 AND blocked_user = $2
+	);
+	`
+}
+
+type queryGetConversationMessages struct{}
+
+func (q queryGetConversationMessages) text() string {
+	return `
+	SELECT id
+	FROM messages
+	WHERE ((sender = $1 AND receiver = $2) OR (sender = $2 AND receiver = $1))
+		AND NOT (receiver = $1 AND is_request)
+	ORDER BY id;
+	`
+}
+
+func (s *Storage) BlockUser(ctx context.Context, userId, blockedUser string, hideConversation bool) (err error) {
+	var tx *sql.Tx
+	tx, err = s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var hidden bool
+	err = tx.Stmt(s.queries[queryGetBlock{}]).QueryRowContext(ctx, userId, blockedUser).Scan(&hidden)
+
+	blocked := err == nil
+
+	switch {
+	case err != nil && err != sql.ErrNoRows:
+		return fmt.Errorf("failed to get user block: %w", err)
+	case blocked && hidden == hideConversation:
+		return nil // already blocked
+	}
+
+	var timestamp int64
+	timestamp, err = s.nextTimestamp(ctx, tx)
+
+	if err != nil {
+		return err
+	}
+
+	if blocked {
+		_, err = tx.Stmt(s.queries[queryUpdateBlock{}]).ExecContext(ctx, userId, blockedUser, hideConversation, timestamp)
+	} else {
+		_, err = tx.Stmt(s.queries[queryCreateBlock{}]).ExecContext(ctx,
+			userId, blockedUser, hideConversation, time.Now().UTC(), timestamp)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteUserUpdate{}]).ExecContext(ctx, userId, timestamp, models.UpdateTypeBlock, blockedUser)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' update: %w", userId, err)
+	}
+
+	if hidden && !hideConversation {
+		err = s.restoreConversationUpdates(ctx, tx, userId, blockedUser)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) UnblockUser(ctx context.Context, userId, blockedUser string) (err error) {
+	var tx *sql.Tx
+	tx, err = s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var hidden bool
+	err = tx.Stmt(s.queries[queryDeleteBlock{}]).QueryRowContext(ctx, userId, blockedUser).Scan(&hidden)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil // not blocked
+		}
+
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+
+	var timestamp int64
+	timestamp, err = s.nextTimestamp(ctx, tx)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteUserUpdate{}]).ExecContext(ctx, userId, timestamp, models.UpdateTypeBlock, blockedUser)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' update: %w", userId, err)
+	}
+
+	if hidden {
+		err = s.restoreConversationUpdates(ctx, tx, userId, blockedUser)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Writes conversation messages to the user's timeline again,
+// so previously hidden conversation is received by the user's clients while syncing.
+func (s *Storage) restoreConversationUpdates(ctx context.Context, tx *sql.Tx, userId, counterpart string) error {
+	ids, err := s.messageIds(ctx, tx, queryGetConversationMessages{}, userId, counterpart)
+
+	if err == nil {
+		err = s.writeUpdates(ctx, tx, userId, ids)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to restore conversation with '%s': %w", counterpart, err)
+	}
+
+	return nil
+}
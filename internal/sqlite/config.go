@@ -0,0 +1,52 @@
+package sqlite
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultDatabase          = "messages.db"
+	defaultIdempotencyKeyTTL = "24h"
+)
+
+const (
+	envVarDatabase          = "MSG_STORAGE_DATABASE" // path to the database file
+	envVarIdempotencyKeyTTL = "MSG_IDEMPOTENCY_KEY_TTL"
+	envVarEncryptionKeys    = "MSG_ENCRYPTION_KEYS" // not supported, see Storage.Open
+)
+
+type config struct {
+	database          string
+	idempotencyKeyTTL time.Duration
+	encryptionKeys    string
+}
+
+func (c *config) Read() {
+	readSetting(envVarDatabase, defaultDatabase, &c.database)
+	readDurationSetting(envVarIdempotencyKeyTTL, defaultIdempotencyKeyTTL, &c.idempotencyKeyTTL)
+	readSetting(envVarEncryptionKeys, "", &c.encryptionKeys)
+}
+
+func readSetting(setting, defaultValue string, result *string) {
+	*result = os.Getenv(setting)
+	if *result == "" {
+		*result = defaultValue
+	}
+}
+
+func readDurationSetting(setting, defaultValue string, result *time.Duration) {
+	var value string
+	readSetting(setting, defaultValue, &value)
+
+	var err error
+	*result, err = time.ParseDuration(value)
+
+	if err != nil || *result <= 0 {
+		log.Warn().Msg(fmt.Sprintf("Invalid %s value '%s', default '%s' is used.", setting, value, defaultValue))
+		*result, _ = time.ParseDuration(defaultValue)
+	}
+}
@@ -0,0 +1,231 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+// Returns the first (in the order of recipients) of those who have blocked the sender.
+type queryGetRecipientBlockingSender struct{}
+
+func (q queryGetRecipientBlockingSender) text() string {
+	return `
+	SELECT b.user_id
+	FROM blocks AS b
+		JOIN json_each($1) AS r
+		ON r.value = b.user_id
+	WHERE b.blocked_user = $2
+	ORDER BY r.key
+	LIMIT 1;
+	`
+}
+
+// Timestamps of the messages are consecutive, starting from $6.
+type queryCreateBroadcastMessages struct{}
+
+func (q queryCreateBroadcastMessages) text() string {
+	return `
+	INSERT INTO messages (sender, receiver, created, message_text, is_request, event_timestamp)
+	SELECT $1, r.value, $3, NULLIF($4, ''), json_extract($5, '$[' || r.key || ']'), $6 + r.key
+	FROM json_each($2) AS r
+	ORDER BY r.key
+	RETURNING id, receiver, event_timestamp;
+	`
+}
+
+type queryCreateBroadcastAttachments struct{}
+
+func (q queryCreateBroadcastAttachments) text() string {
+	return `
+	INSERT INTO attachments (message_id, file_id)
+	SELECT m.value, f.value
+	FROM json_each($1) AS m
+		CROSS JOIN json_each($2) AS f
+	ORDER BY m.value, f.key;
+	`
+}
+
+type queryWriteBroadcastUpdates struct{}
+
+func (q queryWriteBroadcastUpdates) text() string {
+	return `
+	INSERT INTO updates (user_id, event_timestamp, message_id, entry_type, counterpart)
+	SELECT sender, event_timestamp, id, 'message', NULL
+	FROM messages
+	WHERE id IN (SELECT value FROM json_each($1))
+	UNION ALL
+	SELECT
+		receiver,
+		event_timestamp,
+		id,
+		CASE WHEN is_request THEN 'request' ELSE 'message' END,
+		CASE WHEN is_request THEN sender END
+	FROM messages
+	WHERE id IN (SELECT value FROM json_each($1));
+	`
+}
+
+// Recipients are checked one by one (the same way as for a personal message),
+// whereas messages, attachments and updates are created for all recipients at once.
+func (s *Storage) CreateNewBroadcastMessageV1(ctx context.Context, sender string, message *models.NewBroadcastMessageV1,
+	idempotencyKey *models.IdempotencyKey) (*models.SentMessagesV1, error) {
+	receivers, err := jsonArray(message.To)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var files string
+	files, err = jsonArray(message.Files)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var tx *sql.Tx
+	tx, err = s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var blockedBy string
+	err = tx.Stmt(s.queries[queryGetRecipientBlockingSender{}]).QueryRowContext(ctx, receivers, sender).Scan(&blockedBy)
+
+	switch {
+	case err == nil:
+		return nil, &ErrSenderBlocked{recipient: blockedBy}
+	case err != sql.ErrNoRows:
+		return nil, fmt.Errorf("failed to check if sender is blocked: %w", err)
+	}
+
+	requests := make([]bool, len(message.To))
+
+	for i, receiver := range message.To {
+		err = s.acceptConversation(ctx, tx, sender, receiver)
+
+		if err != nil {
+			return nil, err
+		}
+
+		requests[i], err = s.checkReceiverAccepts(ctx, tx, sender, receiver)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.unarchiveConversation(ctx, tx, receiver, sender)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var isRequest string
+	isRequest, err = jsonArray(requests)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var first int64
+	first, err = s.nextTimestamps(ctx, tx, len(message.To))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rows *sql.Rows
+	rows, err = tx.Stmt(s.queries[queryCreateBroadcastMessages{}]).QueryContext(ctx,
+		sender, receivers, time.Now().UTC(), message.Text, isRequest, first)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new messages: %w", err)
+	}
+
+	defer rows.Close()
+
+	created := make(map[string]*models.SentMessageInfoV1, len(message.To))
+	ids := make([]int64, 0, len(message.To))
+
+	for rows.Next() {
+		info := &models.SentMessageInfoV1{}
+		err = rows.Scan(&info.Id, &info.To, &info.Timestamp)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new messages: %w", err)
+		}
+
+		created[info.To] = info
+		ids = append(ids, info.Id)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new messages: %w", err)
+	}
+
+	var messageIds string
+	messageIds, err = jsonArray(ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(message.Files) != 0 {
+		_, err = tx.Stmt(s.queries[queryCreateBroadcastAttachments{}]).ExecContext(ctx, messageIds, files)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create attachments: %w", err)
+		}
+
+		_, err = tx.Stmt(s.queries[queryWriteBroadcastFileUsage{}]).ExecContext(ctx, messageIds, files, time.Now().UTC())
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to write file usage: %w", err)
+		}
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteBroadcastUpdates{}]).ExecContext(ctx, messageIds)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to write users updates: %w", err)
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteBroadcastEvents{}]).ExecContext(ctx, messageIds, time.Now().UTC())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to write message events: %w", err)
+	}
+
+	sent := &models.SentMessagesV1{Messages: make([]*models.SentMessageInfoV1, 0, len(message.To))}
+
+	for _, receiver := range message.To {
+		sent.Messages = append(sent.Messages, created[receiver])
+	}
+
+	sent.Total = len(sent.Messages)
+
+	if idempotencyKey != nil {
+		err = s.saveBroadcastIdempotencyKey(ctx, tx, sender, idempotencyKey, sent)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sent, nil
+}
@@ -0,0 +1,344 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/events"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+type ErrSenderBlocked struct {
+	recipient string
+}
+type ErrClientIdConflict struct {
+	messageId int64
+}
+
+type queryCreateMessage struct{}
+
+func (q queryCreateMessage) text() string {
+	return `
+	INSERT INTO messages (sender, receiver, created, message_text, text_entities, content, envelope,
+		is_request, client_id, event_timestamp)
+	VALUES ($1, $2, $3, NULLIF($4, ''), $5, $8, $9, $6, NULLIF($7, ''), $10)
+	ON CONFLICT (sender, client_id) DO NOTHING
+	RETURNING id, event_timestamp;
+	`
+}
+
+type queryGetMessageIdByClientId struct{}
+
+func (q queryGetMessageIdByClientId) text() string {
+	return `
+	SELECT id
+	FROM messages
+	WHERE sender = $1 AND client_id = $2;
+	`
+}
+
+type queryCreateAttachment struct{}
+
+func (q queryCreateAttachment) text() string {
+	return `
+	INSERT INTO attachments (message_id, file_id)
+	VALUES ($1, $2);
+	`
+}
+
+type queryWriteUpdate struct{}
+
+func (q queryWriteUpdate) text() string {
+	return `
+	INSERT INTO updates (user_id, event_timestamp, message_id)
+	VALUES ($1, $2, $3);
+	`
+}
+
+// Timestamps of the updates are consecutive, starting from $2.
+type queryWriteUpdates struct{}
+
+func (q queryWriteUpdates) text() string {
+	return `
+	INSERT INTO updates (user_id, event_timestamp, message_id)
+	SELECT $1, $2 + key, value
+	FROM json_each($3);
+	`
+}
+
+// Message requests are written to the receiver's timeline as separate entry type.
+type queryWriteReceiverUpdate struct{}
+
+func (q queryWriteReceiverUpdate) text() string {
+	return `
+	INSERT INTO updates (user_id, event_timestamp, message_id, entry_type, counterpart)
+	SELECT
+		receiver,
+		$2,
+		id,
+		CASE WHEN is_request THEN 'request' ELSE 'message' END,
+		CASE WHEN is_request THEN sender END
+	FROM messages
+	WHERE id = $1;
+	`
+}
+
+func (s *Storage) CreateNewPersonalMessageV1(ctx context.Context, sender string, message *models.NewPersonalMessageV1, key *models.IdempotencyKey) (id int64, timestamp int64, err error) {
+	id, timestamp, err = s.createPersonalMessage(ctx, storage.NewMessageV1(sender, message, key))
+	return id, timestamp, err
+}
+
+func (s *Storage) createPersonalMessage(ctx context.Context, message *storage.NewMessage) (id int64, timestamp int64, err error) {
+	var textEntities any
+	textEntities, err = storage.TextEntitiesToJSON(message.Entities)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var content any
+	content, err = storage.MessageContentToJSON(message.Content)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var envelope any
+	envelope, err = storage.EncryptedEnvelopeToJSON(message.Envelope)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var tx *sql.Tx
+	tx, err = s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer tx.Rollback()
+
+	var blocked bool
+	err = tx.Stmt(s.queries[queryCheckSenderBlocked{}]).QueryRowContext(ctx, message.Receiver, message.Sender).Scan(&blocked)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to check if sender is blocked: %w", err)
+	}
+
+	if blocked {
+		return 0, 0, &ErrSenderBlocked{recipient: message.Receiver}
+	}
+
+	err = s.acceptConversation(ctx, tx, message.Sender, message.Receiver) // replying means accepting
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var isRequest bool
+	isRequest, err = s.checkReceiverAccepts(ctx, tx, message.Sender, message.Receiver)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = s.unarchiveConversation(ctx, tx, message.Receiver, message.Sender)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	timestamp, err = s.nextTimestamp(ctx, tx)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	row := tx.Stmt(s.queries[queryCreateMessage{}]).QueryRowContext(ctx,
+		message.Sender, message.Receiver, time.Now().UTC(), message.Text, textEntities, isRequest, message.ClientId,
+		content, envelope, timestamp)
+	err = row.Scan(&id, &timestamp)
+
+	if err == sql.ErrNoRows {
+		return 0, 0, s.clientIdConflict(ctx, tx, message.Sender, message.ClientId)
+	}
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create new message: %w", err)
+	}
+
+	err = s.createAttachments(ctx, tx, id, message.Files)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = s.writeFileUsage(ctx, tx, message.Files, true)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if message.IdempotencyKey != nil {
+		err = s.saveIdempotencyKey(ctx, tx, message.Sender, message.IdempotencyKey, id, timestamp)
+
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteUpdate{}]).ExecContext(ctx, message.Sender, timestamp, id)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to write user '%s' update: %w", message.Sender, err)
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteReceiverUpdate{}]).ExecContext(ctx, id, timestamp)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to write user '%s' update: %w", message.Receiver, err)
+	}
+
+	err = s.writeMessageEvent(ctx, tx, &events.Event{
+		Type: events.MessageCreated, MessageId: id, Timestamp: timestamp, Sender: message.Sender, Receiver: message.Receiver,
+	})
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return id, timestamp, nil
+}
+
+func (s *Storage) createAttachments(ctx context.Context, tx *sql.Tx, messageId int64, files []string) error {
+	for _, fileId := range files {
+		_, err := tx.Stmt(s.queries[queryCreateAttachment{}]).ExecContext(ctx, messageId, fileId)
+
+		if err != nil {
+			return fmt.Errorf("failed to create attachment with file id '%s': %w", fileId, err)
+		}
+	}
+
+	return nil
+}
+
+// Writes the messages to the user's timeline in the given order.
+func (s *Storage) writeUpdates(ctx context.Context, tx *sql.Tx, userId string, messageIds []int64) error {
+	if len(messageIds) == 0 {
+		return nil
+	}
+
+	ids, err := jsonArray(messageIds)
+
+	if err != nil {
+		return err
+	}
+
+	var first int64
+	first, err = s.nextTimestamps(ctx, tx, len(messageIds))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteUpdates{}]).ExecContext(ctx, userId, first, ids)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' updates: %w", userId, err)
+	}
+
+	return nil
+}
+
+// Returns ids of the messages selected (or changed) by the query in ascending order.
+func (s *Storage) messageIds(ctx context.Context, tx *sql.Tx, q query, args ...any) ([]int64, error) {
+	rows, err := tx.Stmt(s.queries[q]).QueryContext(ctx, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
+
+func (s *Storage) MessageIdByClientId(ctx context.Context, sender, clientId string) (id int64, err error) {
+	err = s.queries[queryGetMessageIdByClientId{}].QueryRowContext(ctx, sender, clientId).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return id, err
+}
+
+// The conflicting message is looked up in the same transaction, since it holds the only connection.
+func (s *Storage) clientIdConflict(ctx context.Context, tx *sql.Tx, sender, clientId string) error {
+	var id int64
+	err := tx.Stmt(s.queries[queryGetMessageIdByClientId{}]).QueryRowContext(ctx, sender, clientId).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("failed to create new message: no message with conflicting client id '%s'", clientId)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to get message with conflicting client id '%s': %w", clientId, err)
+	}
+
+	return &ErrClientIdConflict{messageId: id}
+}
+
+func (e *ErrSenderBlocked) Error() string {
+	return "sender is blocked by the receiver"
+}
+
+func (e *ErrSenderBlocked) ImplementsSenderBlockedError() {
+}
+
+func (e *ErrSenderBlocked) Recipient() string {
+	return e.recipient
+}
+
+func (e *ErrClientIdConflict) Error() string {
+	return "message with the same client id already exists"
+}
+
+func (e *ErrClientIdConflict) ImplementsClientIdConflictError() {
+}
+
+func (e *ErrClientIdConflict) MessageId() int64 {
+	return e.messageId
+}
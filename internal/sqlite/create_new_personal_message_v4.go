@@ -0,0 +1,13 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+func (s *Storage) CreateNewPersonalMessageV4(ctx context.Context, sender string, message *models.NewPersonalMessageV4, key *models.IdempotencyKey) (id int64, timestamp int64, err error) {
+	id, timestamp, err = s.createPersonalMessage(ctx, storage.NewMessageV4(sender, message, key))
+	return id, timestamp, err
+}
@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/barpav/msg-messages/internal/events"
+)
+
+type queryCheckDeleteMessageData struct{}
+
+func (q queryCheckDeleteMessageData) text() string {
+	return `
+	SELECT
+		COALESCE(is_deleted, false),
+		event_timestamp = $1,
+		true
+	FROM messages
+	WHERE id = $2;
+	`
+}
+
+type queryDeleteMessageData struct{}
+
+func (q queryDeleteMessageData) text() string {
+	return `
+	UPDATE messages SET
+		event_timestamp = $new_timestamp,
+		created = null,
+		edited = null,
+		is_read = null,
+		read_receipt = null,
+		message_text = null,
+		text_entities = null,
+		content = null,
+		envelope = null,
+		is_deleted = true
+	WHERE id = $2
+	RETURNING id, sender, receiver;
+	`
+}
+
+func (s *Storage) DeleteMessageData(ctx context.Context, id, timestamp int64) (newTimestamp int64, err error) {
+	deleteRelatedData := func(ctx context.Context, tx *sql.Tx, messageId int64) (err error) {
+		_, err = tx.Stmt(s.queries[queryDeleteMessageStars{}]).ExecContext(ctx, messageId)
+
+		if err != nil {
+			return fmt.Errorf("failed to delete message stars: %w", err)
+		}
+
+		_, err = tx.Stmt(s.queries[queryDeletePollVotes{}]).ExecContext(ctx, messageId)
+
+		if err != nil {
+			return fmt.Errorf("failed to delete poll votes: %w", err)
+		}
+
+		var files []string
+		files, err = s.messageFiles(ctx, tx, messageId)
+
+		if err != nil {
+			return err
+		}
+
+		return s.writeFileUsage(ctx, tx, files, false) // attachments are kept, but no longer used
+	}
+
+	newTimestamp, err = s.modifyMessage(ctx, queryCheckDeleteMessageData{}, queryDeleteMessageData{}, events.MessageDeleted, deleteRelatedData,
+		timestamp, id)
+	return newTimestamp, err
+}
@@ -0,0 +1,106 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/events"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+type ErrMessageEncrypted struct{}
+type ErrMessageNotEncrypted struct{}
+
+type queryCheckMessageEncrypted struct{}
+
+func (q queryCheckMessageEncrypted) text() string {
+	return `
+	SELECT envelope IS NOT NULL
+	FROM messages
+	WHERE id = $1;
+	`
+}
+
+type queryCheckEditMessageEnvelope struct{}
+
+func (q queryCheckEditMessageEnvelope) text() string {
+	return `
+	SELECT
+		COALESCE(is_deleted, false),
+		event_timestamp = $1,
+		envelope IS NOT $2
+	FROM messages
+	WHERE id = $3;
+	`
+}
+
+type queryEditMessageEnvelope struct{}
+
+func (q queryEditMessageEnvelope) text() string {
+	return `
+	UPDATE messages SET
+		event_timestamp = $new_timestamp,
+		envelope = $2,
+		edited = $4
+	WHERE id = $3
+	RETURNING id, sender, receiver;
+	`
+}
+
+// Encrypted counterpart of the text editing: the envelope is replaced as a whole.
+func (s *Storage) EditMessageEnvelope(ctx context.Context, id, timestamp int64, envelope *models.EncryptedEnvelope) (newTimestamp int64, err error) {
+	var encrypted bool
+	encrypted, err = s.messageEncrypted(ctx, id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if !encrypted {
+		return 0, &ErrMessageNotEncrypted{}
+	}
+
+	var data any
+	data, err = storage.EncryptedEnvelopeToJSON(envelope)
+
+	if err != nil {
+		return 0, err
+	}
+
+	newTimestamp, err = s.modifyMessage(ctx, queryCheckEditMessageEnvelope{}, queryEditMessageEnvelope{}, events.MessageEdited, nil,
+		timestamp, data, id, time.Now().UTC())
+	return newTimestamp, err
+}
+
+// Message cannot be encrypted end-to-end (or decrypted) after it's created, so it's checked outside of the modification.
+// Deleted messages are not encrypted, since their envelope is removed.
+func (s *Storage) messageEncrypted(ctx context.Context, id int64) (encrypted bool, err error) {
+	err = s.queries[queryCheckMessageEncrypted{}].QueryRowContext(ctx, id).Scan(&encrypted)
+
+	if err == sql.ErrNoRows {
+		return false, nil // let the modification handle it
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to check if message is encrypted: %w", err)
+	}
+
+	return encrypted, nil
+}
+
+func (e *ErrMessageEncrypted) Error() string {
+	return "message is encrypted"
+}
+
+func (e *ErrMessageEncrypted) ImplementsMessageEncryptedError() {
+}
+
+func (e *ErrMessageNotEncrypted) Error() string {
+	return "message is not encrypted"
+}
+
+func (e *ErrMessageNotEncrypted) ImplementsMessageNotEncryptedError() {
+}
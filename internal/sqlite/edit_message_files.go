@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/events"
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+// Attachments are compared as sorted JSON arrays of file ids.
+type queryCheckEditMessageFiles struct{}
+
+func (q queryCheckEditMessageFiles) text() string {
+	return `
+	SELECT
+		COALESCE(is_deleted, false),
+		event_timestamp = $1,
+		(SELECT json_group_array(file_id) FROM (
+			SELECT file_id FROM attachments WHERE message_id = $3 ORDER BY file_id))
+		IS NOT (SELECT json_group_array(value) FROM (
+			SELECT value FROM json_each($2) ORDER BY value))
+	FROM messages
+	WHERE id = $3;
+	`
+}
+
+type queryEditMessageFiles struct{}
+
+func (q queryEditMessageFiles) text() string {
+	return `
+	UPDATE messages SET
+		event_timestamp = $new_timestamp,
+		edited = $4
+	WHERE id = $3
+	RETURNING id, sender, receiver;
+	`
+}
+
+type queryDeleteAttachments struct{}
+
+func (q queryDeleteAttachments) text() string {
+	return `
+	DELETE FROM attachments
+	WHERE message_id = $1;
+	`
+}
+
+func (s *Storage) EditMessageFiles(ctx context.Context, id, timestamp int64, files []string) (newTimestamp int64, err error) {
+	var fileIds string
+	fileIds, err = jsonArray(files)
+
+	if err != nil {
+		return 0, err
+	}
+
+	replaceAttachments := func(ctx context.Context, tx *sql.Tx, messageId int64) (err error) {
+		var attached []string
+		attached, err = s.messageFiles(ctx, tx, messageId)
+
+		if err != nil {
+			return err
+		}
+
+		used, unused := models.FilesDifference(attached, files)
+		err = s.writeFileUsage(ctx, tx, used, true)
+
+		if err != nil {
+			return err
+		}
+
+		err = s.writeFileUsage(ctx, tx, unused, false)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Stmt(s.queries[queryDeleteAttachments{}]).ExecContext(ctx, messageId)
+
+		if err != nil {
+			return fmt.Errorf("failed to delete attachments: %w", err)
+		}
+
+		return s.createAttachments(ctx, tx, messageId, files)
+	}
+
+	newTimestamp, err = s.modifyMessage(ctx, queryCheckEditMessageFiles{}, queryEditMessageFiles{}, events.MessageEdited, replaceAttachments,
+		timestamp, fileIds, id, time.Now().UTC())
+	return newTimestamp, err
+}
@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/events"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+type queryCheckEditMessageText struct{}
+
+func (q queryCheckEditMessageText) text() string {
+	return `
+	SELECT
+		COALESCE(is_deleted, false),
+		event_timestamp = $1,
+		message_text IS NOT NULLIF($2, '') OR text_entities IS NOT $5
+	FROM messages
+	WHERE id = $3;
+	`
+}
+
+type queryEditMessageText struct{}
+
+func (q queryEditMessageText) text() string {
+	return `
+	UPDATE messages SET
+		event_timestamp = $new_timestamp,
+		message_text = NULLIF($2, ''),
+		text_entities = $5,
+		edited = $4
+	WHERE id = $3
+	RETURNING id, sender, receiver;
+	`
+}
+
+// Plain text replaces formatted one, so text entities (if any) are removed.
+func (s *Storage) EditMessageText(ctx context.Context, id, timestamp int64, text string) (newTimestamp int64, err error) {
+	newTimestamp, err = s.EditMessageTextV2(ctx, id, timestamp, text, nil)
+	return newTimestamp, err
+}
+
+func (s *Storage) EditMessageTextV2(ctx context.Context, id, timestamp int64, text string, entities []models.TextEntity) (newTimestamp int64, err error) {
+	var textEntities any
+	textEntities, err = storage.TextEntitiesToJSON(entities)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var encrypted bool
+	encrypted, err = s.messageEncrypted(ctx, id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if encrypted {
+		return 0, &ErrMessageEncrypted{}
+	}
+
+	newTimestamp, err = s.modifyMessage(ctx, queryCheckEditMessageText{}, queryEditMessageText{}, events.MessageEdited, nil,
+		timestamp, text, id, time.Now().UTC(), textEntities)
+	return newTimestamp, err
+}
@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+type queryGetPollVotes struct{}
+
+func (q queryGetPollVotes) text() string {
+	return `
+	SELECT
+		option_index,
+		COUNT(*),
+		MAX(user_id = $2)
+	FROM poll_votes
+	WHERE message_id = $1
+	GROUP BY option_index;
+	`
+}
+
+// Poll tallies are not stored in the content itself, they are calculated from the votes (see storage.CountPollVotes).
+func (s *Storage) countPollVotes(ctx context.Context, userId string, messageId int64, poll *models.PollContent) error {
+	rows, err := s.queries[queryGetPollVotes{}].QueryContext(ctx, messageId, userId)
+
+	if err != nil {
+		return fmt.Errorf("failed to get poll votes: %w", err)
+	}
+
+	defer rows.Close()
+
+	var (
+		option, votes int
+		voted         bool
+	)
+
+	for rows.Next() {
+		err = rows.Scan(&option, &votes, &voted)
+
+		if err != nil {
+			return err
+		}
+
+		storage.CountPollVotes(poll, option, votes, voted)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,149 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/events"
+)
+
+type queryWriteMessageEvent struct{}
+
+func (q queryWriteMessageEvent) text() string {
+	return `
+	INSERT INTO message_events (event_type, message_id, event_timestamp, sender, receiver, created)
+	VALUES ($1, $2, $3, $4, $5, $6);
+	`
+}
+
+type queryWriteBroadcastEvents struct{}
+
+func (q queryWriteBroadcastEvents) text() string {
+	return `
+	INSERT INTO message_events (event_type, message_id, event_timestamp, sender, receiver, created)
+	SELECT 'MessageCreated', id, event_timestamp, sender, receiver, $2
+	FROM messages
+	WHERE id IN (SELECT value FROM json_each($1))
+	ORDER BY id;
+	`
+}
+
+type queryGetPendingMessageEvents struct{}
+
+func (q queryGetPendingMessageEvents) text() string {
+	return `
+	SELECT id, event_type, message_id, event_timestamp, sender, receiver
+	FROM message_events
+	WHERE delivered IS NULL
+	ORDER BY id
+	LIMIT $1;
+	`
+}
+
+type queryMarkMessageEventsDelivered struct{}
+
+func (q queryMarkMessageEventsDelivered) text() string {
+	return `
+	UPDATE message_events SET
+		delivered = $2
+	WHERE id IN (SELECT value FROM json_each($1));
+	`
+}
+
+type queryDeleteDeliveredMessageEvents struct{}
+
+func (q queryDeleteDeliveredMessageEvents) text() string {
+	return `
+	DELETE FROM message_events
+	WHERE delivered < $1;
+	`
+}
+
+func (s *Storage) writeMessageEvent(ctx context.Context, tx *sql.Tx, event *events.Event) error {
+	_, err := tx.Stmt(s.queries[queryWriteMessageEvent{}]).ExecContext(ctx,
+		string(event.Type), event.MessageId, event.Timestamp, event.Sender, event.Receiver, time.Now().UTC())
+
+	if err != nil {
+		return fmt.Errorf("failed to write '%s' event of message '%d': %w", event.Type, event.MessageId, err)
+	}
+
+	return nil
+}
+
+type pendingMessageEvent struct {
+	id    int64
+	event *events.Event
+}
+
+// Events are not locked while they are published, see RelayFileUsage.
+func (s *Storage) RelayMessageEvents(ctx context.Context, limit int, publish func(event *events.Event) error) (relayed int, err error) {
+	var pending []pendingMessageEvent
+	pending, err = s.pendingMessageEvents(ctx, limit)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pending message events: %w", err)
+	}
+
+	delivered := make([]int64, 0, len(pending))
+	var publishErr error
+
+	for _, p := range pending {
+		publishErr = publish(p.event)
+
+		if publishErr != nil {
+			break
+		}
+
+		delivered = append(delivered, p.id)
+	}
+
+	if len(delivered) != 0 {
+		var ids string
+		ids, err = jsonArray(delivered)
+
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = s.queries[queryMarkMessageEventsDelivered{}].ExecContext(ctx, ids, time.Now().UTC())
+
+		if err != nil {
+			return 0, fmt.Errorf("failed to mark message events delivered: %w", err)
+		}
+	}
+
+	return len(delivered), publishErr
+}
+
+func (s *Storage) pendingMessageEvents(ctx context.Context, limit int) (pending []pendingMessageEvent, err error) {
+	var rows *sql.Rows
+	rows, err = s.queries[queryGetPendingMessageEvents{}].QueryContext(ctx, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventType string
+		p := pendingMessageEvent{event: &events.Event{}}
+		err = rows.Scan(&p.id, &eventType, &p.event.MessageId, &p.event.Timestamp, &p.event.Sender, &p.event.Receiver)
+
+		if err != nil {
+			return nil, err
+		}
+
+		p.event.Type = events.Type(eventType)
+		pending = append(pending, p)
+	}
+
+	return pending, rows.Err()
+}
+
+func (s *Storage) DeleteDeliveredMessageEvents(ctx context.Context, before time.Time) error {
+	_, err := s.queries[queryDeleteDeliveredMessageEvents{}].ExecContext(ctx, before.UTC())
+	return err
+}
@@ -0,0 +1,320 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+type ErrRecipientNotAccepting struct {
+	recipient string
+}
+type ErrMessageRequestNotFound struct{}
+
+// Conversation state from the point of view of the user.
+const (
+	conversationAccepted  = "accepted"
+	conversationRequested = "requested" // counterpart's messages are message requests
+	conversationDeclined  = "declined"
+)
+
+type queryGetConversationState struct{}
+
+func (q queryGetConversationState) text() string {
+	return `
+	SELECT state
+	FROM conversations
+	WHERE user_id = $1 AND counterpart = $2;
+	`
+}
+
+type queryCreateConversation struct{}
+
+func (q queryCreateConversation) text() string {
+	return `
+	INSERT INTO conversations (user_id, counterpart, state, created, event_timestamp)
+	VALUES ($1, $2, $3, $4, $5);
+	`
+}
+
+type queryUpdateConversationState struct{}
+
+func (q queryUpdateConversationState) text() string {
+	return `
+	UPDATE conversations SET
+		state = $3,
+		event_timestamp = $4
+	WHERE user_id = $1 AND counterpart = $2;
+	`
+}
+
+// Turns message requests into ordinary messages.
+type queryReleaseRequestMessages struct{}
+
+func (q queryReleaseRequestMessages) text() string {
+	return `
+	UPDATE messages SET
+		is_request = false
+	WHERE sender = $2 AND receiver = $1 AND is_request
+	RETURNING id;
+	`
+}
+
+type queryGetMessageRequestsV1 struct{}
+
+func (q queryGetMessageRequestsV1) text() string {
+	return `
+	SELECT
+		c.counterpart,
+		COUNT(m.id),
+		c.created,
+		c.event_timestamp
+	FROM conversations AS c
+		LEFT OUTER JOIN messages AS m
+		ON m.sender = c.counterpart
+			AND m.receiver = c.user_id
+			AND m.is_request
+			AND COALESCE(m.is_deleted, false) = false
+	WHERE c.user_id = $1 AND c.state = 'requested'
+		AND NOT EXISTS (
+			SELECT 1 FROM blocks AS b
+			WHERE b.user_id = $1 AND b.blocked_user = c.counterpart
+		)
+	GROUP BY c.counterpart, c.created, c.event_timestamp
+	ORDER BY MAX(m.id) DESC NULLS LAST, c.counterpart;
+	`
+}
+
+// Checks whether the receiver accepts messages from the sender, starting a new message request if needed.
+// Must be called before the message is created.
+func (s *Storage) checkReceiverAccepts(ctx context.Context, tx *sql.Tx, sender, receiver string) (isRequest bool, err error) {
+	var setting string
+	err = tx.Stmt(s.queries[queryGetIncomingMessagesSetting{}]).QueryRowContext(ctx, receiver).Scan(&setting)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get incoming messages setting: %w", err)
+	}
+
+	if setting == models.IncomingMessagesNobody {
+		return false, &ErrRecipientNotAccepting{recipient: receiver}
+	}
+
+	var state string
+	state, err = s.conversationState(ctx, tx, receiver, sender)
+
+	switch {
+	case err != nil:
+		return false, err
+	case state == "":
+		if setting != models.IncomingMessagesEveryone {
+			return false, &ErrRecipientNotAccepting{recipient: receiver}
+		}
+
+		err = s.createConversation(ctx, tx, receiver, sender, conversationRequested)
+
+		if err != nil {
+			return false, fmt.Errorf("failed to create message request: %w", err)
+		}
+
+		return true, nil
+	case state == conversationDeclined:
+		return false, &ErrRecipientNotAccepting{recipient: receiver}
+	}
+
+	return state == conversationRequested, nil
+}
+
+// Marks the conversation as accepted by the user. If there was a message request
+// (even declined one), its messages become ordinary ones.
+func (s *Storage) acceptConversation(ctx context.Context, tx *sql.Tx, userId, counterpart string) (err error) {
+	var state string
+	state, err = s.conversationState(ctx, tx, userId, counterpart)
+
+	switch {
+	case err != nil:
+		return err
+	case state == "":
+		err = s.createConversation(ctx, tx, userId, counterpart, conversationAccepted)
+
+		if err != nil {
+			return fmt.Errorf("failed to create conversation: %w", err)
+		}
+
+		return nil // there was no request
+	case state == conversationAccepted:
+		return nil
+	}
+
+	var timestamp int64
+	timestamp, err = s.setConversationState(ctx, tx, userId, counterpart, conversationAccepted)
+
+	if err != nil {
+		return fmt.Errorf("failed to accept conversation: %w", err)
+	}
+
+	var released []int64
+	released, err = s.messageIds(ctx, tx, queryReleaseRequestMessages{}, userId, counterpart)
+
+	if err == nil {
+		err = s.writeUpdates(ctx, tx, userId, released)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to release message request from '%s': %w", counterpart, err)
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteUserUpdate{}]).ExecContext(ctx, userId, timestamp, models.UpdateTypeRequest, counterpart)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' update: %w", userId, err)
+	}
+
+	return nil
+}
+
+// Returns empty state if there is no conversation yet.
+func (s *Storage) conversationState(ctx context.Context, tx *sql.Tx, userId, counterpart string) (state string, err error) {
+	err = tx.Stmt(s.queries[queryGetConversationState{}]).QueryRowContext(ctx, userId, counterpart).Scan(&state)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to get conversation state: %w", err)
+	}
+
+	return state, nil
+}
+
+func (s *Storage) createConversation(ctx context.Context, tx *sql.Tx, userId, counterpart, state string) error {
+	timestamp, err := s.nextTimestamp(ctx, tx)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(s.queries[queryCreateConversation{}]).ExecContext(ctx,
+		userId, counterpart, state, time.Now().UTC(), timestamp)
+	return err
+}
+
+func (s *Storage) setConversationState(ctx context.Context, tx *sql.Tx, userId, counterpart, state string) (timestamp int64, err error) {
+	timestamp, err = s.nextTimestamp(ctx, tx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Stmt(s.queries[queryUpdateConversationState{}]).ExecContext(ctx, userId, counterpart, state, timestamp)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return timestamp, nil
+}
+
+func (s *Storage) AnswerMessageRequest(ctx context.Context, userId, sender string, accepted bool) (err error) {
+	var tx *sql.Tx
+	tx, err = s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var state string
+	state, err = s.conversationState(ctx, tx, userId, sender)
+
+	if err != nil {
+		return err
+	}
+
+	if state != conversationRequested {
+		return &ErrMessageRequestNotFound{}
+	}
+
+	if accepted {
+		err = s.acceptConversation(ctx, tx, userId, sender)
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+
+	var timestamp int64
+	timestamp, err = s.setConversationState(ctx, tx, userId, sender, conversationDeclined)
+
+	if err != nil {
+		return fmt.Errorf("failed to decline message request: %w", err)
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteUserUpdate{}]).ExecContext(ctx, userId, timestamp, models.UpdateTypeRequest, sender)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' update: %w", userId, err)
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) MessageRequestsV1(ctx context.Context, userId string) (*models.MessageRequestsV1, error) {
+	rows, err := s.queries[queryGetMessageRequestsV1{}].QueryContext(ctx, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	requests := &models.MessageRequestsV1{Requests: make([]*models.MessageRequestInfoV1, 0)}
+
+	for rows.Next() {
+		info := &models.MessageRequestInfoV1{}
+		var created time.Time
+		err = rows.Scan(&info.User, &info.Messages, &created, &info.Timestamp)
+
+		if err != nil {
+			return nil, err
+		}
+
+		info.Created = storage.UtcTime(&created)
+		requests.Requests = append(requests.Requests, info)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	requests.Total = len(requests.Requests)
+
+	return requests, nil
+}
+
+func (e *ErrRecipientNotAccepting) Error() string {
+	return "receiver does not accept messages from the sender"
+}
+
+func (e *ErrRecipientNotAccepting) ImplementsRecipientNotAcceptingError() {
+}
+
+func (e *ErrRecipientNotAccepting) Recipient() string {
+	return e.recipient
+}
+
+func (e *ErrMessageRequestNotFound) Error() string {
+	return "message request not found"
+}
+
+func (e *ErrMessageRequestNotFound) ImplementsMessageRequestNotFoundError() {
+}
@@ -0,0 +1,63 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+type queryGetMessageUpdatesV1 struct{}
+
+func (q queryGetMessageUpdatesV1) text() string {
+	return `
+	SELECT
+		u.event_timestamp,
+		u.message_id
+	FROM updates AS u
+		JOIN messages AS m
+		ON m.id = u.message_id
+	WHERE u.user_id = $1 AND u.event_timestamp > $2
+		AND u.entry_type = 'message'
+		AND NOT EXISTS (
+			SELECT 1 FROM blocks AS b
+			WHERE b.user_id = $1
+				AND b.hide_conversation
+				AND b.blocked_user IN (m.sender, m.receiver)
+		)
+	ORDER BY u.event_timestamp ASC
+	LIMIT $3;
+	`
+}
+
+func (s *Storage) MessageUpdatesV1(ctx context.Context, userId string, after int64, limit int) (*models.MessageUpdatesV1, error) {
+	rows, err := s.queries[queryGetMessageUpdatesV1{}].QueryContext(ctx, userId, after, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	updates := &models.MessageUpdatesV1{Messages: make([]*models.MessageUpdateInfoV1, 0, limit)}
+
+	for rows.Next() {
+		info := &models.MessageUpdateInfoV1{}
+		err = rows.Scan(&info.Timestamp, &info.Id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		updates.Messages = append(updates.Messages, info)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	updates.Total = len(updates.Messages)
+
+	return updates, nil
+}
@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+type queryGetMessageUpdatesV2 struct{}
+
+func (q queryGetMessageUpdatesV2) text() string {
+	return `
+	SELECT
+		u.event_timestamp,
+		u.entry_type,
+		COALESCE(u.message_id, 0),
+		COALESCE(u.counterpart, '')
+	FROM updates AS u
+		LEFT OUTER JOIN messages AS m
+		ON m.id = u.message_id
+	WHERE u.user_id = $1 AND u.event_timestamp > $2
+		AND (u.message_id IS NULL OR NOT EXISTS (
+			SELECT 1 FROM blocks AS b
+			WHERE b.user_id = $1
+				AND b.hide_conversation
+				AND b.blocked_user IN (m.sender, m.receiver)
+		))
+	ORDER BY u.event_timestamp ASC
+	LIMIT $3;
+	`
+}
+
+type queryWriteUserUpdate struct{}
+
+func (q queryWriteUserUpdate) text() string {
+	return `
+	INSERT INTO updates (user_id, event_timestamp, entry_type, counterpart)
+	VALUES ($1, $2, $3, $4);
+	`
+}
+
+func (s *Storage) MessageUpdatesV2(ctx context.Context, userId string, after int64, limit int) (*models.MessageUpdatesV2, error) {
+	rows, err := s.queries[queryGetMessageUpdatesV2{}].QueryContext(ctx, userId, after, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	updates := &models.MessageUpdatesV2{Updates: make([]*models.UpdateInfoV2, 0, limit)}
+
+	for rows.Next() {
+		info := &models.UpdateInfoV2{}
+		err = rows.Scan(&info.Timestamp, &info.Type, &info.Id, &info.User)
+
+		if err != nil {
+			return nil, err
+		}
+
+		updates.Updates = append(updates.Updates, info)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	updates.Total = len(updates.Updates)
+
+	return updates, nil
+}
@@ -0,0 +1,143 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/barpav/msg-messages/internal/events"
+)
+
+type ErrMessageDeleted struct{}
+type ErrMessageNotFound struct{}
+type ErrTimestampIsNotMatch struct{}
+type ErrMessageNotModified struct{}
+
+// Changes of the message related data (e.g. attachments) made in the same transaction
+// right after the message itself has been successfully modified.
+type relatedChanges func(ctx context.Context, tx *sql.Tx, messageId int64) error
+
+// SQLite has no data-modifying CTEs, so the conditional update of the PostgreSQL storage is made in two steps
+// of the same transaction: the check query returns the update constraints (message deleted, timestamp match,
+// message modified), and only if they are met the update query changes the message.
+// Both queries take the same arguments, the update query also gets the new timestamp as $new_timestamp.
+func (s *Storage) modifyMessage(ctx context.Context, check, update query, event events.Type, changes relatedChanges, args ...any) (newTimestamp int64, err error) {
+	var tx *sql.Tx
+	tx, err = s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	newTimestamp, err = s.modifyMessageInTx(ctx, tx, check, update, event, changes, args...)
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newTimestamp, nil
+}
+
+// Modifies the message in the transaction started by the caller (e.g. after checks that must be consistent
+// with the modification), which is responsible for committing it.
+func (s *Storage) modifyMessageInTx(ctx context.Context, tx *sql.Tx, check, update query, event events.Type, changes relatedChanges, args ...any) (newTimestamp int64, err error) {
+	var (
+		id                                       int64
+		messageDeleted, timestampMatch, modified bool
+		sender, receiver                         string
+	)
+
+	err = tx.Stmt(s.queries[check]).QueryRowContext(ctx, args...).Scan(&messageDeleted, &timestampMatch, &modified)
+
+	switch {
+	case err != nil:
+		if err == sql.ErrNoRows {
+			return 0, &ErrMessageNotFound{}
+		}
+		return 0, err
+	case messageDeleted:
+		return 0, &ErrMessageDeleted{}
+	case !timestampMatch:
+		return 0, &ErrTimestampIsNotMatch{}
+	case !modified:
+		return 0, &ErrMessageNotModified{}
+	}
+
+	newTimestamp, err = s.nextTimestamp(ctx, tx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Stmt(s.queries[update]).QueryRowContext(ctx, append(args, sql.Named("new_timestamp", newTimestamp))...).Scan(
+		&id, &sender, &receiver,
+	)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to modify message: %w", err)
+	}
+
+	if changes != nil {
+		err = changes(ctx, tx, id)
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteUpdate{}]).ExecContext(ctx, sender, newTimestamp, id)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to write user '%s' update: %w", sender, err)
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteReceiverUpdate{}]).ExecContext(ctx, id, newTimestamp)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to write user '%s' update: %w", receiver, err)
+	}
+
+	err = s.writeMessageEvent(ctx, tx, &events.Event{Type: event, MessageId: id, Timestamp: newTimestamp, Sender: sender, Receiver: receiver})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newTimestamp, nil
+}
+
+func (e *ErrMessageDeleted) Error() string {
+	return "message deleted"
+}
+
+func (e *ErrMessageDeleted) ImplementsMessageDeletedError() {
+}
+
+func (e *ErrMessageNotFound) Error() string {
+	return "message not found"
+}
+
+func (e *ErrMessageNotFound) ImplementsMessageNotFoundError() {
+}
+
+func (e *ErrTimestampIsNotMatch) Error() string {
+	return "message timestamp is not match"
+}
+
+func (e *ErrTimestampIsNotMatch) ImplementsTimestampIsNotMatchError() {
+}
+
+func (e *ErrMessageNotModified) Error() string {
+	return "message has not been modified"
+}
+
+func (e *ErrMessageNotModified) ImplementsMessageNotModifiedError() {
+}
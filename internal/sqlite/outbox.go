@@ -0,0 +1,185 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type queryWriteFileUsage struct{}
+
+func (q queryWriteFileUsage) text() string {
+	return `
+	INSERT INTO outbox (file_id, in_use, created)
+	SELECT value, $2, $3
+	FROM json_each($1)
+	ORDER BY key;
+	`
+}
+
+// Every message has its own attachments, so the files are used once per message.
+type queryWriteBroadcastFileUsage struct{}
+
+func (q queryWriteBroadcastFileUsage) text() string {
+	return `
+	INSERT INTO outbox (file_id, in_use, created)
+	SELECT f.value, true, $3
+	FROM json_each($1) AS m
+		CROSS JOIN json_each($2) AS f
+	ORDER BY m.value, f.key;
+	`
+}
+
+type queryGetPendingFileUsage struct{}
+
+func (q queryGetPendingFileUsage) text() string {
+	return `
+	SELECT id, file_id, in_use
+	FROM outbox
+	WHERE delivered IS NULL
+	ORDER BY id
+	LIMIT $1;
+	`
+}
+
+type queryMarkFileUsageDelivered struct{}
+
+func (q queryMarkFileUsageDelivered) text() string {
+	return `
+	UPDATE outbox SET
+		delivered = $2
+	WHERE id IN (SELECT value FROM json_each($1));
+	`
+}
+
+type queryDeleteDeliveredFileUsage struct{}
+
+func (q queryDeleteDeliveredFileUsage) text() string {
+	return `
+	DELETE FROM outbox
+	WHERE delivered < $1;
+	`
+}
+
+func (s *Storage) writeFileUsage(ctx context.Context, tx *sql.Tx, files []string, inUse bool) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	fileIds, err := jsonArray(files)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteFileUsage{}]).ExecContext(ctx, fileIds, inUse, time.Now().UTC())
+
+	if err != nil {
+		return fmt.Errorf("failed to write file usage: %w", err)
+	}
+
+	return nil
+}
+
+type pendingFileUsage struct {
+	id     int64
+	fileId string
+	inUse  bool
+}
+
+// Unlike the PostgreSQL storage, events are not locked while they are sent, since the transaction would take
+// the only connection for the time of sending. The storage is used by one instance of the microservice,
+// which has one relay, so the events are not sent concurrently anyway.
+func (s *Storage) RelayFileUsage(ctx context.Context, limit int, send func(fileId string, inUse bool) error) (relayed int, err error) {
+	var pending []pendingFileUsage
+	pending, err = s.pendingFileUsage(ctx, limit)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pending file usage events: %w", err)
+	}
+
+	delivered := make([]int64, 0, len(pending))
+	var sendErr error
+
+	for _, event := range pending {
+		sendErr = send(event.fileId, event.inUse)
+
+		if sendErr != nil {
+			break
+		}
+
+		delivered = append(delivered, event.id)
+	}
+
+	if len(delivered) != 0 {
+		var ids string
+		ids, err = jsonArray(delivered)
+
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = s.queries[queryMarkFileUsageDelivered{}].ExecContext(ctx, ids, time.Now().UTC())
+
+		if err != nil {
+			return 0, fmt.Errorf("failed to mark file usage events delivered: %w", err)
+		}
+	}
+
+	return len(delivered), sendErr
+}
+
+func (s *Storage) pendingFileUsage(ctx context.Context, limit int) (pending []pendingFileUsage, err error) {
+	var rows *sql.Rows
+	rows, err = s.queries[queryGetPendingFileUsage{}].QueryContext(ctx, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		event := pendingFileUsage{}
+		err = rows.Scan(&event.id, &event.fileId, &event.inUse)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pending = append(pending, event)
+	}
+
+	return pending, rows.Err()
+}
+
+func (s *Storage) DeleteDeliveredFileUsage(ctx context.Context, before time.Time) error {
+	_, err := s.queries[queryDeleteDeliveredFileUsage{}].ExecContext(ctx, before.UTC())
+	return err
+}
+
+// Attachments are read in the transaction of the modification, so they are the ones being replaced or deleted.
+func (s *Storage) messageFiles(ctx context.Context, tx *sql.Tx, messageId int64) (files []string, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(s.queries[queryGetPersonalMessageAttachments{}]).QueryContext(ctx, messageId)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message files: %w", err)
+	}
+
+	defer rows.Close()
+
+	var fileId string
+	for rows.Next() {
+		err = rows.Scan(&fileId)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get message files: %w", err)
+		}
+
+		files = append(files, fileId)
+	}
+
+	return files, rows.Err()
+}
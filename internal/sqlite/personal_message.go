@@ -0,0 +1,135 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/barpav/msg-messages/internal/storage"
+)
+
+type queryGetPersonalMessage struct{}
+
+func (q queryGetPersonalMessage) text() string {
+	return `
+	SELECT
+		event_timestamp,
+		CASE WHEN sender = $2 THEN COALESCE(client_id, '') ELSE '' END,
+		CASE WHEN COALESCE(is_deleted, false) THEN '' ELSE sender END,
+		CASE WHEN COALESCE(is_deleted, false) THEN '' ELSE receiver END,
+		created,
+		edited,
+		COALESCE(CASE WHEN receiver = $2 THEN is_read ELSE read_receipt END, false),
+		EXISTS (SELECT 1 FROM stars WHERE user_id = $2 AND message_id = $1),
+		COALESCE(message_text, ''),
+		text_entities,
+		content,
+		envelope,
+		COALESCE(is_deleted, false)
+	FROM messages
+	WHERE id = $1
+		AND (sender = $2 OR receiver = $2);
+	`
+}
+
+type queryGetPersonalMessageAttachments struct{}
+
+func (q queryGetPersonalMessageAttachments) text() string {
+	return `
+	SELECT file_id
+	FROM attachments
+	WHERE message_id = $1;
+	`
+}
+
+func (s *Storage) personalMessage(ctx context.Context, userId string, messageId int64) (*storage.PersonalMessage, error) {
+	row := s.queries[queryGetPersonalMessage{}].QueryRowContext(ctx, messageId, userId)
+	err := row.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var textEntities, content, envelope []byte
+	message := &storage.PersonalMessage{Id: messageId, Files: make([]string, 0)}
+	err = row.Scan(
+		&message.Timestamp,
+		&message.ClientId,
+		&message.From,
+		&message.To,
+		&message.Created,
+		&message.Edited,
+		&message.Read,
+		&message.Starred,
+		&message.Text,
+		&textEntities,
+		&content,
+		&envelope,
+		&message.Deleted,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if message.Deleted {
+		return message, nil
+	}
+
+	message.Entities, err = storage.TextEntitiesFromJSON(textEntities)
+
+	if err != nil {
+		return nil, err
+	}
+
+	message.Content, err = storage.MessageContentFromJSON(content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	message.Envelope, err = storage.EncryptedEnvelopeFromJSON(envelope)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if message.Content != nil && message.Content.Poll != nil {
+		err = s.countPollVotes(ctx, userId, messageId, message.Content.Poll)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var rows *sql.Rows
+	rows, err = s.queries[queryGetPersonalMessageAttachments{}].QueryContext(ctx, messageId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var fileId string
+	for rows.Next() {
+		err = rows.Scan(&fileId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		message.Files = append(message.Files, fileId)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
@@ -0,0 +1,155 @@
+package sqlite
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Database schema is defined by the steps applied in the order of their versions, file names are
+// 'version_description.sql' (e.g. '0002_message_reactions.sql'), the same as the PostgreSQL migrations.
+// The version of the database is kept in its header (PRAGMA user_version). Applied steps must never be
+// changed, any schema change requires a new step.
+//
+//go:embed schema/*.sql
+var schemaFiles embed.FS
+
+type schemaStep struct {
+	version int
+	name    string
+	script  string
+}
+
+type queryGetSchemaVersion struct{}
+
+func (q queryGetSchemaVersion) text() string {
+	return `
+	PRAGMA user_version;
+	`
+}
+
+// Pragma does not accept parameters.
+type querySetSchemaVersion struct {
+	version int
+}
+
+func (q querySetSchemaVersion) text() string {
+	return fmt.Sprintf(`
+	PRAGMA user_version = %d;
+	`, q.version)
+}
+
+// Each step is applied in its own transaction along with the new version, so the database is never left
+// between the versions. Databases of the versions unknown to the service (created by newer versions of it)
+// are refused, since their schema may be incompatible with the queries.
+func (s *Storage) upgradeSchema() error {
+	steps, err := schemaSteps()
+
+	if err != nil {
+		return err
+	}
+
+	var version int
+	err = s.db.QueryRow(queryGetSchemaVersion{}.text()).Scan(&version)
+
+	if err != nil {
+		return fmt.Errorf("failed to get database schema version: %w", err)
+	}
+
+	latest := steps[len(steps)-1].version
+
+	if version > latest {
+		return fmt.Errorf("database schema version %d is newer than the latest known version %d", version, latest)
+	}
+
+	for _, step := range steps[version:] {
+		err = s.applySchemaStep(step)
+
+		if err != nil {
+			return err
+		}
+
+		log.Info().Msg(fmt.Sprintf("Database schema step %04d '%s' applied.", step.version, step.name))
+	}
+
+	return nil
+}
+
+func (s *Storage) applySchemaStep(step schemaStep) (err error) {
+	var tx *sql.Tx
+	tx, err = s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec(step.script) // no arguments, so the script may contain multiple statements
+
+	if err == nil {
+		_, err = tx.Exec(querySetSchemaVersion{step.version}.text())
+	}
+
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to apply database schema step %04d '%s': %w", step.version, step.name, err)
+	}
+
+	return nil
+}
+
+// Embedded steps ordered by version, which must be unique and consecutive starting from 1.
+func schemaSteps() ([]schemaStep, error) {
+	files, err := schemaFiles.ReadDir("schema")
+
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]schemaStep, 0, len(files))
+
+	for _, file := range files {
+		version, name, ok := strings.Cut(strings.TrimSuffix(file.Name(), ".sql"), "_")
+		step := schemaStep{name: name}
+		step.version, err = strconv.Atoi(version)
+
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid database schema file name '%s'", file.Name())
+		}
+
+		var script []byte
+		script, err = schemaFiles.ReadFile(path.Join("schema", file.Name()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		step.script = string(script)
+		all = append(all, step)
+	}
+
+	if len(all) == 0 {
+		return nil, errors.New("no database schema steps found")
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].version < all[j].version })
+
+	for i, step := range all {
+		if step.version != i+1 {
+			return nil, fmt.Errorf("database schema step %04d '%s' is out of order (expected version %d)", step.version, step.name, i+1)
+		}
+	}
+
+	return all, nil
+}
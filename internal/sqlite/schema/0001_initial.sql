@@ -0,0 +1,200 @@
+-- SQLite counterpart of internal/data/migrations (as of 0017). Statements are idempotent, since databases
+-- created before the schema was versioned (user_version 0) already have some of the tables.
+
+-- Emulation of the 'timeline' sequence: the only row holds its last value.
+CREATE TABLE IF NOT EXISTS timeline (
+    value INTEGER NOT NULL
+);
+
+INSERT INTO timeline (value)
+SELECT 0
+WHERE NOT EXISTS (SELECT 1 FROM timeline);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_timestamp INTEGER UNIQUE NOT NULL,
+    sender TEXT NOT NULL,
+    receiver TEXT NOT NULL,
+    client_id TEXT,
+    created TIMESTAMP,
+    edited TIMESTAMP,
+    is_read BOOLEAN,
+    read_receipt BOOLEAN,
+    message_text TEXT,
+    text_entities TEXT,
+    content TEXT,
+    envelope TEXT,
+    is_request BOOLEAN NOT NULL DEFAULT false,
+    is_deleted BOOLEAN
+);
+
+CREATE INDEX IF NOT EXISTS messages_conversation_idx ON messages (sender, receiver);
+CREATE INDEX IF NOT EXISTS messages_receiver_idx ON messages (receiver);
+CREATE UNIQUE INDEX IF NOT EXISTS messages_client_id_idx ON messages (sender, client_id);
+
+-- Full text search index (instead of 'text_search' column), kept in sync with the message text by the triggers.
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_search USING fts5 (
+    message_text,
+    content = 'messages',
+    content_rowid = 'id'
+);
+
+CREATE TRIGGER IF NOT EXISTS messages_search_insert AFTER INSERT ON messages
+WHEN new.message_text IS NOT NULL
+BEGIN
+    INSERT INTO messages_search (rowid, message_text) VALUES (new.id, new.message_text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_search_update AFTER UPDATE OF message_text ON messages
+BEGIN
+    INSERT INTO messages_search (messages_search, rowid, message_text)
+    SELECT 'delete', old.id, old.message_text
+    WHERE old.message_text IS NOT NULL;
+
+    INSERT INTO messages_search (rowid, message_text)
+    SELECT new.id, new.message_text
+    WHERE new.message_text IS NOT NULL;
+END;
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_id INTEGER REFERENCES messages(id) NOT NULL,
+    file_id TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS attachments_idx ON attachments (message_id);
+
+CREATE TABLE IF NOT EXISTS updates (
+    user_id TEXT NOT NULL,
+    event_timestamp INTEGER NOT NULL,
+    message_id INTEGER REFERENCES messages(id),
+    entry_type TEXT NOT NULL DEFAULT 'message',
+    counterpart TEXT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS updates_idx ON updates (user_id, event_timestamp);
+
+CREATE TABLE IF NOT EXISTS stars (
+    user_id TEXT NOT NULL,
+    message_id INTEGER REFERENCES messages(id) NOT NULL,
+    event_timestamp INTEGER NOT NULL,
+    PRIMARY KEY (user_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS stars_timeline_idx ON stars (user_id, event_timestamp);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+    message_id INTEGER REFERENCES messages(id) NOT NULL,
+    user_id TEXT NOT NULL,
+    option_index INTEGER NOT NULL,
+    PRIMARY KEY (message_id, user_id, option_index)
+);
+
+CREATE TABLE IF NOT EXISTS blocks (
+    user_id TEXT NOT NULL,
+    blocked_user TEXT NOT NULL,
+    hide_conversation BOOLEAN NOT NULL,
+    created TIMESTAMP NOT NULL,
+    event_timestamp INTEGER NOT NULL,
+    PRIMARY KEY (user_id, blocked_user)
+);
+
+CREATE TABLE IF NOT EXISTS settings (
+    user_id TEXT PRIMARY KEY,
+    incoming_messages TEXT NOT NULL,
+    hide_read_receipts BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE TABLE IF NOT EXISTS conversations (
+    user_id TEXT NOT NULL,
+    counterpart TEXT NOT NULL,
+    state TEXT NOT NULL,
+    muted BOOLEAN NOT NULL DEFAULT false,
+    muted_until TIMESTAMP,
+    archived BOOLEAN NOT NULL DEFAULT false,
+    created TIMESTAMP NOT NULL,
+    event_timestamp INTEGER NOT NULL,
+    PRIMARY KEY (user_id, counterpart)
+);
+
+CREATE INDEX IF NOT EXISTS conversations_state_idx ON conversations (user_id, state);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    sender TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    message_id INTEGER REFERENCES messages(id) NOT NULL,
+    message_timestamp INTEGER NOT NULL,
+    created TIMESTAMP NOT NULL,
+    PRIMARY KEY (sender, idempotency_key)
+);
+
+-- Messages created by the broadcast requests with idempotency keys
+-- (the key itself refers to the first of them).
+CREATE TABLE IF NOT EXISTS idempotency_key_messages (
+    sender TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    message_id INTEGER REFERENCES messages(id) NOT NULL,
+    message_timestamp INTEGER NOT NULL,
+    PRIMARY KEY (sender, idempotency_key, message_id),
+    FOREIGN KEY (sender, idempotency_key) REFERENCES idempotency_keys ON DELETE CASCADE
+);
+
+-- File usage events, relayed to the files usage statistics (internal/outbox).
+CREATE TABLE IF NOT EXISTS outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    file_id TEXT NOT NULL,
+    in_use BOOLEAN NOT NULL,
+    created TIMESTAMP NOT NULL,
+    delivered TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (id) WHERE delivered IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_delivered_idx ON outbox (delivered);
+
+-- Domain events of the messages, relayed to the message broker (internal/outbox).
+CREATE TABLE IF NOT EXISTS message_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_type TEXT NOT NULL,
+    message_id INTEGER NOT NULL,
+    event_timestamp INTEGER NOT NULL,
+    sender TEXT NOT NULL,
+    receiver TEXT NOT NULL,
+    created TIMESTAMP NOT NULL,
+    delivered TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS message_events_pending_idx ON message_events (id) WHERE delivered IS NULL;
+CREATE INDEX IF NOT EXISTS message_events_delivered_idx ON message_events (delivered);
+
+-- Outgoing webhooks of the users' timelines (internal/webhooks).
+CREATE TABLE IF NOT EXISTS webhooks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    auto_disabled BOOLEAN NOT NULL DEFAULT false,
+    after_timestamp INTEGER NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    next_attempt TIMESTAMP NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_user_idx ON webhooks (user_id);
+CREATE INDEX IF NOT EXISTS webhooks_due_idx ON webhooks (next_attempt) WHERE enabled;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER REFERENCES webhooks(id) ON DELETE CASCADE NOT NULL,
+    attempted TIMESTAMP NOT NULL,
+    after_timestamp INTEGER NOT NULL,
+    last_timestamp INTEGER NOT NULL,
+    updates INTEGER NOT NULL,
+    delivered BOOLEAN NOT NULL,
+    status INTEGER,
+    error TEXT,
+    duration INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_idx ON webhook_deliveries (webhook_id, id);
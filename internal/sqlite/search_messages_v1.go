@@ -0,0 +1,139 @@
+package sqlite
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+// Rank is inverted bm25() (the greater the better), like ts_rank of the PostgreSQL storage.
+// Total number of the found messages is returned the same way as by the PostgreSQL storage.
+type querySearchMessagesV1 struct{}
+
+func (q querySearchMessagesV1) text() string {
+	return `
+	WITH found AS (
+		SELECT
+			m.id,
+			m.event_timestamp,
+			-bm25(messages_search) AS rank
+		FROM messages_search
+			JOIN messages AS m
+			ON m.id = messages_search.rowid
+		WHERE messages_search MATCH $2
+			AND (m.sender = $1 OR m.receiver = $1)
+			AND COALESCE(m.is_deleted, false) = false
+			AND NOT (m.receiver = $1 AND m.is_request)
+			AND m.envelope IS NULL -- encrypted messages cannot be searched by the service
+			AND ($3 = '' OR (m.sender = $1 AND m.receiver = $3) OR (m.sender = $3 AND m.receiver = $1))
+			AND ($4 IS NULL OR m.created >= $4)
+			AND ($5 IS NULL OR m.created < $5)
+	)
+	SELECT
+		counted.total,
+		COALESCE(page.id, 0),
+		COALESCE(page.event_timestamp, 0),
+		COALESCE(page.rank, 0)
+	FROM (SELECT count(*) AS total FROM found) AS counted
+		LEFT JOIN (
+			SELECT *
+			FROM found
+			ORDER BY rank DESC, id DESC
+			LIMIT $6 OFFSET $7
+		) AS page
+		ON true
+	ORDER BY page.rank DESC, page.id DESC;
+	`
+}
+
+func (s *Storage) SearchMessagesV1(ctx context.Context, userId string, params *models.MessageSearchParameters) (*models.MessageSearchResultsV1, error) {
+	results := &models.MessageSearchResultsV1{Messages: make([]*models.MessageSearchInfoV1, 0, params.Limit)}
+	query := fullTextQuery(params.Query)
+
+	if query == "" {
+		return results, nil // nothing to search for
+	}
+
+	rows, err := s.queries[querySearchMessagesV1{}].QueryContext(ctx,
+		userId, query, params.With, utc(params.Since), utc(params.Until), params.Limit, params.Offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		info := &models.MessageSearchInfoV1{}
+		err = rows.Scan(&results.Total, &info.Id, &info.Timestamp, &info.Rank)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Id != 0 {
+			results.Messages = append(results.Messages, info)
+		}
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// Converts the web search syntax (as websearch_to_tsquery of the PostgreSQL storage) to FTS5 query:
+// all words are required, except alternatives separated by 'or', and words prefixed with '-' must be absent.
+// FTS5 cannot search for absent words only, so such queries (and queries without words) give empty string.
+func fullTextQuery(text string) string {
+	var required, excluded []string
+	alternative := false
+
+	for _, field := range strings.Fields(text) {
+		if strings.EqualFold(field, "or") && len(required) != 0 {
+			alternative = true
+			continue
+		}
+
+		negated := strings.HasPrefix(field, "-")
+
+		for i, word := range searchWords(field) {
+			term := `"` + word + `"`
+
+			switch {
+			case negated:
+				excluded = append(excluded, term)
+			case alternative && i == 0:
+				required[len(required)-1] += " OR " + term
+			default:
+				required = append(required, term)
+			}
+		}
+
+		alternative = false
+	}
+
+	if len(required) == 0 {
+		return ""
+	}
+
+	query := "(" + strings.Join(required, ") AND (") + ")"
+
+	if len(excluded) != 0 {
+		query += " NOT " + strings.Join(excluded, " NOT ")
+	}
+
+	return query
+}
+
+// Words are the sequences of letters and digits, so they are safe to be quoted in FTS5 query.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,145 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+type ErrConversationNotFound struct{}
+
+// Unspecified settings ($3 - muted, $5 - archived) are left unchanged,
+// whereas mute expiration time ($4) is reset on any mute state change.
+// Returns whether the settings are modified.
+type queryCheckConversationSettings struct{}
+
+func (q queryCheckConversationSettings) text() string {
+	return `
+	SELECT
+		muted IS NOT COALESCE($3, muted)
+		OR muted_until IS NOT (CASE WHEN $3 IS NULL THEN muted_until WHEN $3 THEN $4 END)
+		OR archived IS NOT COALESCE($5, archived)
+	FROM conversations
+	WHERE user_id = $1 AND counterpart = $2;
+	`
+}
+
+type querySetConversationSettings struct{}
+
+func (q querySetConversationSettings) text() string {
+	return `
+	UPDATE conversations SET
+		muted = COALESCE($3, muted),
+		muted_until = CASE WHEN $3 IS NULL THEN muted_until WHEN $3 THEN $4 END,
+		archived = COALESCE($5, archived),
+		event_timestamp = $6
+	WHERE user_id = $1 AND counterpart = $2;
+	`
+}
+
+type queryCheckConversationArchived struct{}
+
+func (q queryCheckConversationArchived) text() string {
+	return `
+	SELECT archived
+	FROM conversations
+	WHERE user_id = $1 AND counterpart = $2;
+	`
+}
+
+type queryUnarchiveConversation struct{}
+
+func (q queryUnarchiveConversation) text() string {
+	return `
+	UPDATE conversations SET
+		archived = false,
+		event_timestamp = $3
+	WHERE user_id = $1 AND counterpart = $2;
+	`
+}
+
+func (s *Storage) SetConversationSettings(ctx context.Context, userId, counterpart string, settings *models.ConversationSettingsV1) (err error) {
+	var tx *sql.Tx
+	tx, err = s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	args := []any{userId, counterpart, settings.Muted, utc(settings.MutedUntil), settings.Archived}
+
+	var modified bool
+	err = tx.Stmt(s.queries[queryCheckConversationSettings{}]).QueryRowContext(ctx, args...).Scan(&modified)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return &ErrConversationNotFound{}
+	case err != nil:
+		return fmt.Errorf("failed to set conversation settings: %w", err)
+	case !modified:
+		return nil
+	}
+
+	var timestamp int64
+	timestamp, err = s.nextTimestamp(ctx, tx)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(s.queries[querySetConversationSettings{}]).ExecContext(ctx, append(args, timestamp)...)
+
+	if err != nil {
+		return fmt.Errorf("failed to set conversation settings: %w", err)
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteUserUpdate{}]).ExecContext(ctx, userId, timestamp, models.UpdateTypeConversation, counterpart)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' update: %w", userId, err)
+	}
+
+	return tx.Commit()
+}
+
+// New incoming message brings archived conversation back.
+func (s *Storage) unarchiveConversation(ctx context.Context, tx *sql.Tx, userId, counterpart string) (err error) {
+	var archived bool
+	err = tx.Stmt(s.queries[queryCheckConversationArchived{}]).QueryRowContext(ctx, userId, counterpart).Scan(&archived)
+
+	if err == sql.ErrNoRows || (err == nil && !archived) {
+		return nil // not archived
+	}
+
+	var timestamp int64
+	if err == nil {
+		timestamp, err = s.nextTimestamp(ctx, tx)
+	}
+
+	if err == nil {
+		_, err = tx.Stmt(s.queries[queryUnarchiveConversation{}]).ExecContext(ctx, userId, counterpart, timestamp)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to unarchive conversation: %w", err)
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteUserUpdate{}]).ExecContext(ctx, userId, timestamp, models.UpdateTypeConversation, counterpart)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' update: %w", userId, err)
+	}
+
+	return nil
+}
+
+func (e *ErrConversationNotFound) Error() string {
+	return "conversation not found"
+}
+
+func (e *ErrConversationNotFound) ImplementsConversationNotFoundError() {
+}
@@ -0,0 +1,136 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/barpav/msg-messages/internal/events"
+)
+
+type queryCheckSetMessageReadState struct{}
+
+func (q queryCheckSetMessageReadState) text() string {
+	return `
+	SELECT
+		COALESCE(is_deleted, false),
+		event_timestamp = $1,
+		COALESCE(is_read, false) != $2
+	FROM messages
+	WHERE id = $3;
+	`
+}
+
+type querySetMessageReadState struct{}
+
+func (q querySetMessageReadState) text() string {
+	return `
+	UPDATE messages SET
+		event_timestamp = $new_timestamp,
+		is_read = NULLIF($2, false),
+		read_receipt = NULLIF($2, false)
+	WHERE id = $3
+	RETURNING id, sender, receiver;
+	`
+}
+
+// Changes only the receiver's read state, leaving the message timestamp
+// and the read receipt seen by the sender the same.
+type querySetMessageReadStatePrivately struct{}
+
+func (q querySetMessageReadStatePrivately) text() string {
+	return `
+	UPDATE messages SET
+		is_read = NULLIF($2, false)
+	WHERE id = $3
+	RETURNING receiver;
+	`
+}
+
+// The receiver's setting is checked in the same transaction as the read state is changed,
+// so the read receipt cannot be written after the receiver has hidden read receipts.
+func (s *Storage) SetMessageReadState(ctx context.Context, id, timestamp int64, read bool) (newTimestamp int64, err error) {
+	var tx *sql.Tx
+	tx, err = s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	var hidden bool
+	err = tx.Stmt(s.queries[queryCheckReadReceiptsHidden{}]).QueryRowContext(ctx, id).Scan(&hidden)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to check if read receipts are hidden: %w", err)
+	}
+
+	if hidden {
+		err = s.setMessageReadStatePrivately(ctx, tx, id, timestamp, read)
+		newTimestamp = timestamp
+	} else {
+		newTimestamp, err = s.modifyMessageInTx(ctx, tx, queryCheckSetMessageReadState{}, querySetMessageReadState{}, events.MessageReadStateChanged, nil,
+			timestamp, read, id)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newTimestamp, nil
+}
+
+// Read state is personal in this case, so the change is written only to the receiver's timeline
+// (like message stars), and the message timestamp stays the same.
+func (s *Storage) setMessageReadStatePrivately(ctx context.Context, tx *sql.Tx, id, timestamp int64, read bool) (err error) {
+	var (
+		messageDeleted, timestampMatch, modified bool
+		receiver                                 string
+	)
+
+	err = tx.Stmt(s.queries[queryCheckSetMessageReadState{}]).QueryRowContext(ctx, timestamp, read, id).Scan(
+		&messageDeleted, &timestampMatch, &modified,
+	)
+
+	switch {
+	case err != nil:
+		if err == sql.ErrNoRows {
+			return &ErrMessageNotFound{}
+		}
+		return err
+	case messageDeleted:
+		return &ErrMessageDeleted{}
+	case !timestampMatch:
+		return &ErrTimestampIsNotMatch{}
+	case !modified:
+		return &ErrMessageNotModified{}
+	}
+
+	err = tx.Stmt(s.queries[querySetMessageReadStatePrivately{}]).QueryRowContext(ctx, timestamp, read, id).Scan(&receiver)
+
+	if err != nil {
+		return fmt.Errorf("failed to modify message: %w", err)
+	}
+
+	var updateTimestamp int64
+	updateTimestamp, err = s.nextTimestamp(ctx, tx)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteUpdate{}]).ExecContext(ctx, receiver, updateTimestamp, id)
+
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s' update: %w", receiver, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type queryStarMessage struct{}
+
+func (q queryStarMessage) text() string {
+	return `
+	INSERT INTO stars (user_id, message_id, event_timestamp)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, message_id) DO NOTHING
+	RETURNING event_timestamp;
+	`
+}
+
+type queryUnstarMessage struct{}
+
+func (q queryUnstarMessage) text() string {
+	return `
+	DELETE FROM stars
+	WHERE user_id = $1 AND message_id = $2
+	RETURNING $3;
+	`
+}
+
+type queryDeleteMessageStars struct{}
+
+func (q queryDeleteMessageStars) text() string {
+	return `
+	DELETE FROM stars
+	WHERE message_id = $1;
+	`
+}
+
+// Stars are personal, so the change is written only to the user's timeline:
+// the message itself (and its timestamp) stays the same for both participants.
+func (s *Storage) SetMessageStar(ctx context.Context, userId string, messageId int64, starred bool) (timestamp int64, err error) {
+	var tx *sql.Tx
+	tx, err = s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	timestamp, err = s.nextTimestamp(ctx, tx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	q := query(queryUnstarMessage{})
+
+	if starred {
+		q = queryStarMessage{}
+	}
+
+	err = tx.Stmt(s.queries[q]).QueryRowContext(ctx, userId, messageId, timestamp).Scan(&timestamp)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, &ErrMessageNotModified{}
+		}
+
+		return 0, fmt.Errorf("failed to change message star: %w", err)
+	}
+
+	_, err = tx.Stmt(s.queries[queryWriteUpdate{}]).ExecContext(ctx, userId, timestamp, messageId)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to write user '%s' update: %w", userId, err)
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return timestamp, nil
+}
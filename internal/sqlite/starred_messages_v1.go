@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+type queryGetStarredMessagesV1 struct{}
+
+func (q queryGetStarredMessagesV1) text() string {
+	return `
+	SELECT
+		s.event_timestamp,
+		m.id,
+		m.event_timestamp
+	FROM stars AS s
+		JOIN messages AS m
+		ON m.id = s.message_id
+	WHERE s.user_id = $1
+		AND ($2 = 0 OR s.event_timestamp < $2)
+		AND COALESCE(m.is_deleted, false) = false
+	ORDER BY s.event_timestamp DESC
+	LIMIT $3;
+	`
+}
+
+func (s *Storage) StarredMessagesV1(ctx context.Context, userId string, before int64, limit int) (*models.StarredMessagesV1, error) {
+	rows, err := s.queries[queryGetStarredMessagesV1{}].QueryContext(ctx, userId, before, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	starred := &models.StarredMessagesV1{Messages: make([]*models.StarredMessageInfoV1, 0, limit)}
+
+	var starTimestamp int64
+
+	for rows.Next() {
+		info := &models.StarredMessageInfoV1{}
+		err = rows.Scan(&starTimestamp, &info.Id, &info.Timestamp)
+
+		if err != nil {
+			return nil, err
+		}
+
+		starred.Messages = append(starred.Messages, info)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	starred.Total = len(starred.Messages)
+
+	if starred.Total == limit {
+		starred.Next = starTimestamp
+	}
+
+	return starred, nil
+}
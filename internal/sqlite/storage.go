@@ -0,0 +1,275 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	_ "modernc.org/sqlite"
+)
+
+type Storage struct {
+	db      *sql.DB
+	cfg     *config
+	queries map[query]*sql.Stmt
+}
+
+type query interface {
+	text() string
+}
+
+func queriesToPrepare() []query {
+	return []query{
+		queryNextTimestamps{},
+		queryCreateMessage{},
+		queryGetMessageIdByClientId{},
+		queryCreateAttachment{},
+		queryGetRecipientBlockingSender{},
+		queryCreateBroadcastMessages{},
+		queryCreateBroadcastAttachments{},
+		queryWriteBroadcastUpdates{},
+		queryWriteUpdate{},
+		queryWriteUpdates{},
+		queryWriteReceiverUpdate{},
+		queryGetIdempotentMessage{},
+		queryDeleteExpiredIdempotencyKeys{},
+		queryCreateIdempotencyKey{},
+		queryGetIdempotentBroadcast{},
+		queryCreateIdempotencyKeyMessages{},
+		queryGetMessageUpdatesV1{},
+		queryGetMessageUpdatesV2{},
+		queryWriteUserUpdate{},
+		querySearchMessagesV1{},
+		queryGetSharedFilesV1{},
+		queryStarMessage{},
+		queryUnstarMessage{},
+		queryDeleteMessageStars{},
+		queryGetStarredMessagesV1{},
+		queryGetBlock{},
+		queryCreateBlock{},
+		queryUpdateBlock{},
+		queryDeleteBlock{},
+		queryCheckSenderBlocked{},
+		queryGetConversationMessages{},
+		queryGetBlockedUsersV1{},
+		queryGetBlockedUserV1{},
+		queryGetUserSettings{},
+		queryGetIncomingMessagesSetting{},
+		queryCheckReadReceiptsHidden{},
+		querySetUserSettings{},
+		queryGetConversationState{},
+		queryCreateConversation{},
+		queryUpdateConversationState{},
+		queryReleaseRequestMessages{},
+		queryGetMessageRequestsV1{},
+		queryGetConversationsV1{},
+		queryCheckConversationSettings{},
+		querySetConversationSettings{},
+		queryCheckConversationArchived{},
+		queryUnarchiveConversation{},
+		queryGetPersonalMessage{},
+		queryGetPersonalMessageAttachments{},
+		queryGetPollVotes{},
+		queryCheckEditMessageText{},
+		queryEditMessageText{},
+		queryCheckMessageEncrypted{},
+		queryCheckEditMessageEnvelope{},
+		queryEditMessageEnvelope{},
+		queryCheckSetMessageReadState{},
+		querySetMessageReadState{},
+		querySetMessageReadStatePrivately{},
+		queryCheckDeleteMessageData{},
+		queryDeleteMessageData{},
+		queryCheckEditMessageFiles{},
+		queryEditMessageFiles{},
+		queryDeleteAttachments{},
+		queryCheckVotePoll{},
+		queryVotePoll{},
+		queryDeleteUserPollVotes{},
+		queryCreatePollVotes{},
+		queryDeletePollVotes{},
+		queryWriteFileUsage{},
+		queryWriteBroadcastFileUsage{},
+		queryGetPendingFileUsage{},
+		queryMarkFileUsageDelivered{},
+		queryDeleteDeliveredFileUsage{},
+		queryWriteMessageEvent{},
+		queryWriteBroadcastEvents{},
+		queryGetPendingMessageEvents{},
+		queryMarkMessageEventsDelivered{},
+		queryDeleteDeliveredMessageEvents{},
+		queryCreateWebhook{},
+		queryGetWebhooksV1{},
+		queryGetWebhookV1{},
+		querySetWebhookEnabled{},
+		queryDeleteWebhook{},
+		queryGetWebhookDeliveriesV1{},
+		queryClaimDueWebhooks{},
+		querySaveWebhookOutcome{},
+		queryWriteWebhookDelivery{},
+		queryTrimWebhookDeliveries{},
+	}
+}
+
+// Data is not encrypted, so the storage refuses to start with encryption keys
+// rather than keep the data unencrypted contrary to the settings.
+func (s *Storage) Open() (err error) {
+	s.cfg = &config{}
+	s.cfg.Read()
+
+	if s.cfg.encryptionKeys != "" {
+		return fmt.Errorf("encryption at rest is not supported by the SQLite storage (%s must not be specified)", envVarEncryptionKeys)
+	}
+
+	err = s.connectToDatabase()
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			s.db.Close() // opening may be retried
+		}
+	}()
+
+	err = s.upgradeSchema()
+
+	if err != nil {
+		return fmt.Errorf("failed to upgrade database schema: %w", err)
+	}
+
+	return s.prepareQueries()
+}
+
+func (s *Storage) Close(ctx context.Context) (err error) {
+	var closeErr error
+	closed := make(chan struct{}, 1)
+
+	go func() {
+		for _, stmt := range s.queries {
+			if stmt != nil {
+				closeErr = errors.Join(closeErr, stmt.Close())
+			}
+		}
+
+		closeErr = errors.Join(closeErr, s.db.Close())
+
+		closed <- struct{}{}
+	}()
+
+	select {
+	case <-closed:
+		err = closeErr
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to disconnect from database: %w", err)
+	}
+
+	return err
+}
+
+// SQLite allows only one writer at a time, so the storage uses the only connection: transactions
+// are serialized (instead of row locks of the PostgreSQL storage), and every query in a transaction
+// must be executed in it. Foreign keys are disabled in SQLite by default.
+func (s *Storage) connectToDatabase() (err error) {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Set("_txlock", "immediate")
+	params.Set("_time_format", "sqlite")
+
+	s.db, err = sql.Open("sqlite", fmt.Sprintf("file:%s?%s", s.cfg.database, params.Encode()))
+
+	if err == nil {
+		s.db.SetMaxOpenConns(1)
+		err = s.db.Ping()
+
+		if err != nil {
+			s.db.Close()
+		}
+	}
+
+	if err == nil {
+		log.Info().Msg(fmt.Sprintf("Successfully opened SQLite database at %s", s.cfg.database))
+	}
+
+	return err
+}
+
+func (s *Storage) prepareQueries() (err error) {
+	s.queries = make(map[query]*sql.Stmt)
+
+	for _, q := range queriesToPrepare() {
+		err = errors.Join(err, s.prepare(q))
+	}
+
+	return err
+}
+
+func (s *Storage) prepare(q query) (err error) {
+	s.queries[q], err = s.db.Prepare(q.text())
+	return err
+}
+
+// Emulation of nextval('timeline') for n rows at once.
+type queryNextTimestamps struct{}
+
+func (q queryNextTimestamps) text() string {
+	return `
+	UPDATE timeline SET
+		value = value + $1
+	RETURNING value - $1 + 1;
+	`
+}
+
+// Returns the first of n consecutive timestamps reserved in the transaction.
+func (s *Storage) nextTimestamps(ctx context.Context, tx *sql.Tx, n int) (first int64, err error) {
+	err = tx.Stmt(s.queries[queryNextTimestamps{}]).QueryRowContext(ctx, n).Scan(&first)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get next timestamp: %w", err)
+	}
+
+	return first, nil
+}
+
+func (s *Storage) nextTimestamp(ctx context.Context, tx *sql.Tx) (timestamp int64, err error) {
+	timestamp, err = s.nextTimestamps(ctx, tx, 1)
+	return timestamp, err
+}
+
+// Arrays are passed to the queries as JSON (SQLite has no array type) and expanded by json_each().
+func jsonArray[T any](values []T) (string, error) {
+	if values == nil {
+		values = make([]T, 0)
+	}
+
+	data, err := json.Marshal(values)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize query parameter: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// SQLite stores time as text, which is compared correctly only in the same time zone.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	utc := t.UTC()
+	return &utc
+}
@@ -0,0 +1,95 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/barpav/msg-messages/internal/rest"
+	"github.com/barpav/msg-messages/internal/sqlite"
+	"github.com/barpav/msg-messages/internal/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) rest.Storage {
+		t.Setenv("MSG_STORAGE_DATABASE", filepath.Join(t.TempDir(), "messages.db"))
+
+		s := &sqlite.Storage{}
+		require.NoError(t, s.Open())
+
+		t.Cleanup(func() {
+			s.Close(context.Background())
+		})
+
+		return s
+	})
+}
+
+func TestStorage_Open_encryptionKeys(t *testing.T) {
+	t.Setenv("MSG_STORAGE_DATABASE", filepath.Join(t.TempDir(), "messages.db"))
+	t.Setenv("MSG_ENCRYPTION_KEYS", "1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")
+
+	s := &sqlite.Storage{}
+	require.Error(t, s.Open())
+}
+
+func TestStorage_Open_schemaVersion(t *testing.T) {
+	database := filepath.Join(t.TempDir(), "messages.db")
+	t.Setenv("MSG_STORAGE_DATABASE", database)
+
+	s := &sqlite.Storage{}
+	require.NoError(t, s.Open())
+	require.NoError(t, s.Close(context.Background()))
+
+	require.Equal(t, 1, schemaVersion(t, database))
+
+	s = &sqlite.Storage{}
+	require.NoError(t, s.Open(), "reopened")
+	require.NoError(t, s.Close(context.Background()))
+
+	require.Equal(t, 1, schemaVersion(t, database), "steps are applied once")
+
+	setSchemaVersion(t, database, 2)
+
+	s = &sqlite.Storage{}
+	require.ErrorContains(t, s.Open(), "newer than the latest known version", "created by a newer version of the service")
+}
+
+// Databases created before the schema was versioned.
+func TestStorage_Open_unversionedSchema(t *testing.T) {
+	database := filepath.Join(t.TempDir(), "messages.db")
+	t.Setenv("MSG_STORAGE_DATABASE", database)
+
+	s := &sqlite.Storage{}
+	require.NoError(t, s.Open())
+	require.NoError(t, s.Close(context.Background()))
+
+	setSchemaVersion(t, database, 0)
+
+	s = &sqlite.Storage{}
+	require.NoError(t, s.Open())
+	require.NoError(t, s.Close(context.Background()))
+
+	require.Equal(t, 1, schemaVersion(t, database))
+}
+
+func schemaVersion(t *testing.T, database string) (version int) {
+	db, err := sql.Open("sqlite", database)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.QueryRow("PRAGMA user_version;").Scan(&version))
+	return version
+}
+
+func setSchemaVersion(t *testing.T, database string, version int) {
+	db, err := sql.Open("sqlite", database)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(fmt.Sprintf("PRAGMA user_version = %d;", version))
+	require.NoError(t, err)
+}
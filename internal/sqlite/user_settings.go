@@ -0,0 +1,75 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+type queryGetUserSettings struct{}
+
+func (q queryGetUserSettings) text() string {
+	return `
+	SELECT
+		COALESCE(s.incoming_messages, 'everyone'),
+		COALESCE(s.hide_read_receipts, false)
+	FROM (SELECT $1 AS user_id) AS u
+		LEFT OUTER JOIN settings AS s
+		ON s.user_id = u.user_id;
+	`
+}
+
+type queryGetIncomingMessagesSetting struct{}
+
+func (q queryGetIncomingMessagesSetting) text() string {
+	return `
+	SELECT COALESCE(
+		(SELECT incoming_messages FROM settings WHERE user_id = $1),
+		'everyone'
+	);
+	`
+}
+
+type queryCheckReadReceiptsHidden struct{}
+
+func (q queryCheckReadReceiptsHidden) text() string {
+	return `
+	SELECT COALESCE(
+		(SELECT s.hide_read_receipts
+		FROM messages AS m
+			JOIN settings AS s
+			ON s.user_id = m.receiver
+		WHERE m.id = $1),
+		false
+	);
+	`
+}
+
+type querySetUserSettings struct{}
+
+func (q querySetUserSettings) text() string {
+	return `
+	INSERT INTO settings (user_id, incoming_messages, hide_read_receipts)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id) DO UPDATE SET
+		incoming_messages = EXCLUDED.incoming_messages,
+		hide_read_receipts = EXCLUDED.hide_read_receipts;
+	`
+}
+
+func (s *Storage) UserSettingsV1(ctx context.Context, userId string) (*models.UserSettingsV1, error) {
+	settings := &models.UserSettingsV1{}
+	err := s.queries[queryGetUserSettings{}].QueryRowContext(ctx, userId).Scan(
+		&settings.IncomingMessages, &settings.HideReadReceipts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (s *Storage) SetUserSettings(ctx context.Context, userId string, settings *models.UserSettingsV1) error {
+	_, err := s.queries[querySetUserSettings{}].ExecContext(ctx, userId, settings.IncomingMessages, settings.HideReadReceipts)
+	return err
+}
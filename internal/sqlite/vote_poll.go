@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/barpav/msg-messages/internal/events"
+)
+
+// Votes are compared as sorted JSON arrays of distinct option indexes.
+type queryCheckVotePoll struct{}
+
+func (q queryCheckVotePoll) text() string {
+	return `
+	SELECT
+		COALESCE(is_deleted, false),
+		event_timestamp = $1,
+		(SELECT json_group_array(option_index) FROM (
+			SELECT option_index FROM poll_votes WHERE message_id = $3 AND user_id = $4 ORDER BY option_index))
+		IS NOT (SELECT json_group_array(value) FROM (
+			SELECT DISTINCT value FROM json_each($2) ORDER BY value))
+	FROM messages
+	WHERE id = $3;
+	`
+}
+
+type queryVotePoll struct{}
+
+func (q queryVotePoll) text() string {
+	return `
+	UPDATE messages SET
+		event_timestamp = $new_timestamp
+	WHERE id = $3
+	RETURNING id, sender, receiver;
+	`
+}
+
+type queryDeleteUserPollVotes struct{}
+
+func (q queryDeleteUserPollVotes) text() string {
+	return `
+	DELETE FROM poll_votes
+	WHERE message_id = $1 AND user_id = $2;
+	`
+}
+
+type queryCreatePollVotes struct{}
+
+func (q queryCreatePollVotes) text() string {
+	return `
+	INSERT INTO poll_votes (message_id, user_id, option_index)
+	SELECT DISTINCT $1, $2, value
+	FROM json_each($3);
+	`
+}
+
+type queryDeletePollVotes struct{}
+
+func (q queryDeletePollVotes) text() string {
+	return `
+	DELETE FROM poll_votes
+	WHERE message_id = $1;
+	`
+}
+
+// Tallies are visible to both participants, so voting changes the message timestamp
+// like any other modification. Options are expected to be validated against the poll.
+func (s *Storage) VotePoll(ctx context.Context, userId string, id, timestamp int64, options []int) (newTimestamp int64, err error) {
+	var votes string
+	votes, err = jsonArray(options)
+
+	if err != nil {
+		return 0, err
+	}
+
+	replaceVotes := func(ctx context.Context, tx *sql.Tx, messageId int64) (err error) {
+		_, err = tx.Stmt(s.queries[queryDeleteUserPollVotes{}]).ExecContext(ctx, messageId, userId)
+
+		if err != nil {
+			return fmt.Errorf("failed to delete poll votes: %w", err)
+		}
+
+		if len(options) == 0 {
+			return nil // vote retracted
+		}
+
+		_, err = tx.Stmt(s.queries[queryCreatePollVotes{}]).ExecContext(ctx, messageId, userId, votes)
+
+		if err != nil {
+			return fmt.Errorf("failed to create poll votes: %w", err)
+		}
+
+		return nil
+	}
+
+	newTimestamp, err = s.modifyMessage(ctx, queryCheckVotePoll{}, queryVotePoll{}, events.MessageEdited, replaceVotes,
+		timestamp, votes, id, userId)
+	return newTimestamp, err
+}
@@ -0,0 +1,356 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/storage"
+	"github.com/barpav/msg-messages/internal/webhooks"
+)
+
+// New webhook receives only the updates written after its creation.
+type queryCreateWebhook struct{}
+
+func (q queryCreateWebhook) text() string {
+	return `
+	INSERT INTO webhooks (user_id, url, secret, after_timestamp, next_attempt, created)
+	VALUES ($1, $2, $3, COALESCE((SELECT MAX(event_timestamp) FROM updates WHERE user_id = $1), 0), $4, $4)
+	RETURNING id, after_timestamp;
+	`
+}
+
+type queryGetWebhooksV1 struct{}
+
+func (q queryGetWebhooksV1) text() string {
+	return `
+	SELECT id, url, enabled, auto_disabled, failures, after_timestamp, created
+	FROM webhooks
+	WHERE user_id = $1
+	ORDER BY id;
+	`
+}
+
+type queryGetWebhookV1 struct{}
+
+func (q queryGetWebhookV1) text() string {
+	return `
+	SELECT id, url, enabled, auto_disabled, failures, after_timestamp, created
+	FROM webhooks
+	WHERE user_id = $1 AND id = $2;
+	`
+}
+
+// Enabled webhook is delivered right away, starting from the first undelivered update.
+type querySetWebhookEnabled struct{}
+
+func (q querySetWebhookEnabled) text() string {
+	return `
+	UPDATE webhooks SET
+		enabled = $3,
+		auto_disabled = false,
+		failures = CASE WHEN $3 THEN 0 ELSE failures END,
+		next_attempt = $4
+	WHERE user_id = $1 AND id = $2;
+	`
+}
+
+type queryDeleteWebhook struct{}
+
+func (q queryDeleteWebhook) text() string {
+	return `
+	DELETE FROM webhooks
+	WHERE user_id = $1 AND id = $2;
+	`
+}
+
+type queryGetWebhookDeliveriesV1 struct{}
+
+func (q queryGetWebhookDeliveriesV1) text() string {
+	return `
+	SELECT attempted, after_timestamp, last_timestamp, updates, delivered, COALESCE(status, 0), COALESCE(error, ''), duration
+	FROM webhook_deliveries
+	WHERE webhook_id = $1
+	ORDER BY id DESC;
+	`
+}
+
+type queryClaimDueWebhooks struct{}
+
+func (q queryClaimDueWebhooks) text() string {
+	return `
+	UPDATE webhooks SET
+		next_attempt = $2
+	WHERE id IN (
+		SELECT id
+		FROM webhooks
+		WHERE enabled AND next_attempt <= $1
+		ORDER BY next_attempt
+		LIMIT $3
+	)
+	RETURNING id, user_id, url, secret, after_timestamp, failures;
+	`
+}
+
+type querySaveWebhookOutcome struct{}
+
+func (q querySaveWebhookOutcome) text() string {
+	return `
+	UPDATE webhooks SET
+		after_timestamp = $2,
+		failures = $3,
+		next_attempt = $4,
+		enabled = enabled AND NOT $5,
+		auto_disabled = auto_disabled OR (enabled AND $5)
+	WHERE id = $1;
+	`
+}
+
+type queryWriteWebhookDelivery struct{}
+
+func (q queryWriteWebhookDelivery) text() string {
+	return `
+	INSERT INTO webhook_deliveries (webhook_id, attempted, after_timestamp, last_timestamp, updates, delivered, status, error, duration)
+	VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NULLIF($8, ''), $9);
+	`
+}
+
+// Keeps the latest deliveries only.
+type queryTrimWebhookDeliveries struct{}
+
+func (q queryTrimWebhookDeliveries) text() string {
+	return `
+	DELETE FROM webhook_deliveries
+	WHERE webhook_id = $1 AND id <= (
+		SELECT id
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY id DESC
+		LIMIT 1 OFFSET $2
+	);
+	`
+}
+
+func (s *Storage) CreateWebhook(ctx context.Context, userId string, webhook *models.NewWebhookV1, secret string) (*models.WebhookV1, error) {
+	created := time.Now().UTC()
+	result := &models.WebhookV1{Url: webhook.Url, Secret: secret, Enabled: true, Created: storage.UtcTime(&created)}
+
+	err := s.queries[queryCreateWebhook{}].QueryRowContext(ctx, userId, webhook.Url, secret, created).Scan(&result.Id, &result.After)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return result, nil
+}
+
+func (s *Storage) WebhooksV1(ctx context.Context, userId string) (*models.WebhooksV1, error) {
+	rows, err := s.queries[queryGetWebhooksV1{}].QueryContext(ctx, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	result := &models.WebhooksV1{Webhooks: make([]*models.WebhookV1, 0)}
+
+	for rows.Next() {
+		webhook := &models.WebhookV1{}
+		err = scanWebhookV1(rows, webhook)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result.Webhooks = append(result.Webhooks, webhook)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result.Total = len(result.Webhooks)
+
+	return result, nil
+}
+
+func (s *Storage) WebhookV1(ctx context.Context, userId string, id int64) (*models.WebhookV1, error) {
+	webhook := &models.WebhookV1{}
+	err := scanWebhookV1(s.queries[queryGetWebhookV1{}].QueryRowContext(ctx, userId, id), webhook)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func scanWebhookV1(row interface{ Scan(dest ...any) error }, webhook *models.WebhookV1) error {
+	var created time.Time
+	err := row.Scan(&webhook.Id, &webhook.Url, &webhook.Enabled, &webhook.AutoDisabled, &webhook.Failures, &webhook.After, &created)
+
+	if err != nil {
+		return err
+	}
+
+	webhook.Created = storage.UtcTime(&created)
+
+	return nil
+}
+
+func (s *Storage) SetWebhookEnabled(ctx context.Context, userId string, id int64, enabled bool) (found bool, err error) {
+	var result sql.Result
+	result, err = s.queries[querySetWebhookEnabled{}].ExecContext(ctx, userId, id, enabled, time.Now().UTC())
+
+	if err != nil {
+		return false, err
+	}
+
+	var affected int64
+	affected, err = result.RowsAffected()
+
+	return affected != 0, err
+}
+
+func (s *Storage) DeleteWebhook(ctx context.Context, userId string, id int64) (found bool, err error) {
+	var result sql.Result
+	result, err = s.queries[queryDeleteWebhook{}].ExecContext(ctx, userId, id)
+
+	if err != nil {
+		return false, err
+	}
+
+	var affected int64
+	affected, err = result.RowsAffected()
+
+	return affected != 0, err
+}
+
+func (s *Storage) WebhookDeliveriesV1(ctx context.Context, userId string, id int64) (*models.WebhookDeliveriesV1, error) {
+	webhook, err := s.WebhookV1(ctx, userId, id)
+
+	if err != nil || webhook == nil {
+		return nil, err
+	}
+
+	var rows *sql.Rows
+	rows, err = s.queries[queryGetWebhookDeliveriesV1{}].QueryContext(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	result := &models.WebhookDeliveriesV1{Deliveries: make([]*models.WebhookDeliveryV1, 0)}
+
+	for rows.Next() {
+		var attempted time.Time
+		delivery := &models.WebhookDeliveryV1{}
+		err = rows.Scan(&attempted, &delivery.After, &delivery.Last, &delivery.Updates, &delivery.Delivered,
+			&delivery.Status, &delivery.Error, &delivery.Duration)
+
+		if err != nil {
+			return nil, err
+		}
+
+		delivery.Attempted = storage.UtcTime(&attempted)
+		result.Deliveries = append(result.Deliveries, delivery)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result.Total = len(result.Deliveries)
+
+	return result, nil
+}
+
+// Claim doesn't need row locks, since transactions are serialized (see connectToDatabase).
+func (s *Storage) ClaimDueWebhooks(ctx context.Context, limit int, lease time.Duration) ([]*webhooks.Subscription, error) {
+	now := time.Now().UTC()
+	rows, err := s.queries[queryClaimDueWebhooks{}].QueryContext(ctx, now, now.Add(lease), limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhooks: %w", err)
+	}
+
+	defer rows.Close()
+
+	var claimed []*webhooks.Subscription
+
+	for rows.Next() {
+		subscription := &webhooks.Subscription{}
+		err = rows.Scan(&subscription.Id, &subscription.UserId, &subscription.Url, &subscription.Secret,
+			&subscription.After, &subscription.Failures)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim webhooks: %w", err)
+		}
+
+		claimed = append(claimed, subscription)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhooks: %w", err)
+	}
+
+	return claimed, nil
+}
+
+func (s *Storage) SaveWebhookOutcome(ctx context.Context, outcome *webhooks.Outcome) (err error) {
+	var tx *sql.Tx
+	tx, err = s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var result sql.Result
+	result, err = tx.Stmt(s.queries[querySaveWebhookOutcome{}]).ExecContext(ctx,
+		outcome.WebhookId, outcome.After, outcome.Failures, outcome.NextAttempt.UTC(), outcome.Disable)
+
+	if err != nil {
+		return fmt.Errorf("failed to save webhook '%d' outcome: %w", outcome.WebhookId, err)
+	}
+
+	var affected int64
+	affected, err = result.RowsAffected()
+
+	if err != nil || affected == 0 {
+		return err // deleted meanwhile
+	}
+
+	if d := outcome.Delivery; d != nil {
+		_, err = tx.Stmt(s.queries[queryWriteWebhookDelivery{}]).ExecContext(ctx, outcome.WebhookId, time.Time(*d.Attempted).UTC(),
+			d.After, d.Last, d.Updates, d.Delivered, d.Status, d.Error, d.Duration)
+
+		if err != nil {
+			return fmt.Errorf("failed to write webhook '%d' delivery: %w", outcome.WebhookId, err)
+		}
+
+		_, err = tx.Stmt(s.queries[queryTrimWebhookDeliveries{}]).ExecContext(ctx, outcome.WebhookId, webhooks.DeliveryLogSize)
+
+		if err != nil {
+			return fmt.Errorf("failed to trim webhook '%d' deliveries: %w", outcome.WebhookId, err)
+		}
+	}
+
+	return tx.Commit()
+}
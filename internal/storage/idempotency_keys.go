@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+// Keys created before the returned time are expired, so they can be used again.
+func IdempotencyKeysExpiredBefore(ttl time.Duration) time.Time {
+	return time.Now().UTC().Add(-ttl)
+}
+
+// Request data is identified by the fingerprint saved with the key,
+// so the key reused for another request doesn't get the response of the original one.
+func FingerprintMatches(saved string, key *models.IdempotencyKey) bool {
+	return saved == key.Fingerprint
+}
+
+// All the messages of the broadcast are saved with its idempotency key (in the order of recipients),
+// whereas the key itself refers to the first one.
+func SentMessageIds(sent *models.SentMessagesV1) (ids, timestamps []int64) {
+	ids, timestamps = make([]int64, 0, len(sent.Messages)), make([]int64, 0, len(sent.Messages))
+
+	for _, info := range sent.Messages {
+		ids = append(ids, info.Id)
+		timestamps = append(timestamps, info.Timestamp)
+	}
+
+	return ids, timestamps
+}
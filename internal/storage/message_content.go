@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+// Returns nil (NULL) for messages without structured content, so it can be stored as is in 'content' column.
+func MessageContentToJSON(content *models.MessageContent) (any, error) {
+	if content == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(content)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize message content: %w", err)
+	}
+
+	return string(data), nil
+}
+
+func MessageContentFromJSON(data []byte) (*models.MessageContent, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	content := &models.MessageContent{}
+	err := json.Unmarshal(data, content)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize message content: %w", err)
+	}
+
+	return content, nil
+}
+
+// Poll tallies are not stored in the content itself, they are calculated from the votes:
+// the number of votes for the option and whether the user is one of the voters.
+// Votes for the options the poll no longer has are ignored.
+func CountPollVotes(poll *models.PollContent, option, votes int, voted bool) {
+	if option >= 0 && option < len(poll.Options) {
+		poll.Options[option].Votes, poll.Options[option].Voted = votes, voted
+	}
+}
+
+// Returns nil (NULL) for plain messages, so it can be stored as is in 'envelope' column.
+func EncryptedEnvelopeToJSON(envelope *models.EncryptedEnvelope) (any, error) {
+	if envelope == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(envelope)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize message envelope: %w", err)
+	}
+
+	return string(data), nil
+}
+
+func EncryptedEnvelopeFromJSON(data []byte) (*models.EncryptedEnvelope, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	envelope := &models.EncryptedEnvelope{}
+	err := json.Unmarshal(data, envelope)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize message envelope: %w", err)
+	}
+
+	return envelope, nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import "github.com/barpav/msg-messages/internal/rest/models"
+
+// Message data common for all versions of the new message schema.
+type NewMessage struct {
+	Sender         string
+	Receiver       string
+	Text           string
+	Entities       []models.TextEntity
+	Content        *models.MessageContent    // optional
+	Envelope       *models.EncryptedEnvelope // optional, instead of text and content
+	Files          []string
+	ClientId       string                 // optional
+	IdempotencyKey *models.IdempotencyKey // optional
+}
+
+func NewMessageV1(sender string, message *models.NewPersonalMessageV1, key *models.IdempotencyKey) *NewMessage {
+	return &NewMessage{
+		Sender:         sender,
+		Receiver:       message.To,
+		Text:           message.Text,
+		Files:          message.Files,
+		ClientId:       message.ClientId,
+		IdempotencyKey: key,
+	}
+}
+
+func NewMessageV2(sender string, message *models.NewPersonalMessageV2, key *models.IdempotencyKey) *NewMessage {
+	return &NewMessage{
+		Sender:         sender,
+		Receiver:       message.To,
+		Text:           message.Text,
+		Entities:       message.Entities,
+		Files:          message.Files,
+		ClientId:       message.ClientId,
+		IdempotencyKey: key,
+	}
+}
+
+func NewMessageV3(sender string, message *models.NewPersonalMessageV3, key *models.IdempotencyKey) *NewMessage {
+	return &NewMessage{
+		Sender:         sender,
+		Receiver:       message.To,
+		Text:           message.Text,
+		Entities:       message.Entities,
+		Content:        message.Content,
+		Files:          message.Files,
+		ClientId:       message.ClientId,
+		IdempotencyKey: key,
+	}
+}
+
+func NewMessageV4(sender string, message *models.NewPersonalMessageV4, key *models.IdempotencyKey) *NewMessage {
+	return &NewMessage{
+		Sender:         sender,
+		Receiver:       message.To,
+		Envelope:       message.Envelope,
+		Files:          message.Files,
+		ClientId:       message.ClientId,
+		IdempotencyKey: key,
+	}
+}
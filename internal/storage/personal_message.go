@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+// Message data common for all versions of the personal message schema.
+type PersonalMessage struct {
+	Id        int64
+	ClientId  string
+	Timestamp int64
+	From      string
+	To        string
+	Created   *time.Time
+	Edited    *time.Time
+	Read      bool
+	Starred   bool
+	Text      string
+	Entities  []models.TextEntity
+	Content   *models.MessageContent
+	Envelope  *models.EncryptedEnvelope
+	Files     []string
+	Deleted   bool
+}
+
+func (m *PersonalMessage) V1() *models.PersonalMessageV1 {
+	return &models.PersonalMessageV1{
+		Id:        m.Id,
+		ClientId:  m.ClientId,
+		Timestamp: m.Timestamp,
+		From:      m.From,
+		To:        m.To,
+		Created:   UtcTime(m.Created),
+		Edited:    UtcTime(m.Edited),
+		Read:      m.Read,
+		Starred:   m.Starred,
+		Text:      m.Text,
+		Files:     m.Files,
+		Deleted:   m.Deleted,
+	}
+}
+
+func (m *PersonalMessage) V2() *models.PersonalMessageV2 {
+	return &models.PersonalMessageV2{
+		Id:        m.Id,
+		ClientId:  m.ClientId,
+		Timestamp: m.Timestamp,
+		From:      m.From,
+		To:        m.To,
+		Created:   UtcTime(m.Created),
+		Edited:    UtcTime(m.Edited),
+		Read:      m.Read,
+		Starred:   m.Starred,
+		Text:      m.Text,
+		Entities:  m.Entities,
+		Files:     m.Files,
+		Deleted:   m.Deleted,
+	}
+}
+
+func (m *PersonalMessage) V3() *models.PersonalMessageV3 {
+	return &models.PersonalMessageV3{
+		Id:        m.Id,
+		ClientId:  m.ClientId,
+		Timestamp: m.Timestamp,
+		From:      m.From,
+		To:        m.To,
+		Created:   UtcTime(m.Created),
+		Edited:    UtcTime(m.Edited),
+		Read:      m.Read,
+		Starred:   m.Starred,
+		Text:      m.Text,
+		Entities:  m.Entities,
+		Content:   m.Content,
+		Files:     m.Files,
+		Deleted:   m.Deleted,
+	}
+}
+
+func (m *PersonalMessage) V4() *models.PersonalMessageV4 {
+	return &models.PersonalMessageV4{
+		Id:        m.Id,
+		ClientId:  m.ClientId,
+		Timestamp: m.Timestamp,
+		From:      m.From,
+		To:        m.To,
+		Created:   UtcTime(m.Created),
+		Edited:    UtcTime(m.Edited),
+		Read:      m.Read,
+		Starred:   m.Starred,
+		Text:      m.Text,
+		Entities:  m.Entities,
+		Content:   m.Content,
+		Envelope:  m.Envelope,
+		Files:     m.Files,
+		Deleted:   m.Deleted,
+	}
+}
@@ -0,0 +1,19 @@
+// Package storage contains the code shared by the SQL storages (PostgreSQL in 'data' and SQLite in 'sqlite')
+// that doesn't depend on the SQL dialect: encoding of the message data stored as JSON, assembly of the models
+// and checks of idempotency keys. Queries and transactions stay in the storages.
+package storage
+
+import (
+	"time"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+func UtcTime(t *time.Time) *models.UtcTime {
+	if t == nil {
+		return nil
+	}
+
+	utc := models.UtcTime(*t)
+	return &utc
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+func TestTextEntitiesToJSON(t *testing.T) {
+	data, err := TextEntitiesToJSON(nil)
+	require.NoError(t, err)
+	require.Nil(t, data) // NULL
+
+	entities := []models.TextEntity{{Type: "bold", Offset: 0, Length: 5}}
+	data, err = TextEntitiesToJSON(entities)
+	require.NoError(t, err)
+
+	decoded, err := TextEntitiesFromJSON([]byte(data.(string)))
+	require.NoError(t, err)
+	require.Equal(t, entities, decoded)
+
+	decoded, err = TextEntitiesFromJSON(nil)
+	require.NoError(t, err)
+	require.Nil(t, decoded)
+}
+
+func TestMessageContentToJSON(t *testing.T) {
+	data, err := MessageContentToJSON(nil)
+	require.NoError(t, err)
+	require.Nil(t, data) // NULL
+
+	content := &models.MessageContent{Poll: &models.PollContent{
+		Question: "Lunch?",
+		Options:  []*models.PollOption{{Text: "Yes"}, {Text: "No"}},
+	}}
+	data, err = MessageContentToJSON(content)
+	require.NoError(t, err)
+
+	decoded, err := MessageContentFromJSON([]byte(data.(string)))
+	require.NoError(t, err)
+	require.Equal(t, content, decoded)
+
+	_, err = MessageContentFromJSON([]byte("{"))
+	require.Error(t, err)
+}
+
+func TestCountPollVotes(t *testing.T) {
+	poll := &models.PollContent{Options: []*models.PollOption{{Text: "Yes"}, {Text: "No"}}}
+
+	CountPollVotes(poll, 1, 3, true)
+	CountPollVotes(poll, 2, 1, false) // the option was removed
+	CountPollVotes(poll, -1, 1, false)
+
+	require.Equal(t, []*models.PollOption{{Text: "Yes"}, {Text: "No", Votes: 3, Voted: true}}, poll.Options)
+}
+
+func TestSentMessageIds(t *testing.T) {
+	sent := &models.SentMessagesV1{Messages: []*models.SentMessageInfoV1{
+		{To: "jane", Id: 2, Timestamp: 20},
+		{To: "john", Id: 3, Timestamp: 21},
+	}}
+
+	ids, timestamps := SentMessageIds(sent)
+	require.Equal(t, []int64{2, 3}, ids)
+	require.Equal(t, []int64{20, 21}, timestamps)
+}
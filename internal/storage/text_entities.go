@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+// Returns nil (NULL) for plain text, so it can be stored as is in 'text_entities' column.
+func TextEntitiesToJSON(entities []models.TextEntity) (any, error) {
+	if len(entities) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(entities)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize text entities: %w", err)
+	}
+
+	return string(data), nil
+}
+
+func TextEntitiesFromJSON(data []byte) ([]models.TextEntity, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var entities []models.TextEntity
+	err := json.Unmarshal(data, &entities)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize text entities: %w", err)
+	}
+
+	return entities, nil
+}
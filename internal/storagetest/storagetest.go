@@ -0,0 +1,1402 @@
+// Package storagetest verifies implementations of the service storage (rest.Storage)
+// against the contract the handlers rely on, so every backend behaves the same way.
+//
+// The suite creates its own users (unique for every run), so it can be run against a shared database.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/events"
+	"github.com/barpav/msg-messages/internal/outbox"
+	"github.com/barpav/msg-messages/internal/rest"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/webhooks"
+	"github.com/stretchr/testify/require"
+)
+
+// Run executes the suite, newStorage is called for every test and must return ready to use storage.
+func Run(t *testing.T, newStorage func(t *testing.T) rest.Storage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s rest.Storage, u *users)
+	}{
+		{"Created message is visible to participants only", testCreatedMessage},
+		{"Updates are synced in timeline order", testSyncOrder},
+		{"Message text edited with matching timestamp only", testEditMessageText},
+		{"Read state is visible to both participants", testReadState},
+		{"Read state toggled with matching timestamp only", testReadStateToggled},
+		{"Timestamps reserved in batches are unique", testTimestampsReserved},
+		{"Deleted message cannot be modified", testDeletedMessage},
+		{"Unknown message cannot be modified", testUnknownMessage},
+		{"Attachments replaced as a set", testAttachments},
+		{"Third users see nothing", testThirdUser},
+		{"Search returns the total number of found messages", testSearch},
+		{"Personal message replayed by idempotency key", testPersonalMessageIdempotencyKey},
+		{"Broadcast replayed by idempotency key", testBroadcastIdempotencyKey},
+		{"Broadcast rejected with the blocking recipient named", testBroadcastBlocked},
+		{"Blocked sender cannot write, hidden conversation is not synced", testBlocks},
+		{"Messages of unknown senders are message requests", testMessageRequests},
+		{"Incoming messages setting is respected", testIncomingMessagesSetting},
+		{"Read receipts hidden by the receiver", testHiddenReadReceipts},
+		{"Conversations muted and archived by the user only", testConversationSettings},
+		{"Stars are personal", testStars},
+		{"Poll votes counted for both participants", testPollVotes},
+		{"Encrypted message envelope replaced as a whole", testEnvelopes},
+		{"Text entities replaced along with the text", testTextEntities},
+		{"File usage relayed once in the order of writing", testFileUsage},
+		{"Message events relayed once in the order of writing", testMessageEvents},
+		{"Webhooks claimed, disabled and enabled by their owners only", testWebhooks},
+	}
+
+	run := time.Now().UnixNano()
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &users{
+				sender:   fmt.Sprintf("jane-%x-%d", run, i),
+				receiver: fmt.Sprintf("john-%x-%d", run, i),
+				third:    fmt.Sprintf("bob-%x-%d", run, i),
+			}
+
+			tt.test(t, newStorage(t), u)
+		})
+	}
+}
+
+type users struct {
+	sender   string
+	receiver string
+	third    string
+}
+
+// Sends a message to the receiver, who has written to the sender before,
+// so the message is an ordinary one (not a message request).
+func sendMessage(t *testing.T, s rest.Storage, u *users, message *models.NewPersonalMessageV1) (id, timestamp int64) {
+	startConversation(t, s, u)
+
+	message.To = u.receiver
+	id, timestamp, err := s.CreateNewPersonalMessageV1(context.Background(), u.sender, message, nil)
+	require.NoError(t, err)
+	require.NotZero(t, id)
+	require.NotZero(t, timestamp)
+
+	return id, timestamp
+}
+
+// The receiver writes to the sender, so the sender is a contact of the receiver.
+func startConversation(t *testing.T, s rest.Storage, u *users) {
+	_, _, err := s.CreateNewPersonalMessageV1(context.Background(), u.receiver, &models.NewPersonalMessageV1{To: u.sender, Text: "Hi!"}, nil)
+	require.NoError(t, err)
+}
+
+func testCreatedMessage(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	clientId := fmt.Sprintf("00000000-0000-4000-8000-%012x", time.Now().UnixNano()&0xffffffffffff)
+	id, timestamp := sendMessage(t, s, u, &models.NewPersonalMessageV1{
+		Text:     "Hello!",
+		Files:    []string{fileId(1), fileId(2)},
+		ClientId: clientId,
+	})
+
+	sent, err := s.PersonalMessageV1(ctx, u.sender, id)
+	require.NoError(t, err)
+	require.NotNil(t, sent)
+	require.Equal(t, id, sent.Id)
+	require.Equal(t, clientId, sent.ClientId)
+	require.Equal(t, timestamp, sent.Timestamp)
+	require.Equal(t, u.sender, sent.From)
+	require.Equal(t, u.receiver, sent.To)
+	require.NotNil(t, sent.Created)
+	require.Nil(t, sent.Edited)
+	require.False(t, sent.Read)
+	require.Equal(t, "Hello!", sent.Text)
+	require.ElementsMatch(t, []string{fileId(1), fileId(2)}, sent.Files)
+	require.False(t, sent.Deleted)
+
+	var received *models.PersonalMessageV1
+	received, err = s.PersonalMessageV1(ctx, u.receiver, id)
+	require.NoError(t, err)
+	require.NotNil(t, received)
+	require.Empty(t, received.ClientId, "client id is visible to the sender only")
+	require.Equal(t, timestamp, received.Timestamp)
+	require.Equal(t, "Hello!", received.Text)
+
+	var found int64
+	found, err = s.MessageIdByClientId(ctx, u.sender, clientId)
+	require.NoError(t, err)
+	require.Equal(t, id, found)
+
+	found, err = s.MessageIdByClientId(ctx, u.receiver, clientId)
+	require.NoError(t, err)
+	require.Zero(t, found)
+
+	_, _, err = s.CreateNewPersonalMessageV1(ctx, u.sender,
+		&models.NewPersonalMessageV1{To: u.receiver, Text: "Hello again!", ClientId: clientId}, nil)
+	require.Implements(t, (*rest.ErrClientIdConflict)(nil), err)
+	require.Equal(t, id, err.(rest.ErrClientIdConflict).MessageId())
+}
+
+func testSyncOrder(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	ids := make([]int64, 0, 3)
+
+	for i := 0; i < 3; i++ {
+		id, _ := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: fmt.Sprintf("Message #%d", i)})
+		ids = append(ids, id)
+	}
+
+	all, err := s.MessageUpdatesV1(ctx, u.receiver, 0, 100)
+	require.NoError(t, err)
+	require.Equal(t, len(all.Messages), all.Total)
+	require.Len(t, all.Messages, 6, "own and received messages")
+
+	for i := 1; i < len(all.Messages); i++ {
+		require.Greater(t, all.Messages[i].Timestamp, all.Messages[i-1].Timestamp)
+	}
+
+	synced := make([]int64, 0, len(ids))
+
+	for _, info := range all.Messages {
+		synced = append(synced, info.Id)
+	}
+
+	require.Subset(t, synced, ids)
+
+	var page *models.MessageUpdatesV1
+	page, err = s.MessageUpdatesV1(ctx, u.receiver, 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, page.Total)
+	require.Equal(t, all.Messages[:2], page.Messages)
+
+	page, err = s.MessageUpdatesV1(ctx, u.receiver, page.Messages[1].Timestamp, 100)
+	require.NoError(t, err)
+	require.Equal(t, all.Messages[2:], page.Messages)
+
+	page, err = s.MessageUpdatesV1(ctx, u.receiver, all.Messages[len(all.Messages)-1].Timestamp, 100)
+	require.NoError(t, err)
+	require.Zero(t, page.Total)
+
+	var updates *models.MessageUpdatesV2
+	updates, err = s.MessageUpdatesV2(ctx, u.receiver, 0, 100)
+	require.NoError(t, err)
+	require.Equal(t, len(updates.Updates), updates.Total)
+
+	for i := 1; i < len(updates.Updates); i++ {
+		require.Greater(t, updates.Updates[i].Timestamp, updates.Updates[i-1].Timestamp)
+	}
+}
+
+func testEditMessageText(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	id, timestamp := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello!"})
+
+	newTimestamp, err := s.EditMessageText(ctx, id, timestamp, "Hello, John!")
+	require.NoError(t, err)
+	require.Greater(t, newTimestamp, timestamp)
+
+	_, err = s.EditMessageText(ctx, id, timestamp, "Hi, John!")
+	require.Implements(t, (*rest.ErrTimestampIsNotMatch)(nil), err)
+
+	_, err = s.EditMessageText(ctx, id, newTimestamp, "Hello, John!")
+	require.Implements(t, (*rest.ErrMessageNotModified)(nil), err)
+
+	var message *models.PersonalMessageV1
+	message, err = s.PersonalMessageV1(ctx, u.receiver, id)
+	require.NoError(t, err)
+	require.Equal(t, newTimestamp, message.Timestamp)
+	require.Equal(t, "Hello, John!", message.Text)
+	require.NotNil(t, message.Edited)
+
+	requireMessageUpdate(t, s, u.sender, id, newTimestamp)
+	requireMessageUpdate(t, s, u.receiver, id, newTimestamp)
+}
+
+func testReadState(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	id, timestamp := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello!"})
+
+	newTimestamp, err := s.SetMessageReadState(ctx, id, timestamp, true)
+	require.NoError(t, err)
+	require.Greater(t, newTimestamp, timestamp)
+
+	_, err = s.SetMessageReadState(ctx, id, newTimestamp, true)
+	require.Implements(t, (*rest.ErrMessageNotModified)(nil), err)
+
+	_, err = s.SetMessageReadState(ctx, id, timestamp, false)
+	require.Implements(t, (*rest.ErrTimestampIsNotMatch)(nil), err)
+
+	for _, userId := range []string{u.sender, u.receiver} {
+		var message *models.PersonalMessageV1
+		message, err = s.PersonalMessageV1(ctx, userId, id)
+		require.NoError(t, err)
+		require.True(t, message.Read)
+		require.Equal(t, newTimestamp, message.Timestamp)
+	}
+
+	requireMessageUpdate(t, s, u.sender, id, newTimestamp)
+}
+
+func testReadStateToggled(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	id, created := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello!"})
+
+	read, err := s.SetMessageReadState(ctx, id, created, true)
+	require.NoError(t, err)
+
+	var unread int64
+	unread, err = s.SetMessageReadState(ctx, id, read, false)
+	require.NoError(t, err)
+	require.Greater(t, unread, read)
+	requireReadState(t, s, u, id, unread, false, false)
+
+	_, err = s.SetMessageReadState(ctx, id, read, true)
+	require.Implements(t, (*rest.ErrTimestampIsNotMatch)(nil), err, "stale timestamp")
+
+	_, err = s.SetMessageReadState(ctx, id, unread, false)
+	require.Implements(t, (*rest.ErrMessageNotModified)(nil), err)
+
+	err = s.SetUserSettings(ctx, u.receiver, &models.UserSettingsV1{IncomingMessages: models.IncomingMessagesEveryone, HideReadReceipts: true})
+	require.NoError(t, err)
+
+	_, err = s.SetMessageReadState(ctx, id, read, true)
+	require.Implements(t, (*rest.ErrTimestampIsNotMatch)(nil), err, "stale timestamp of privately read message")
+
+	var privatelyRead int64
+	privatelyRead, err = s.SetMessageReadState(ctx, id, unread, true)
+	require.NoError(t, err)
+	require.Equal(t, unread, privatelyRead)
+	requireReadState(t, s, u, id, unread, true, false)
+
+	privatelyRead, err = s.SetMessageReadState(ctx, id, unread, false)
+	require.NoError(t, err, "privately unread")
+	require.Equal(t, unread, privatelyRead)
+	requireReadState(t, s, u, id, unread, false, false)
+
+	err = s.SetUserSettings(ctx, u.receiver, &models.UserSettingsV1{IncomingMessages: models.IncomingMessagesEveryone})
+	require.NoError(t, err)
+
+	read, err = s.SetMessageReadState(ctx, id, unread, true)
+	require.NoError(t, err)
+	require.Greater(t, read, unread)
+	requireReadState(t, s, u, id, read, true, true)
+
+	var deleted int64
+	deleted, err = s.DeleteMessageData(ctx, id, read)
+	require.NoError(t, err)
+
+	err = s.SetUserSettings(ctx, u.receiver, &models.UserSettingsV1{IncomingMessages: models.IncomingMessagesEveryone, HideReadReceipts: true})
+	require.NoError(t, err)
+
+	_, err = s.SetMessageReadState(ctx, id, deleted, false)
+	require.Implements(t, (*rest.ErrMessageDeleted)(nil), err)
+
+	_, err = s.SetMessageReadState(ctx, id+1_000_000_000, deleted, true)
+	require.Implements(t, (*rest.ErrMessageNotFound)(nil), err)
+}
+
+// Checks the message timestamp and the read state as seen by the receiver and by the sender.
+func requireReadState(t *testing.T, s rest.Storage, u *users, id, timestamp int64, read, receipt bool) {
+	received, err := s.PersonalMessageV1(context.Background(), u.receiver, id)
+	require.NoError(t, err)
+	require.Equal(t, timestamp, received.Timestamp)
+	require.Equal(t, read, received.Read, "read by the receiver")
+
+	var sent *models.PersonalMessageV1
+	sent, err = s.PersonalMessageV1(context.Background(), u.sender, id)
+	require.NoError(t, err)
+	require.Equal(t, timestamp, sent.Timestamp)
+	require.Equal(t, receipt, sent.Read, "read receipt seen by the sender")
+}
+
+// Broadcasts and accepted message requests reserve several timestamps at once.
+func testTimestampsReserved(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	timestamps := make(map[int64]bool)
+
+	requireNewTimestamp := func(timestamp int64) {
+		require.False(t, timestamps[timestamp], "timestamp %d is used twice", timestamp)
+		timestamps[timestamp] = true
+	}
+
+	requests := make([]int64, 0, 4)
+
+	for i := 0; i < 2; i++ {
+		for _, sender := range []string{u.receiver, u.third} {
+			id, timestamp, err := s.CreateNewPersonalMessageV1(ctx, sender, &models.NewPersonalMessageV1{To: u.sender, Text: fmt.Sprintf("Request #%d", i)}, nil)
+			require.NoError(t, err)
+			requireNewTimestamp(timestamp)
+			requests = append(requests, id)
+		}
+	}
+
+	before := lastUpdate(t, s, u.sender).Timestamp
+
+	sent, err := s.CreateNewBroadcastMessageV1(ctx, u.sender, &models.NewBroadcastMessageV1{To: []string{u.receiver, u.third}, Text: "Hello!"}, nil)
+	require.NoError(t, err)
+
+	for _, info := range sent.Messages {
+		requireNewTimestamp(info.Timestamp)
+	}
+
+	var updates *models.MessageUpdatesV2
+	updates, err = s.MessageUpdatesV2(ctx, u.sender, before, 100)
+	require.NoError(t, err)
+
+	accepted := make([]int64, 0, len(requests))
+
+	for _, update := range updates.Updates {
+		if update.Type == models.UpdateTypeMessage && !timestamps[update.Timestamp] {
+			requireNewTimestamp(update.Timestamp)
+			accepted = append(accepted, update.Id)
+		}
+	}
+
+	require.ElementsMatch(t, requests, accepted, "request messages written to the timeline once accepted")
+
+	_, timestamp, err := s.CreateNewPersonalMessageV1(ctx, u.sender, &models.NewPersonalMessageV1{To: u.receiver, Text: "Hello again!"}, nil)
+	require.NoError(t, err)
+
+	for used := range timestamps {
+		require.Greater(t, timestamp, used, "timestamps are not reused")
+	}
+
+	all, err := s.MessageUpdatesV2(ctx, u.sender, 0, 100)
+	require.NoError(t, err)
+
+	for i := 1; i < len(all.Updates); i++ {
+		require.Greater(t, all.Updates[i].Timestamp, all.Updates[i-1].Timestamp)
+	}
+}
+
+func testDeletedMessage(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	id, timestamp := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello!", Files: []string{fileId(1)}})
+
+	_, err := s.DeleteMessageData(ctx, id, timestamp-1)
+	require.Implements(t, (*rest.ErrTimestampIsNotMatch)(nil), err)
+
+	var newTimestamp int64
+	newTimestamp, err = s.DeleteMessageData(ctx, id, timestamp)
+	require.NoError(t, err)
+	require.Greater(t, newTimestamp, timestamp)
+
+	_, err = s.DeleteMessageData(ctx, id, newTimestamp)
+	require.Implements(t, (*rest.ErrMessageDeleted)(nil), err)
+
+	_, err = s.EditMessageText(ctx, id, newTimestamp, "Hi!")
+	require.Implements(t, (*rest.ErrMessageDeleted)(nil), err)
+
+	_, err = s.SetMessageReadState(ctx, id, newTimestamp, true)
+	require.Implements(t, (*rest.ErrMessageDeleted)(nil), err)
+
+	_, err = s.EditMessageFiles(ctx, id, newTimestamp, nil)
+	require.Implements(t, (*rest.ErrMessageDeleted)(nil), err)
+
+	var message *models.PersonalMessageV1
+	message, err = s.PersonalMessageV1(ctx, u.receiver, id)
+	require.NoError(t, err)
+	require.Equal(t, &models.PersonalMessageV1{Id: id, Timestamp: newTimestamp, Files: []string{}, Deleted: true}, message)
+
+	var files *models.SharedFilesV1
+	files, err = s.SharedFilesV1(ctx, u.receiver, u.sender, 0, 10)
+	require.NoError(t, err)
+	require.Zero(t, files.Total)
+
+	requireMessageUpdate(t, s, u.receiver, id, newTimestamp)
+}
+
+func testUnknownMessage(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	id, timestamp := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello!"})
+	unknown := id + 1_000_000_000
+
+	_, err := s.EditMessageText(ctx, unknown, timestamp, "Hi!")
+	require.Implements(t, (*rest.ErrMessageNotFound)(nil), err)
+
+	_, err = s.SetMessageReadState(ctx, unknown, timestamp, true)
+	require.Implements(t, (*rest.ErrMessageNotFound)(nil), err)
+
+	_, err = s.EditMessageFiles(ctx, unknown, timestamp, []string{fileId(1)})
+	require.Implements(t, (*rest.ErrMessageNotFound)(nil), err)
+
+	_, err = s.DeleteMessageData(ctx, unknown, timestamp)
+	require.Implements(t, (*rest.ErrMessageNotFound)(nil), err)
+
+	var message *models.PersonalMessageV1
+	message, err = s.PersonalMessageV1(ctx, u.sender, unknown)
+	require.NoError(t, err)
+	require.Nil(t, message)
+}
+
+func testAttachments(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	id, timestamp := sendMessage(t, s, u, &models.NewPersonalMessageV1{Files: []string{fileId(1), fileId(2)}})
+
+	_, err := s.EditMessageFiles(ctx, id, timestamp, []string{fileId(2), fileId(1)})
+	require.Implements(t, (*rest.ErrMessageNotModified)(nil), err)
+
+	var newTimestamp int64
+	newTimestamp, err = s.EditMessageFiles(ctx, id, timestamp, []string{fileId(2), fileId(3)})
+	require.NoError(t, err)
+	require.Greater(t, newTimestamp, timestamp)
+
+	var message *models.PersonalMessageV1
+	message, err = s.PersonalMessageV1(ctx, u.receiver, id)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{fileId(2), fileId(3)}, message.Files)
+	require.NotNil(t, message.Edited)
+
+	var files *models.SharedFilesV1
+	files, err = s.SharedFilesV1(ctx, u.receiver, u.sender, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, files.Total)
+	require.Zero(t, files.Next)
+
+	shared := make([]string, 0, files.Total)
+
+	for _, file := range files.Files {
+		require.Equal(t, id, file.MessageId)
+		require.Equal(t, u.sender, file.From)
+		shared = append(shared, file.FileId)
+	}
+
+	require.ElementsMatch(t, []string{fileId(2), fileId(3)}, shared)
+
+	files, err = s.SharedFilesV1(ctx, u.sender, u.receiver, 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, 2, files.Total, "all files of the conversation")
+	require.Len(t, files.Files, 1)
+	require.NotZero(t, files.Next)
+
+	var next *models.SharedFilesV1
+	next, err = s.SharedFilesV1(ctx, u.sender, u.receiver, files.Next, 1)
+	require.NoError(t, err)
+	require.Equal(t, 2, next.Total)
+	require.Len(t, next.Files, 1)
+	require.NotEqual(t, files.Files[0].FileId, next.Files[0].FileId)
+
+	next, err = s.SharedFilesV1(ctx, u.sender, u.receiver, files.Next, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, next.Total)
+	require.Len(t, next.Files, 1)
+	require.Zero(t, next.Next, "the last page")
+}
+
+func testThirdUser(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	word := fmt.Sprintf("conformance%d", time.Now().UnixNano())
+	id, timestamp := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello " + word, Files: []string{fileId(1)}})
+
+	message, err := s.PersonalMessageV1(ctx, u.third, id)
+	require.NoError(t, err)
+	require.Nil(t, message)
+
+	var updates *models.MessageUpdatesV2
+	updates, err = s.MessageUpdatesV2(ctx, u.third, 0, 100)
+	require.NoError(t, err)
+	require.Zero(t, updates.Total)
+
+	var files *models.SharedFilesV1
+	files, err = s.SharedFilesV1(ctx, u.third, u.sender, 0, 10)
+	require.NoError(t, err)
+	require.Zero(t, files.Total)
+
+	search := &models.MessageSearchParameters{Query: word, Limit: 10}
+
+	var results *models.MessageSearchResultsV1
+	results, err = s.SearchMessagesV1(ctx, u.third, search)
+	require.NoError(t, err)
+	require.Zero(t, results.Total)
+
+	results, err = s.SearchMessagesV1(ctx, u.receiver, search)
+	require.NoError(t, err)
+	require.Equal(t, 1, results.Total)
+	require.Equal(t, id, results.Messages[0].Id)
+	require.Equal(t, timestamp, results.Messages[0].Timestamp)
+}
+
+func testSearch(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	word := fmt.Sprintf("conformance%d", time.Now().UnixNano())
+
+	for i := 0; i < 3; i++ {
+		sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: fmt.Sprintf("%s #%d", word, i)})
+	}
+
+	results, err := s.SearchMessagesV1(ctx, u.sender, &models.MessageSearchParameters{Query: word, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, 3, results.Total)
+	require.Len(t, results.Messages, 2)
+
+	results, err = s.SearchMessagesV1(ctx, u.sender, &models.MessageSearchParameters{Query: word, Offset: 4, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, 3, results.Total)
+	require.Empty(t, results.Messages)
+
+	results, err = s.SearchMessagesV1(ctx, u.sender, &models.MessageSearchParameters{Query: word, With: u.receiver, Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, 3, results.Total)
+	require.Len(t, results.Messages, 3)
+
+	results, err = s.SearchMessagesV1(ctx, u.sender, &models.MessageSearchParameters{Query: word, With: u.third, Limit: 10})
+	require.NoError(t, err)
+	require.Zero(t, results.Total)
+}
+
+func testBroadcastIdempotencyKey(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	key := &models.IdempotencyKey{Key: "broadcast", Fingerprint: "fingerprint"}
+	message := &models.NewBroadcastMessageV1{To: []string{u.receiver, u.third}, Text: "Hello!"}
+
+	replayed, err := s.BroadcastByIdempotencyKey(ctx, u.sender, key)
+	require.NoError(t, err)
+	require.Nil(t, replayed)
+
+	var sent *models.SentMessagesV1
+	sent, err = s.CreateNewBroadcastMessageV1(ctx, u.sender, message, key)
+	require.NoError(t, err)
+	require.Equal(t, 2, sent.Total)
+	require.Equal(t, u.receiver, sent.Messages[0].To)
+	require.Equal(t, u.third, sent.Messages[1].To)
+
+	replayed, err = s.BroadcastByIdempotencyKey(ctx, u.sender, key)
+	require.NoError(t, err)
+	require.Equal(t, sent, replayed)
+
+	replayed, err = s.BroadcastByIdempotencyKey(ctx, u.receiver, key)
+	require.NoError(t, err)
+	require.Nil(t, replayed, "keys are per sender")
+
+	_, err = s.BroadcastByIdempotencyKey(ctx, u.sender, &models.IdempotencyKey{Key: key.Key, Fingerprint: "another"})
+	require.Implements(t, (*rest.ErrIdempotencyKeyMismatch)(nil), err)
+
+	_, err = s.CreateNewBroadcastMessageV1(ctx, u.sender, message, key)
+	require.Implements(t, (*rest.ErrIdempotencyKeyUsed)(nil), err)
+
+	var updates *models.MessageUpdatesV1
+	updates, err = s.MessageUpdatesV1(ctx, u.sender, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, updates.Total, "retried broadcast is not sent again")
+}
+
+func testBroadcastBlocked(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	err := s.BlockUser(ctx, u.third, u.sender, false)
+	require.NoError(t, err)
+
+	_, err = s.CreateNewBroadcastMessageV1(ctx, u.sender, &models.NewBroadcastMessageV1{To: []string{u.receiver, u.third}, Text: "Hello!"}, nil)
+	require.Implements(t, (*rest.ErrSenderBlocked)(nil), err)
+	require.Equal(t, u.third, err.(rest.ErrSenderBlocked).Recipient())
+
+	var updates *models.MessageUpdatesV1
+	updates, err = s.MessageUpdatesV1(ctx, u.receiver, 0, 10)
+	require.NoError(t, err)
+	require.Zero(t, updates.Total, "nothing is sent to the other recipients")
+}
+
+func testPersonalMessageIdempotencyKey(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	key := &models.IdempotencyKey{Key: "message", Fingerprint: "fingerprint"}
+	message := &models.NewPersonalMessageV1{To: u.receiver, Text: "Hello!"}
+	startConversation(t, s, u)
+
+	id, timestamp, err := s.MessageByIdempotencyKey(ctx, u.sender, key)
+	require.NoError(t, err)
+	require.Zero(t, id)
+	require.Zero(t, timestamp)
+
+	var sentId, sentTimestamp int64
+	sentId, sentTimestamp, err = s.CreateNewPersonalMessageV1(ctx, u.sender, message, key)
+	require.NoError(t, err)
+
+	id, timestamp, err = s.MessageByIdempotencyKey(ctx, u.sender, key)
+	require.NoError(t, err)
+	require.Equal(t, sentId, id)
+	require.Equal(t, sentTimestamp, timestamp)
+
+	id, _, err = s.MessageByIdempotencyKey(ctx, u.receiver, key)
+	require.NoError(t, err)
+	require.Zero(t, id, "keys are per sender")
+
+	_, _, err = s.MessageByIdempotencyKey(ctx, u.sender, &models.IdempotencyKey{Key: key.Key, Fingerprint: "another"})
+	require.Implements(t, (*rest.ErrIdempotencyKeyMismatch)(nil), err)
+
+	_, _, err = s.CreateNewPersonalMessageV1(ctx, u.sender, message, key)
+	require.Implements(t, (*rest.ErrIdempotencyKeyUsed)(nil), err)
+
+	var updates *models.MessageUpdatesV1
+	updates, err = s.MessageUpdatesV1(ctx, u.receiver, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, updates.Total, "retried message is not sent again")
+}
+
+func testBlocks(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	id, _ := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello!"})
+
+	err := s.BlockUser(ctx, u.receiver, u.sender, false)
+	require.NoError(t, err)
+
+	var blocked *models.BlockedUserV1
+	blocked, err = s.BlockedUserV1(ctx, u.receiver, u.sender)
+	require.NoError(t, err)
+	require.Equal(t, u.sender, blocked.User)
+	require.False(t, blocked.HideConversation)
+	require.NotNil(t, blocked.Created)
+	requireLastUpdate(t, s, u.receiver, &models.UpdateInfoV2{Type: models.UpdateTypeBlock, Timestamp: blocked.Timestamp, User: u.sender})
+
+	blocked, err = s.BlockedUserV1(ctx, u.sender, u.receiver)
+	require.NoError(t, err)
+	require.Nil(t, blocked, "blocks are personal")
+
+	var all *models.BlockedUsersV1
+	all, err = s.BlockedUsersV1(ctx, u.receiver)
+	require.NoError(t, err)
+	require.Equal(t, 1, all.Total)
+	require.Equal(t, u.sender, all.Users[0].User)
+
+	_, _, err = s.CreateNewPersonalMessageV1(ctx, u.sender, &models.NewPersonalMessageV1{To: u.receiver, Text: "Hello?"}, nil)
+	require.Implements(t, (*rest.ErrSenderBlocked)(nil), err)
+	require.Equal(t, u.receiver, err.(rest.ErrSenderBlocked).Recipient())
+
+	_, _, err = s.CreateNewPersonalMessageV1(ctx, u.receiver, &models.NewPersonalMessageV1{To: u.sender, Text: "Bye!"}, nil)
+	require.NoError(t, err, "blocked user can still be written to")
+
+	var before int64
+	before = lastUpdate(t, s, u.receiver).Timestamp
+	require.NoError(t, s.BlockUser(ctx, u.receiver, u.sender, false))
+	require.Equal(t, before, lastUpdate(t, s, u.receiver).Timestamp, "already blocked")
+
+	require.NoError(t, s.BlockUser(ctx, u.receiver, u.sender, true))
+
+	var updates *models.MessageUpdatesV1
+	updates, err = s.MessageUpdatesV1(ctx, u.receiver, 0, 100)
+	require.NoError(t, err)
+	require.Zero(t, updates.Total, "hidden conversation is not synced")
+
+	var conversation *models.ConversationV1
+	conversation, err = s.ConversationV1(ctx, u.receiver, u.sender)
+	require.NoError(t, err)
+	require.Nil(t, conversation)
+
+	var conversations *models.ConversationsV1
+	conversations, err = s.ConversationsV1(ctx, u.receiver)
+	require.NoError(t, err)
+	require.Zero(t, conversations.Total)
+
+	conversation, err = s.ConversationV1(ctx, u.sender, u.receiver)
+	require.NoError(t, err)
+	require.NotNil(t, conversation, "hidden by the blocking user only")
+
+	before = lastUpdate(t, s, u.receiver).Timestamp
+	require.NoError(t, s.UnblockUser(ctx, u.receiver, u.sender))
+
+	blocked, err = s.BlockedUserV1(ctx, u.receiver, u.sender)
+	require.NoError(t, err)
+	require.Nil(t, blocked)
+
+	updates, err = s.MessageUpdatesV1(ctx, u.receiver, before, 100)
+	require.NoError(t, err)
+	require.Equal(t, 3, updates.Total, "conversation synced again")
+	require.Equal(t, id, updates.Messages[1].Id)
+
+	_, _, err = s.CreateNewPersonalMessageV1(ctx, u.sender, &models.NewPersonalMessageV1{To: u.receiver, Text: "Hello again!"}, nil)
+	require.NoError(t, err)
+}
+
+func testMessageRequests(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	id, _, err := s.CreateNewPersonalMessageV1(ctx, u.sender, &models.NewPersonalMessageV1{To: u.receiver, Text: "Hello!"}, nil)
+	require.NoError(t, err)
+
+	var updates *models.MessageUpdatesV1
+	updates, err = s.MessageUpdatesV1(ctx, u.receiver, 0, 100)
+	require.NoError(t, err)
+	require.Zero(t, updates.Total, "message requests are not synced as messages")
+
+	update := lastUpdate(t, s, u.receiver)
+	require.Equal(t, &models.UpdateInfoV2{Type: models.UpdateTypeRequest, Timestamp: update.Timestamp, Id: id, User: u.sender}, update)
+
+	var requests *models.MessageRequestsV1
+	requests, err = s.MessageRequestsV1(ctx, u.receiver)
+	require.NoError(t, err)
+	require.Equal(t, 1, requests.Total)
+	require.Equal(t, u.sender, requests.Requests[0].User)
+	require.Equal(t, 1, requests.Requests[0].Messages)
+
+	requireConversationState(t, s, u.receiver, u.sender, "requested")
+	requireConversationState(t, s, u.sender, u.receiver, "accepted")
+
+	err = s.AnswerMessageRequest(ctx, u.receiver, u.third, true)
+	require.Implements(t, (*rest.ErrMessageRequestNotFound)(nil), err)
+
+	require.NoError(t, s.AnswerMessageRequest(ctx, u.receiver, u.sender, false))
+	requireConversationState(t, s, u.receiver, u.sender, "declined")
+	requireLastUpdate(t, s, u.receiver, &models.UpdateInfoV2{Type: models.UpdateTypeRequest, Timestamp: lastUpdate(t, s, u.receiver).Timestamp, User: u.sender})
+
+	requests, err = s.MessageRequestsV1(ctx, u.receiver)
+	require.NoError(t, err)
+	require.Zero(t, requests.Total)
+
+	_, _, err = s.CreateNewPersonalMessageV1(ctx, u.sender, &models.NewPersonalMessageV1{To: u.receiver, Text: "Hello?"}, nil)
+	require.Implements(t, (*rest.ErrRecipientNotAccepting)(nil), err)
+	require.Equal(t, u.receiver, err.(rest.ErrRecipientNotAccepting).Recipient())
+
+	startConversation(t, s, u) // replying means accepting, even declined request
+	requireConversationState(t, s, u.receiver, u.sender, "accepted")
+
+	updates, err = s.MessageUpdatesV1(ctx, u.receiver, 0, 100)
+	require.NoError(t, err)
+	require.Equal(t, 2, updates.Total)
+	require.Contains(t, []int64{updates.Messages[0].Id, updates.Messages[1].Id}, id)
+
+	id, _, err = s.CreateNewPersonalMessageV1(ctx, u.third, &models.NewPersonalMessageV1{To: u.receiver, Text: "Hello!"}, nil)
+	require.NoError(t, err)
+	require.NoError(t, s.AnswerMessageRequest(ctx, u.receiver, u.third, true))
+	requireConversationState(t, s, u.receiver, u.third, "accepted")
+	requireMessageUpdate(t, s, u.receiver, id, lastMessageUpdate(t, s, u.receiver).Timestamp)
+
+	err = s.AnswerMessageRequest(ctx, u.receiver, u.third, false)
+	require.Implements(t, (*rest.ErrMessageRequestNotFound)(nil), err, "already accepted")
+}
+
+func testIncomingMessagesSetting(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	settings, err := s.UserSettingsV1(ctx, u.receiver)
+	require.NoError(t, err)
+	require.Equal(t, &models.UserSettingsV1{IncomingMessages: models.IncomingMessagesEveryone}, settings, "default settings")
+
+	err = s.SetUserSettings(ctx, u.receiver, &models.UserSettingsV1{IncomingMessages: models.IncomingMessagesContacts})
+	require.NoError(t, err)
+
+	settings, err = s.UserSettingsV1(ctx, u.receiver)
+	require.NoError(t, err)
+	require.Equal(t, models.IncomingMessagesContacts, settings.IncomingMessages)
+
+	_, _, err = s.CreateNewPersonalMessageV1(ctx, u.sender, &models.NewPersonalMessageV1{To: u.receiver, Text: "Hello!"}, nil)
+	require.Implements(t, (*rest.ErrRecipientNotAccepting)(nil), err, "unknown sender")
+
+	id, timestamp := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello!"})
+	requireMessageUpdate(t, s, u.receiver, id, timestamp)
+
+	err = s.SetUserSettings(ctx, u.receiver, &models.UserSettingsV1{IncomingMessages: models.IncomingMessagesNobody})
+	require.NoError(t, err)
+
+	_, _, err = s.CreateNewPersonalMessageV1(ctx, u.sender, &models.NewPersonalMessageV1{To: u.receiver, Text: "Hello?"}, nil)
+	require.Implements(t, (*rest.ErrRecipientNotAccepting)(nil), err, "even contacts")
+
+	_, err = s.CreateNewBroadcastMessageV1(ctx, u.sender, &models.NewBroadcastMessageV1{To: []string{u.third, u.receiver}, Text: "Hello!"}, nil)
+	require.Implements(t, (*rest.ErrRecipientNotAccepting)(nil), err)
+	require.Equal(t, u.receiver, err.(rest.ErrRecipientNotAccepting).Recipient())
+
+	settings, err = s.UserSettingsV1(ctx, u.sender)
+	require.NoError(t, err)
+	require.Equal(t, models.IncomingMessagesEveryone, settings.IncomingMessages, "settings are personal")
+}
+
+func testHiddenReadReceipts(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	id, timestamp := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello!"})
+
+	err := s.SetUserSettings(ctx, u.receiver, &models.UserSettingsV1{IncomingMessages: models.IncomingMessagesEveryone, HideReadReceipts: true})
+	require.NoError(t, err)
+
+	var newTimestamp int64
+	newTimestamp, err = s.SetMessageReadState(ctx, id, timestamp, true)
+	require.NoError(t, err)
+	require.Equal(t, timestamp, newTimestamp, "message is not modified")
+
+	_, err = s.SetMessageReadState(ctx, id, timestamp, true)
+	require.Implements(t, (*rest.ErrMessageNotModified)(nil), err)
+
+	_, err = s.SetMessageReadState(ctx, id, timestamp-1, false)
+	require.Implements(t, (*rest.ErrTimestampIsNotMatch)(nil), err)
+
+	received, err := s.PersonalMessageV1(ctx, u.receiver, id)
+	require.NoError(t, err)
+	require.True(t, received.Read)
+	require.Equal(t, timestamp, received.Timestamp)
+
+	update := lastMessageUpdate(t, s, u.receiver)
+	require.Equal(t, id, update.Id)
+	require.Greater(t, update.Timestamp, timestamp, "personal change of the receiver")
+
+	var updates *models.MessageUpdatesV1
+	updates, err = s.MessageUpdatesV1(ctx, u.sender, timestamp, 100)
+	require.NoError(t, err)
+	require.Zero(t, updates.Total, "sender is not notified")
+
+	err = s.SetUserSettings(ctx, u.receiver, &models.UserSettingsV1{IncomingMessages: models.IncomingMessagesEveryone})
+	require.NoError(t, err)
+
+	sent, err := s.PersonalMessageV1(ctx, u.sender, id)
+	require.NoError(t, err)
+	require.False(t, sent.Read, "stays hidden after the setting is turned off")
+	require.Equal(t, timestamp, sent.Timestamp)
+}
+
+func testConversationSettings(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	muted, unmuted, archived := true, false, true
+	mutedUntil := time.Now().UTC().Add(time.Hour)
+	id, _ := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello!"})
+
+	err := s.SetConversationSettings(ctx, u.third, u.sender, &models.ConversationSettingsV1{Muted: &muted})
+	require.Implements(t, (*rest.ErrConversationNotFound)(nil), err)
+
+	err = s.SetConversationSettings(ctx, u.receiver, u.sender, &models.ConversationSettingsV1{Muted: &muted, MutedUntil: &mutedUntil})
+	require.NoError(t, err)
+
+	conversation, err := s.ConversationV1(ctx, u.receiver, u.sender)
+	require.NoError(t, err)
+	require.Equal(t, "accepted", conversation.State)
+	require.True(t, conversation.Muted)
+	require.NotNil(t, conversation.MutedUntil)
+	require.WithinDuration(t, mutedUntil, time.Time(*conversation.MutedUntil), time.Millisecond)
+	require.False(t, conversation.Archived)
+	require.Equal(t, id, conversation.LastMessage)
+	requireLastUpdate(t, s, u.receiver, &models.UpdateInfoV2{Type: models.UpdateTypeConversation, Timestamp: conversation.Timestamp, User: u.sender})
+
+	err = s.SetConversationSettings(ctx, u.receiver, u.sender, &models.ConversationSettingsV1{Muted: &muted, MutedUntil: &mutedUntil})
+	require.NoError(t, err)
+	require.Equal(t, conversation.Timestamp, lastUpdate(t, s, u.receiver).Timestamp, "not modified")
+
+	counterpart, err := s.ConversationV1(ctx, u.sender, u.receiver)
+	require.NoError(t, err)
+	require.False(t, counterpart.Muted, "settings are personal")
+
+	err = s.SetConversationSettings(ctx, u.receiver, u.sender, &models.ConversationSettingsV1{Archived: &archived})
+	require.NoError(t, err)
+
+	conversations, err := s.ConversationsV1(ctx, u.receiver)
+	require.NoError(t, err)
+	require.Equal(t, 1, conversations.Total)
+	require.True(t, conversations.Conversations[0].Archived)
+	require.True(t, conversations.Conversations[0].Muted, "unspecified settings are left unchanged")
+
+	id, _, err = s.CreateNewPersonalMessageV1(ctx, u.sender, &models.NewPersonalMessageV1{To: u.receiver, Text: "Hello?"}, nil)
+	require.NoError(t, err)
+
+	conversation, err = s.ConversationV1(ctx, u.receiver, u.sender)
+	require.NoError(t, err)
+	require.False(t, conversation.Archived, "new incoming message brings archived conversation back")
+	require.True(t, conversation.Muted)
+	require.Equal(t, id, conversation.LastMessage)
+
+	err = s.SetConversationSettings(ctx, u.receiver, u.sender, &models.ConversationSettingsV1{Muted: &unmuted})
+	require.NoError(t, err)
+
+	conversation, err = s.ConversationV1(ctx, u.receiver, u.sender)
+	require.NoError(t, err)
+	require.False(t, conversation.Muted)
+	require.Nil(t, conversation.MutedUntil)
+}
+
+func testStars(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	first, firstTimestamp := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello!"})
+	second, secondTimestamp := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello again!"})
+
+	starredFirst, err := s.SetMessageStar(ctx, u.sender, first, true)
+	require.NoError(t, err)
+	require.Greater(t, starredFirst, secondTimestamp)
+	requireMessageUpdate(t, s, u.sender, first, starredFirst)
+
+	_, err = s.SetMessageStar(ctx, u.sender, first, true)
+	require.Implements(t, (*rest.ErrMessageNotModified)(nil), err)
+
+	var message *models.PersonalMessageV1
+	message, err = s.PersonalMessageV1(ctx, u.sender, first)
+	require.NoError(t, err)
+	require.True(t, message.Starred)
+	require.Equal(t, firstTimestamp, message.Timestamp, "message is not modified")
+
+	message, err = s.PersonalMessageV1(ctx, u.receiver, first)
+	require.NoError(t, err)
+	require.False(t, message.Starred, "stars are personal")
+
+	var updates *models.MessageUpdatesV1
+	updates, err = s.MessageUpdatesV1(ctx, u.receiver, secondTimestamp, 100)
+	require.NoError(t, err)
+	require.Zero(t, updates.Total)
+
+	_, err = s.SetMessageStar(ctx, u.sender, second, true)
+	require.NoError(t, err)
+
+	var starred *models.StarredMessagesV1
+	starred, err = s.StarredMessagesV1(ctx, u.sender, 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, []*models.StarredMessageInfoV1{{Id: second, Timestamp: secondTimestamp}}, starred.Messages, "the latest starred first")
+	require.NotZero(t, starred.Next)
+
+	starred, err = s.StarredMessagesV1(ctx, u.sender, starred.Next, 10)
+	require.NoError(t, err)
+	require.Equal(t, []*models.StarredMessageInfoV1{{Id: first, Timestamp: firstTimestamp}}, starred.Messages)
+	require.Zero(t, starred.Next)
+
+	_, err = s.SetMessageStar(ctx, u.sender, first, false)
+	require.NoError(t, err)
+
+	var deleted int64
+	deleted, err = s.DeleteMessageData(ctx, second, secondTimestamp)
+	require.NoError(t, err)
+
+	starred, err = s.StarredMessagesV1(ctx, u.sender, 0, 10)
+	require.NoError(t, err)
+	require.Zero(t, starred.Total, "stars of deleted messages are removed")
+
+	_, err = s.SetMessageStar(ctx, u.sender, second, false)
+	require.Implements(t, (*rest.ErrMessageNotModified)(nil), err)
+
+	message, err = s.PersonalMessageV1(ctx, u.sender, second)
+	require.NoError(t, err)
+	require.Equal(t, deleted, message.Timestamp)
+	require.False(t, message.Starred)
+}
+
+func testPollVotes(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	startConversation(t, s, u)
+	id, timestamp, err := s.CreateNewPersonalMessageV3(ctx, u.sender, &models.NewPersonalMessageV3{
+		To: u.receiver,
+		Content: &models.MessageContent{Type: models.MessageContentPoll, Poll: &models.PollContent{
+			Question: "Lunch?",
+			Options:  []*models.PollOption{{Text: "Yes"}, {Text: "No"}, {Text: "Later"}},
+		}},
+	}, nil)
+	require.NoError(t, err)
+
+	var voted int64
+	voted, err = s.VotePoll(ctx, u.receiver, id, timestamp, []int{0})
+	require.NoError(t, err)
+	require.Greater(t, voted, timestamp)
+
+	_, err = s.VotePoll(ctx, u.sender, id, timestamp, []int{2})
+	require.Implements(t, (*rest.ErrTimestampIsNotMatch)(nil), err)
+
+	_, err = s.VotePoll(ctx, u.receiver, id, voted, []int{0})
+	require.Implements(t, (*rest.ErrMessageNotModified)(nil), err)
+
+	voted, err = s.VotePoll(ctx, u.sender, id, voted, []int{0})
+	require.NoError(t, err)
+	requireMessageUpdate(t, s, u.receiver, id, voted)
+
+	requirePollVotes(t, s, u.sender, id, voted, []int{2, 0, 0}, 0)
+	requirePollVotes(t, s, u.receiver, id, voted, []int{2, 0, 0}, 0)
+
+	voted, err = s.VotePoll(ctx, u.receiver, id, voted, []int{1})
+	require.NoError(t, err)
+	requirePollVotes(t, s, u.receiver, id, voted, []int{1, 1, 0}, 1)
+
+	voted, err = s.VotePoll(ctx, u.sender, id, voted, nil)
+	require.NoError(t, err, "vote retracted")
+	requirePollVotes(t, s, u.sender, id, voted, []int{0, 1, 0}, -1)
+
+	var deleted int64
+	deleted, err = s.DeleteMessageData(ctx, id, voted)
+	require.NoError(t, err)
+
+	_, err = s.VotePoll(ctx, u.receiver, id, deleted, []int{2})
+	require.Implements(t, (*rest.ErrMessageDeleted)(nil), err)
+}
+
+// Checks tallies of the poll options and the option voted by the user (-1 if none).
+func requirePollVotes(t *testing.T, s rest.Storage, userId string, id, timestamp int64, votes []int, voted int) {
+	message, err := s.PersonalMessageV3(context.Background(), userId, id)
+	require.NoError(t, err)
+	require.Equal(t, timestamp, message.Timestamp)
+	require.NotNil(t, message.Content)
+	require.NotNil(t, message.Content.Poll)
+	require.Len(t, message.Content.Poll.Options, len(votes))
+
+	for i, option := range message.Content.Poll.Options {
+		require.Equal(t, votes[i], option.Votes, "votes of option #%d", i)
+		require.Equal(t, i == voted, option.Voted, "option #%d voted by %s", i, userId)
+	}
+}
+
+func testEnvelopes(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	envelope := &models.EncryptedEnvelope{
+		Algorithm:      "x25519-aes256gcm",
+		RecipientKeyId: "key-1",
+		SenderDeviceId: "device-1",
+		Nonce:          "AAAAAAAAAAAAAAAA",
+		Ciphertext:     "SGVsbG8h",
+	}
+	startConversation(t, s, u)
+
+	id, timestamp, err := s.CreateNewPersonalMessageV4(ctx, u.sender, &models.NewPersonalMessageV4{To: u.receiver, Envelope: envelope}, nil)
+	require.NoError(t, err)
+
+	var message *models.PersonalMessageV4
+	message, err = s.PersonalMessageV4(ctx, u.receiver, id)
+	require.NoError(t, err)
+	require.Equal(t, envelope, message.Envelope)
+	require.Empty(t, message.Text)
+
+	_, err = s.EditMessageText(ctx, id, timestamp, "Hello!")
+	require.Implements(t, (*rest.ErrMessageEncrypted)(nil), err)
+
+	_, err = s.EditMessageEnvelope(ctx, id, timestamp, envelope)
+	require.Implements(t, (*rest.ErrMessageNotModified)(nil), err)
+
+	edited := *envelope
+	edited.Ciphertext = "SGVsbG8sIEpvaG4h"
+
+	var newTimestamp int64
+	newTimestamp, err = s.EditMessageEnvelope(ctx, id, timestamp, &edited)
+	require.NoError(t, err)
+	require.Greater(t, newTimestamp, timestamp)
+	requireMessageUpdate(t, s, u.receiver, id, newTimestamp)
+
+	message, err = s.PersonalMessageV4(ctx, u.sender, id)
+	require.NoError(t, err)
+	require.Equal(t, &edited, message.Envelope)
+	require.NotNil(t, message.Edited)
+
+	_, err = s.EditMessageEnvelope(ctx, id, timestamp, envelope)
+	require.Implements(t, (*rest.ErrTimestampIsNotMatch)(nil), err)
+
+	plain, plainTimestamp := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello!"})
+	_, err = s.EditMessageEnvelope(ctx, plain, plainTimestamp, envelope)
+	require.Implements(t, (*rest.ErrMessageNotEncrypted)(nil), err)
+}
+
+func testTextEntities(t *testing.T, s rest.Storage, u *users) {
+	ctx := context.Background()
+	bold := []models.TextEntity{{Type: models.TextEntityBold, Offset: 0, Length: 5}}
+	mention := []models.TextEntity{{Type: models.TextEntityMention, Offset: 7, Length: 4, User: u.receiver}}
+	startConversation(t, s, u)
+
+	id, timestamp, err := s.CreateNewPersonalMessageV2(ctx, u.sender,
+		&models.NewPersonalMessageV2{To: u.receiver, Text: "Hello, John!", Entities: bold}, nil)
+	require.NoError(t, err)
+	requireTextEntities(t, s, u.receiver, id, "Hello, John!", bold)
+
+	_, err = s.EditMessageTextV2(ctx, id, timestamp, "Hello, John!", bold)
+	require.Implements(t, (*rest.ErrMessageNotModified)(nil), err)
+
+	var edited int64
+	edited, err = s.EditMessageTextV2(ctx, id, timestamp, "Hello, John!", mention)
+	require.NoError(t, err, "entities are modified")
+	require.Greater(t, edited, timestamp)
+	requireTextEntities(t, s, u.receiver, id, "Hello, John!", mention)
+
+	edited, err = s.EditMessageText(ctx, id, edited, "Hello, John!")
+	require.NoError(t, err, "plain text replaces formatted one")
+	requireTextEntities(t, s, u.sender, id, "Hello, John!", nil)
+
+	_, err = s.EditMessageTextV2(ctx, id, edited, "Hello, John!", nil)
+	require.Implements(t, (*rest.ErrMessageNotModified)(nil), err)
+
+	var message *models.PersonalMessageV1
+	message, err = s.PersonalMessageV1(ctx, u.receiver, id)
+	require.NoError(t, err)
+	require.Equal(t, edited, message.Timestamp)
+	require.Equal(t, "Hello, John!", message.Text)
+}
+
+func requireTextEntities(t *testing.T, s rest.Storage, userId string, id int64, text string, entities []models.TextEntity) {
+	message, err := s.PersonalMessageV2(context.Background(), userId, id)
+	require.NoError(t, err)
+	require.Equal(t, text, message.Text)
+
+	if len(entities) == 0 {
+		require.Empty(t, message.Entities)
+	} else {
+		require.Equal(t, entities, message.Entities)
+	}
+}
+
+func requireConversationState(t *testing.T, s rest.Storage, userId, counterpart, state string) {
+	conversation, err := s.ConversationV1(context.Background(), userId, counterpart)
+	require.NoError(t, err)
+	require.NotNil(t, conversation)
+	require.Equal(t, state, conversation.State)
+}
+
+// The latest entry of the user's timeline.
+func lastUpdate(t *testing.T, s rest.Storage, userId string) *models.UpdateInfoV2 {
+	updates, err := s.MessageUpdatesV2(context.Background(), userId, 0, 1000)
+	require.NoError(t, err)
+	require.NotZero(t, updates.Total)
+
+	return updates.Updates[updates.Total-1]
+}
+
+func lastMessageUpdate(t *testing.T, s rest.Storage, userId string) *models.MessageUpdateInfoV1 {
+	updates, err := s.MessageUpdatesV1(context.Background(), userId, 0, 1000)
+	require.NoError(t, err)
+	require.NotZero(t, updates.Total)
+
+	return updates.Messages[updates.Total-1]
+}
+
+func requireLastUpdate(t *testing.T, s rest.Storage, userId string, expected *models.UpdateInfoV2) {
+	require.Equal(t, expected, lastUpdate(t, s, userId))
+}
+
+// Checks that the user's timeline contains the message with the timestamp.
+func requireMessageUpdate(t *testing.T, s rest.Storage, userId string, id, timestamp int64) {
+	updates, err := s.MessageUpdatesV1(context.Background(), userId, timestamp-1, 100)
+	require.NoError(t, err)
+
+	found := sort.Search(len(updates.Messages), func(i int) bool {
+		return updates.Messages[i].Timestamp >= timestamp
+	})
+
+	require.Less(t, found, len(updates.Messages), "update not found")
+	require.Equal(t, models.MessageUpdateInfoV1{Id: id, Timestamp: timestamp}, *updates.Messages[found])
+}
+
+// File ids are 24 character long.
+type fileUsage struct {
+	fileId string
+	inUse  bool
+}
+
+// The microservice relays file usage events written by the storage, so every storage has to be an outbox.
+func testFileUsage(t *testing.T, s rest.Storage, u *users) {
+	require.Implements(t, (*outbox.Storage)(nil), s)
+	o := s.(outbox.Storage)
+
+	ctx := context.Background()
+	prefix := fmt.Sprintf("%012x", time.Now().UnixNano()&0xffffffffffff) // events of other runs are ignored
+	a, b, c := prefix+"00000000000a", prefix+"00000000000b", prefix+"00000000000c"
+
+	relayFileUsage(t, o, prefix) // pending events of other tests
+	id, timestamp := sendMessage(t, s, u, &models.NewPersonalMessageV1{Files: []string{a, b}})
+	require.Equal(t, []fileUsage{{a, true}, {b, true}}, relayFileUsage(t, o, prefix))
+
+	newTimestamp, err := s.EditMessageFiles(ctx, id, timestamp, []string{b, c})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []fileUsage{{c, true}, {a, false}}, relayFileUsage(t, o, prefix))
+
+	_, err = s.DeleteMessageData(ctx, id, newTimestamp)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []fileUsage{{b, false}, {c, false}}, relayFileUsage(t, o, prefix))
+	require.Empty(t, relayFileUsage(t, o, prefix))
+
+	sendMessage(t, s, u, &models.NewPersonalMessageV1{Files: []string{a}})
+	_, err = o.RelayFileUsage(ctx, 100, func(fileId string, inUse bool) error {
+		if strings.HasPrefix(fileId, prefix) {
+			return errors.New("files usage statistics unavailable")
+		}
+		return nil
+	})
+	require.Error(t, err)
+	require.Equal(t, []fileUsage{{a, true}}, relayFileUsage(t, o, prefix))
+
+	require.NoError(t, o.DeleteDeliveredFileUsage(ctx, time.Now().UTC().Add(time.Hour)))
+	require.Empty(t, relayFileUsage(t, o, prefix))
+}
+
+// Relays all pending events, returns the ones with file ids starting with the prefix.
+func relayFileUsage(t *testing.T, o outbox.Storage, prefix string) []fileUsage {
+	const limit = 100
+	var relayed []fileUsage
+
+	for {
+		n, err := o.RelayFileUsage(context.Background(), limit, func(fileId string, inUse bool) error {
+			if strings.HasPrefix(fileId, prefix) {
+				relayed = append(relayed, fileUsage{fileId, inUse})
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		if n < limit {
+			return relayed
+		}
+	}
+}
+
+func testMessageEvents(t *testing.T, s rest.Storage, u *users) {
+	require.Implements(t, (*outbox.Storage)(nil), s)
+	o := s.(outbox.Storage)
+
+	ctx := context.Background()
+	relayMessageEvents(t, o, u) // pending events of other tests
+	id, created := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello!"})
+
+	edited, err := s.EditMessageText(ctx, id, created, "Hello, John!")
+	require.NoError(t, err)
+
+	var read int64
+	read, err = s.SetMessageReadState(ctx, id, edited, true)
+	require.NoError(t, err)
+
+	var deleted int64
+	deleted, err = s.DeleteMessageData(ctx, id, read)
+	require.NoError(t, err)
+
+	published := relayMessageEvents(t, o, u)
+	require.Len(t, published, 5)
+	require.Equal(t, events.MessageCreated, published[0].Type) // the receiver has written first
+	require.Equal(t, u.receiver, published[0].Sender)
+
+	require.Equal(t, []*events.Event{
+		{Type: events.MessageCreated, MessageId: id, Timestamp: created, Sender: u.sender, Receiver: u.receiver},
+		{Type: events.MessageEdited, MessageId: id, Timestamp: edited, Sender: u.sender, Receiver: u.receiver},
+		{Type: events.MessageReadStateChanged, MessageId: id, Timestamp: read, Sender: u.sender, Receiver: u.receiver},
+		{Type: events.MessageDeleted, MessageId: id, Timestamp: deleted, Sender: u.sender, Receiver: u.receiver},
+	}, published[1:])
+	require.Empty(t, relayMessageEvents(t, o, u))
+
+	require.NoError(t, o.DeleteDeliveredMessageEvents(ctx, time.Now().UTC().Add(time.Hour)))
+}
+
+// Relays all pending events, returns the ones of the messages between the users.
+func relayMessageEvents(t *testing.T, o outbox.Storage, u *users) []*events.Event {
+	const limit = 100
+	var relayed []*events.Event
+
+	for {
+		n, err := o.RelayMessageEvents(context.Background(), limit, func(event *events.Event) error {
+			if event.Sender == u.sender || event.Sender == u.receiver {
+				published := *event
+				relayed = append(relayed, &published)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		if n < limit {
+			return relayed
+		}
+	}
+}
+
+func testWebhooks(t *testing.T, s rest.Storage, u *users) {
+	require.Implements(t, (*webhooks.Storage)(nil), s)
+	w := s.(webhooks.Storage)
+
+	ctx := context.Background()
+	_, before := sendMessage(t, s, u, &models.NewPersonalMessageV1{Text: "Hello!"})
+
+	created, err := s.CreateWebhook(ctx, u.sender, &models.NewWebhookV1{Url: "https://example.com/hook"}, "test secret")
+	require.NoError(t, err)
+	require.Equal(t, before, created.After) // only new updates are delivered
+	require.Equal(t, "test secret", created.Secret)
+	require.True(t, created.Enabled)
+
+	var list *models.WebhooksV1
+	list, err = s.WebhooksV1(ctx, u.sender)
+	require.NoError(t, err)
+	require.Equal(t, 1, list.Total)
+	require.Equal(t, created.Id, list.Webhooks[0].Id)
+	require.Empty(t, list.Webhooks[0].Secret)
+
+	var webhook *models.WebhookV1
+	webhook, err = s.WebhookV1(ctx, u.third, created.Id)
+	require.NoError(t, err)
+	require.Nil(t, webhook)
+
+	_, after, err := s.CreateNewPersonalMessageV1(ctx, u.sender, &models.NewPersonalMessageV1{To: u.receiver, Text: "Are you there?"}, nil)
+	require.NoError(t, err)
+
+	claimed := claimWebhook(t, w, created.Id)
+	require.NotNil(t, claimed)
+	require.Equal(t, &webhooks.Subscription{Id: created.Id, UserId: u.sender, Url: "https://example.com/hook", Secret: "test secret", After: before}, claimed)
+	require.Nil(t, claimWebhook(t, w, created.Id)) // until the lease expires
+
+	attempted := models.UtcTime(time.Now().UTC())
+	err = w.SaveWebhookOutcome(ctx, &webhooks.Outcome{
+		WebhookId:   created.Id,
+		After:       before,
+		Failures:    1,
+		NextAttempt: time.Now().UTC(),
+		Disable:     true,
+		Delivery:    &models.WebhookDeliveryV1{Attempted: &attempted, After: before, Last: after, Updates: 1, Status: 503, Error: "test error"},
+	})
+	require.NoError(t, err)
+
+	webhook, err = s.WebhookV1(ctx, u.sender, created.Id)
+	require.NoError(t, err)
+	require.False(t, webhook.Enabled)
+	require.True(t, webhook.AutoDisabled)
+	require.Equal(t, 1, webhook.Failures)
+	require.Nil(t, claimWebhook(t, w, created.Id))
+
+	found, err := s.SetWebhookEnabled(ctx, u.third, created.Id, true)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	found, err = s.SetWebhookEnabled(ctx, u.sender, created.Id, true)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	webhook, err = s.WebhookV1(ctx, u.sender, created.Id)
+	require.NoError(t, err)
+	require.True(t, webhook.Enabled)
+	require.False(t, webhook.AutoDisabled)
+	require.Zero(t, webhook.Failures)
+	require.NotNil(t, claimWebhook(t, w, created.Id))
+
+	err = w.SaveWebhookOutcome(ctx, &webhooks.Outcome{
+		WebhookId:   created.Id,
+		After:       after,
+		NextAttempt: time.Now().UTC(),
+		Delivery:    &models.WebhookDeliveryV1{Attempted: &attempted, After: before, Last: after, Updates: 1, Delivered: true, Status: 200},
+	})
+	require.NoError(t, err)
+
+	var deliveries *models.WebhookDeliveriesV1
+	deliveries, err = s.WebhookDeliveriesV1(ctx, u.sender, created.Id)
+	require.NoError(t, err)
+	require.Equal(t, 2, deliveries.Total)
+	require.True(t, deliveries.Deliveries[0].Delivered) // the latest first
+	require.Equal(t, "test error", deliveries.Deliveries[1].Error)
+	require.Equal(t, 503, deliveries.Deliveries[1].Status)
+
+	deliveries, err = s.WebhookDeliveriesV1(ctx, u.third, created.Id)
+	require.NoError(t, err)
+	require.Nil(t, deliveries)
+
+	found, err = s.DeleteWebhook(ctx, u.third, created.Id)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	found, err = s.DeleteWebhook(ctx, u.sender, created.Id)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	webhook, err = s.WebhookV1(ctx, u.sender, created.Id)
+	require.NoError(t, err)
+	require.Nil(t, webhook)
+
+	// Outcome of the delivery in progress while the webhook is deleted.
+	require.NoError(t, w.SaveWebhookOutcome(ctx, &webhooks.Outcome{WebhookId: created.Id, After: after, NextAttempt: time.Now().UTC()}))
+}
+
+// Claims due webhooks until the one is found, others are claimed as well (see Run).
+func claimWebhook(t *testing.T, w webhooks.Storage, id int64) *webhooks.Subscription {
+	const limit = 100
+
+	for {
+		claimed, err := w.ClaimDueWebhooks(context.Background(), limit, time.Minute)
+		require.NoError(t, err)
+
+		for _, s := range claimed {
+			if s.Id == id {
+				return s
+			}
+		}
+
+		if len(claimed) < limit {
+			return nil
+		}
+	}
+}
+
+func fileId(n int) string {
+	return fmt.Sprintf("%024d", n)
+}
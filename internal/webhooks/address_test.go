@@ -0,0 +1,46 @@
+package webhooks
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressAllowed(t *testing.T) {
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"100.64.0.1", false}, // carrier-grade NAT
+		{"100.127.255.254", false},
+		{"100.128.0.1", true},
+		{"169.254.169.254", false},
+		{"172.31.0.1", false},
+		{"192.0.0.170", false},
+		{"192.168.1.1", false},
+		{"198.18.0.1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"::", false},
+		{"::ffff:10.0.0.1", false}, // IPv4-mapped
+		{"::ffff:8.8.8.8", true},
+		{"64:ff9b::a00:1", false},
+		{"2002:a00:1::1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"ff02::1", false},
+		{"2001:db8::1", false},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.allowed, addressAllowed(netip.MustParseAddr(test.addr)), test.addr)
+	}
+}
@@ -0,0 +1,98 @@
+package webhooks
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultPollInterval = "1s"
+	defaultTimeout      = "10s"
+	defaultBatchSize    = 100
+	defaultWorkers      = 4
+	defaultMaxFailures  = 20
+	defaultAllowPrivate = false
+)
+
+const (
+	envVarPollInterval = "MSG_WEBHOOKS_POLL_INTERVAL" // how often timelines of the webhooks are checked
+	envVarTimeout      = "MSG_WEBHOOKS_TIMEOUT"       // of one delivery
+	envVarBatchSize    = "MSG_WEBHOOKS_BATCH"         // updates delivered in one request
+	envVarWorkers      = "MSG_WEBHOOKS_WORKERS"       // concurrent deliveries
+	envVarMaxFailures  = "MSG_WEBHOOKS_MAX_FAILURES"  // consecutive failures before the webhook is disabled
+	envVarAllowPrivate = "MSG_WEBHOOKS_ALLOW_PRIVATE" // allows endpoints in private networks (e.g. for development)
+)
+
+type config struct {
+	pollInterval time.Duration
+	timeout      time.Duration
+	batchSize    int
+	workers      int
+	maxFailures  int
+	allowPrivate bool
+}
+
+func (c *config) Read() {
+	readDurationSetting(envVarPollInterval, defaultPollInterval, &c.pollInterval)
+	readDurationSetting(envVarTimeout, defaultTimeout, &c.timeout)
+	readIntSetting(envVarBatchSize, defaultBatchSize, &c.batchSize)
+	readIntSetting(envVarWorkers, defaultWorkers, &c.workers)
+	readIntSetting(envVarMaxFailures, defaultMaxFailures, &c.maxFailures)
+	readBoolSetting(envVarAllowPrivate, defaultAllowPrivate, &c.allowPrivate)
+}
+
+func readDurationSetting(setting, defaultValue string, result *time.Duration) {
+	value := os.Getenv(setting)
+
+	if value == "" {
+		value = defaultValue
+	}
+
+	var err error
+	*result, err = time.ParseDuration(value)
+
+	if err != nil || *result <= 0 {
+		log.Warn().Msg(fmt.Sprintf("Invalid %s value '%s', default '%s' is used.", setting, value, defaultValue))
+		*result, _ = time.ParseDuration(defaultValue)
+	}
+}
+
+func readIntSetting(setting string, defaultValue int, result *int) {
+	*result = defaultValue
+	value := os.Getenv(setting)
+
+	if value == "" {
+		return
+	}
+
+	parsed, err := strconv.Atoi(value)
+
+	if err != nil || parsed <= 0 {
+		log.Warn().Msg(fmt.Sprintf("Invalid %s value '%s', default '%d' is used.", setting, value, defaultValue))
+		return
+	}
+
+	*result = parsed
+}
+
+func readBoolSetting(setting string, defaultValue bool, result *bool) {
+	*result = defaultValue
+	value := os.Getenv(setting)
+
+	if value == "" {
+		return
+	}
+
+	parsed, err := strconv.ParseBool(value)
+
+	if err != nil {
+		log.Warn().Msg(fmt.Sprintf("Invalid %s value '%s', default '%t' is used.", setting, value, defaultValue))
+		return
+	}
+
+	*result = parsed
+}
@@ -0,0 +1,309 @@
+// Package webhooks delivers updates of users' timelines (the same entries as 'GET /messages' returns
+// in messageUpdates.v2 representation) to the endpoints they subscribed, signed with the webhook secret.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/barpav/msg-messages/internal/rest/models"
+)
+
+const (
+	mimeTypeMessageUpdatesV2 = "application/vnd.messageUpdates.v2+json"
+	userAgent                = "msg-messages-webhooks"
+)
+
+const (
+	initialRetryDelay = 5 * time.Second
+	maxRetryDelay     = time.Hour
+	maxErrorLength    = 500
+)
+
+// Number of the latest deliveries kept in the log of every webhook.
+const DeliveryLogSize = 100
+
+// Enabled webhook due for delivery.
+type Subscription struct {
+	Id       int64
+	UserId   string
+	Url      string
+	Secret   string
+	After    int64 // timestamp of the last delivered update
+	Failures int   // consecutive
+}
+
+// Result of processing the subscription, saved by the storage.
+type Outcome struct {
+	WebhookId   int64
+	After       int64
+	Failures    int
+	NextAttempt time.Time
+	Disable     bool                      // the webhook fails persistently
+	Delivery    *models.WebhookDeliveryV1 // nil if there was nothing to deliver
+}
+
+type Storage interface {
+	MessageUpdatesV2(ctx context.Context, userId string, after int64, limit int) (*models.MessageUpdatesV2, error)
+	// Returns up to limit enabled webhooks due for delivery and postpones their next attempt by the lease,
+	// so they are not delivered concurrently (e.g. by other replicas) until the outcome is saved.
+	ClaimDueWebhooks(ctx context.Context, limit int, lease time.Duration) ([]*Subscription, error)
+	// Saves the delivery (if any) to the log and schedules the next attempt. Webhook deleted meanwhile is ignored,
+	// webhook disabled by the user meanwhile stays disabled.
+	SaveWebhookOutcome(ctx context.Context, outcome *Outcome) error
+}
+
+type Dispatcher struct {
+	cfg     *config
+	storage Storage
+	client  *http.Client
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func (d *Dispatcher) Start(storage Storage) {
+	d.cfg = &config{}
+	d.cfg.Read()
+
+	d.storage = storage
+	d.client = newClient(d.cfg)
+
+	d.stop = make(chan struct{})
+	d.stopped = make(chan struct{})
+
+	go d.run()
+}
+
+// Deliveries in progress are completed before the dispatcher stops, unless the context is done earlier.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	if d.stop == nil {
+		return nil // not started
+	}
+
+	close(d.stop)
+
+	select {
+	case <-d.stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to complete webhook deliveries: %w", ctx.Err())
+	}
+}
+
+// Every worker processes one claimed webhook, the next ones are claimed when all of them are processed.
+func (d *Dispatcher) run() {
+	defer close(d.stopped)
+
+	lease := d.cfg.timeout + 30*time.Second // enough to get updates, deliver them and save the outcome
+	var delay time.Duration
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-time.After(delay):
+		}
+
+		ctx := context.Background()
+		claimed, err := d.storage.ClaimDueWebhooks(ctx, d.cfg.workers, lease)
+
+		if err != nil {
+			log.Err(err).Msg("Failed to get webhooks due for delivery.")
+			delay = d.cfg.pollInterval
+			continue
+		}
+
+		var wg sync.WaitGroup
+
+		for _, s := range claimed {
+			wg.Add(1)
+
+			go func(s *Subscription) {
+				defer wg.Done()
+				d.process(ctx, s)
+			}(s)
+		}
+
+		wg.Wait()
+
+		delay = d.cfg.pollInterval
+
+		if len(claimed) == d.cfg.workers {
+			delay = 0 // there may be more
+		}
+	}
+}
+
+func (d *Dispatcher) process(ctx context.Context, s *Subscription) {
+	outcome := d.deliver(ctx, s)
+	err := d.storage.SaveWebhookOutcome(ctx, outcome)
+
+	if err != nil {
+		log.Err(err).Msg(fmt.Sprintf("Failed to save webhook '%d' delivery, updates may be delivered again.", s.Id))
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, s *Subscription) *Outcome {
+	started := time.Now().UTC()
+	outcome := &Outcome{WebhookId: s.Id, After: s.After, Failures: s.Failures, NextAttempt: started.Add(d.cfg.pollInterval)}
+
+	updates, err := d.storage.MessageUpdatesV2(ctx, s.UserId, s.After, d.cfg.batchSize)
+
+	if err != nil {
+		log.Err(err).Msg(fmt.Sprintf("Failed to get updates of webhook '%d'.", s.Id))
+		return outcome // not the endpoint's fault
+	}
+
+	if updates.Total == 0 {
+		return outcome
+	}
+
+	last := updates.Updates[updates.Total-1].Timestamp
+	var status int
+	status, err = d.post(ctx, s, updates)
+
+	attempted := models.UtcTime(started)
+	outcome.Delivery = &models.WebhookDeliveryV1{
+		Attempted: &attempted,
+		After:     s.After,
+		Last:      last,
+		Updates:   updates.Total,
+		Delivered: err == nil,
+		Status:    status,
+		Duration:  time.Since(started).Milliseconds(),
+	}
+
+	if err == nil {
+		outcome.After, outcome.Failures = last, 0
+
+		if updates.Total == d.cfg.batchSize {
+			outcome.NextAttempt = time.Now().UTC() // there may be more
+		}
+
+		return outcome
+	}
+
+	outcome.Delivery.Error = truncate(err.Error(), maxErrorLength)
+	outcome.Failures++
+	outcome.NextAttempt = time.Now().UTC().Add(retryDelay(outcome.Failures))
+	outcome.Disable = outcome.Failures >= d.cfg.maxFailures
+
+	if outcome.Disable {
+		log.Warn().Msg(fmt.Sprintf("Webhook '%d' of user '%s' disabled after %d failed deliveries: %s", s.Id, s.UserId, outcome.Failures, err))
+	}
+
+	return outcome
+}
+
+// Only 2xx statuses mean the updates are delivered, redirects are not followed.
+func (d *Dispatcher) post(ctx context.Context, s *Subscription, updates *models.MessageUpdatesV2) (status int, err error) {
+	var body []byte
+	body, err = json.Marshal(updates)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to serialize updates: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.timeout)
+	defer cancel()
+
+	var request *http.Request
+	request, err = http.NewRequestWithContext(ctx, http.MethodPost, s.Url, bytes.NewReader(body))
+
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+	request.Header.Set("Content-Type", mimeTypeMessageUpdatesV2)
+	request.Header.Set("User-Agent", userAgent)
+	request.Header.Set(headerWebhookId, strconv.FormatInt(s.Id, 10))
+	request.Header.Set(headerTimestamp, strconv.FormatInt(now, 10))
+	request.Header.Set(headerSignature, Sign(s.Secret, now, body))
+
+	var response *http.Response
+	response, err = d.client.Do(request)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10)) // lets the connection be reused
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("endpoint responded with status %d", response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
+
+// Endpoints are specified by users, so by default they cannot make the service send requests
+// to its own network (addresses are checked after resolving, so DNS names are covered too).
+func newClient(cfg *config) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.timeout}
+
+	if !cfg.allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+
+			if err != nil {
+				return err
+			}
+
+			if !addressAllowed(addrPort.Addr()) {
+				return errors.New("webhook endpoint address is not allowed")
+			}
+
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: cfg.timeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Exponential backoff.
+func retryDelay(failures int) time.Duration {
+	delay := initialRetryDelay
+
+	for i := 1; i < failures && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	return delay
+}
+
+func truncate(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+
+	return s[:length]
+}
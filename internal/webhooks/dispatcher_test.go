@@ -0,0 +1,146 @@
+package webhooks_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/barpav/msg-messages/internal/memory"
+	"github.com/barpav/msg-messages/internal/rest/models"
+	"github.com/barpav/msg-messages/internal/webhooks"
+	"github.com/stretchr/testify/require"
+)
+
+func startDispatcher(t *testing.T, storage *memory.Storage) {
+	t.Setenv("MSG_WEBHOOKS_POLL_INTERVAL", "10ms")
+
+	dispatcher := &webhooks.Dispatcher{}
+	dispatcher.Start(storage)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, dispatcher.Stop(ctx))
+	})
+}
+
+func newStorage(t *testing.T) *memory.Storage {
+	storage := &memory.Storage{}
+	require.NoError(t, storage.Open())
+	return storage
+}
+
+func TestDispatcher_signedDelivery(t *testing.T) {
+	t.Setenv("MSG_WEBHOOKS_ALLOW_PRIVATE", "true") // test server listens on loopback
+
+	storage := newStorage(t)
+	received := make(chan []byte, 1)
+	var secret string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		timestamp, err := strconv.ParseInt(r.Header.Get("X-Msg-Webhook-Timestamp"), 10, 0)
+		require.NoError(t, err)
+		require.Equal(t, webhooks.Sign(secret, timestamp, body), r.Header.Get("X-Msg-Webhook-Signature"))
+		require.Equal(t, "application/vnd.messageUpdates.v2+json", r.Header.Get("Content-Type"))
+
+		received <- body
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	webhook, err := storage.CreateWebhook(ctx, "jane", &models.NewWebhookV1{Url: server.URL}, "test secret")
+	require.NoError(t, err)
+	secret = webhook.Secret
+
+	_, timestamp, err := storage.CreateNewPersonalMessageV1(ctx, "jane", &models.NewPersonalMessageV1{To: "john", Text: "Hello!"}, nil)
+	require.NoError(t, err)
+
+	startDispatcher(t, storage)
+
+	select {
+	case body := <-received:
+		require.JSONEq(t, `{"total": 1, "updates": [{"type": "message", "timestamp": `+strconv.FormatInt(timestamp, 10)+`, "id": 1}]}`, string(body))
+	case <-time.After(5 * time.Second):
+		t.Fatal("updates are not delivered")
+	}
+
+	require.Eventually(t, func() bool {
+		webhook, err = storage.WebhookV1(ctx, "jane", webhook.Id)
+		return err == nil && webhook.After == timestamp
+	}, 5*time.Second, 10*time.Millisecond)
+
+	deliveries, err := storage.WebhookDeliveriesV1(ctx, "jane", webhook.Id)
+	require.NoError(t, err)
+	require.Equal(t, 1, deliveries.Total)
+	require.True(t, deliveries.Deliveries[0].Delivered)
+	require.Equal(t, http.StatusOK, deliveries.Deliveries[0].Status)
+}
+
+func TestDispatcher_failingEndpointDisabled(t *testing.T) {
+	t.Setenv("MSG_WEBHOOKS_ALLOW_PRIVATE", "true")
+	t.Setenv("MSG_WEBHOOKS_MAX_FAILURES", "1")
+
+	storage := newStorage(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	webhook := createWebhookWithUpdate(t, storage, server.URL)
+	startDispatcher(t, storage)
+	waitDisabled(t, storage, webhook.Id)
+
+	deliveries, err := storage.WebhookDeliveriesV1(context.Background(), "jane", webhook.Id)
+	require.NoError(t, err)
+	require.Equal(t, 1, deliveries.Total)
+	require.False(t, deliveries.Deliveries[0].Delivered)
+	require.Equal(t, http.StatusServiceUnavailable, deliveries.Deliveries[0].Status)
+}
+
+func TestDispatcher_privateAddressRejected(t *testing.T) {
+	t.Setenv("MSG_WEBHOOKS_MAX_FAILURES", "1")
+
+	storage := newStorage(t)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	webhook := createWebhookWithUpdate(t, storage, server.URL)
+	startDispatcher(t, storage)
+	waitDisabled(t, storage, webhook.Id)
+
+	deliveries, err := storage.WebhookDeliveriesV1(context.Background(), "jane", webhook.Id)
+	require.NoError(t, err)
+	require.Equal(t, 1, deliveries.Total)
+	require.Zero(t, deliveries.Deliveries[0].Status)
+	require.Contains(t, deliveries.Deliveries[0].Error, "not allowed")
+	require.Zero(t, requests.Load())
+}
+
+func createWebhookWithUpdate(t *testing.T, storage *memory.Storage, url string) *models.WebhookV1 {
+	ctx := context.Background()
+	webhook, err := storage.CreateWebhook(ctx, "jane", &models.NewWebhookV1{Url: url}, "test secret")
+	require.NoError(t, err)
+
+	_, _, err = storage.CreateNewPersonalMessageV1(ctx, "jane", &models.NewPersonalMessageV1{To: "john", Text: "Hello!"}, nil)
+	require.NoError(t, err)
+
+	return webhook
+}
+
+func waitDisabled(t *testing.T, storage *memory.Storage, id int64) {
+	require.Eventually(t, func() bool {
+		webhook, err := storage.WebhookV1(context.Background(), "jane", id)
+		return err == nil && !webhook.Enabled && webhook.AutoDisabled
+	}, 5*time.Second, 10*time.Millisecond)
+}
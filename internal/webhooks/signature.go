@@ -0,0 +1,40 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+const (
+	headerWebhookId = "X-Msg-Webhook-Id"
+	headerTimestamp = "X-Msg-Webhook-Timestamp"
+	headerSignature = "X-Msg-Webhook-Signature"
+)
+
+const secretLength = 32 // bytes
+
+func NewSecret() (string, error) {
+	secret := make([]byte, secretLength)
+	_, err := rand.Read(secret)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// HMAC-SHA256 of the request time (Unix seconds) and the body separated by a dot, so the receiver
+// can verify the request is sent by the service and reject replays of old requests.
+func Sign(secret string, unixTime int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(unixTime, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}